@@ -0,0 +1,42 @@
+-- +migrate Up
+create table accounts (
+    id serial not null primary key,
+    version int not null,
+    created_at timestamp without time zone not null,
+    changed_at timestamp without time zone not null,
+
+    name text not null,
+    website text not null,
+
+    billing_street text not null,
+    billing_postal_code text not null,
+    billing_state text not null,
+    billing_city text not null,
+    billing_country text not null,
+
+    physical_street text not null,
+    physical_postal_code text not null,
+    physical_state text not null,
+    physical_city text not null,
+    physical_country text not null
+);
+
+create table account_phone_numbers (
+    id serial not null primary key,
+
+    number text not null,
+    type text not null,
+    account_id int default null,
+
+    foreign key (account_id) references accounts(id) on update cascade on delete cascade
+);
+
+alter table people add column account_id int default null
+    references accounts(id) on update cascade on delete set null;
+
+create index people_account_id_idx on people (account_id);
+
+-- +migrate Down
+alter table people drop column if exists account_id;
+drop table if exists account_phone_numbers CASCADE;
+drop table if exists accounts CASCADE;
@@ -0,0 +1,26 @@
+-- +migrate Up
+create table activities (
+    id serial not null primary key,
+    version int not null,
+    created_at timestamp without time zone not null,
+    changed_at timestamp without time zone not null,
+
+    type text not null,
+    subject text not null,
+    body text not null,
+    occurred_at timestamp without time zone not null,
+    author text not null,
+
+    person_id int default null,
+    account_id int default null,
+
+    foreign key (author) references users(login) on update cascade on delete restrict,
+    foreign key (person_id) references people(id) on update cascade on delete cascade,
+    foreign key (account_id) references accounts(id) on update cascade on delete cascade
+);
+
+create index activities_person_id_idx on activities (person_id);
+create index activities_account_id_idx on activities (account_id);
+
+-- +migrate Down
+drop table if exists activities CASCADE;
@@ -0,0 +1,25 @@
+-- +migrate Up
+create table tasks (
+    id serial not null primary key,
+    version int not null,
+    created_at timestamp without time zone not null,
+    changed_at timestamp without time zone not null,
+
+    title text not null,
+    description text not null,
+    due_date date default null,
+    status text not null,
+    assignee text not null,
+
+    person_id int default null,
+    account_id int default null,
+
+    foreign key (assignee) references users(login) on update cascade on delete restrict,
+    foreign key (person_id) references people(id) on update cascade on delete set null,
+    foreign key (account_id) references accounts(id) on update cascade on delete set null
+);
+
+create index tasks_assignee_status_idx on tasks (assignee, status);
+
+-- +migrate Down
+drop table if exists tasks CASCADE;
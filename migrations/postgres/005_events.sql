@@ -0,0 +1,46 @@
+-- +migrate Up
+create table events (
+    id serial not null primary key,
+    version int not null,
+    created_at timestamp without time zone not null,
+    changed_at timestamp without time zone not null,
+
+    title text not null,
+    description text not null,
+    location text not null,
+    start_at timestamp without time zone not null,
+    end_at timestamp without time zone not null
+);
+
+create table event_people (
+    event_id int not null,
+    person_id int not null,
+
+    primary key (event_id, person_id),
+    foreign key (event_id) references events(id) on update cascade on delete cascade,
+    foreign key (person_id) references people(id) on update cascade on delete cascade
+);
+
+create table event_users (
+    event_id int not null,
+    login text not null,
+
+    primary key (event_id, login),
+    foreign key (event_id) references events(id) on update cascade on delete cascade,
+    foreign key (login) references users(login) on update cascade on delete cascade
+);
+
+create index event_users_login_idx on event_users (login);
+
+create table calendar_tokens (
+    token text not null primary key,
+    "user" text not null unique,
+
+    foreign key ("user") references users(login) on update cascade on delete cascade
+);
+
+-- +migrate Down
+drop table if exists calendar_tokens CASCADE;
+drop table if exists event_users CASCADE;
+drop table if exists event_people CASCADE;
+drop table if exists events CASCADE;
@@ -0,0 +1,27 @@
+-- +migrate Up
+create table email_addresses (
+    id serial not null primary key,
+
+    address text not null,
+    type text not null,
+    "primary" boolean not null,
+    person_id int default null,
+
+    foreign key (person_id) references people(id) on update cascade on delete cascade
+);
+
+create index email_addresses_person_id_idx on email_addresses (person_id);
+create index email_addresses_address_idx on email_addresses (lower(address));
+
+insert into email_addresses (address, type, "primary", person_id)
+    select email_address, 'work', true, id from people where email_address <> '';
+
+alter table people drop column email_address;
+
+-- +migrate Down
+alter table people add column email_address text not null default '';
+
+update people set email_address = e.address
+    from email_addresses e where e.person_id = people.id and e."primary";
+
+drop table if exists email_addresses CASCADE;
@@ -0,0 +1,24 @@
+-- +migrate Up
+create table tags (
+    id serial not null primary key,
+    version int not null,
+    created_at timestamp without time zone not null,
+    changed_at timestamp without time zone not null,
+
+    name text not null unique
+);
+
+create table person_tags (
+    person_id int not null,
+    tag_id int not null,
+
+    primary key (person_id, tag_id),
+    foreign key (person_id) references people(id) on update cascade on delete cascade,
+    foreign key (tag_id) references tags(id) on update cascade on delete cascade
+);
+
+create index person_tags_tag_id_idx on person_tags (tag_id);
+
+-- +migrate Down
+drop table if exists person_tags CASCADE;
+drop table if exists tags CASCADE;
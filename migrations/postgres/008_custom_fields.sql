@@ -0,0 +1,18 @@
+-- +migrate Up
+create table custom_fields (
+    id serial not null primary key,
+    version int not null,
+    created_at timestamp without time zone not null,
+    changed_at timestamp without time zone not null,
+
+    name text not null unique,
+    type text not null,
+    required boolean not null default false,
+    options jsonb not null default '[]'
+);
+
+alter table people add column custom jsonb not null default '{}';
+
+-- +migrate Down
+alter table people drop column if exists custom;
+drop table if exists custom_fields CASCADE;
@@ -0,0 +1,87 @@
+-- +migrate Up
+create table people_search (
+    person_id int not null primary key,
+    document tsvector not null,
+
+    foreign key (person_id) references people(id) on update cascade on delete cascade
+);
+
+create index people_search_document_idx on people_search using gin (document);
+
+-- people_search_normalize splits s into words consisting only of letters and
+-- digits, so that e.g. email addresses and phone numbers are indexed by their
+-- parts.
+-- +migrate StatementBegin
+create function people_search_normalize(s text) returns text as $$
+    select regexp_replace(lower(s), '[^[:alnum:]]+', ' ', 'g');
+$$ language sql immutable;
+-- +migrate StatementEnd
+
+-- people_search_refresh recomputes the search document for a person. The
+-- weights are: A for the name, B for title, department and email addresses, C
+-- for the address and phone numbers and D for the comment.
+-- +migrate StatementBegin
+create function people_search_refresh(pid int) returns void as $$
+begin
+    delete from people_search where person_id = pid;
+
+    insert into people_search (person_id, document)
+    select p.id,
+        setweight(to_tsvector('simple', people_search_normalize(p.name)), 'A') ||
+        setweight(to_tsvector('simple', people_search_normalize(
+            p.title || ' ' || p.department || ' ' ||
+            coalesce((select string_agg(address, ' ') from email_addresses where person_id = p.id), ''))), 'B') ||
+        setweight(to_tsvector('simple', people_search_normalize(
+            p.street || ' ' || p.postal_code || ' ' || p.state || ' ' || p.city || ' ' || p.country || ' ' ||
+            coalesce((select string_agg(number, ' ') from phone_numbers where person_id = p.id), ''))), 'C') ||
+        setweight(to_tsvector('simple', people_search_normalize(p.comment)), 'D')
+    from people p where p.id = pid;
+end;
+$$ language plpgsql;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+create function people_search_people_trigger() returns trigger as $$
+begin
+    perform people_search_refresh(NEW.id);
+    return null;
+end;
+$$ language plpgsql;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+create function people_search_details_trigger() returns trigger as $$
+begin
+    if TG_OP in ('INSERT', 'UPDATE') and NEW.person_id is not null then
+        perform people_search_refresh(NEW.person_id);
+    end if;
+
+    if TG_OP in ('UPDATE', 'DELETE') and OLD.person_id is not null then
+        perform people_search_refresh(OLD.person_id);
+    end if;
+
+    return null;
+end;
+$$ language plpgsql;
+-- +migrate StatementEnd
+
+create trigger people_search_update after insert or update on people
+    for each row execute procedure people_search_people_trigger();
+
+create trigger people_search_update after insert or update or delete on email_addresses
+    for each row execute procedure people_search_details_trigger();
+
+create trigger people_search_update after insert or update or delete on phone_numbers
+    for each row execute procedure people_search_details_trigger();
+
+select people_search_refresh(id) from people;
+
+-- +migrate Down
+drop trigger if exists people_search_update on phone_numbers;
+drop trigger if exists people_search_update on email_addresses;
+drop trigger if exists people_search_update on people;
+drop function if exists people_search_details_trigger();
+drop function if exists people_search_people_trigger();
+drop function if exists people_search_refresh(int);
+drop function if exists people_search_normalize(text);
+drop table if exists people_search CASCADE;
@@ -0,0 +1,8 @@
+-- +migrate Up
+create extension if not exists pg_trgm;
+
+create index people_name_trgm_idx on people using gin (name gin_trgm_ops);
+
+-- +migrate Down
+drop index if exists people_name_trgm_idx;
+drop extension if exists pg_trgm;
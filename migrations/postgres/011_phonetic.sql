@@ -0,0 +1,14 @@
+-- +migrate Up
+-- The phonetic codes for the name of a person, separated by spaces. They are
+-- computed by ghenga when a person is saved.
+alter table people add column name_cologne text not null default '';
+alter table people add column name_metaphone text not null default '';
+
+create index people_name_cologne_idx on people using gin (string_to_array(name_cologne, ' '));
+create index people_name_metaphone_idx on people using gin (string_to_array(name_metaphone, ' '));
+
+-- +migrate Down
+drop index if exists people_name_metaphone_idx;
+drop index if exists people_name_cologne_idx;
+alter table people drop column if exists name_metaphone;
+alter table people drop column if exists name_cologne;
@@ -0,0 +1,45 @@
+-- +migrate Up
+
+-- people_search_fold converts s to lower case, transliterates umlauts, ß and
+-- ligatures (e.g. 'ä' becomes 'ae') and removes diacritics (e.g. 'é' becomes
+-- 'e'). It must be kept in sync with the function fold in package db.
+-- +migrate StatementBegin
+create function people_search_fold(s text) returns text as $$
+    select translate(
+        replace(replace(replace(replace(replace(replace(
+        replace(replace(replace(replace(replace(replace(lower(s),
+            'ä', 'ae'), 'ö', 'oe'), 'ü', 'ue'), 'ß', 'ss'), 'æ', 'ae'), 'œ', 'oe'),
+            'Ä', 'ae'), 'Ö', 'oe'), 'Ü', 'ue'), 'Æ', 'ae'), 'Œ', 'oe'), 'ẞ', 'ss'),
+        'àáâãåāăąçćčďđèéêëēėęěìíîïīįłñńňòóôõøōőŕřśšşťţùúûůūűųýÿźżžÀÁÂÃÅĀĂĄÇĆČĎĐÈÉÊËĒĖĘĚÌÍÎÏĪĮŁÑŃŇÒÓÔÕØŌŐŔŘŚŠŞŤŢÙÚÛŮŪŰŲÝŸŹŻŽ',
+        'aaaaaaaacccddeeeeeeeeiiiiiilnnnooooooorrsssttuuuuuuuyyzzzaaaaaaaacccddeeeeeeeeiiiiiilnnnooooooorrsssttuuuuuuuyyzzz');
+$$ language sql immutable;
+-- +migrate StatementEnd
+
+-- +migrate StatementBegin
+create or replace function people_search_normalize(s text) returns text as $$
+    select regexp_replace(people_search_fold(s), '[^[:alnum:]]+', ' ', 'g');
+$$ language sql immutable;
+-- +migrate StatementEnd
+
+drop index if exists people_name_trgm_idx;
+create index people_name_fold_trgm_idx on people using gin (people_search_fold(name) gin_trgm_ops);
+
+select people_search_refresh(id) from people;
+
+-- the phonetic codes are computed from the folded name now, they are
+-- recomputed by ghenga after the migration
+update people set name_cologne = '', name_metaphone = '';
+
+-- +migrate Down
+drop index if exists people_name_fold_trgm_idx;
+create index people_name_trgm_idx on people using gin (name gin_trgm_ops);
+
+-- +migrate StatementBegin
+create or replace function people_search_normalize(s text) returns text as $$
+    select regexp_replace(lower(s), '[^[:alnum:]]+', ' ', 'g');
+$$ language sql immutable;
+-- +migrate StatementEnd
+
+drop function if exists people_search_fold(text);
+
+select people_search_refresh(id) from people;
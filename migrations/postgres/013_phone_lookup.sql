@@ -0,0 +1,9 @@
+-- +migrate Up
+-- The normalized number is computed by ghenga when a phone number is saved.
+alter table phone_numbers add column normalized_number text not null default '';
+
+create index phone_numbers_normalized_number_idx on phone_numbers (normalized_number);
+
+-- +migrate Down
+drop index if exists phone_numbers_normalized_number_idx;
+alter table phone_numbers drop column if exists normalized_number;
@@ -0,0 +1,7 @@
+-- +migrate Up
+-- Prefix index for the suggestions for people, word prefixes are found with
+-- the index on people_search.
+create index people_name_prefix_idx on people (people_search_fold(name) text_pattern_ops);
+
+-- +migrate Down
+drop index if exists people_name_prefix_idx;
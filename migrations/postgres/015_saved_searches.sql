@@ -0,0 +1,22 @@
+-- +migrate Up
+create table saved_searches (
+    id serial not null primary key,
+    version int not null,
+    created_at timestamp without time zone not null,
+    changed_at timestamp without time zone not null,
+
+    owner text not null,
+    name text not null,
+    query text not null,
+    mode text not null,
+    tags jsonb not null default '[]',
+    tag_match text not null,
+    shared boolean not null default false,
+
+    foreign key (owner) references users(login) on update cascade on delete cascade
+);
+
+create index saved_searches_owner_idx on saved_searches (owner);
+
+-- +migrate Down
+drop table if exists saved_searches CASCADE;
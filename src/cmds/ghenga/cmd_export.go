@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"ghenga/db"
+	"ghenga/query"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type cmdExport struct {
+	Format string   `short:"f" long:"format" description:"output format, csv or xlsx (default: from the file name, or csv)"`
+	Output string   `short:"o" long:"output" default:"-" description:"write to this file, - for standard output"`
+	Tags   []string `short:"t" long:"tag"    description:"only export people with this tag, may be given several times"`
+	AnyTag bool     `long:"any-tag"          description:"export people with at least one of the tags instead of all"`
+	Filter []string `long:"filter"           description:"only export people where the field has the value (field=value), may be given several times"`
+	Sort   string   `short:"s" long:"sort"   description:"sort by this field, a leading - reverses the order"`
+	Query  string   `short:"q" long:"query"  description:"only export people matching the search query"`
+}
+
+func init() {
+	_, err := parser.AddCommand("export",
+		"export people",
+		"The export command writes people to a CSV file or an XLSX spreadsheet, "+
+			"with one row per person. The columns are named like the fields for "+
+			"'ghenga import csv', so that the file can be imported again.",
+		&cmdExport{})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// iterate returns the people to export.
+func (opts *cmdExport) iterate(dbm db.DB) (db.PeopleIterator, error) {
+	tags := db.TagFilter{Tags: opts.Tags, MatchAll: !opts.AnyTag}
+
+	if opts.Query != "" {
+		q, err := query.Parse(opts.Query)
+		if err != nil {
+			return nil, err
+		}
+
+		var people []*db.Person
+		if q.Simple() {
+			people, err = dbm.FuzzyFindPersons(opts.Query, db.SearchFullText, tags)
+		} else {
+			people, err = dbm.SearchPeople(q, tags)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return db.IterateSlice(people), nil
+	}
+
+	list := db.ListOptions{
+		Sort:   strings.TrimPrefix(opts.Sort, "-"),
+		Desc:   strings.HasPrefix(opts.Sort, "-"),
+		Filter: make(map[string]string),
+	}
+
+	for _, f := range opts.Filter {
+		i := strings.Index(f, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid filter %q, expected field=value", f)
+		}
+		list.Filter[f[:i]] = f[i+1:]
+	}
+
+	return dbm.IteratePeople(tags, list)
+}
+
+func (opts *cmdExport) Execute(args []string) (err error) {
+	format := opts.Format
+	if format == "" {
+		format = "csv"
+		if strings.EqualFold(filepath.Ext(opts.Output), ".xlsx") {
+			format = "xlsx"
+		}
+	}
+
+	valid := false
+	for _, f := range db.ExportFormats {
+		if format == f {
+			valid = true
+		}
+	}
+
+	if !valid {
+		return fmt.Errorf("invalid format %q", format)
+	}
+
+	dbm, e := db.Open(globalOpts.DB)
+	if e != nil {
+		return e
+	}
+	defer CleanupErr(&err, func() error {
+		return dbm.Close()
+	})
+
+	fields, err := dbm.ListCustomFields()
+	if err != nil {
+		return err
+	}
+
+	it, err := opts.iterate(dbm)
+	if err != nil {
+		return err
+	}
+	defer CleanupErr(&err, it.Close)
+
+	var wr io.Writer = os.Stdout
+	if opts.Output != "-" {
+		f, e := os.Create(opts.Output)
+		if e != nil {
+			return e
+		}
+		defer CleanupErr(&err, f.Close)
+		wr = f
+	}
+
+	n, err := db.ExportPeople(wr, format, it, fields)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("exported %d people", n)
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"ghenga/db"
+	"io"
+	"log"
+	"os"
+	"unicode/utf8"
+)
+
+type cmdImport struct{}
+
+type cmdImportCSV struct {
+	Map       []string `short:"m" long:"map"       description:"map a column to a field of a person (column=field), may be given several times"`
+	Separator string   `short:"s" long:"separator" default:","  description:"character separating the columns"`
+	DryRun    bool     `short:"n" long:"dry-run"                description:"only check the rows, do not save anything"`
+}
+
+func init() {
+	cmd, err := parser.AddCommand("import",
+		"import data",
+		"The import command imports data from files into the db",
+		&cmdImport{})
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = cmd.AddCommand("csv",
+		"import people from a CSV file",
+		"This command imports people from a CSV file with a header line. "+
+			"Without a mapping, the columns named like a field are imported. "+
+			"Fields are name, title, department, comment, street, postal_code, "+
+			"state, city, country, phone, phone:<type>, email, email:<type>, "+
+			"tags and custom:<name>. The valid rows are saved in one transaction, "+
+			"invalid rows are reported. The file - is read from standard input.",
+		&cmdImportCSV{})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (opts *cmdImportCSV) Execute(args []string) (err error) {
+	if len(args) != 1 {
+		return errors.New("usage: ghenga import csv [options] FILE")
+	}
+
+	if utf8.RuneCountInString(opts.Separator) != 1 {
+		return fmt.Errorf("invalid separator %q", opts.Separator)
+	}
+	sep, _ := utf8.DecodeRuneInString(opts.Separator)
+
+	mapping, err := db.ParseCSVMapping(opts.Map)
+	if err != nil {
+		return err
+	}
+
+	var rd io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, e := os.Open(args[0])
+		if e != nil {
+			return e
+		}
+		defer f.Close()
+		rd = f
+	}
+
+	dbm, e := db.Open(globalOpts.DB)
+	if e != nil {
+		return e
+	}
+	defer CleanupErr(&err, func() error {
+		return dbm.Close()
+	})
+
+	res, err := db.ImportPeopleCSV(dbm, rd, db.CSVImportOptions{
+		Mapping:   mapping,
+		Separator: sep,
+		DryRun:    opts.DryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range res.Errors {
+		fmt.Fprintf(os.Stderr, "line %d: %v\n", e.Line, e.Message)
+	}
+
+	if res.DryRun {
+		log.Printf("dry run: %d of %d rows are valid", res.Valid, res.Rows)
+		return nil
+	}
+
+	log.Printf("imported %d of %d rows", res.Imported, res.Rows)
+	return nil
+}
@@ -18,6 +18,10 @@ type cmdServe struct {
 	Port   uint   `short:"p" long:"port"   default:"8080"   description:"set the port for the HTTP server"`
 	Addr   string `short:"b" long:"bind"   default:""       description:"bind to this address"`
 	Public string `          long:"public" default:"public" description:"directory for serving static files"`
+
+	MaxSuggestions int           `long:"max-suggestions" default:"50"    description:"maximal number of suggestions for people"`
+	SuggestTimeout time.Duration `long:"suggest-timeout" default:"200ms" description:"maximal duration of a query for suggestions"`
+	MaxSearchHits  int           `long:"max-search-hits" default:"100"   description:"maximal number of hits of the global search"`
 }
 
 func init() {
@@ -76,6 +80,9 @@ func (opts *cmdServe) Execute(args []string) (err error) {
 		Cfg: server.Config{
 			Debug:           globalOpts.Debug,
 			SessionDuration: sessionDuration,
+			MaxSuggestions:  opts.MaxSuggestions,
+			SuggestTimeout:  opts.SuggestTimeout,
+			MaxSearchHits:   opts.MaxSearchHits,
 		},
 	}
 
@@ -146,6 +146,27 @@ func (c *Client) doJSON(req *http.Request, responseStatus int, data interface{})
 	return probe.Trace(res.Body.Close())
 }
 
+// doJSONPage works like doJSON for requests to list endpoints, which return a
+// page of a list with the status code 200. The cursor for the next page is
+// returned, it is empty for the last page.
+func (c *Client) doJSONPage(req *http.Request, data interface{}) (cursor string, err error) {
+	res, err := c.do(req)
+	if err != nil {
+		return "", probe.Trace(err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", probe.Trace(ParseError(res))
+	}
+
+	dec := json.NewDecoder(res.Body)
+	if err := dec.Decode(data); err != nil {
+		return "", probe.Trace(err)
+	}
+
+	return res.Header.Get("X-Next-Cursor"), probe.Trace(res.Body.Close())
+}
+
 // Check queries the API server whether the token is still valid.
 func (c *Client) Check() error {
 	req, err := http.NewRequest("GET", c.BaseURL+"/api/login/info", nil)
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/fd0/probe"
+)
+
+// BatchOperation is a single operation of a batch. Op is one of `create`,
+// `update` and `delete`, Type is `person` or `user` (only for `create`). Data
+// is encoded to JSON, e.g. a db.Person or db.User.
+type BatchOperation struct {
+	Op      string      `json:"op"`
+	Type    string      `json:"type"`
+	ID      int64       `json:"id,omitempty"`
+	Version int64       `json:"version,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// BatchResult is the result of a single operation of a batch, with the status
+// code the operation would have as a single request. Data contains the
+// resulting entity.
+type BatchResult struct {
+	Status int             `json:"status"`
+	Error  string          `json:"error,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// BatchResponse is the response of the server to a batch request.
+type BatchResponse struct {
+	Message   string        `json:"message"`
+	Committed bool          `json:"committed"`
+	Results   []BatchResult `json:"results"`
+}
+
+// Batch runs the operations on the server in one transaction. Unless
+// continueOnError is set, the batch is aborted when an operation fails. In
+// this case, the results are returned together with an Error.
+func (c *Client) Batch(ops []BatchOperation, continueOnError bool) ([]BatchResult, error) {
+	data, err := json.Marshal(struct {
+		ContinueOnError bool             `json:"continue_on_error"`
+		Operations      []BatchOperation `json:"operations"`
+	}{continueOnError, ops})
+	if err != nil {
+		return nil, probe.Trace(err)
+	}
+
+	req, err := http.NewRequest("POST", c.BaseURL+"/api/batch", bytes.NewReader(data))
+	if err != nil {
+		return nil, probe.Trace(err)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return nil, probe.Trace(err)
+	}
+
+	ct := res.Header.Get("Content-Type")
+	if res.StatusCode != http.StatusOK && strings.Split(ct, ";")[0] != "application/json" {
+		return nil, probe.Trace(ParseError(res))
+	}
+
+	var response BatchResponse
+	dec := json.NewDecoder(res.Body)
+	if err = dec.Decode(&response); err != nil {
+		return nil, probe.Trace(err)
+	}
+
+	if err = res.Body.Close(); err != nil {
+		return nil, probe.Trace(err)
+	}
+
+	if res.StatusCode != http.StatusOK || !response.Committed {
+		return response.Results, Error{Message: response.Message}
+	}
+
+	return response.Results, nil
+}
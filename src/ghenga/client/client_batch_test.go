@@ -0,0 +1,56 @@
+package client
+
+import (
+	"encoding/json"
+	"ghenga/db"
+	"ghenga/server"
+	"testing"
+)
+
+func TestClientBatch(t *testing.T) {
+	srv, cleanup := server.TestServer(t)
+	defer cleanup()
+
+	client := TestClient(t, srv.URL, "admin", "geheim")
+
+	ops := []BatchOperation{
+		{Op: "create", Type: "person", Data: db.Person{Name: "Batch Person"}},
+		{Op: "create", Type: "user", Data: db.User{Login: "batch", Password: "secret"}},
+	}
+
+	results, err := client.Batch(ops, false)
+	if err != nil {
+		t.Fatalf("batch failed: %v", err)
+	}
+
+	if len(results) != 2 || results[0].Status != 201 || results[1].Status != 201 {
+		t.Fatalf("batch returned wrong results: %v", results)
+	}
+
+	var p db.Person
+	if err = json.Unmarshal(results[0].Data, &p); err != nil {
+		t.Fatalf("invalid person in result: %v", err)
+	}
+
+	if p.ID == 0 || p.Name != "Batch Person" {
+		t.Errorf("batch returned wrong person: %v", p)
+	}
+
+	ops = []BatchOperation{
+		{Op: "delete", Type: "person", ID: p.ID},
+		{Op: "update", Type: "person", ID: p.ID, Data: db.Person{Name: "Batch Outdated", Version: p.Version + 1}},
+	}
+
+	results, err = client.Batch(ops, false)
+	if _, ok := err.(Error); !ok {
+		t.Fatalf("aborted batch returned wrong error %v", err)
+	}
+
+	if len(results) != 2 || results[0].Status != 424 || results[1].Status != 409 {
+		t.Fatalf("aborted batch returned wrong results: %v", results)
+	}
+
+	if _, err = client.Batch(nil, false); err == nil {
+		t.Errorf("empty batch did not return an error")
+	}
+}
@@ -6,24 +6,36 @@ import (
 	"fmt"
 	"ghenga/db"
 	"net/http"
+	"net/url"
 
 	"github.com/fd0/probe"
 )
 
-// ListUsers returns the list of all users.
+// ListUsers returns the list of all users. The pages of the list are
+// requested one after another, until the server does not announce a next
+// page.
 func (c *Client) ListUsers() ([]db.User, error) {
-	req, err := http.NewRequest("GET", c.BaseURL+"/api/user", nil)
-	if err != nil {
-		return nil, probe.Trace(err)
-	}
-
 	var list []db.User
-	err = c.doJSON(req, http.StatusOK, &list)
-	if err != nil {
-		return nil, probe.Trace(err)
-	}
+	cursor := ""
 
-	return list, nil
+	for {
+		req, err := http.NewRequest("GET", c.BaseURL+"/api/user?cursor="+url.QueryEscape(cursor), nil)
+		if err != nil {
+			return nil, probe.Trace(err)
+		}
+
+		var page []db.User
+		cursor, err = c.doJSONPage(req, &page)
+		if err != nil {
+			return nil, probe.Trace(err)
+		}
+
+		list = append(list, page...)
+
+		if cursor == "" {
+			return list, nil
+		}
+	}
 }
 
 // FindUser returns the record of a single user, identified by the user ID.
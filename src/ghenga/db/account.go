@@ -0,0 +1,312 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/modl"
+)
+
+// AccountDatabase allows handling accounts.
+type AccountDatabase interface {
+	FindAccount(int64) (*Account, error)
+
+	InsertAccount(*Account) error
+	ListAccounts() ([]*Account, error)
+	UpdateAccount(*Account) error
+	DeleteAccount(int64) error
+
+	ListAccountPeople(int64) ([]*Person, error)
+}
+
+// Account is a company, a union or another organisation in the database.
+type Account struct {
+	ID           int64
+	Name         string
+	Website      string
+	PhoneNumbers AccountPhoneNumbers `db:"-"`
+
+	// Billing address
+	BillingStreet     string
+	BillingPostalCode string
+	BillingState      string
+	BillingCity       string
+	BillingCountry    string
+
+	// Physical address
+	PhysicalStreet     string
+	PhysicalPostalCode string
+	PhysicalState      string
+	PhysicalCity       string
+	PhysicalCountry    string
+
+	ChangedAt time.Time
+	CreatedAt time.Time
+	Version   int64
+}
+
+// AccountJSON is the JSON representation of an Account as returned or
+// consumed by the API.
+type AccountJSON struct {
+	ID           int64             `json:"id,omitempty"`
+	Name         string            `json:"name,omitempty"`
+	Website      string            `json:"website,omitempty"`
+	PhoneNumbers []PhoneNumberJSON `json:"phone_numbers"`
+
+	BillingAddress  AddressJSON `json:"billing_address,omitempty"`
+	PhysicalAddress AddressJSON `json:"physical_address,omitempty"`
+
+	ChangedAt string `json:"changed_at,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+
+	Version int64 `json:"version"`
+}
+
+// NewAccount returns a new account record.
+func NewAccount(name string) *Account {
+	ts := time.Now()
+	return &Account{
+		Name:      name,
+		CreatedAt: ts,
+		ChangedAt: ts,
+	}
+}
+
+// MarshalJSON returns the JSON representation of a.
+func (a Account) MarshalJSON() ([]byte, error) {
+	ja := AccountJSON{
+		ID:      a.ID,
+		Name:    a.Name,
+		Website: a.Website,
+
+		ChangedAt: a.ChangedAt.Format(timeLayout),
+		CreatedAt: a.CreatedAt.Format(timeLayout),
+		Version:   a.Version,
+	}
+
+	ja.PhoneNumbers = []PhoneNumberJSON{}
+	for _, pn := range a.PhoneNumbers {
+		ja.PhoneNumbers = append(ja.PhoneNumbers, PhoneNumberJSON{
+			Type:   pn.Type,
+			Number: pn.Number,
+		})
+	}
+
+	ja.BillingAddress = AddressJSON{
+		Street:     a.BillingStreet,
+		PostalCode: a.BillingPostalCode,
+		State:      a.BillingState,
+		City:       a.BillingCity,
+		Country:    a.BillingCountry,
+	}
+
+	ja.PhysicalAddress = AddressJSON{
+		Street:     a.PhysicalStreet,
+		PostalCode: a.PhysicalPostalCode,
+		State:      a.PhysicalState,
+		City:       a.PhysicalCity,
+		Country:    a.PhysicalCountry,
+	}
+
+	return json.Marshal(ja)
+}
+
+// UnmarshalJSON returns an account from JSON.
+func (a *Account) UnmarshalJSON(data []byte) error {
+	var ja AccountJSON
+
+	err := json.Unmarshal(data, &ja)
+	if err != nil {
+		return err
+	}
+
+	createdAt, err := time.Parse(timeLayout, ja.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	changedAt, err := time.Parse(timeLayout, ja.ChangedAt)
+	if err != nil {
+		return err
+	}
+
+	*a = Account{
+		CreatedAt: createdAt,
+		ChangedAt: changedAt,
+	}
+
+	a.Update(ja)
+	a.ID = ja.ID
+
+	return nil
+}
+
+// Validate checks if a is valid and returns an error if not.
+func (a *Account) Validate() error {
+	if a.Name == "" {
+		return errors.New("name is empty")
+	}
+
+	if a.CreatedAt.IsZero() || a.ChangedAt.IsZero() {
+		return errors.New("invalid timestamps")
+	}
+
+	return nil
+}
+
+// Update updates a with the fields from other.
+func (a *Account) Update(other AccountJSON) {
+	a.Name = other.Name
+	a.Website = other.Website
+
+	a.PhoneNumbers = nil
+	for _, num := range other.PhoneNumbers {
+		a.PhoneNumbers = append(a.PhoneNumbers, AccountPhoneNumber{
+			Type:   num.Type,
+			Number: num.Number,
+		})
+	}
+
+	a.BillingStreet = other.BillingAddress.Street
+	a.BillingPostalCode = other.BillingAddress.PostalCode
+	a.BillingState = other.BillingAddress.State
+	a.BillingCity = other.BillingAddress.City
+	a.BillingCountry = other.BillingAddress.Country
+
+	a.PhysicalStreet = other.PhysicalAddress.Street
+	a.PhysicalPostalCode = other.PhysicalAddress.PostalCode
+	a.PhysicalState = other.PhysicalAddress.State
+	a.PhysicalCity = other.PhysicalAddress.City
+	a.PhysicalCountry = other.PhysicalAddress.Country
+
+	a.Version = other.Version
+}
+
+func (a Account) String() string {
+	return fmt.Sprintf("<Account[%v] (%v)>", a.ID, a.Name)
+}
+
+// PostInsert is run after an account is saved into the database. It is used
+// to handle phone numbers associated with the account.
+func (a *Account) PostInsert(db modl.SqlExecutor) error {
+	for _, num := range a.PhoneNumbers {
+		num.AccountID = a.ID
+		err := db.Insert(&num)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PostGet loads the phone numbers associated with the account.
+func (a *Account) PostGet(db modl.SqlExecutor) error {
+	return db.Select(&a.PhoneNumbers, "SELECT * FROM account_phone_numbers WHERE account_id = $1", a.ID)
+}
+
+// PostUpdate is run after an account has been updated. It handles updating
+// the phone numbers for the account.
+func (a *Account) PostUpdate(db modl.SqlExecutor) error {
+	var ids []int64
+	for _, num := range a.PhoneNumbers {
+		num.AccountID = a.ID
+		var err error
+		if num.ID != 0 {
+			_, err = db.Update(&num)
+		} else {
+			err = db.Insert(&num)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		ids = append(ids, num.ID)
+	}
+
+	if len(ids) > 0 {
+		// remove excess phone numbers
+		query, args, err := in("DELETE FROM account_phone_numbers WHERE account_id = ? AND id NOT IN (?)", a.ID, ids)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(query, args...)
+		return err
+	}
+
+	// else remove all phone numbers
+	_, err := db.Exec("DELETE FROM account_phone_numbers WHERE account_id = $1", a.ID)
+	return err
+}
+
+// FindAccount returns the account struct with the given id.
+func (db *Database) FindAccount(id int64) (*Account, error) {
+	var a Account
+
+	err := db.dbmap.SelectOne(&a, "SELECT * FROM accounts WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// UpdateAccount modifies an existing account.
+func (db *Database) UpdateAccount(a *Account) error {
+	_, err := db.dbmap.Update(a)
+	return err
+}
+
+// InsertAccount creates a new account.
+func (db *Database) InsertAccount(a *Account) error {
+	return db.dbmap.Insert(a)
+}
+
+// ListAccounts returns the list of accounts.
+func (db *Database) ListAccounts() ([]*Account, error) {
+	var accounts []*Account
+	err := db.dbmap.Select(&accounts, "select * from accounts")
+	return accounts, err
+}
+
+// DeleteAccount removes an account. People associated with the account are
+// kept, their account is reset and their version is increased.
+func (db *Database) DeleteAccount(id int64) error {
+	tx, err := db.dbmap.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = bumpPeopleVersions(tx, "account_id = $1", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	res, err := tx.Exec("delete from accounts where id = $1", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if n != 1 {
+		tx.Rollback()
+		return errors.New("account not found")
+	}
+
+	return tx.Commit()
+}
+
+// ListAccountPeople returns the list of people associated with the account.
+func (db *Database) ListAccountPeople(id int64) ([]*Person, error) {
+	return db.selectPeople("select * from people where account_id = $1 order by id", id)
+}
@@ -0,0 +1,234 @@
+package db
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var testAccounts = []struct {
+	name string
+	a    Account
+}{
+	{
+		name: "testaccount1",
+		a: Account{
+			Name:    "Beispiel GmbH",
+			Website: "https://www.example.com",
+			PhoneNumbers: AccountPhoneNumbers{
+				{Type: "switchboard", Number: "+49 221 1231234"},
+				{Type: "fax", Number: "+49 221 1231235"},
+			},
+			BillingStreet:      "Teststraße 24",
+			BillingPostalCode:  "03030",
+			BillingCity:        "Berlin",
+			BillingCountry:     "Germany",
+			PhysicalStreet:     "Teststraße 24b",
+			PhysicalPostalCode: "03030",
+			PhysicalCity:       "Berlin",
+			PhysicalCountry:    "Germany",
+			ChangedAt:          parseTime("2016-04-24T10:30:07+00:00"),
+			CreatedAt:          parseTime("2016-04-24T10:30:07+00:00"),
+			Version:            2,
+		},
+	},
+	{
+		name: "testaccount2",
+		a: Account{
+			Name:      "Verein e.V.",
+			ChangedAt: parseTime("2016-04-24T10:30:07+00:00"),
+			CreatedAt: parseTime("2016-04-24T10:30:07+00:00"),
+			Version:   1,
+		},
+	},
+}
+
+func testAccountInsertSelect(t *testing.T, db DB) {
+	var ids []int64
+	for _, test := range testAccounts {
+		err := db.InsertAccount(&test.a)
+		if err != nil {
+			t.Fatalf("saving %v failed: %v", test.name, err)
+		}
+
+		ids = append(ids, test.a.ID)
+	}
+
+	for i, test := range testAccounts {
+		a, err := db.FindAccount(ids[i])
+		if err != nil {
+			t.Errorf("loading %v failed: %v", ids[i], err)
+			continue
+		}
+
+		if a.Version != test.a.Version+1 {
+			t.Errorf("%v: wrong version loaded from db, want %v, got %v",
+				test.name, test.a.Version+1, a.Version)
+		}
+
+		a.ID = test.a.ID
+		a.Version = test.a.Version
+
+		buf1 := marshal(t, test.a)
+		buf2 := marshal(t, a)
+
+		if !bytes.Equal(buf1, buf2) {
+			t.Errorf("loading %v returned different data:\n  want: %s\n   got: %s",
+				test.name, buf1, buf2)
+		}
+	}
+}
+
+func TestDBAccountInsertSelect(t *testing.T) {
+	testAccountInsertSelect(t, testDB)
+}
+
+func TestMockDBAccountInsertSelect(t *testing.T) {
+	testAccountInsertSelect(t, NewMockDB(20, 5))
+}
+
+func insertAccount(t *testing.T, db DB, name string) *Account {
+	a := NewAccount(name)
+	if err := db.InsertAccount(a); err != nil {
+		t.Fatalf("unable to insert account %v: %v", name, err)
+	}
+
+	return a
+}
+
+func testAccountUpdate(t *testing.T, db DB) {
+	a := insertAccount(t, db, "Update AG")
+
+	a.Website = "https://update.example.com"
+	a.PhoneNumbers = AccountPhoneNumbers{{Type: "switchboard", Number: "12345"}}
+	if err := db.UpdateAccount(a); err != nil {
+		t.Fatalf("unable to update account: %v", err)
+	}
+
+	a2, err := db.FindAccount(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a2.Website != a.Website {
+		t.Errorf("website not updated, want %q, got %q", a.Website, a2.Website)
+	}
+
+	if !a.PhoneNumbers.Equals(a2.PhoneNumbers) {
+		t.Errorf("changing phone numbers did not work, want:\n%v\n  got:\n%v", a.PhoneNumbers, a2.PhoneNumbers)
+	}
+
+	a.Version = 1
+	if err = db.UpdateAccount(a); err == nil {
+		t.Fatalf("update did not fail despite wrong version field")
+	}
+}
+
+func TestDBAccountUpdate(t *testing.T) {
+	testAccountUpdate(t, testDB)
+}
+
+func TestMockDBAccountUpdate(t *testing.T) {
+	testAccountUpdate(t, NewMockDB(20, 5))
+}
+
+func testAccountPeople(t *testing.T, db DB) {
+	a := insertAccount(t, db, "People KG")
+
+	p := findPerson(t, db, 3)
+	p.AccountID.Int64 = a.ID
+	p.AccountID.Valid = true
+	updatePerson(t, db, p)
+
+	people, err := db.ListAccountPeople(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(people) != 1 || people[0].ID != p.ID {
+		t.Fatalf("ListAccountPeople(%v) returned wrong list %v", a.ID, people)
+	}
+
+	if err = db.DeleteAccount(a.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = db.FindAccount(a.ID); err == nil {
+		t.Fatalf("deleted account %v still found", a.ID)
+	}
+
+	version := p.Version
+	p = findPerson(t, db, p.ID)
+	if p.AccountID.Valid {
+		t.Fatalf("account ID of person was not reset, got %v", p.AccountID.Int64)
+	}
+
+	if p.Version <= version {
+		t.Fatalf("version of person was not increased when the account was deleted")
+	}
+}
+
+func TestDBAccountPeople(t *testing.T) {
+	testAccountPeople(t, testDB)
+}
+
+func TestMockDBAccountPeople(t *testing.T) {
+	testAccountPeople(t, NewMockDB(20, 5))
+}
+
+func TestAccountMarshal(t *testing.T) {
+	for i, test := range testAccounts {
+		buf := marshal(t, test.a)
+
+		golden := filepath.Join("testdata", "TestAccountMarshal_"+test.name+".golden")
+		if *update {
+			err := ioutil.WriteFile(golden, buf, 0644)
+			if err != nil {
+				t.Fatalf("test %d: update golden file %v failed: %v", i, golden, err)
+			}
+		}
+
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Errorf("test %d: unable to read golden file %v", i, golden)
+			continue
+		}
+		if !bytes.Equal(buf, expected) {
+			t.Errorf("test %d (%v) wrong JSON returned:\nwant:\n%s\ngot:\n%s", i, test.name, expected, buf)
+		}
+	}
+}
+
+func TestAccountUnmarshal(t *testing.T) {
+	for i, test := range testAccounts {
+		golden := filepath.Join("testdata", "TestAccountMarshal_"+test.name+".golden")
+		buf, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Errorf("test %d: unable to read golden file %v", i, golden)
+			continue
+		}
+
+		var a Account
+		unmarshal(t, buf, &a)
+
+		buf2 := marshal(t, a)
+
+		if !bytes.Equal(buf, buf2) {
+			t.Errorf("test %d (%v) wrong JSON returned:\nwant:\n%s\ngot:\n%s", i, test.name, buf, buf2)
+		}
+	}
+}
+
+func TestAccountValidate(t *testing.T) {
+	for i, test := range testAccounts {
+		if err := test.a.Validate(); err != nil {
+			t.Errorf("test %v (%v) failed: testAccount is invalid: %v", test.name, i, err)
+		}
+	}
+
+	a := Account{}
+	if err := a.Validate(); err == nil {
+		t.Errorf("empty account is valid")
+	}
+}
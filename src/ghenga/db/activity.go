@@ -0,0 +1,233 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ActivityDatabase allows handling activities.
+type ActivityDatabase interface {
+	FindActivity(int64) (*Activity, error)
+
+	InsertActivity(*Activity) error
+	ListActivities() ([]*Activity, error)
+	UpdateActivity(*Activity) error
+	DeleteActivity(int64) error
+
+	ListPersonActivities(int64) ([]*Activity, error)
+}
+
+// ActivityTypes contains the valid values for the type of an activity.
+var ActivityTypes = []string{"call", "meeting", "email", "other"}
+
+// Activity is an interaction with a person or an account, e.g. a phone call.
+type Activity struct {
+	ID         int64
+	Type       string
+	Subject    string
+	Body       string
+	OccurredAt time.Time
+	Author     string
+
+	PersonID  sql.NullInt64
+	AccountID sql.NullInt64
+
+	ChangedAt time.Time
+	CreatedAt time.Time
+	Version   int64
+}
+
+// ActivityJSON is the JSON representation of an Activity as returned or
+// consumed by the API.
+type ActivityJSON struct {
+	ID         int64  `json:"id,omitempty"`
+	Type       string `json:"type,omitempty"`
+	Subject    string `json:"subject,omitempty"`
+	Body       string `json:"body,omitempty"`
+	OccurredAt string `json:"occurred_at,omitempty"`
+	Author     string `json:"author,omitempty"`
+
+	PersonID  *int64 `json:"person_id,omitempty"`
+	AccountID *int64 `json:"account_id,omitempty"`
+
+	ChangedAt string `json:"changed_at,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+
+	Version int64 `json:"version"`
+}
+
+// NewActivity returns a new activity record.
+func NewActivity(tpe, subject, author string) *Activity {
+	ts := time.Now()
+	return &Activity{
+		Type:       tpe,
+		Subject:    subject,
+		Author:     author,
+		OccurredAt: ts,
+		CreatedAt:  ts,
+		ChangedAt:  ts,
+	}
+}
+
+// MarshalJSON returns the JSON representation of a.
+func (a Activity) MarshalJSON() ([]byte, error) {
+	ja := ActivityJSON{
+		ID:         a.ID,
+		Type:       a.Type,
+		Subject:    a.Subject,
+		Body:       a.Body,
+		OccurredAt: a.OccurredAt.Format(timeLayout),
+		Author:     a.Author,
+
+		PersonID:  int64Ptr(a.PersonID),
+		AccountID: int64Ptr(a.AccountID),
+
+		ChangedAt: a.ChangedAt.Format(timeLayout),
+		CreatedAt: a.CreatedAt.Format(timeLayout),
+		Version:   a.Version,
+	}
+
+	return json.Marshal(ja)
+}
+
+// UnmarshalJSON returns an activity from JSON.
+func (a *Activity) UnmarshalJSON(data []byte) error {
+	var ja ActivityJSON
+
+	err := json.Unmarshal(data, &ja)
+	if err != nil {
+		return err
+	}
+
+	createdAt, err := time.Parse(timeLayout, ja.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	changedAt, err := time.Parse(timeLayout, ja.ChangedAt)
+	if err != nil {
+		return err
+	}
+
+	*a = Activity{
+		ID:        ja.ID,
+		Author:    ja.Author,
+		CreatedAt: createdAt,
+		ChangedAt: changedAt,
+	}
+
+	return a.Update(ja)
+}
+
+// Validate checks if a is valid and returns an error if not.
+func (a *Activity) Validate() error {
+	valid := false
+	for _, t := range ActivityTypes {
+		if a.Type == t {
+			valid = true
+			break
+		}
+	}
+
+	if !valid {
+		return fmt.Errorf("invalid type %q", a.Type)
+	}
+
+	if a.Author == "" {
+		return errors.New("author is empty")
+	}
+
+	if !a.PersonID.Valid && !a.AccountID.Valid {
+		return errors.New("activity is neither linked to a person nor to an account")
+	}
+
+	if a.OccurredAt.IsZero() || a.CreatedAt.IsZero() || a.ChangedAt.IsZero() {
+		return errors.New("invalid timestamps")
+	}
+
+	return nil
+}
+
+// Update updates a with the fields from other. The author is not changed.
+func (a *Activity) Update(other ActivityJSON) error {
+	a.Type = other.Type
+	a.Subject = other.Subject
+	a.Body = other.Body
+
+	a.OccurredAt = time.Time{}
+	if other.OccurredAt != "" {
+		t, err := time.Parse(timeLayout, other.OccurredAt)
+		if err != nil {
+			return err
+		}
+		a.OccurredAt = t
+	}
+
+	a.PersonID = nullInt64(other.PersonID)
+	a.AccountID = nullInt64(other.AccountID)
+
+	a.Version = other.Version
+
+	return nil
+}
+
+func (a Activity) String() string {
+	return fmt.Sprintf("<Activity[%v] %v (%v)>", a.ID, a.Type, a.Subject)
+}
+
+// FindActivity returns the activity with the given id.
+func (db *Database) FindActivity(id int64) (*Activity, error) {
+	var a Activity
+
+	err := db.dbmap.SelectOne(&a, "SELECT * FROM activities WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// UpdateActivity modifies an existing activity.
+func (db *Database) UpdateActivity(a *Activity) error {
+	_, err := db.dbmap.Update(a)
+	return err
+}
+
+// InsertActivity creates a new activity.
+func (db *Database) InsertActivity(a *Activity) error {
+	return db.dbmap.Insert(a)
+}
+
+// ListActivities returns the list of activities, the most recent first.
+func (db *Database) ListActivities() ([]*Activity, error) {
+	var activities []*Activity
+	err := db.dbmap.Select(&activities, "select * from activities order by occurred_at desc, id desc")
+	return activities, err
+}
+
+// DeleteActivity removes an activity.
+func (db *Database) DeleteActivity(id int64) error {
+	res := db.dbmap.Dbx.MustExec("delete from activities where id = $1", id)
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n != 1 {
+		return errors.New("activity not found")
+	}
+
+	return nil
+}
+
+// ListPersonActivities returns the list of activities linked to the person,
+// the most recent first.
+func (db *Database) ListPersonActivities(id int64) ([]*Activity, error) {
+	var activities []*Activity
+	err := db.dbmap.Select(&activities,
+		"select * from activities where person_id = $1 order by occurred_at desc, id desc", id)
+	return activities, err
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func insertActivity(t *testing.T, db DB, personID int64, subject string, occurred time.Time) *Activity {
+	a := NewActivity("call", subject, "admin")
+	a.PersonID.Int64 = personID
+	a.PersonID.Valid = true
+	a.OccurredAt = occurred
+
+	if err := a.Validate(); err != nil {
+		t.Fatalf("activity %v is invalid: %v", a, err)
+	}
+
+	if err := db.InsertActivity(a); err != nil {
+		t.Fatalf("unable to insert activity %v: %v", a, err)
+	}
+
+	return a
+}
+
+func testActivityPerson(t *testing.T, db DB) {
+	ts := time.Date(2016, 4, 24, 10, 30, 0, 0, time.UTC)
+	a1 := insertActivity(t, db, 7, "first call", ts)
+	a2 := insertActivity(t, db, 7, "second call", ts.Add(time.Hour))
+	insertActivity(t, db, 8, "other call", ts)
+
+	list, err := db.ListPersonActivities(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 {
+		t.Fatalf("wrong number of activities returned, want 2, got %v", len(list))
+	}
+
+	if list[0].ID != a2.ID || list[1].ID != a1.ID {
+		t.Fatalf("wrong order of activities returned: %v", list)
+	}
+
+	a1.Subject = "changed"
+	if err = db.UpdateActivity(a1); err != nil {
+		t.Fatalf("unable to update activity: %v", err)
+	}
+
+	a, err := db.FindActivity(a1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Subject != "changed" || a.Author != "admin" {
+		t.Fatalf("activity was not updated correctly: %v", a)
+	}
+
+	a1.Version = 1000
+	if err = db.UpdateActivity(a1); err == nil {
+		t.Fatalf("update did not fail despite wrong version field")
+	}
+
+	if err = db.DeleteActivity(a2.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = db.FindActivity(a2.ID); err == nil {
+		t.Fatalf("deleted activity %v still found", a2.ID)
+	}
+}
+
+func TestDBActivityPerson(t *testing.T) {
+	testActivityPerson(t, testDB)
+}
+
+func TestMockDBActivityPerson(t *testing.T) {
+	testActivityPerson(t, NewMockDB(20, 5))
+}
+
+func TestActivityValidate(t *testing.T) {
+	a := NewActivity("call", "test", "admin")
+	if err := a.Validate(); err == nil {
+		t.Errorf("activity without person and account is valid")
+	}
+
+	a.AccountID.Int64 = 23
+	a.AccountID.Valid = true
+	if err := a.Validate(); err != nil {
+		t.Errorf("activity is invalid: %v", err)
+	}
+
+	a.Type = "foobar"
+	if err := a.Validate(); err == nil {
+		t.Errorf("activity with invalid type is valid")
+	}
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/jmoiron/modl"
+)
+
+// BatchTx collects the changes which can be made by the operations of a
+// batch. The methods work like the methods of the same name of DB.
+type BatchTx interface {
+	InsertPerson(*Person) error
+	UpdatePerson(*Person) error
+	DeletePerson(int64) error
+	DeletePersonVersion(id, version int64) error
+	InsertUser(*User) error
+}
+
+// BatchOperation is a single operation of a batch, it makes its changes with
+// tx. It must not call methods of the DB running the batch.
+type BatchOperation func(tx BatchTx) error
+
+// BatchDatabase runs batches of changes.
+type BatchDatabase interface {
+	RunBatch(ops []BatchOperation, atomic bool) (errs []error, err error)
+}
+
+// batchTx implements BatchTx for a transaction.
+type batchTx struct {
+	tx *modl.Transaction
+}
+
+// ensure that batchTx implements BatchTx
+var _ BatchTx = batchTx{}
+
+// InsertPerson creates a new person.
+func (b batchTx) InsertPerson(p *Person) error {
+	return b.tx.Insert(p)
+}
+
+// UpdatePerson modifies an existing person, see Database.UpdatePerson.
+func (b batchTx) UpdatePerson(p *Person) error {
+	return updateVersion(b.tx, p, &p.Version, "person")
+}
+
+// DeletePerson removes a person.
+func (b batchTx) DeletePerson(id int64) error {
+	res, err := b.tx.Exec("delete from people where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n != 1 {
+		return errors.New("person not found")
+	}
+
+	return nil
+}
+
+// DeletePersonVersion removes a person if it still has the version, see
+// Database.DeletePersonVersion.
+func (b batchTx) DeletePersonVersion(id, version int64) error {
+	return deleteVersion(b.tx, "people", "person", id, version)
+}
+
+// InsertUser creates a new user.
+func (b batchTx) InsertUser(u *User) error {
+	return b.tx.Insert(u)
+}
+
+// RunBatch runs the operations in order in one transaction, the error
+// returned by each operation is returned in errs. When atomic is true, the
+// first failing operation aborts the batch, errs ends with its error and none
+// of the changes are saved. Otherwise the changes of failing operations are
+// discarded (using a savepoint for each operation) and the changes of all
+// other operations are saved. When the transaction itself fails, err is
+// returned and no changes are saved.
+func (db *Database) RunBatch(ops []BatchOperation, atomic bool) (errs []error, err error) {
+	tx, err := db.dbmap.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range ops {
+		if !atomic {
+			if _, err = tx.Exec("SAVEPOINT batch_operation"); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+
+		opErr := op(batchTx{tx})
+		errs = append(errs, opErr)
+
+		switch {
+		case opErr != nil && atomic:
+			tx.Rollback()
+			return errs, nil
+		case opErr != nil:
+			_, err = tx.Exec("ROLLBACK TO SAVEPOINT batch_operation")
+		case !atomic:
+			_, err = tx.Exec("RELEASE SAVEPOINT batch_operation")
+		}
+
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	return errs, tx.Commit()
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func testRunBatch(t *testing.T, db DB) {
+	p := NewPerson("Batch Person")
+	if err := db.InsertPerson(p); err != nil {
+		t.Fatal(err)
+	}
+
+	errFailed := errors.New("operation failed")
+
+	var inserted []*Person
+	insert := func(name string) BatchOperation {
+		return func(tx BatchTx) error {
+			p := NewPerson(name)
+			inserted = append(inserted, p)
+			return tx.InsertPerson(p)
+		}
+	}
+
+	rename := func(version int64, name string) BatchOperation {
+		person, err := db.FindPerson(p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		person.Version = version
+		person.Name = name
+		return func(tx BatchTx) error {
+			return tx.UpdatePerson(person)
+		}
+	}
+
+	fail := func(tx BatchTx) error {
+		return errFailed
+	}
+
+	// the failing operation rolls back all changes
+	errs, err := db.RunBatch([]BatchOperation{insert("Batch A"), rename(p.Version, "Batch Renamed"), fail, insert("Batch B")}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) != 3 || errs[0] != nil || errs[1] != nil || errs[2] != errFailed {
+		t.Fatalf("atomic batch returned wrong errors %v", errs)
+	}
+
+	if len(inserted) != 1 {
+		t.Fatalf("atomic batch did not stop after the failing operation")
+	}
+
+	if _, err = db.FindPerson(inserted[0].ID); err == nil {
+		t.Errorf("person inserted in aborted batch was saved")
+	}
+
+	if person, _ := db.FindPerson(p.ID); person.Name != "Batch Person" || person.Version != p.Version {
+		t.Errorf("update in aborted batch was saved: %v", person)
+	}
+
+	// only the failing operations are discarded
+	inserted = nil
+	errs, err = db.RunBatch([]BatchOperation{insert("Batch C"), rename(p.Version+5, "Batch Outdated"), fail, rename(p.Version, "Batch Renamed")}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) != 4 || errs[0] != nil || errs[1] != ErrVersionConflict || errs[2] != errFailed || errs[3] != nil {
+		t.Fatalf("batch returned wrong errors %v", errs)
+	}
+
+	if _, err = db.FindPerson(inserted[0].ID); err != nil {
+		t.Errorf("person inserted in batch was not saved: %v", err)
+	}
+
+	person, err := db.FindPerson(p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if person.Name != "Batch Renamed" || person.Version != p.Version+1 {
+		t.Errorf("update in batch was not saved: %v", person)
+	}
+
+	// the version is checked while deleting
+	errs, err = db.RunBatch([]BatchOperation{
+		func(tx BatchTx) error { return tx.DeletePersonVersion(p.ID, p.Version) },
+	}, false)
+	if err != nil || errs[0] != ErrVersionConflict {
+		t.Fatalf("deleting an outdated version returned %v, %v", errs, err)
+	}
+
+	errs, err = db.RunBatch([]BatchOperation{
+		func(tx BatchTx) error { return tx.DeletePerson(inserted[0].ID) },
+		func(tx BatchTx) error { return tx.DeletePersonVersion(p.ID, person.Version) },
+	}, true)
+	if err != nil || errs[0] != nil || errs[1] != nil {
+		t.Fatalf("deleting people failed: %v, %v", errs, err)
+	}
+
+	if _, err = db.FindPerson(p.ID); err == nil {
+		t.Errorf("person deleted in batch still exists")
+	}
+}
+
+func TestDBRunBatch(t *testing.T) {
+	testRunBatch(t, testDB)
+}
+
+func TestMockDBRunBatch(t *testing.T) {
+	testRunBatch(t, NewMockDB(20, 5))
+}
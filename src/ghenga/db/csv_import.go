@@ -0,0 +1,454 @@
+package db
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CSVMapping maps the columns of a CSV file (by the name in the header line)
+// to the fields of a person. Valid fields are:
+//
+//	name, title, department, comment
+//	street, postal_code, state, city, country   (the parts of the address)
+//	phone, phone:<type>                         (phone numbers, default type "work")
+//	email, email:<type>                         (email addresses, default type "work")
+//	tags                                        (tags)
+//	custom:<name>                               (the value of a custom field)
+//
+// When several columns are mapped to the same text field, the values are
+// joined with a space (e.g. first and last name). Columns for phone numbers,
+// email addresses and tags may contain several values separated by commas.
+// A single quote before a value starting with one of the characters =+-@ is
+// removed, it is added by spreadsheet programs (and ExportPeople) so that the
+// value is not interpreted as a formula.
+type CSVMapping map[string]string
+
+// ParseCSVMapping returns the mapping for a list of specifications in the
+// form `column=field`.
+func ParseCSVMapping(specs []string) (CSVMapping, error) {
+	m := make(CSVMapping, len(specs))
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid mapping %q, expected column=field", spec)
+		}
+
+		column, field := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+		if column == "" || field == "" {
+			return nil, fmt.Errorf("invalid mapping %q, expected column=field", spec)
+		}
+
+		m[column] = field
+	}
+
+	return m, nil
+}
+
+// CSVImportOptions configures ImportPeopleCSV.
+type CSVImportOptions struct {
+	// Mapping selects the columns which are imported. If it is empty, the
+	// columns which are named like a field are imported.
+	Mapping CSVMapping
+
+	// Separator is the character separating the columns, the default is a
+	// comma.
+	Separator rune
+
+	// DryRun only checks the rows, nothing is saved.
+	DryRun bool
+}
+
+// CSVRowError describes a row of a CSV file which could not be imported.
+type CSVRowError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// CSVImportResult summarizes the import of a CSV file.
+type CSVImportResult struct {
+	Rows     int           `json:"rows"`
+	Valid    int           `json:"valid"`
+	Imported int           `json:"imported"`
+	DryRun   bool          `json:"dry_run"`
+	Errors   []CSVRowError `json:"errors"`
+}
+
+// CSVError is returned by ImportPeopleCSV when the file cannot be read as CSV
+// or the mapping does not match the file.
+type CSVError struct {
+	Err error
+}
+
+func (e CSVError) Error() string {
+	return "invalid CSV file: " + e.Err.Error()
+}
+
+// personCSVFields are the text fields of a person which can be imported from
+// CSV columns.
+var personCSVFields = map[string]func(jp *PersonJSON) *string{
+	"name":        func(jp *PersonJSON) *string { return &jp.Name },
+	"title":       func(jp *PersonJSON) *string { return &jp.Title },
+	"department":  func(jp *PersonJSON) *string { return &jp.Department },
+	"street":      func(jp *PersonJSON) *string { return &jp.Address.Street },
+	"postal_code": func(jp *PersonJSON) *string { return &jp.Address.PostalCode },
+	"state":       func(jp *PersonJSON) *string { return &jp.Address.State },
+	"city":        func(jp *PersonJSON) *string { return &jp.Address.City },
+	"country":     func(jp *PersonJSON) *string { return &jp.Address.Country },
+	"comment":     func(jp *PersonJSON) *string { return &jp.Comment },
+}
+
+// csvColumn is a column of a CSV file which is imported into a field.
+type csvColumn struct {
+	index int
+	set   func(jp *PersonJSON, value string) error
+}
+
+// csvFieldSetter returns the function which sets the field to the (non-empty)
+// value of a column. The definitions of the custom fields are needed to
+// convert the values of custom fields.
+func csvFieldSetter(field string, fields []*CustomField) (func(*PersonJSON, string) error, error) {
+	if text, ok := personCSVFields[field]; ok {
+		return func(jp *PersonJSON, v string) error {
+			s := text(jp)
+			if *s != "" {
+				*s += " "
+			}
+			*s += v
+			return nil
+		}, nil
+	}
+
+	kind, arg := field, ""
+	if i := strings.Index(field, ":"); i >= 0 {
+		kind, arg = field[:i], field[i+1:]
+	}
+
+	switch kind {
+	case "phone":
+		if arg == "" {
+			arg = "work"
+		}
+
+		return func(jp *PersonJSON, v string) error {
+			for _, num := range csvList(v) {
+				jp.PhoneNumbers = append(jp.PhoneNumbers, PhoneNumberJSON{Type: arg, Number: num})
+			}
+			return nil
+		}, nil
+
+	case "email":
+		if arg == "" {
+			arg = "work"
+		}
+
+		return func(jp *PersonJSON, v string) error {
+			for _, addr := range csvList(v) {
+				jp.EmailAddresses = append(jp.EmailAddresses, EmailAddressJSON{Type: arg, Address: addr})
+			}
+			return nil
+		}, nil
+
+	case "tags":
+		if arg != "" {
+			break
+		}
+
+		return func(jp *PersonJSON, v string) error {
+			jp.Tags = append(jp.Tags, csvList(v)...)
+			return nil
+		}, nil
+
+	case "custom":
+		for _, f := range fields {
+			if f.Name == arg {
+				return csvCustomSetter(f), nil
+			}
+		}
+
+		return nil, fmt.Errorf("unknown custom field %q", arg)
+	}
+
+	return nil, fmt.Errorf("unknown field %q", field)
+}
+
+// csvList splits a value containing several values separated by commas,
+// empty values are skipped.
+func csvList(v string) []string {
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// csvValue returns the value of a cell without surrounding white space and
+// without the single quote which protects formula characters.
+func csvValue(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) > 1 && v[0] == '\'' && strings.IndexByte(csvFormulaChars, v[1]) >= 0 {
+		return v[1:]
+	}
+
+	return v
+}
+
+// csvCustomSetter returns the function which converts the value of a column
+// according to the type of the custom field and sets it.
+func csvCustomSetter(f *CustomField) func(*PersonJSON, string) error {
+	return func(jp *PersonJSON, v string) error {
+		var value interface{} = v
+
+		switch f.Type {
+		case "number":
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("field %v: value %q is not a number", f.Name, v)
+			}
+			value = n
+		case "bool":
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("field %v: value %q is not a boolean", f.Name, v)
+			}
+			value = b
+		}
+
+		if jp.Custom == nil {
+			jp.Custom = make(map[string]interface{})
+		}
+		jp.Custom[f.Name] = value
+		return nil
+	}
+}
+
+// csvColumns returns the columns to import for the header line of a CSV file.
+func csvColumns(header []string, m CSVMapping, fields []*CustomField) ([]csvColumn, error) {
+	auto := len(m) == 0
+	found := make(map[string]bool, len(m))
+
+	var columns []csvColumn
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if i == 0 {
+			// remove the byte order mark written by some spreadsheet programs
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+
+		field, ok := m[name]
+		if auto {
+			field, ok = strings.ToLower(name), true
+		}
+
+		if !ok {
+			continue
+		}
+
+		set, err := csvFieldSetter(field, fields)
+		if err != nil && auto {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %v", name, err)
+		}
+
+		found[name] = true
+		columns = append(columns, csvColumn{index: i, set: set})
+	}
+
+	for name := range m {
+		if !found[name] {
+			return nil, fmt.Errorf("column %q not found", name)
+		}
+	}
+
+	if len(columns) == 0 {
+		return nil, errors.New("no columns to import")
+	}
+
+	return columns, nil
+}
+
+// csvPerson returns the person for a row of a CSV file and checks it.
+func csvPerson(db DB, record []string, columns []csvColumn, fields []*CustomField) (*Person, error) {
+	var jp PersonJSON
+	for _, col := range columns {
+		if col.index >= len(record) {
+			continue
+		}
+
+		v := csvValue(record[col.index])
+		if v == "" {
+			continue
+		}
+
+		if err := col.set(&jp, v); err != nil {
+			return nil, err
+		}
+	}
+
+	p := NewPerson("")
+	p.Update(jp)
+
+	if err := p.Validate(fields); err != nil {
+		return nil, err
+	}
+
+	for _, tag := range p.Tags {
+		if _, err := db.FindTagName(tag); err != nil {
+			return nil, fmt.Errorf("tag %q not found", tag)
+		}
+	}
+
+	return p, nil
+}
+
+// csvReadError returns a CSVError for syntax errors in the file, other errors
+// (e.g. from the underlying reader) are returned as they are.
+func csvReadError(err error) error {
+	if _, ok := err.(*csv.ParseError); ok {
+		return CSVError{err}
+	}
+
+	return err
+}
+
+// csvNewlines returns the number of newlines within the fields of record.
+func csvNewlines(record []string) (n int) {
+	for _, field := range record {
+		n += strings.Count(field, "\n")
+	}
+
+	return n
+}
+
+// csvLineReader passes the data to the CSV reader one line at a time and
+// counts the lines. After a record has been read, line is the number of its
+// last line. The lines cannot be counted from the records, because
+// encoding/csv skips empty lines.
+type csvLineReader struct {
+	rd   *bufio.Reader
+	buf  []byte
+	err  error
+	line int
+}
+
+func newCSVLineReader(rd io.Reader) *csvLineReader {
+	return &csvLineReader{rd: bufio.NewReader(rd)}
+}
+
+// Read passes at most the rest of the current line to the CSV reader.
+func (r *csvLineReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		r.buf, r.err = r.rd.ReadBytes('\n')
+		if len(r.buf) == 0 {
+			return 0, r.err
+		}
+
+		r.line++
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// ImportPeopleCSV reads people from a CSV file with a header line and saves
+// them in db. Each row is checked with Person.Validate, the rows which are
+// not valid are listed in the result. All valid rows are saved in a single
+// transaction (unless opts.DryRun is set), if saving one of them fails none
+// are saved. A CSVError is returned if the file cannot be parsed or the
+// mapping is invalid.
+func ImportPeopleCSV(db DB, rd io.Reader, opts CSVImportOptions) (*CSVImportResult, error) {
+	fields, err := db.ListCustomFields()
+	if err != nil {
+		return nil, err
+	}
+
+	lr := newCSVLineReader(rd)
+	r := csv.NewReader(lr)
+	r.FieldsPerRecord = -1
+	if opts.Separator != 0 {
+		r.Comma = opts.Separator
+	}
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, CSVError{errors.New("file is empty")}
+	}
+	if err != nil {
+		return nil, csvReadError(err)
+	}
+
+	columns, err := csvColumns(header, opts.Mapping, fields)
+	if err != nil {
+		return nil, CSVError{err}
+	}
+
+	res := &CSVImportResult{DryRun: opts.DryRun, Errors: []CSVRowError{}}
+
+	var people []*Person
+	var lines []int
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, csvReadError(err)
+		}
+
+		// fields may contain newlines
+		start := lr.line - csvNewlines(record)
+		res.Rows++
+
+		p, err := csvPerson(db, record, columns, fields)
+		if err != nil {
+			res.Errors = append(res.Errors, CSVRowError{Line: start, Message: err.Error()})
+			continue
+		}
+
+		people = append(people, p)
+		lines = append(lines, start)
+	}
+
+	res.Valid = len(people)
+	if opts.DryRun || len(people) == 0 {
+		return res, nil
+	}
+
+	ops := make([]BatchOperation, 0, len(people))
+	for _, p := range people {
+		p := p
+		ops = append(ops, func(tx BatchTx) error {
+			return tx.InsertPerson(p)
+		})
+	}
+
+	errs, err := db.RunBatch(ops, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			res.Errors = append(res.Errors, CSVRowError{Line: lines[i], Message: err.Error()})
+			return res, nil
+		}
+	}
+
+	res.Imported = len(people)
+	return res, nil
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+var parseCSVMappingTests = []struct {
+	specs   []string
+	mapping CSVMapping
+}{
+	{[]string{"Name=name"}, CSVMapping{"Name": "name"}},
+	{[]string{"Mobile = phone:mobile", "E-Mail=email"}, CSVMapping{"Mobile": "phone:mobile", "E-Mail": "email"}},
+	{[]string{"a=b=name"}, CSVMapping{"a=b": "name"}},
+	{[]string{"name"}, nil},
+	{[]string{"=name"}, nil},
+	{[]string{"Name="}, nil},
+}
+
+func TestParseCSVMapping(t *testing.T) {
+	for i, test := range parseCSVMappingTests {
+		m, err := ParseCSVMapping(test.specs)
+		if test.mapping == nil {
+			if err == nil {
+				t.Errorf("test %d: invalid mapping %v accepted", i, test.specs)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("test %d: unexpected error %v", i, err)
+			continue
+		}
+
+		if len(m) != len(test.mapping) {
+			t.Errorf("test %d: wrong mapping, want %v, got %v", i, test.mapping, m)
+			continue
+		}
+
+		for column, field := range test.mapping {
+			if m[column] != field {
+				t.Errorf("test %d: wrong mapping, want %v, got %v", i, test.mapping, m)
+			}
+		}
+	}
+}
+
+const testImportCSV = `Vorname;Nachname;Mobil;E-Mail;Stadt;Tags;Punkte
+Max;Mustermann;0171 123456;csvimport@example.com;Köln;csvimport;23
+
+Erika;Muster;;invalid;Berlin;;
+;;;;;;
+Anna;"Test
+Person";;;;unknown-tag;
+Bob;Beispiel;;;;;many
+`
+
+func testImportPeopleCSV(t *testing.T, db DB) {
+	tag := NewTag("csvimport")
+	if err := db.InsertTag(tag); err != nil {
+		t.Fatal(err)
+	}
+	defer db.DeleteTag(tag.ID)
+
+	field := NewCustomField("csvimport_points", "number")
+	if err := db.InsertCustomField(field); err != nil {
+		t.Fatal(err)
+	}
+	defer db.DeleteCustomField(field.ID)
+
+	mapping, err := ParseCSVMapping([]string{
+		"Vorname=name", "Nachname=name", "Mobil=phone:mobile", "E-Mail=email",
+		"Stadt=city", "Tags=tags", "Punkte=custom:csvimport_points",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := CSVImportOptions{Mapping: mapping, Separator: ';'}
+
+	for _, dryRun := range []bool{true, false} {
+		opts.DryRun = dryRun
+
+		res, err := ImportPeopleCSV(db, strings.NewReader(testImportCSV), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		imported := 1
+		if dryRun {
+			imported = 0
+		}
+
+		if res.Rows != 5 || res.Valid != 1 || res.Imported != imported || res.DryRun != dryRun {
+			t.Errorf("dry run %v: wrong result %+v", dryRun, res)
+		}
+
+		var lines []int
+		for _, e := range res.Errors {
+			lines = append(lines, e.Line)
+		}
+
+		if len(lines) != 4 || lines[0] != 4 || lines[1] != 5 || lines[2] != 6 || lines[3] != 8 {
+			t.Errorf("dry run %v: wrong errors %v", dryRun, res.Errors)
+		}
+
+		people, err := db.FindPeopleByEmail("csvimport@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(people) != imported {
+			t.Fatalf("dry run %v: found %d imported people, want %d", dryRun, len(people), imported)
+		}
+	}
+
+	people, err := db.FindPeopleByEmail("csvimport@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := people[0]
+	defer db.DeletePerson(p.ID)
+
+	if p.Name != "Max Mustermann" || p.City != "Köln" {
+		t.Errorf("imported person has wrong name or city: %v", p)
+	}
+
+	if len(p.PhoneNumbers) != 1 || p.PhoneNumbers[0].Type != "mobile" || p.PhoneNumbers[0].Number != "0171 123456" {
+		t.Errorf("imported person has wrong phone numbers: %v", p.PhoneNumbers)
+	}
+
+	if len(p.Tags) != 1 || p.Tags[0] != "csvimport" {
+		t.Errorf("imported person has wrong tags: %v", p.Tags)
+	}
+
+	if p.Custom["csvimport_points"] != float64(23) {
+		t.Errorf("imported person has wrong custom values: %v", p.Custom)
+	}
+}
+
+func TestDBImportPeopleCSV(t *testing.T) {
+	testImportPeopleCSV(t, testDB)
+}
+
+func TestMockDBImportPeopleCSV(t *testing.T) {
+	testImportPeopleCSV(t, NewMockDB(20, 5))
+}
+
+var invalidImportCSVTests = []struct {
+	csv     string
+	mapping []string
+}{
+	{"", nil},
+	{"foo,bar\nx,y\n", nil},
+	{"name,city\nx,y\n", []string{"Name=name"}},
+	{"name,city\nx,y\n", []string{"name=nickname"}},
+	{"name,city\nx,y\n", []string{"name=custom:unknown"}},
+	{"name,city\n\"x,y\n", nil},
+}
+
+func TestImportPeopleCSVInvalid(t *testing.T) {
+	db := NewMockDB(5, 1)
+
+	for i, test := range invalidImportCSVTests {
+		mapping, err := ParseCSVMapping(test.mapping)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = ImportPeopleCSV(db, strings.NewReader(test.csv), CSVImportOptions{Mapping: mapping})
+		if err == nil {
+			t.Errorf("test %d: invalid file was accepted", i)
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CustomFieldDatabase allows handling the definitions of custom fields.
+type CustomFieldDatabase interface {
+	FindCustomField(int64) (*CustomField, error)
+
+	InsertCustomField(*CustomField) error
+	ListCustomFields() ([]*CustomField, error)
+	UpdateCustomField(*CustomField) error
+	DeleteCustomField(int64) error
+}
+
+// CustomFieldTypes contains the valid values for the type of a custom field.
+var CustomFieldTypes = []string{"text", "number", "date", "bool", "enum"}
+
+// customFieldName is the pattern for valid names of custom fields.
+var customFieldName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// CustomField defines an additional attribute for people. The values are
+// stored in Person.Custom.
+type CustomField struct {
+	ID       int64
+	Name     string
+	Type     string
+	Required bool
+
+	// Options lists the allowed values for fields of type enum.
+	Options StringList
+
+	ChangedAt time.Time
+	CreatedAt time.Time
+	Version   int64
+}
+
+// CustomFieldJSON is the JSON representation of a CustomField as returned or
+// consumed by the API.
+type CustomFieldJSON struct {
+	ID       int64    `json:"id,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Type     string   `json:"type,omitempty"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options"`
+
+	ChangedAt string `json:"changed_at,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+
+	Version int64 `json:"version"`
+}
+
+// StringList is a list of strings which is stored as a JSON array in the
+// database.
+type StringList []string
+
+// Value returns the JSON representation of l.
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+
+	buf, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(buf), nil
+}
+
+// Scan decodes the list from the JSON representation.
+func (l *StringList) Scan(src interface{}) error {
+	return scanJSON(src, l)
+}
+
+// CustomValues holds the values of custom fields, indexed by the name of the
+// field. The values are stored as a JSON object in the database.
+type CustomValues map[string]interface{}
+
+// Value returns the JSON representation of v.
+func (v CustomValues) Value() (driver.Value, error) {
+	if v == nil {
+		return "{}", nil
+	}
+
+	buf, err := json.Marshal(map[string]interface{}(v))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(buf), nil
+}
+
+// Scan decodes the values from the JSON representation.
+func (v *CustomValues) Scan(src interface{}) error {
+	return scanJSON(src, v)
+}
+
+// scanJSON decodes a JSON document as returned by the database driver into
+// target.
+func scanJSON(src interface{}, target interface{}) error {
+	switch data := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(data, target)
+	case string:
+		return json.Unmarshal([]byte(data), target)
+	}
+
+	return fmt.Errorf("unable to decode JSON from %T", src)
+}
+
+// NewCustomField returns a new custom field definition.
+func NewCustomField(name, tpe string) *CustomField {
+	ts := time.Now()
+	return &CustomField{
+		Name:      name,
+		Type:      tpe,
+		CreatedAt: ts,
+		ChangedAt: ts,
+	}
+}
+
+// MarshalJSON returns the JSON representation of f.
+func (f CustomField) MarshalJSON() ([]byte, error) {
+	jf := CustomFieldJSON{
+		ID:       f.ID,
+		Name:     f.Name,
+		Type:     f.Type,
+		Required: f.Required,
+		Options:  f.Options,
+
+		ChangedAt: f.ChangedAt.Format(timeLayout),
+		CreatedAt: f.CreatedAt.Format(timeLayout),
+		Version:   f.Version,
+	}
+
+	if jf.Options == nil {
+		jf.Options = []string{}
+	}
+
+	return json.Marshal(jf)
+}
+
+// UnmarshalJSON returns a custom field from JSON.
+func (f *CustomField) UnmarshalJSON(data []byte) error {
+	var jf CustomFieldJSON
+
+	err := json.Unmarshal(data, &jf)
+	if err != nil {
+		return err
+	}
+
+	createdAt, err := time.Parse(timeLayout, jf.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	changedAt, err := time.Parse(timeLayout, jf.ChangedAt)
+	if err != nil {
+		return err
+	}
+
+	*f = CustomField{
+		ID:        jf.ID,
+		CreatedAt: createdAt,
+		ChangedAt: changedAt,
+	}
+
+	f.Update(jf)
+	return nil
+}
+
+// Validate checks if f is valid and returns an error if not.
+func (f *CustomField) Validate() error {
+	if !customFieldName.MatchString(f.Name) {
+		return fmt.Errorf("invalid name %q", f.Name)
+	}
+
+	valid := false
+	for _, t := range CustomFieldTypes {
+		if f.Type == t {
+			valid = true
+			break
+		}
+	}
+
+	if !valid {
+		return fmt.Errorf("invalid type %q", f.Type)
+	}
+
+	if f.Type == "enum" && len(f.Options) == 0 {
+		return errors.New("no options for enum field")
+	}
+
+	if f.Type != "enum" && len(f.Options) > 0 {
+		return fmt.Errorf("options are not allowed for type %q", f.Type)
+	}
+
+	if f.CreatedAt.IsZero() || f.ChangedAt.IsZero() {
+		return errors.New("invalid timestamps")
+	}
+
+	return nil
+}
+
+// Update updates f with the fields from other.
+func (f *CustomField) Update(other CustomFieldJSON) {
+	f.Name = strings.TrimSpace(other.Name)
+	f.Type = other.Type
+	f.Required = other.Required
+	f.Options = nil
+	for _, opt := range other.Options {
+		f.Options = append(f.Options, opt)
+	}
+	f.Version = other.Version
+}
+
+// Check returns an error if value is not valid for the field. The value is
+// expected to be decoded from JSON, so numbers are float64.
+func (f *CustomField) Check(value interface{}) error {
+	if value == nil {
+		if f.Required {
+			return fmt.Errorf("field %v is required", f.Name)
+		}
+		return nil
+	}
+
+	switch f.Type {
+	case "text":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("field %v: value is not a string", f.Name)
+		}
+
+		if s == "" && f.Required {
+			return fmt.Errorf("field %v is required", f.Name)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("field %v: value is not a number", f.Name)
+		}
+	case "date":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("field %v: value is not a date", f.Name)
+		}
+
+		if _, err := time.Parse(dateLayout, s); err != nil {
+			return fmt.Errorf("field %v: value is not a date", f.Name)
+		}
+	case "bool":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("field %v: value is not a boolean", f.Name)
+		}
+	case "enum":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("field %v: value is not a string", f.Name)
+		}
+
+		for _, opt := range f.Options {
+			if s == opt {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("field %v: invalid value %q", f.Name, s)
+	default:
+		return fmt.Errorf("field %v has invalid type %q", f.Name, f.Type)
+	}
+
+	return nil
+}
+
+// Validate checks the values against the definitions of the custom fields.
+// Values for undefined fields are not allowed.
+func (v CustomValues) Validate(fields []*CustomField) error {
+	defined := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		defined[f.Name] = true
+
+		if err := f.Check(v[f.Name]); err != nil {
+			return err
+		}
+	}
+
+	for name := range v {
+		if !defined[name] {
+			return fmt.Errorf("unknown custom field %q", name)
+		}
+	}
+
+	return nil
+}
+
+func (f CustomField) String() string {
+	return fmt.Sprintf("<CustomField[%v] %v (%v)>", f.ID, f.Name, f.Type)
+}
+
+// FindCustomField returns the custom field with the given id.
+func (db *Database) FindCustomField(id int64) (*CustomField, error) {
+	var f CustomField
+
+	err := db.dbmap.SelectOne(&f, "SELECT * FROM custom_fields WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+// UpdateCustomField modifies an existing custom field. When the field is
+// renamed, the values stored for people are renamed as well and their version
+// is increased.
+func (db *Database) UpdateCustomField(f *CustomField) error {
+	tx, err := db.dbmap.Begin()
+	if err != nil {
+		return err
+	}
+
+	var oldName string
+	err = tx.SelectOne(&oldName, "SELECT name FROM custom_fields WHERE id = $1", f.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.Update(f); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if oldName != f.Name {
+		_, err = tx.Exec(`UPDATE people SET custom = (custom - $1::text) || jsonb_build_object($2::text, custom->$1::text),
+			version = version + 1 WHERE custom ? $1::text`, oldName, f.Name)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// InsertCustomField creates a new custom field.
+func (db *Database) InsertCustomField(f *CustomField) error {
+	return db.dbmap.Insert(f)
+}
+
+// ListCustomFields returns the list of custom fields, ordered by name.
+func (db *Database) ListCustomFields() ([]*CustomField, error) {
+	var fields []*CustomField
+	err := db.dbmap.Select(&fields, "select * from custom_fields order by name")
+	return fields, err
+}
+
+// DeleteCustomField removes a custom field. The values stored for people are
+// removed as well and their version is increased.
+func (db *Database) DeleteCustomField(id int64) error {
+	tx, err := db.dbmap.Begin()
+	if err != nil {
+		return err
+	}
+
+	var name string
+	err = tx.SelectOne(&name, "SELECT name FROM custom_fields WHERE id = $1", id)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return errors.New("custom field not found")
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	res, err := tx.Exec("DELETE FROM custom_fields WHERE id = $1", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if n != 1 {
+		tx.Rollback()
+		return errors.New("custom field not found")
+	}
+
+	_, err = tx.Exec("UPDATE people SET custom = custom - $1::text, version = version + 1 WHERE custom ? $1::text", name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,155 @@
+package db
+
+import "testing"
+
+var testCustomFields = []*CustomField{
+	{Name: "customer_number", Type: "text", Required: true},
+	{Name: "employees", Type: "number"},
+	{Name: "contract_end", Type: "date"},
+	{Name: "newsletter", Type: "bool"},
+	{Name: "industry", Type: "enum", Options: StringList{"it", "retail"}},
+}
+
+var customValuesTests = []struct {
+	values CustomValues
+	valid  bool
+}{
+	{CustomValues{"customer_number": "K-23"}, true},
+	{CustomValues{
+		"customer_number": "K-23",
+		"employees":       float64(12),
+		"contract_end":    "2016-12-31",
+		"newsletter":      true,
+		"industry":        "it",
+	}, true},
+	{nil, false},
+	{CustomValues{"customer_number": ""}, false},
+	{CustomValues{"customer_number": 23.0}, false},
+	{CustomValues{"customer_number": "K-23", "employees": "12"}, false},
+	{CustomValues{"customer_number": "K-23", "contract_end": "31.12.2016"}, false},
+	{CustomValues{"customer_number": "K-23", "newsletter": "yes"}, false},
+	{CustomValues{"customer_number": "K-23", "industry": "banking"}, false},
+	{CustomValues{"customer_number": "K-23", "unknown": "foo"}, false},
+}
+
+func TestCustomValuesValidate(t *testing.T) {
+	for i, test := range customValuesTests {
+		err := test.values.Validate(testCustomFields)
+		if test.valid && err != nil {
+			t.Errorf("test %d: values %v should be valid but are invalid: %v", i, test.values, err)
+		}
+
+		if !test.valid && err == nil {
+			t.Errorf("test %d: values %v should be invalid but are valid", i, test.values)
+		}
+	}
+}
+
+var customFieldValidateTests = []struct {
+	f     CustomField
+	valid bool
+}{
+	{CustomField{Name: "industry", Type: "enum", Options: StringList{"it"}}, true},
+	{CustomField{Name: "customer_number2", Type: "text"}, true},
+	{CustomField{Name: "Customer Number", Type: "text"}, false},
+	{CustomField{Name: "", Type: "text"}, false},
+	{CustomField{Name: "foo", Type: "list"}, false},
+	{CustomField{Name: "industry", Type: "enum"}, false},
+	{CustomField{Name: "foo", Type: "text", Options: StringList{"bar"}}, false},
+}
+
+func TestCustomFieldValidate(t *testing.T) {
+	for i, test := range customFieldValidateTests {
+		f := NewCustomField(test.f.Name, test.f.Type)
+		f.Options = test.f.Options
+
+		err := f.Validate()
+		if test.valid && err != nil {
+			t.Errorf("test %d: field %v should be valid but is invalid: %v", i, f, err)
+		}
+
+		if !test.valid && err == nil {
+			t.Errorf("test %d: field %v should be invalid but is valid", i, f)
+		}
+	}
+}
+
+func testCustomFieldValues(t *testing.T, db DB) {
+	f := NewCustomField("cftest_number", "text")
+	if err := db.InsertCustomField(f); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.InsertCustomField(NewCustomField("cftest_number", "text")); err == nil {
+		t.Fatalf("inserting a custom field with a duplicate name did not fail")
+	}
+
+	p := NewPerson("Custom Field Test")
+	p.Custom = CustomValues{"cftest_number": "K-23"}
+	if err := db.InsertPerson(p); err != nil {
+		t.Fatal(err)
+	}
+
+	p2, err := db.FindPerson(p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p2.Custom["cftest_number"] != "K-23" {
+		t.Fatalf("custom value not found, got %v", p2.Custom)
+	}
+
+	// renaming the field renames the values
+	f.Name = "cftest_customer"
+	if err = db.UpdateCustomField(f); err != nil {
+		t.Fatal(err)
+	}
+
+	p2, err = db.FindPerson(p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p2.Custom) != 1 || p2.Custom["cftest_customer"] != "K-23" {
+		t.Fatalf("renamed custom value not found, got %v", p2.Custom)
+	}
+
+	if p2.Version <= p.Version {
+		t.Fatalf("version of person was not increased when the field was renamed")
+	}
+
+	f.Version = 1000
+	if err = db.UpdateCustomField(f); err == nil {
+		t.Fatalf("update did not fail despite wrong version field")
+	}
+
+	// removing the field removes the values
+	if err = db.DeleteCustomField(f.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	p2, err = db.FindPerson(p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p2.Custom) != 0 {
+		t.Fatalf("custom value of deleted field still present: %v", p2.Custom)
+	}
+
+	if p2.Version <= p.Version+1 {
+		t.Fatalf("version of person was not increased when the field was deleted")
+	}
+
+	if err = db.DeletePerson(p.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBCustomFieldValues(t *testing.T) {
+	testCustomFieldValues(t, testDB)
+}
+
+func TestMockDBCustomFieldValues(t *testing.T) {
+	testCustomFieldValues(t, NewMockDB(20, 5))
+}
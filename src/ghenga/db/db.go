@@ -3,6 +3,7 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -54,6 +55,16 @@ func configDBMap(db *sql.DB) (*modl.DbMap, error) {
 	dbmap := modl.NewDbMap(db, modl.PostgresDialect{})
 	dbmap.AddTableWithName(Person{}, "people").SetKeys(true, "id")
 	dbmap.AddTableWithName(PhoneNumber{}, "phone_numbers").SetKeys(true, "id")
+	dbmap.AddTableWithName(EmailAddress{}, "email_addresses").SetKeys(true, "id")
+	dbmap.AddTableWithName(Account{}, "accounts").SetKeys(true, "id")
+	dbmap.AddTableWithName(AccountPhoneNumber{}, "account_phone_numbers").SetKeys(true, "id")
+	dbmap.AddTableWithName(Activity{}, "activities").SetKeys(true, "id")
+	dbmap.AddTableWithName(Task{}, "tasks").SetKeys(true, "id")
+	dbmap.AddTableWithName(Event{}, "events").SetKeys(true, "id")
+	dbmap.AddTableWithName(CalendarToken{}, "calendar_tokens").SetKeys(false, "token")
+	dbmap.AddTableWithName(Tag{}, "tags").SetKeys(true, "id")
+	dbmap.AddTableWithName(CustomField{}, "custom_fields").SetKeys(true, "id")
+	dbmap.AddTableWithName(SavedSearch{}, "saved_searches").SetKeys(true, "id")
 	dbmap.AddTableWithName(User{}, "users").SetKeys(true, "id")
 	dbmap.AddTableWithName(Session{}, "sessions").SetKeys(false, "token")
 
@@ -91,7 +102,8 @@ func Open(dataSource string) (*Database, error) {
 }
 
 // migrateDB applies migrations according to the files in the subdir
-// "migrations/".
+// "migrations/". Afterwards, missing phonetic codes for people and normalized
+// phone numbers are computed.
 func migrateDB(db *modl.DbMap) error {
 	dir, err := findMigrationsDir()
 	if err != nil {
@@ -101,10 +113,104 @@ func migrateDB(db *modl.DbMap) error {
 	src := &migrate.FileMigrationSource{Dir: dir}
 
 	_, err = migrate.Exec(db.Db, dialect, src, migrate.Up)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if err = refreshPhoneticCodes(db); err != nil {
+		return err
+	}
+
+	return refreshNormalizedNumbers(db)
 }
 
 // Close closes the connection to the underlying database.
 func (db *Database) Close() error {
 	return db.dbmap.Db.Close()
 }
+
+// ErrVersionConflict is returned by updates when the version of the entity in
+// the database does not match the version of the entity to save, because
+// someone else has modified it in the meantime.
+var ErrVersionConflict = errors.New("version conflict")
+
+// updateVersioned updates the entity v, whose field Version is passed in
+// version, in a transaction together with the changes done by its hooks (see
+// updateVersion).
+func (db *Database) updateVersioned(v interface{}, version *int64, name string) error {
+	tx, err := db.dbmap.Begin()
+	if err != nil {
+		return err
+	}
+
+	oldVersion := *version
+	if err = updateVersion(tx, v, version, name); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		*version = oldVersion
+		return err
+	}
+
+	return nil
+}
+
+// updateVersion updates the entity v, whose field Version is passed in
+// version. The version is checked in the UPDATE statement itself, so
+// concurrent updates of the same version cannot both succeed,
+// ErrVersionConflict is returned for the loser. When the entity does not
+// exist, an error "<name> not found" is returned.
+func updateVersion(e modl.SqlExecutor, v interface{}, version *int64, name string) error {
+	oldVersion := *version
+
+	_, err := e.Update(v)
+	if err == nil {
+		return nil
+	}
+
+	// modl has already increased the version if the UPDATE statement succeeded
+	*version = oldVersion
+
+	if e, ok := err.(modl.OptimisticLockError); ok && e.RowExists {
+		return ErrVersionConflict
+	}
+
+	if _, ok := err.(modl.OptimisticLockError); ok || err == sql.ErrNoRows {
+		return fmt.Errorf("%s not found", name)
+	}
+
+	return err
+}
+
+// deleteVersion removes the entity with the ID from the table, but only if
+// it still has the given version. Otherwise, ErrVersionConflict is returned.
+// When the entity does not exist, an error "<name> not found" is returned.
+func deleteVersion(e modl.SqlExecutor, table, name string, id, version int64) error {
+	res, err := e.Exec("DELETE FROM "+table+" WHERE id = $1 AND version = $2", id, version)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 1 {
+		return nil
+	}
+
+	var ids []int64
+	err = e.Select(&ids, "SELECT id FROM "+table+" WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	if len(ids) > 0 {
+		return ErrVersionConflict
+	}
+
+	return fmt.Errorf("%s not found", name)
+}
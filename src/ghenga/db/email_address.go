@@ -0,0 +1,118 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EmailAddressTypes contains the valid values for the type of an email
+// address.
+var EmailAddressTypes = []string{"work", "private", "other"}
+
+// EmailAddress is an email address of a specified type.
+type EmailAddress struct {
+	ID       int64
+	Address  string
+	Type     string
+	Primary  bool
+	PersonID int64
+}
+
+// EmailAddressJSON is the JSON representation of an email address.
+type EmailAddressJSON struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+	Primary bool   `json:"primary"`
+}
+
+func (e EmailAddress) String() string {
+	return fmt.Sprintf("<EmailAddress [%v] %v>", e.Type, e.Address)
+}
+
+// Validate checks if e is valid and returns an error if not.
+func (e EmailAddress) Validate() error {
+	if !strings.Contains(e.Address, "@") {
+		return fmt.Errorf("invalid email address %q", e.Address)
+	}
+
+	for _, t := range EmailAddressTypes {
+		if e.Type == t {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid type %q for email address %q", e.Type, e.Address)
+}
+
+// EmailAddresses is a collection of email addresses.
+type EmailAddresses []EmailAddress
+
+// Validate checks that all addresses are valid and at most one of them is the
+// primary address.
+func (e EmailAddresses) Validate() error {
+	primary := 0
+	for _, addr := range e {
+		if err := addr.Validate(); err != nil {
+			return err
+		}
+
+		if addr.Primary {
+			primary++
+		}
+	}
+
+	if primary > 1 {
+		return fmt.Errorf("%d primary email addresses found, only one is allowed", primary)
+	}
+
+	return nil
+}
+
+// Primary returns the primary email address or the empty string if there is
+// none.
+func (e EmailAddresses) Primary() string {
+	for _, addr := range e {
+		if addr.Primary {
+			return addr.Address
+		}
+	}
+
+	return ""
+}
+
+// Contains returns true iff address is contained in e. Case is ignored.
+func (e EmailAddresses) Contains(address string) bool {
+	for _, addr := range e {
+		if strings.EqualFold(addr.Address, address) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Equals returns true iff other contains exactly the same addresses, types
+// and primary flags.
+func (e EmailAddresses) Equals(other EmailAddresses) bool {
+	found := make(map[EmailAddress]bool)
+
+	for _, addr := range e {
+		found[EmailAddress{Address: addr.Address, Type: addr.Type, Primary: addr.Primary}] = false
+	}
+
+	for _, addr := range other {
+		id := EmailAddress{Address: addr.Address, Type: addr.Type, Primary: addr.Primary}
+		if _, ok := found[id]; !ok {
+			return false
+		}
+		found[id] = true
+	}
+
+	for _, v := range found {
+		if !v {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,366 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/modl"
+)
+
+// EventDatabase allows handling events.
+type EventDatabase interface {
+	FindEvent(int64) (*Event, error)
+
+	InsertEvent(*Event) error
+	ListEvents() ([]*Event, error)
+	UpdateEvent(*Event) error
+	DeleteEvent(int64) error
+
+	ListUserEvents(login string) ([]*Event, error)
+
+	CalendarToken(login string) (string, error)
+	FindCalendarUser(token string) (string, error)
+}
+
+// Event is a meeting or an appointment with people and users as participants.
+type Event struct {
+	ID          int64
+	Title       string
+	Description string
+	Location    string
+	StartAt     time.Time
+	EndAt       time.Time
+
+	// IDs of the participating people
+	People []int64 `db:"-"`
+	// login names of the participating users
+	Users []string `db:"-"`
+
+	ChangedAt time.Time
+	CreatedAt time.Time
+	Version   int64
+}
+
+// EventJSON is the JSON representation of an Event as returned or consumed by
+// the API.
+type EventJSON struct {
+	ID          int64  `json:"id,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Location    string `json:"location,omitempty"`
+	StartAt     string `json:"start_at,omitempty"`
+	EndAt       string `json:"end_at,omitempty"`
+
+	People []int64  `json:"people"`
+	Users  []string `json:"users"`
+
+	ChangedAt string `json:"changed_at,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+
+	Version int64 `json:"version"`
+}
+
+// CalendarToken allows access to the calendar feed of a user without a
+// session.
+type CalendarToken struct {
+	Token string
+	User  string
+}
+
+// NewEvent returns a new event record.
+func NewEvent(title string, start, end time.Time) *Event {
+	ts := time.Now()
+	return &Event{
+		Title:     title,
+		StartAt:   start.UTC(),
+		EndAt:     end.UTC(),
+		CreatedAt: ts,
+		ChangedAt: ts,
+	}
+}
+
+// MarshalJSON returns the JSON representation of e.
+func (e Event) MarshalJSON() ([]byte, error) {
+	je := EventJSON{
+		ID:          e.ID,
+		Title:       e.Title,
+		Description: e.Description,
+		Location:    e.Location,
+		StartAt:     e.StartAt.Format(timeLayout),
+		EndAt:       e.EndAt.Format(timeLayout),
+
+		People: e.People,
+		Users:  e.Users,
+
+		ChangedAt: e.ChangedAt.Format(timeLayout),
+		CreatedAt: e.CreatedAt.Format(timeLayout),
+		Version:   e.Version,
+	}
+
+	if je.People == nil {
+		je.People = []int64{}
+	}
+
+	if je.Users == nil {
+		je.Users = []string{}
+	}
+
+	return json.Marshal(je)
+}
+
+// UnmarshalJSON returns an event from JSON.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var je EventJSON
+
+	err := json.Unmarshal(data, &je)
+	if err != nil {
+		return err
+	}
+
+	createdAt, err := time.Parse(timeLayout, je.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	changedAt, err := time.Parse(timeLayout, je.ChangedAt)
+	if err != nil {
+		return err
+	}
+
+	*e = Event{
+		ID:        je.ID,
+		CreatedAt: createdAt,
+		ChangedAt: changedAt,
+	}
+
+	return e.Update(je)
+}
+
+// Validate checks if e is valid and returns an error if not.
+func (e *Event) Validate() error {
+	if e.Title == "" {
+		return errors.New("title is empty")
+	}
+
+	if e.StartAt.IsZero() || e.EndAt.IsZero() {
+		return errors.New("start and end must be set")
+	}
+
+	if e.EndAt.Before(e.StartAt) {
+		return errors.New("event ends before it starts")
+	}
+
+	if e.CreatedAt.IsZero() || e.ChangedAt.IsZero() {
+		return errors.New("invalid timestamps")
+	}
+
+	return nil
+}
+
+// Update updates e with the fields from other. Start and end are converted to
+// UTC.
+func (e *Event) Update(other EventJSON) error {
+	e.Title = other.Title
+	e.Description = other.Description
+	e.Location = other.Location
+
+	for _, f := range []struct {
+		s string
+		t *time.Time
+	}{
+		{other.StartAt, &e.StartAt},
+		{other.EndAt, &e.EndAt},
+	} {
+		*f.t = time.Time{}
+		if f.s == "" {
+			continue
+		}
+
+		t, err := time.Parse(timeLayout, f.s)
+		if err != nil {
+			return err
+		}
+		*f.t = t.UTC()
+	}
+
+	e.People = nil
+	seenPeople := make(map[int64]bool)
+	for _, id := range other.People {
+		if !seenPeople[id] {
+			e.People = append(e.People, id)
+			seenPeople[id] = true
+		}
+	}
+
+	e.Users = nil
+	seenUsers := make(map[string]bool)
+	for _, login := range other.Users {
+		if !seenUsers[login] {
+			e.Users = append(e.Users, login)
+			seenUsers[login] = true
+		}
+	}
+
+	e.Version = other.Version
+
+	return nil
+}
+
+// HasUser returns true iff the user is a participant of e.
+func (e Event) HasUser(login string) bool {
+	for _, u := range e.Users {
+		if u == login {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("<Event[%v] %v (%v - %v)>", e.ID, e.Title, e.StartAt, e.EndAt)
+}
+
+// PostInsert is run after an event is saved into the database. It is used to
+// save the participants of the event.
+func (e *Event) PostInsert(db modl.SqlExecutor) error {
+	return e.insertParticipants(db)
+}
+
+// insertParticipants saves the participants of e to the database.
+func (e *Event) insertParticipants(db modl.SqlExecutor) error {
+	for _, id := range e.People {
+		_, err := db.Exec("INSERT INTO event_people (event_id, person_id) VALUES ($1, $2)", e.ID, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, login := range e.Users {
+		_, err := db.Exec("INSERT INTO event_users (event_id, login) VALUES ($1, $2)", e.ID, login)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PostGet loads the participants of the event.
+func (e *Event) PostGet(db modl.SqlExecutor) error {
+	err := db.Select(&e.People, "SELECT person_id FROM event_people WHERE event_id = $1 ORDER BY person_id", e.ID)
+	if err != nil {
+		return err
+	}
+
+	return db.Select(&e.Users, "SELECT login FROM event_users WHERE event_id = $1 ORDER BY login", e.ID)
+}
+
+// PostUpdate is run after an event has been updated. It replaces the
+// participants of the event.
+func (e *Event) PostUpdate(db modl.SqlExecutor) error {
+	for _, table := range []string{"event_people", "event_users"} {
+		_, err := db.Exec("DELETE FROM "+table+" WHERE event_id = $1", e.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.insertParticipants(db)
+}
+
+// FindEvent returns the event with the given id.
+func (db *Database) FindEvent(id int64) (*Event, error) {
+	var e Event
+
+	err := db.dbmap.SelectOne(&e, "SELECT * FROM events WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+// UpdateEvent modifies an existing event.
+func (db *Database) UpdateEvent(e *Event) error {
+	_, err := db.dbmap.Update(e)
+	return err
+}
+
+// InsertEvent creates a new event.
+func (db *Database) InsertEvent(e *Event) error {
+	return db.dbmap.Insert(e)
+}
+
+// ListEvents returns the list of events, ordered by start time.
+func (db *Database) ListEvents() ([]*Event, error) {
+	var events []*Event
+	err := db.dbmap.Select(&events, "select * from events order by start_at, id")
+	return events, err
+}
+
+// DeleteEvent removes an event.
+func (db *Database) DeleteEvent(id int64) error {
+	res := db.dbmap.Dbx.MustExec("delete from events where id = $1", id)
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n != 1 {
+		return errors.New("event not found")
+	}
+
+	return nil
+}
+
+// ListUserEvents returns the list of events the user participates in, ordered
+// by start time.
+func (db *Database) ListUserEvents(login string) ([]*Event, error) {
+	var events []*Event
+	err := db.dbmap.Select(&events,
+		`select events.* from events join event_users on events.id = event_users.event_id
+		where event_users.login = $1 order by start_at, id`, login)
+	return events, err
+}
+
+// CalendarToken returns the token for the calendar feed of the user. If the
+// user does not have a token yet, a new one is generated.
+func (db *Database) CalendarToken(login string) (string, error) {
+	var ct CalendarToken
+	err := db.dbmap.SelectOne(&ct, `SELECT * FROM calendar_tokens WHERE "user" = $1`, login)
+	if err == nil {
+		return ct.Token, nil
+	}
+
+	if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	ct = CalendarToken{Token: token, User: login}
+	if err = db.dbmap.Insert(&ct); err != nil {
+		return "", err
+	}
+
+	return ct.Token, nil
+}
+
+// FindCalendarUser returns the login name of the user the calendar token
+// belongs to.
+func (db *Database) FindCalendarUser(token string) (string, error) {
+	var ct CalendarToken
+	err := db.dbmap.SelectOne(&ct, "SELECT * FROM calendar_tokens WHERE token = $1", token)
+	if err != nil {
+		return "", err
+	}
+
+	return ct.User, nil
+}
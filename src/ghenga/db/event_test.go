@@ -0,0 +1,138 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func insertEvent(t *testing.T, db DB, title string, start time.Time, people []int64, users []string) *Event {
+	e := NewEvent(title, start, start.Add(time.Hour))
+	e.People = people
+	e.Users = users
+
+	if err := e.Validate(); err != nil {
+		t.Fatalf("event %v is invalid: %v", e, err)
+	}
+
+	if err := db.InsertEvent(e); err != nil {
+		t.Fatalf("unable to insert event %v: %v", e, err)
+	}
+
+	return e
+}
+
+func testEventParticipants(t *testing.T, db DB) {
+	start := time.Date(2016, 4, 24, 10, 30, 0, 0, time.UTC)
+	e1 := insertEvent(t, db, "later", start.Add(24*time.Hour), []int64{2, 4}, []string{"admin", "user"})
+	e2 := insertEvent(t, db, "first", start, []int64{4}, []string{"user"})
+	insertEvent(t, db, "admin only", start, nil, []string{"admin"})
+
+	e, err := db.FindEvent(e1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(e.People, []int64{2, 4}) || !reflect.DeepEqual(e.Users, []string{"admin", "user"}) {
+		t.Fatalf("wrong participants loaded: %v %v", e.People, e.Users)
+	}
+
+	if !e.StartAt.Equal(e1.StartAt) || !e.EndAt.Equal(e1.EndAt) {
+		t.Fatalf("wrong start or end loaded: %v - %v", e.StartAt, e.EndAt)
+	}
+
+	list, err := db.ListUserEvents("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 2 || list[0].ID != e2.ID || list[1].ID != e1.ID {
+		t.Fatalf("wrong list of events for user returned: %v", list)
+	}
+
+	e.People = []int64{2}
+	e.Users = []string{"admin"}
+	if err = db.UpdateEvent(e); err != nil {
+		t.Fatalf("unable to update event: %v", err)
+	}
+
+	list, err = db.ListUserEvents("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 1 || list[0].ID != e2.ID {
+		t.Fatalf("wrong list of events for user returned after update: %v", list)
+	}
+
+	e.Version = 1000
+	if err = db.UpdateEvent(e); err == nil {
+		t.Fatalf("update did not fail despite wrong version field")
+	}
+
+	if err = db.DeleteEvent(e2.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = db.FindEvent(e2.ID); err == nil {
+		t.Fatalf("deleted event %v still found", e2.ID)
+	}
+}
+
+func TestDBEventParticipants(t *testing.T) {
+	testEventParticipants(t, testDB)
+}
+
+func TestMockDBEventParticipants(t *testing.T) {
+	testEventParticipants(t, NewMockDB(20, 5))
+}
+
+func testCalendarToken(t *testing.T, db DB) {
+	token, err := db.CalendarToken("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token2, err := db.CalendarToken("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token == "" || token != token2 {
+		t.Fatalf("CalendarToken returned different tokens %q and %q", token, token2)
+	}
+
+	login, err := db.FindCalendarUser(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if login != "user" {
+		t.Fatalf("FindCalendarUser returned wrong user %q", login)
+	}
+
+	if _, err = db.FindCalendarUser("invalid"); err == nil {
+		t.Fatalf("FindCalendarUser found user for invalid token")
+	}
+}
+
+func TestDBCalendarToken(t *testing.T) {
+	testCalendarToken(t, testDB)
+}
+
+func TestMockDBCalendarToken(t *testing.T) {
+	testCalendarToken(t, NewMockDB(20, 5))
+}
+
+func TestEventValidate(t *testing.T) {
+	start := time.Now()
+	e := NewEvent("test", start, start.Add(time.Hour))
+	if err := e.Validate(); err != nil {
+		t.Errorf("event is invalid: %v", err)
+	}
+
+	e.EndAt = start.Add(-time.Hour)
+	if err := e.Validate(); err == nil {
+		t.Errorf("event which ends before it starts is valid")
+	}
+}
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"encoding/csv"
+	"fmt"
+	"ghenga/xlsx"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ExportFormats contains the formats supported by ExportPeople.
+var ExportFormats = []string{"csv", "xlsx"}
+
+// exportPhoneTypes are the types of phone numbers which get a column of their
+// own when people are exported. Numbers of other types are exported in the
+// column for the type "other".
+var exportPhoneTypes = []string{"work", "mobile", "fax", "private", "other"}
+
+// PeopleTable flattens people into the rows of a table, e.g. for exporting
+// them to a spreadsheet. The names of the columns are the fields of a
+// CSVMapping, so that exported files can be imported again. Several values
+// for the same column (e.g. two mobile phone numbers) are separated by a
+// comma, ImportPeopleCSV splits them again.
+type PeopleTable struct {
+	fields []*CustomField
+}
+
+// NewPeopleTable returns a table for people with columns for the custom
+// fields.
+func NewPeopleTable(fields []*CustomField) *PeopleTable {
+	return &PeopleTable{fields: fields}
+}
+
+// Header returns the names of the columns.
+func (t *PeopleTable) Header() []string {
+	header := []string{"id", "name", "title", "department",
+		"street", "postal_code", "state", "city", "country"}
+
+	for _, tpe := range exportPhoneTypes {
+		header = append(header, "phone:"+tpe)
+	}
+
+	for _, tpe := range EmailAddressTypes {
+		header = append(header, "email:"+tpe)
+	}
+
+	header = append(header, "tags", "comment")
+
+	for _, f := range t.fields {
+		header = append(header, "custom:"+f.Name)
+	}
+
+	return append(header, "account_id", "created_at", "changed_at")
+}
+
+// Row returns the values of the columns for p.
+func (t *PeopleTable) Row(p *Person) []string {
+	row := []string{strconv.FormatInt(p.ID, 10), p.Name, p.Title, p.Department,
+		p.Street, p.PostalCode, p.State, p.City, p.Country}
+
+	phones := make(map[string][]string)
+	for _, num := range p.PhoneNumbers {
+		tpe := "other"
+		for _, t := range exportPhoneTypes {
+			if num.Type == t {
+				tpe = t
+			}
+		}
+		phones[tpe] = append(phones[tpe], num.Number)
+	}
+
+	for _, tpe := range exportPhoneTypes {
+		row = append(row, strings.Join(phones[tpe], ", "))
+	}
+
+	emails := make(map[string][]string)
+	for _, addr := range p.EmailAddresses {
+		emails[addr.Type] = append(emails[addr.Type], addr.Address)
+	}
+
+	for _, tpe := range EmailAddressTypes {
+		row = append(row, strings.Join(emails[tpe], ", "))
+	}
+
+	row = append(row, strings.Join(p.Tags, ", "), p.Comment)
+
+	for _, f := range t.fields {
+		row = append(row, exportCustomValue(p.Custom[f.Name]))
+	}
+
+	account := ""
+	if p.AccountID.Valid {
+		account = strconv.FormatInt(p.AccountID.Int64, 10)
+	}
+
+	return append(row, account, p.CreatedAt.Format(timeLayout), p.ChangedAt.Format(timeLayout))
+}
+
+// exportCustomValue formats the value of a custom field as text.
+func exportCustomValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	return fmt.Sprint(v)
+}
+
+// csvFormulaChars are the characters which start a formula in spreadsheet
+// programs.
+const csvFormulaChars = "=+-@"
+
+// csvFormulaWriter writes rows to a CSV file. Values starting like a formula
+// are prefixed with a single quote, so that spreadsheet programs opening the
+// file show them as text instead of evaluating them. ImportPeopleCSV removes
+// the quote again.
+type csvFormulaWriter struct {
+	*csv.Writer
+}
+
+// Write writes a row with the escaped values.
+func (w csvFormulaWriter) Write(row []string) error {
+	escaped := make([]string, len(row))
+	for i, v := range row {
+		if v != "" && strings.IndexByte(csvFormulaChars, v[0]) >= 0 {
+			v = "'" + v
+		}
+		escaped[i] = v
+	}
+
+	return w.Writer.Write(escaped)
+}
+
+// ExportPeople writes the people returned by it to wr as a table (see
+// PeopleTable) in one of the ExportFormats. The people are written while
+// they are read from it. The number of people written is returned. On error,
+// the output is cut off.
+func ExportPeople(wr io.Writer, format string, it PeopleIterator, fields []*CustomField) (n int, err error) {
+	var w interface {
+		Write([]string) error
+	}
+	var finish func() error
+
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(wr)
+		w = csvFormulaWriter{cw}
+		finish = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case "xlsx":
+		xw, err := xlsx.NewWriter(wr, "People")
+		if err != nil {
+			return 0, err
+		}
+		w, finish = xw, xw.Close
+	default:
+		return 0, fmt.Errorf("unknown export format %q", format)
+	}
+
+	table := NewPeopleTable(fields)
+	if err = w.Write(table.Header()); err != nil {
+		return 0, err
+	}
+
+	for it.Next() {
+		if err = w.Write(table.Row(it.Person())); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	if err = it.Err(); err != nil {
+		return n, err
+	}
+
+	return n, finish()
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"testing"
+)
+
+func TestPeopleTable(t *testing.T) {
+	fields := []*CustomField{NewCustomField("points", "number"), NewCustomField("vip", "bool")}
+
+	p := NewPerson("Max Mustermann")
+	p.ID = 23
+	p.City = "Köln"
+	p.PhoneNumbers = PhoneNumbers{
+		{Type: "mobile", Number: "0171 1"},
+		{Type: "mobile", Number: "0171 2"},
+		{Type: "pager", Number: "123"},
+	}
+	p.EmailAddresses = EmailAddresses{{Type: "private", Address: "max@example.com", Primary: true}}
+	p.Tags = []string{"a", "b"}
+	p.Custom = CustomValues{"points": float64(1.5), "vip": true}
+	p.AccountID = sql.NullInt64{Int64: 5, Valid: true}
+
+	table := NewPeopleTable(fields)
+	header := table.Header()
+	row := table.Row(p)
+
+	if len(header) != len(row) {
+		t.Fatalf("header has %d columns, row has %d", len(header), len(row))
+	}
+
+	values := make(map[string]string)
+	for i, name := range header {
+		values[name] = row[i]
+	}
+
+	for name, want := range map[string]string{
+		"id":             "23",
+		"name":           "Max Mustermann",
+		"city":           "Köln",
+		"phone:mobile":   "0171 1, 0171 2",
+		"phone:other":    "123",
+		"phone:work":     "",
+		"email:private":  "max@example.com",
+		"tags":           "a, b",
+		"custom:points":  "1.5",
+		"custom:vip":     "true",
+		"account_id":     "5",
+		"street":         "",
+		"email:work":     "",
+		"custom:unknown": "",
+	} {
+		if values[name] != want {
+			t.Errorf("wrong value for column %v, want %q, got %q", name, want, values[name])
+		}
+	}
+}
+
+func TestPeopleTableImport(t *testing.T) {
+	db := NewMockDB(0, 0)
+	for _, name := range []string{"a", "b"} {
+		if err := db.InsertTag(NewTag(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := NewPerson("=Max Mustermann")
+	p.Street = "Domstraße 1"
+	p.City = "Köln"
+	p.PhoneNumbers = PhoneNumbers{
+		{Type: "work", Number: "+49 221 1"},
+		{Type: "mobile", Number: "0171 1"},
+		{Type: "mobile", Number: "0171 2"},
+		{Type: "fax", Number: "0221 2"},
+	}
+	p.EmailAddresses = EmailAddresses{
+		{Type: "work", Address: "max@example.com", Primary: true},
+		{Type: "work", Address: "mustermann@example.com"},
+		{Type: "private", Address: "max@example.org"},
+	}
+	p.Tags = []string{"a", "b"}
+
+	var buf bytes.Buffer
+	if _, err := ExportPeople(&buf, "csv", IterateSlice([]*Person{p}), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := ImportPeopleCSV(db, &buf, CSVImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Imported != 1 {
+		t.Fatalf("exported person was not imported: %+v", res)
+	}
+
+	people, err := db.FindPeopleByEmail("max@example.com")
+	if err != nil || len(people) != 1 {
+		t.Fatalf("imported person not found: %v", err)
+	}
+
+	p2 := people[0]
+	if p2.Name != p.Name || p2.Street != p.Street || p2.City != p.City {
+		t.Errorf("imported person differs: want %v, got %v", p, p2)
+	}
+
+	if !p2.PhoneNumbers.Equals(p.PhoneNumbers) || !p2.EmailAddresses.Equals(p.EmailAddresses) {
+		t.Errorf("imported person has different phone numbers or email addresses: %v %v", p2.PhoneNumbers, p2.EmailAddresses)
+	}
+
+	if len(p2.Tags) != 2 || p2.Tags[0] != "a" || p2.Tags[1] != "b" {
+		t.Errorf("imported person has wrong tags %v", p2.Tags)
+	}
+}
+
+func TestExportPeople(t *testing.T) {
+	people := []*Person{NewPerson("Max Mustermann"), NewPerson("Erika Mustermann"), NewPerson(`=HYPERLINK("http://example.com")`)}
+
+	var buf bytes.Buffer
+	n, err := ExportPeople(&buf, "csv", IterateSlice(people), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 3 {
+		t.Errorf("wrong number of exported people, want 3, got %d", n)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 4 || records[0][1] != "name" || records[2][1] != "Erika Mustermann" {
+		t.Errorf("wrong CSV file %q", records)
+	}
+
+	if len(records) == 4 && records[3][1] != `'=HYPERLINK("http://example.com")` {
+		t.Errorf("formula was not escaped: %q", records[3][1])
+	}
+
+	buf.Reset()
+	if _, err = ExportPeople(&buf, "xlsx", IterateSlice(people), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(buf.Bytes(), []byte("PK")) {
+		t.Errorf("XLSX file is not a zip archive")
+	}
+
+	if _, err = ExportPeople(&buf, "pdf", IterateSlice(people), nil); err == nil {
+		t.Errorf("unknown format did not return an error")
+	}
+}
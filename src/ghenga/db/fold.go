@@ -0,0 +1,32 @@
+package db
+
+import "strings"
+
+// foldReplacer replaces umlauts and other characters with diacritics by their
+// transliteration in lower case ASCII.
+var foldReplacer = strings.NewReplacer(
+	"ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss", "æ", "ae", "œ", "oe",
+	"à", "a", "á", "a", "â", "a", "ã", "a", "å", "a", "ā", "a", "ă", "a", "ą", "a",
+	"ç", "c", "ć", "c", "č", "c",
+	"ď", "d", "đ", "d",
+	"è", "e", "é", "e", "ê", "e", "ë", "e", "ē", "e", "ė", "e", "ę", "e", "ě", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ī", "i", "į", "i",
+	"ł", "l",
+	"ñ", "n", "ń", "n", "ň", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ø", "o", "ō", "o", "ő", "o",
+	"ŕ", "r", "ř", "r",
+	"ś", "s", "š", "s", "ş", "s",
+	"ť", "t", "ţ", "t",
+	"ù", "u", "ú", "u", "û", "u", "ů", "u", "ū", "u", "ű", "u", "ų", "u",
+	"ý", "y", "ÿ", "y",
+	"ź", "z", "ż", "z", "ž", "z",
+)
+
+// fold returns s in lower case with umlauts, ß and ligatures transliterated
+// (e.g. "ä" becomes "ae") and diacritics removed (e.g. "é" becomes "e"), so
+// that different spellings of a word are equal. The SQL function
+// people_search_fold, defined in the migrations, does the same in the
+// database.
+func fold(s string) string {
+	return foldReplacer.Replace(strings.ToLower(s))
+}
@@ -0,0 +1,23 @@
+package db
+
+import "testing"
+
+var foldTests = []struct {
+	s, want string
+}{
+	{"Müller", "mueller"},
+	{"MÜLLER", "mueller"},
+	{"Straße", "strasse"},
+	{"José Ñúñez", "jose nunez"},
+	{"Łódź", "lodz"},
+	{"Ærø", "aero"},
+	{"plain ascii", "plain ascii"},
+}
+
+func TestFold(t *testing.T) {
+	for i, test := range foldTests {
+		if res := fold(test.s); res != test.want {
+			t.Errorf("test %d: fold(%q) returned %q, want %q", i, test.s, res, test.want)
+		}
+	}
+}
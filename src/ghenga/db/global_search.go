@@ -0,0 +1,506 @@
+package db
+
+import (
+	"fmt"
+	"ghenga/query"
+	"sort"
+	"strings"
+)
+
+// SearchDatabase allows searching all types of entities at once.
+type SearchDatabase interface {
+	Search(query string, types []string, limit int) ([]*SearchHit, error)
+}
+
+// Types of entities for the global search.
+const (
+	SearchTypePerson   = "person"
+	SearchTypeAccount  = "account"
+	SearchTypeActivity = "activity"
+	SearchTypeTask     = "task"
+	SearchTypeEvent    = "event"
+	SearchTypeTag      = "tag"
+	SearchTypeUser     = "user"
+)
+
+// SearchTypes contains all types of entities which can be searched. Hits
+// with the same rank are returned in this order.
+var SearchTypes = []string{
+	SearchTypePerson, SearchTypeAccount, SearchTypeActivity,
+	SearchTypeTask, SearchTypeEvent, SearchTypeTag, SearchTypeUser,
+}
+
+// SearchHit is an entity found by the global search.
+type SearchHit struct {
+	Type  string `json:"type"`
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+
+	// Field is the name of the most relevant field containing the query,
+	// Snippet is the part of the field around the match.
+	Field   string `json:"field"`
+	Snippet string `json:"snippet"`
+
+	Rank float64 `json:"rank"`
+}
+
+// searchField is a field of an entity which is searched.
+type searchField struct {
+	name   string
+	value  string
+	weight float64
+}
+
+// searchDoc contains the searchable fields of an entity.
+type searchDoc struct {
+	typ    string
+	id     int64
+	title  string
+	fields []searchField
+}
+
+// add appends the field to the document, empty values are ignored.
+func (d *searchDoc) add(name string, weight float64, values ...string) {
+	for _, v := range values {
+		if v != "" {
+			d.fields = append(d.fields, searchField{name: name, value: v, weight: weight})
+		}
+	}
+}
+
+// personFieldWeights are the weights for the fields of a person, the same
+// as for the full-text search.
+var personFieldWeights = map[string]float64{
+	"name": weightA,
+
+	"title":      weightB,
+	"department": weightB,
+	"email":      weightB,
+
+	"phone":       weightC,
+	"street":      weightC,
+	"postal_code": weightC,
+	"state":       weightC,
+	"city":        weightC,
+	"country":     weightC,
+
+	"comment": weightD,
+}
+
+func personSearchDoc(p Person) searchDoc {
+	d := searchDoc{typ: SearchTypePerson, id: p.ID, title: p.Name}
+	for _, name := range personTextFields {
+		d.add(name, personFieldWeights[name], personQueryFields[name].values(p)...)
+	}
+	return d
+}
+
+func accountSearchDoc(a Account) searchDoc {
+	d := searchDoc{typ: SearchTypeAccount, id: a.ID, title: a.Name}
+	d.add("name", weightA, a.Name)
+	d.add("website", weightB, a.Website)
+	d.add("billing_street", weightC, a.BillingStreet)
+	d.add("billing_postal_code", weightC, a.BillingPostalCode)
+	d.add("billing_state", weightC, a.BillingState)
+	d.add("billing_city", weightC, a.BillingCity)
+	d.add("billing_country", weightC, a.BillingCountry)
+	d.add("physical_street", weightC, a.PhysicalStreet)
+	d.add("physical_postal_code", weightC, a.PhysicalPostalCode)
+	d.add("physical_state", weightC, a.PhysicalState)
+	d.add("physical_city", weightC, a.PhysicalCity)
+	d.add("physical_country", weightC, a.PhysicalCountry)
+	return d
+}
+
+func activitySearchDoc(a Activity) searchDoc {
+	d := searchDoc{typ: SearchTypeActivity, id: a.ID, title: a.Subject}
+	d.add("subject", weightA, a.Subject)
+	d.add("body", weightD, a.Body)
+	return d
+}
+
+func taskSearchDoc(t Task) searchDoc {
+	d := searchDoc{typ: SearchTypeTask, id: t.ID, title: t.Title}
+	d.add("title", weightA, t.Title)
+	d.add("description", weightD, t.Description)
+	return d
+}
+
+func eventSearchDoc(e Event) searchDoc {
+	d := searchDoc{typ: SearchTypeEvent, id: e.ID, title: e.Title}
+	d.add("title", weightA, e.Title)
+	d.add("location", weightB, e.Location)
+	d.add("description", weightD, e.Description)
+	return d
+}
+
+func tagSearchDoc(t Tag) searchDoc {
+	d := searchDoc{typ: SearchTypeTag, id: t.ID, title: t.Name}
+	d.add("name", weightA, t.Name)
+	return d
+}
+
+func userSearchDoc(u User) searchDoc {
+	d := searchDoc{typ: SearchTypeUser, id: u.ID, title: u.Login}
+	d.add("login", weightA, u.Login)
+	return d
+}
+
+// searchTables contains the table and the searched columns with their weights
+// for all types except people. The columns must be the same as the fields in
+// the search documents.
+var searchTables = map[string]struct {
+	table   string
+	columns []searchField
+}{
+	SearchTypeAccount: {"accounts", []searchField{
+		{name: "name", weight: weightA},
+		{name: "website", weight: weightB},
+		{name: "billing_street", weight: weightC},
+		{name: "billing_postal_code", weight: weightC},
+		{name: "billing_state", weight: weightC},
+		{name: "billing_city", weight: weightC},
+		{name: "billing_country", weight: weightC},
+		{name: "physical_street", weight: weightC},
+		{name: "physical_postal_code", weight: weightC},
+		{name: "physical_state", weight: weightC},
+		{name: "physical_city", weight: weightC},
+		{name: "physical_country", weight: weightC},
+	}},
+	SearchTypeActivity: {"activities", []searchField{
+		{name: "subject", weight: weightA},
+		{name: "body", weight: weightD},
+	}},
+	SearchTypeTask: {"tasks", []searchField{
+		{name: "title", weight: weightA},
+		{name: "description", weight: weightD},
+	}},
+	SearchTypeEvent: {"events", []searchField{
+		{name: "title", weight: weightA},
+		{name: "location", weight: weightB},
+		{name: "description", weight: weightD},
+	}},
+	SearchTypeTag:  {"tags", []searchField{{name: "name", weight: weightA}}},
+	SearchTypeUser: {"users", []searchField{{name: "login", weight: weightA}}},
+}
+
+// checkSearchTypes returns an error if one of the types is invalid.
+func checkSearchTypes(types []string) error {
+	for _, typ := range types {
+		if searchTypeIndex(typ) < 0 {
+			return fmt.Errorf("invalid search type %q", typ)
+		}
+	}
+
+	return nil
+}
+
+// searchTypeIndex returns the position of typ in SearchTypes, or -1.
+func searchTypeIndex(typ string) int {
+	for i, t := range SearchTypes {
+		if t == typ {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// snippetLength is the maximal length of a snippet in characters, snippetContext
+// is the number of characters shown before the match.
+const (
+	snippetLength  = 80
+	snippetContext = 20
+)
+
+// snippet returns the part of s around the first occurrence of the folded
+// term. White space is collapsed, and "…" marks text which was cut off.
+func snippet(s, term string) string {
+	runes := []rune(strings.Join(strings.Fields(s), " "))
+	if len(runes) <= snippetLength {
+		return string(runes)
+	}
+
+	// fold each character separately, so that positions in the folded text
+	// can be mapped back
+	var folded []rune
+	var pos []int
+	for i, r := range runes {
+		for _, f := range fold(string(r)) {
+			folded = append(folded, f)
+			pos = append(pos, i)
+		}
+	}
+
+	start := 0
+	if idx := strings.Index(string(folded), term); idx >= 0 {
+		start = pos[len([]rune(string(folded)[:idx]))] - snippetContext
+	}
+
+	if start > len(runes)-snippetLength {
+		start = len(runes) - snippetLength
+	}
+
+	if start < 0 {
+		start = 0
+	}
+
+	end := start + snippetLength
+
+	s = string(runes[start:end])
+	if start > 0 {
+		s = "…" + s
+	}
+
+	if end < len(runes) {
+		s += "…"
+	}
+
+	return s
+}
+
+// hit returns the search hit for the document, which is nil if not all
+// terms are contained in a field of the document. The rank is computed like
+// for the full-text search of people.
+func (d searchDoc) hit(terms []string) *SearchHit {
+	if len(terms) == 0 {
+		return nil
+	}
+
+	var rank float64
+	var best *searchField
+	var bestTerm string
+
+	for _, term := range terms {
+		weight := 0.0
+		for i, f := range d.fields {
+			if !strings.Contains(fold(f.value), term) {
+				continue
+			}
+
+			if f.weight > weight {
+				weight = f.weight
+			}
+
+			if best == nil || f.weight > best.weight {
+				best = &d.fields[i]
+				bestTerm = term
+			}
+		}
+
+		if weight == 0 {
+			return nil
+		}
+
+		rank += weight
+	}
+
+	return &SearchHit{
+		Type:    d.typ,
+		ID:      d.id,
+		Title:   d.title,
+		Field:   best.name,
+		Snippet: snippet(best.value, bestTerm),
+		Rank:    rank,
+	}
+}
+
+// byHitRank sorts search hits by rank, type and ID.
+type byHitRank []*SearchHit
+
+func (l byHitRank) Len() int      { return len(l) }
+func (l byHitRank) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byHitRank) Less(i, j int) bool {
+	if l[i].Rank != l[j].Rank {
+		return l[i].Rank > l[j].Rank
+	}
+
+	if l[i].Type != l[j].Type {
+		return searchTypeIndex(l[i].Type) < searchTypeIndex(l[j].Type)
+	}
+
+	return l[i].ID < l[j].ID
+}
+
+// searchHits returns at most limit hits for the documents containing all
+// terms, ordered by relevance.
+func searchHits(docs []searchDoc, terms []string, limit int) []*SearchHit {
+	hits := []*SearchHit{}
+	if limit <= 0 {
+		return hits
+	}
+
+	for _, d := range docs {
+		if h := d.hit(terms); h != nil {
+			hits = append(hits, h)
+		}
+	}
+
+	sort.Sort(byHitRank(hits))
+
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	return hits
+}
+
+// searchCondition is an SQL condition (using the bindvar '?') which matches a
+// term in a field, together with the weight of the field.
+type searchCondition struct {
+	sql    string
+	args   []interface{}
+	weight float64
+}
+
+// searchSQL returns the query which selects at most limit entities from the
+// table which contain all terms, ordered by relevance and ID. The rank is
+// computed like in searchDoc.hit, so the result contains the best hits of the
+// table. The function conds returns the conditions for all searched fields
+// and a term.
+func searchSQL(table string, terms []string, limit int, conds func(term string) ([]searchCondition, error)) (string, []interface{}, error) {
+	var where, ranks []string
+	var whereArgs, rankArgs []interface{}
+
+	for _, term := range terms {
+		list, err := conds(term)
+		if err != nil {
+			return "", nil, err
+		}
+
+		var alternatives, weights []string
+		for _, c := range list {
+			alternatives = append(alternatives, c.sql)
+			whereArgs = append(whereArgs, c.args...)
+
+			// the weights are summed up as float8 in the same order as in
+			// searchDoc.hit, so the ranks are exactly the same
+			weights = append(weights, fmt.Sprintf("CASE WHEN %s THEN %v::float8 ELSE 0::float8 END", c.sql, c.weight))
+			rankArgs = append(rankArgs, c.args...)
+		}
+
+		where = append(where, "("+strings.Join(alternatives, " OR ")+")")
+		ranks = append(ranks, "GREATEST("+strings.Join(weights, ", ")+")")
+	}
+
+	q := fmt.Sprintf("SELECT * FROM %s WHERE %s ORDER BY %s DESC, id LIMIT %d",
+		table, strings.Join(where, " AND "), strings.Join(ranks, " + "), limit)
+
+	return in(q, append(whereArgs, rankArgs...)...)
+}
+
+// searchPeople returns at most limit people which contain all terms in one of
+// the text fields, ordered by relevance.
+func (db *Database) searchPeople(terms []string, limit int) ([]*Person, error) {
+	q, args, err := searchSQL("people", terms, limit, func(term string) ([]searchCondition, error) {
+		var list []searchCondition
+		for _, name := range personTextFields {
+			cond, args, err := fieldSQL(personQueryFields[name], query.Term{Value: term})
+			if err != nil {
+				return nil, err
+			}
+
+			list = append(list, searchCondition{sql: cond, args: args, weight: personFieldWeights[name]})
+		}
+		return list, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return db.selectPeople(q, args...)
+}
+
+// searchTable selects at most limit entities of the type into dest which
+// contain all terms in one of the searched columns, ordered by relevance.
+func (db *Database) searchTable(dest interface{}, typ string, terms []string, limit int) error {
+	t := searchTables[typ]
+
+	q, args, err := searchSQL(t.table, terms, limit, func(term string) ([]searchCondition, error) {
+		var list []searchCondition
+		for _, col := range t.columns {
+			list = append(list, searchCondition{
+				sql:    "people_search_fold(" + col.name + ") LIKE ?",
+				args:   []interface{}{"%" + likeEscaper.Replace(term) + "%"},
+				weight: col.weight,
+			})
+		}
+		return list, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.dbmap.Select(dest, q, args...)
+}
+
+// Search returns at most limit entities of the given types which contain all
+// words of the query, ordered by relevance. A word matches when it is
+// contained in any searched field, case, umlauts and diacritics are ignored
+// (see fold). At most limit entities are loaded for each type.
+func (db *Database) Search(query string, types []string, limit int) ([]*SearchHit, error) {
+	if err := checkSearchTypes(types); err != nil {
+		return nil, err
+	}
+
+	terms := searchTerms(query)
+	if len(terms) == 0 || limit <= 0 {
+		return searchHits(nil, terms, 0), nil
+	}
+
+	var docs []searchDoc
+	for _, typ := range types {
+		var err error
+
+		switch typ {
+		case SearchTypePerson:
+			var people []*Person
+			people, err = db.searchPeople(terms, limit)
+			for _, p := range people {
+				docs = append(docs, personSearchDoc(*p))
+			}
+		case SearchTypeAccount:
+			var accounts []*Account
+			err = db.searchTable(&accounts, typ, terms, limit)
+			for _, a := range accounts {
+				docs = append(docs, accountSearchDoc(*a))
+			}
+		case SearchTypeActivity:
+			var activities []*Activity
+			err = db.searchTable(&activities, typ, terms, limit)
+			for _, a := range activities {
+				docs = append(docs, activitySearchDoc(*a))
+			}
+		case SearchTypeTask:
+			var tasks []*Task
+			err = db.searchTable(&tasks, typ, terms, limit)
+			for _, t := range tasks {
+				docs = append(docs, taskSearchDoc(*t))
+			}
+		case SearchTypeEvent:
+			var events []*Event
+			err = db.searchTable(&events, typ, terms, limit)
+			for _, e := range events {
+				docs = append(docs, eventSearchDoc(*e))
+			}
+		case SearchTypeTag:
+			var tags []*Tag
+			err = db.searchTable(&tags, typ, terms, limit)
+			for _, t := range tags {
+				docs = append(docs, tagSearchDoc(*t))
+			}
+		case SearchTypeUser:
+			var users []*User
+			err = db.searchTable(&users, typ, terms, limit)
+			for _, u := range users {
+				docs = append(docs, userSearchDoc(*u))
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return searchHits(docs, terms, limit), nil
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSearch(t *testing.T, db DB) {
+	p := NewPerson("Zyxgl Person")
+	p.Comment = "knows everything about qwvbn"
+	if err := db.InsertPerson(p); err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewAccount("Zyxgl Müller GmbH")
+	if err := db.InsertAccount(a); err != nil {
+		t.Fatal(err)
+	}
+
+	task := NewTask("Call Zyxgl about qwvbn", "admin")
+	if err := db.InsertTask(task); err != nil {
+		t.Fatal(err)
+	}
+
+	start := parseTime("2016-05-02T10:00:00+02:00")
+	e := NewEvent("Meeting", start, start.Add(time.Hour))
+	e.Location = "Zyxgl headquarters"
+	if err := db.InsertEvent(e); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := NewUser("zyxgl", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.InsertUser(u); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		query string
+		types []string
+		want  []string
+	}{
+		{"zyxgl", SearchTypes, []string{"person:name", "account:name", "task:title", "user:login", "event:location"}},
+		{"zyxgl", []string{SearchTypePerson, SearchTypeEvent}, []string{"person:name", "event:location"}},
+		{"zyxgl qwvbn", SearchTypes, []string{"task:title", "person:name"}},
+		{"zyxgl mueller", SearchTypes, []string{"account:name"}},
+		{"nonexistingqwvbn", SearchTypes, nil},
+		{"", SearchTypes, nil},
+	}
+
+	for i, test := range tests {
+		hits, err := db.Search(test.query, test.types, 20)
+		if err != nil {
+			t.Errorf("test %d: Search(%q) returned error %v", i, test.query, err)
+			continue
+		}
+
+		var found []string
+		for _, h := range hits {
+			found = append(found, h.Type+":"+h.Field)
+		}
+
+		if strings.Join(found, " ") != strings.Join(test.want, " ") {
+			t.Errorf("test %d: Search(%q) returned wrong hits, want %v, got %v", i, test.query, test.want, found)
+		}
+	}
+
+	hits, err := db.Search("zyxgl", SearchTypes, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hits) != 2 || hits[0].Type != SearchTypePerson || hits[1].Type != SearchTypeAccount {
+		t.Errorf("Search with limit 2 returned wrong hits %v", hits)
+	}
+
+	if _, err = db.Search("zyxgl", []string{"foo"}, 20); err == nil {
+		t.Errorf("Search with invalid type did not return an error")
+	}
+
+	// the best hits of each type are returned, not the first ones
+	p2 := NewPerson("Other Person")
+	p2.Comment = "knows Vbnqw"
+	if err = db.InsertPerson(p2); err != nil {
+		t.Fatal(err)
+	}
+
+	p3 := NewPerson("Vbnqw")
+	if err = db.InsertPerson(p3); err != nil {
+		t.Fatal(err)
+	}
+
+	hits, err = db.Search("vbnqw", []string{SearchTypePerson}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hits) != 1 || hits[0].ID != p3.ID || hits[0].Field != "name" {
+		t.Errorf("Search with limit 1 returned wrong hits %v", hits)
+	}
+
+	for _, person := range []*Person{p2, p3} {
+		if err = db.DeletePerson(person.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = db.DeletePerson(p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.DeleteAccount(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.DeleteTask(task.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.DeleteEvent(e.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.DeleteUser(u.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBSearch(t *testing.T) {
+	testSearch(t, testDB)
+}
+
+func TestMockDBSearch(t *testing.T) {
+	testSearch(t, NewMockDB(20, 5))
+}
+
+var snippetTests = []struct {
+	s, term, want string
+}{
+	{"short text", "text", "short text"},
+	{"with\n  white   space", "white", "with white space"},
+	{strings.Repeat("a", 50) + " Müller " + strings.Repeat("b", 50), "mueller",
+		"…" + strings.Repeat("a", 22) + " Müller " + strings.Repeat("b", 50)},
+	{strings.Repeat("a", 50) + " Müller " + strings.Repeat("b", 100), "mueller",
+		"…" + strings.Repeat("a", 19) + " Müller " + strings.Repeat("b", 53) + "…"},
+	{"Müller " + strings.Repeat("b", 100), "mueller", "Müller " + strings.Repeat("b", 73) + "…"},
+	{strings.Repeat("a", 100) + " end", "end", "…" + strings.Repeat("a", 76) + " end"},
+}
+
+func TestSnippet(t *testing.T) {
+	for i, test := range snippetTests {
+		if res := snippet(test.s, test.term); res != test.want {
+			t.Errorf("test %d: snippet(%q, %q) returned %q, want %q", i, test.s, test.term, res, test.want)
+		}
+	}
+}
@@ -21,7 +21,9 @@ func NewFakePerson(lang string) (*Person, error) {
 		p.Title = "CEO"
 	}
 	p.Department = "Testers"
-	p.EmailAddress = f.Email()
+	p.EmailAddresses = EmailAddresses{
+		{Type: "work", Address: f.Email(), Primary: true},
+	}
 
 	for _, d := range []struct {
 		probability float32
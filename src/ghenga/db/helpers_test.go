@@ -8,7 +8,7 @@ func TestNewFakePerson(t *testing.T) {
 		t.Fatalf("NewFakePerson(): %v", err)
 	}
 
-	if err = p.Validate(); err != nil {
+	if err = p.Validate(nil); err != nil {
 		t.Fatalf("NewFakePerson() not valid: %v", err)
 	}
 }
@@ -6,5 +6,14 @@ type DB interface {
 
 	UserDatabase
 	PeopleDatabase
+	AccountDatabase
+	ActivityDatabase
+	TaskDatabase
+	EventDatabase
+	TagDatabase
+	CustomFieldDatabase
 	SessionDatabase
+	SearchDatabase
+	SavedSearchDatabase
+	BatchDatabase
 }
@@ -0,0 +1,168 @@
+package db
+
+import "github.com/jmoiron/sqlx"
+
+// PeopleIterator iterates over a list of people, which are read from the
+// database while iterating instead of loading the whole list into memory.
+// Next must be called before the first person is accessed, Close must always
+// be called.
+//
+//	it, err := db.IteratePeople(TagFilter{}, ListOptions{})
+//	if err != nil { ... }
+//	defer it.Close()
+//
+//	for it.Next() {
+//		p := it.Person()
+//		...
+//	}
+//
+//	if err := it.Err(); err != nil { ... }
+type PeopleIterator interface {
+	// Next advances to the next person. It returns false after the last
+	// person or when an error occurred.
+	Next() bool
+
+	// Person returns the current person.
+	Person() *Person
+
+	// Err returns the error which stopped the iteration, if any.
+	Err() error
+
+	// Close releases the resources held by the iterator.
+	Close() error
+}
+
+// iterateBatchSize is the number of people for which the phone numbers,
+// email addresses and tags are loaded at once while iterating.
+const iterateBatchSize = 100
+
+// peopleRows iterates over people read from an SQL query.
+type peopleRows struct {
+	db    *sqlx.DB
+	rows  *sqlx.Rows
+	limit int
+
+	batch []*Person
+	cur   *Person
+	n     int
+	err   error
+}
+
+// ensure that *peopleRows implements PeopleIterator
+var _ PeopleIterator = &peopleRows{}
+
+// fill reads the next batch of people and loads their details.
+func (it *peopleRows) fill() {
+	for len(it.batch) < iterateBatchSize && it.rows.Next() {
+		var p Person
+		if it.err = it.rows.StructScan(&p); it.err != nil {
+			return
+		}
+		it.batch = append(it.batch, &p)
+	}
+
+	if it.err = it.rows.Err(); it.err != nil {
+		return
+	}
+
+	it.err = loadPeopleDetails(it.db, it.batch)
+}
+
+// Next advances to the next person.
+func (it *peopleRows) Next() bool {
+	if it.err != nil || (it.limit > 0 && it.n >= it.limit) {
+		return false
+	}
+
+	if len(it.batch) == 0 {
+		it.fill()
+		if it.err != nil || len(it.batch) == 0 {
+			return false
+		}
+	}
+
+	it.cur, it.batch = it.batch[0], it.batch[1:]
+	it.n++
+	return true
+}
+
+// Person returns the current person.
+func (it *peopleRows) Person() *Person {
+	return it.cur
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *peopleRows) Err() error {
+	return it.err
+}
+
+// Close closes the underlying rows.
+func (it *peopleRows) Close() error {
+	return it.rows.Close()
+}
+
+// IteratePeople returns an iterator over the people matching the tag filter,
+// sorted and filtered as specified in opts. Like for ListPeople, the list
+// starts after opts.Cursor and contains at most opts.Limit people. Errors for
+// invalid options are of type *ListError.
+func (db *Database) IteratePeople(tags TagFilter, opts ListOptions) (PeopleIterator, error) {
+	q, err := opts.query(personListFields)
+	if err != nil {
+		return nil, err
+	}
+
+	cond, order, args := q.sql()
+	tagCond, tagArgs := tags.sqlCondition()
+	args = append(args, tagArgs...)
+
+	query, args, err := in("select * from people where "+cond+" and "+tagCond+order, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.dbmap.Dbx.Queryx(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &peopleRows{db: db.dbmap.Dbx, rows: rows, limit: q.Limit}, nil
+}
+
+// IterateSlice returns an iterator over a list of people in memory.
+func IterateSlice(list []*Person) PeopleIterator {
+	return &peopleSlice{list: list}
+}
+
+// peopleSlice iterates over a list of people in memory.
+type peopleSlice struct {
+	list []*Person
+	cur  *Person
+}
+
+// ensure that *peopleSlice implements PeopleIterator
+var _ PeopleIterator = &peopleSlice{}
+
+// Next advances to the next person.
+func (it *peopleSlice) Next() bool {
+	if len(it.list) == 0 {
+		return false
+	}
+
+	it.cur, it.list = it.list[0], it.list[1:]
+	return true
+}
+
+// Person returns the current person.
+func (it *peopleSlice) Person() *Person {
+	return it.cur
+}
+
+// Err returns nil.
+func (it *peopleSlice) Err() error {
+	return nil
+}
+
+// Close does nothing.
+func (it *peopleSlice) Close() error {
+	return nil
+}
@@ -0,0 +1,334 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListOptions selects a page of a sorted and filtered list of entities.
+type ListOptions struct {
+	// Limit is the maximal number of entities returned, zero means no limit.
+	Limit int
+
+	// Cursor is the position after which the page starts, as returned by the
+	// list function for the previous page. It is empty for the first page.
+	Cursor string
+
+	// Sort is the name of the field the list is sorted by, the default is
+	// "id". Desc reverses the order. Entities with the same value for the
+	// field are sorted by ID in the same direction.
+	Sort string
+	Desc bool
+
+	// Filter selects entities by the values of fields, the field must be
+	// equal to the value for all entries.
+	Filter map[string]string
+}
+
+// ListError is returned for invalid list options.
+type ListError struct {
+	Msg string
+}
+
+func (e *ListError) Error() string {
+	return "list: " + e.Msg
+}
+
+func listErrorf(format string, args ...interface{}) error {
+	return &ListError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// fieldKind describes how the values of a field are parsed and compared.
+type fieldKind int
+
+const (
+	kindText fieldKind = iota
+	kindInteger
+	kindBoolean
+	kindTimestamp
+)
+
+// listFields maps the names of the fields which can be used to sort and
+// filter a list to their kind. The name of a field is the name of the column.
+type listFields map[string]fieldKind
+
+// personListFields are the fields for sorting and filtering lists of people.
+var personListFields = listFields{
+	"id":          kindInteger,
+	"name":        kindText,
+	"title":       kindText,
+	"department":  kindText,
+	"street":      kindText,
+	"postal_code": kindText,
+	"state":       kindText,
+	"city":        kindText,
+	"country":     kindText,
+	"comment":     kindText,
+	"created_at":  kindTimestamp,
+	"changed_at":  kindTimestamp,
+	"version":     kindInteger,
+}
+
+// userListFields are the fields for sorting and filtering lists of users.
+var userListFields = listFields{
+	"id":         kindInteger,
+	"login":      kindText,
+	"admin":      kindBoolean,
+	"created_at": kindTimestamp,
+	"changed_at": kindTimestamp,
+	"version":    kindInteger,
+}
+
+// parseValue returns the value of the field kind from s. Timestamps are
+// expected in RFC 3339 format, with fractional seconds.
+func parseValue(kind fieldKind, s string) (interface{}, error) {
+	switch kind {
+	case kindInteger:
+		return strconv.ParseInt(s, 10, 64)
+	case kindBoolean:
+		return strconv.ParseBool(s)
+	case kindTimestamp:
+		return time.Parse(time.RFC3339Nano, s)
+	}
+
+	return s, nil
+}
+
+// formatValue returns the string representation of v, which can be parsed
+// with parseValue.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+
+	return fmt.Sprint(v)
+}
+
+// compareValues returns -1, 0 or 1 if a is less than, equal to or greater
+// than b. Both values must be of the same kind.
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int64:
+		b := b.(int64)
+		if a < b {
+			return -1
+		} else if a > b {
+			return 1
+		}
+	case bool:
+		b := b.(bool)
+		if !a && b {
+			return -1
+		} else if a && !b {
+			return 1
+		}
+	case time.Time:
+		b := b.(time.Time)
+		if a.Before(b) {
+			return -1
+		} else if a.After(b) {
+			return 1
+		}
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+
+	return 0
+}
+
+// columnValue returns the value of the column for the entity v, which must be
+// a pointer to a struct. The column name is derived from the name of the
+// struct field, like for the database (see ToSnakeCase).
+func columnValue(v interface{}, column string) interface{} {
+	s := reflect.Indirect(reflect.ValueOf(v))
+	for i := 0; i < s.NumField(); i++ {
+		if ToSnakeCase(s.Type().Field(i).Name) == column {
+			return s.Field(i).Interface()
+		}
+	}
+
+	panic(fmt.Sprintf("column %q not found for %T", column, v))
+}
+
+// listCursor is the position in a sorted list, it is encoded as base64
+// JSON for the API.
+type listCursor struct {
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+// listQuery is the checked and parsed form of ListOptions.
+type listQuery struct {
+	ListOptions
+
+	filter map[string]interface{}
+
+	// cursor is nil for the first page
+	cursor      *listCursor
+	cursorValue interface{}
+}
+
+// query checks the options and returns the parsed form. The error is of type
+// *ListError.
+func (o ListOptions) query(fields listFields) (*listQuery, error) {
+	if o.Sort == "" {
+		o.Sort = "id"
+	}
+
+	kind, ok := fields[o.Sort]
+	if !ok {
+		return nil, listErrorf("unknown field %q for sorting", o.Sort)
+	}
+
+	if o.Limit < 0 {
+		return nil, listErrorf("invalid limit %d", o.Limit)
+	}
+
+	q := &listQuery{ListOptions: o, filter: make(map[string]interface{})}
+
+	for name, s := range o.Filter {
+		k, ok := fields[name]
+		if !ok {
+			return nil, listErrorf("unknown field %q for filtering", name)
+		}
+
+		if k == kindTimestamp {
+			return nil, listErrorf("field %q cannot be filtered", name)
+		}
+
+		v, err := parseValue(k, s)
+		if err != nil {
+			return nil, listErrorf("invalid value %q for field %q", s, name)
+		}
+
+		q.filter[name] = v
+	}
+
+	if o.Cursor != "" {
+		buf, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+		if err != nil {
+			return nil, listErrorf("invalid cursor")
+		}
+
+		q.cursor = &listCursor{}
+		if err = json.Unmarshal(buf, q.cursor); err != nil {
+			return nil, listErrorf("invalid cursor")
+		}
+
+		q.cursorValue, err = parseValue(kind, q.cursor.Value)
+		if err != nil {
+			return nil, listErrorf("invalid cursor")
+		}
+	}
+
+	return q, nil
+}
+
+// sql returns the SQL condition (using the bindvar '?') for the filter and
+// the cursor, and the ORDER BY and LIMIT clauses. One more entity than
+// requested is selected, so that the caller can find out if there is a next
+// page.
+func (q *listQuery) sql() (cond, order string, args []interface{}) {
+	conds := []string{"TRUE"}
+
+	// sort the names, so that the SQL statement is deterministic
+	var names []string
+	for name := range q.filter {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		conds = append(conds, name+" = ?")
+		args = append(args, q.filter[name])
+	}
+
+	dir, op := "ASC", ">"
+	if q.Desc {
+		dir, op = "DESC", "<"
+	}
+
+	if q.cursor != nil {
+		if q.Sort == "id" {
+			conds = append(conds, "id "+op+" ?")
+			args = append(args, q.cursor.ID)
+		} else {
+			conds = append(conds, "("+q.Sort+", id) "+op+" (?, ?)")
+			args = append(args, q.cursorValue, q.cursor.ID)
+		}
+	}
+
+	order = " ORDER BY " + q.Sort + " " + dir
+	if q.Sort != "id" {
+		order += ", id " + dir
+	}
+
+	if q.Limit > 0 {
+		order += fmt.Sprintf(" LIMIT %d", q.Limit+1)
+	}
+
+	return strings.Join(conds, " AND "), order, args
+}
+
+// less returns true if the entity a is sorted before b.
+func (q *listQuery) less(a, b interface{}) bool {
+	c := compareValues(columnValue(a, q.Sort), columnValue(b, q.Sort))
+	if c == 0 {
+		c = compareValues(columnValue(a, "id"), columnValue(b, "id"))
+	}
+
+	if q.Desc {
+		return c > 0
+	}
+
+	return c < 0
+}
+
+// match returns true if the entity v matches the filter and comes after the
+// cursor. It has the same semantics as the SQL condition returned by sql.
+func (q *listQuery) match(v interface{}) bool {
+	for name, value := range q.filter {
+		if compareValues(columnValue(v, name), value) != 0 {
+			return false
+		}
+	}
+
+	if q.cursor == nil {
+		return true
+	}
+
+	c := compareValues(columnValue(v, q.Sort), q.cursorValue)
+	if c == 0 {
+		c = compareValues(columnValue(v, "id"), q.cursor.ID)
+	}
+
+	if q.Desc {
+		return c < 0
+	}
+
+	return c > 0
+}
+
+// cursorAfter returns the cursor for the page starting after the entity v.
+func (q *listQuery) cursorAfter(v interface{}) string {
+	buf, err := json.Marshal(listCursor{
+		Value: formatValue(columnValue(v, q.Sort)),
+		ID:    columnValue(v, "id").(int64),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testListPeople(t *testing.T, db DB) {
+	var ids []int64
+	for _, name := range []string{"Listtest C", "Listtest A", "Listtest B"} {
+		p := NewPerson(name)
+		p.City = "Listcity"
+		if err := db.InsertPerson(p); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, p.ID)
+	}
+
+	filter := map[string]string{"city": "Listcity"}
+
+	for _, test := range []struct {
+		opts  ListOptions
+		pages [][]int64
+	}{
+		{ListOptions{Filter: filter}, [][]int64{{ids[0], ids[1], ids[2]}}},
+		{ListOptions{Filter: filter, Sort: "name", Limit: 2}, [][]int64{{ids[1], ids[2]}, {ids[0]}}},
+		{ListOptions{Filter: filter, Sort: "name", Desc: true, Limit: 2}, [][]int64{{ids[0], ids[2]}, {ids[1]}}},
+		{ListOptions{Filter: filter, Sort: "created_at", Limit: 1}, [][]int64{{ids[0]}, {ids[1]}, {ids[2]}}},
+		{ListOptions{Filter: filter, Limit: 3}, [][]int64{{ids[0], ids[1], ids[2]}}},
+		{ListOptions{Filter: map[string]string{"city": "Listcity", "name": "Listtest B"}}, [][]int64{{ids[2]}}},
+	} {
+		opts := test.opts
+		var pages [][]int64
+		for {
+			people, next, err := db.ListPeople(TagFilter{}, opts)
+			if err != nil {
+				t.Fatalf("options %+v returned error %v", opts, err)
+			}
+
+			var page []int64
+			for _, p := range people {
+				page = append(page, p.ID)
+			}
+			pages = append(pages, page)
+
+			if next == "" || len(pages) > len(test.pages) {
+				break
+			}
+
+			opts.Cursor = next
+		}
+
+		if !reflect.DeepEqual(pages, test.pages) {
+			t.Errorf("options %+v returned wrong pages, want %v, got %v", test.opts, test.pages, pages)
+		}
+	}
+
+	for _, opts := range []ListOptions{
+		{Sort: "foo"},
+		{Sort: "email"},
+		{Filter: map[string]string{"foo": "bar"}},
+		{Filter: map[string]string{"created_at": "2016-04-24T10:30:07Z"}},
+		{Filter: map[string]string{"version": "x"}},
+		{Cursor: "foo"},
+		{Limit: -1},
+	} {
+		_, _, err := db.ListPeople(TagFilter{}, opts)
+		if _, ok := err.(*ListError); !ok {
+			t.Errorf("invalid options %+v returned wrong error %v", opts, err)
+		}
+	}
+
+	for _, id := range ids {
+		if err := db.DeletePerson(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDBListPeople(t *testing.T) {
+	testListPeople(t, testDB)
+}
+
+func TestMockDBListPeople(t *testing.T) {
+	testListPeople(t, NewMockDB(20, 5))
+}
+
+func testListUsers(t *testing.T, db DB) {
+	all, next, err := db.ListUsers(ListOptions{Sort: "login"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next != "" {
+		t.Fatalf("list without limit returned cursor %q", next)
+	}
+
+	var users []*User
+	opts := ListOptions{Sort: "login", Limit: 2}
+	for {
+		page, next, err := db.ListUsers(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(page) > 2 {
+			t.Fatalf("page with limit 2 contains %d users", len(page))
+		}
+
+		users = append(users, page...)
+		if next == "" {
+			break
+		}
+		opts.Cursor = next
+	}
+
+	if len(users) != len(all) {
+		t.Fatalf("paging returned %d users, want %d", len(users), len(all))
+	}
+
+	for i := range all {
+		if users[i].ID != all[i].ID {
+			t.Fatalf("paging returned wrong users, want %v, got %v", all, users)
+		}
+
+		if i > 0 && all[i-1].Login > all[i].Login {
+			t.Fatalf("users are not sorted by login: %v", all)
+		}
+	}
+
+	admins, _, err := db.ListUsers(ListOptions{Filter: map[string]string{"admin": "true", "login": "admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(admins) != 1 || admins[0].Login != "admin" {
+		t.Fatalf("filter returned wrong list of users: %v", admins)
+	}
+}
+
+func TestDBListUsers(t *testing.T) {
+	testListUsers(t, testDB)
+}
+
+func TestMockDBListUsers(t *testing.T) {
+	testListUsers(t, NewMockDB(20, 5))
+}
+
+func testIteratePeople(t *testing.T, db DB) {
+	for _, opts := range []ListOptions{
+		{},
+		{Sort: "name", Desc: true},
+		{Sort: "city", Limit: 5},
+		{Filter: map[string]string{"version": "1"}},
+	} {
+		want, _, err := db.ListPeople(TagFilter{}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		it, err := db.IteratePeople(TagFilter{}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var people []*Person
+		for it.Next() {
+			people = append(people, it.Person())
+		}
+
+		if err = it.Err(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = it.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(personIDs(people), personIDs(want)) {
+			t.Errorf("options %+v: iterator returned wrong people, want %v, got %v", opts, personIDs(want), personIDs(people))
+			continue
+		}
+
+		for i, p := range people {
+			if p.ID != want[i].ID {
+				t.Errorf("options %+v: iterator returned wrong order, want %v, got %v", opts, want[i].ID, p.ID)
+				break
+			}
+
+			if !p.PhoneNumbers.Equals(want[i].PhoneNumbers) || !p.EmailAddresses.Equals(want[i].EmailAddresses) {
+				t.Errorf("options %+v: details for person %v not loaded: %v", opts, p.ID, p)
+			}
+		}
+	}
+
+	if _, err := db.IteratePeople(TagFilter{}, ListOptions{Sort: "foo"}); err == nil {
+		t.Errorf("invalid options did not return an error")
+	}
+}
+
+func TestDBIteratePeople(t *testing.T) {
+	testIteratePeople(t, testDB)
+}
+
+func TestMockDBIteratePeople(t *testing.T) {
+	testIteratePeople(t, NewMockDB(20, 5))
+}
@@ -2,17 +2,46 @@ package db
 
 import (
 	"errors"
+	"fmt"
+	"ghenga/query"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
-// MockDB implements the DB interface but only stores data in memory.
+// MockDB implements the DB interface but only stores data in memory. It is
+// safe for concurrent use, mu is held by all exported methods.
 type MockDB struct {
+	mu sync.Mutex
+
 	users    []User
 	userID   int64
 	people   []Person
 	personID int64
 	sessions []Session
+
+	accounts  []Account
+	accountID int64
+
+	activities []Activity
+	activityID int64
+
+	tasks  []Task
+	taskID int64
+
+	events         []Event
+	eventID        int64
+	calendarTokens []CalendarToken
+
+	tags  []Tag
+	tagID int64
+
+	customFields  []CustomField
+	customFieldID int64
+
+	savedSearches []SavedSearch
+	savedSearchID int64
 }
 
 // ensure that *MockDB implements DB
@@ -20,11 +49,22 @@ var _ DB = &MockDB{}
 
 // Close does nothing.
 func (db *MockDB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	return nil
 }
 
 // InsertUser adds a new user to the db.
 func (db *MockDB) InsertUser(u *User) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.insertUser(u)
+}
+
+// insertUser implements InsertUser, db.mu must be held.
+func (db *MockDB) insertUser(u *User) error {
 	u.Version++
 	db.userID++
 	u.ID = db.userID
@@ -33,23 +73,62 @@ func (db *MockDB) InsertUser(u *User) error {
 	return nil
 }
 
-// ListUsers returns a list of all users.
-func (db *MockDB) ListUsers() ([]*User, error) {
+// listSorter sorts entities as specified by a list query.
+type listSorter struct {
+	q    *listQuery
+	len  int
+	swap func(i, j int)
+	get  func(i int) interface{}
+}
+
+func (l listSorter) Len() int           { return l.len }
+func (l listSorter) Swap(i, j int)      { l.swap(i, j) }
+func (l listSorter) Less(i, j int) bool { return l.q.less(l.get(i), l.get(j)) }
+
+// ListUsers returns a page of the list of users, sorted and filtered as
+// specified in opts.
+func (db *MockDB) ListUsers(opts ListOptions) ([]*User, string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	q, err := opts.query(userListFields)
+	if err != nil {
+		return nil, "", err
+	}
+
 	list := make([]*User, 0, len(db.users))
 	for _, u := range db.users {
 		user := u
-		list = append(list, &user)
+		if q.match(&user) {
+			list = append(list, &user)
+		}
 	}
 
-	return list, nil
+	sort.Sort(listSorter{
+		q:    q,
+		len:  len(list),
+		swap: func(i, j int) { list[i], list[j] = list[j], list[i] },
+		get:  func(i int) interface{} { return list[i] },
+	})
+
+	var next string
+	if q.Limit > 0 && len(list) > q.Limit {
+		list = list[:q.Limit]
+		next = q.cursorAfter(list[q.Limit-1])
+	}
+
+	return list, next, nil
 }
 
 // UpdateUser modifies an existing user record in the db.
 func (db *MockDB) UpdateUser(u *User) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	for i, user := range db.users {
 		if user.ID == u.ID {
 			if user.Version != u.Version {
-				return errors.New("wrong version")
+				return ErrVersionConflict
 			}
 
 			if u.Password != "" {
@@ -71,8 +150,43 @@ func (db *MockDB) UpdateUser(u *User) error {
 
 // DeleteUser removes a record from the db.
 func (db *MockDB) DeleteUser(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.deleteUser(id)
+}
+
+// DeleteUserVersion removes a record from the db if it still has the given
+// version.
+func (db *MockDB) DeleteUserVersion(id, version int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, user := range db.users {
+		if user.ID == id && user.Version != version {
+			return ErrVersionConflict
+		}
+	}
+
+	return db.deleteUser(id)
+}
+
+// deleteUser implements DeleteUser, db.mu must be held.
+func (db *MockDB) deleteUser(id int64) error {
 	for i, user := range db.users {
 		if user.ID == id {
+			for _, a := range db.activities {
+				if a.Author == user.Login {
+					return ErrUserReferenced
+				}
+			}
+
+			for _, task := range db.tasks {
+				if task.Assignee == user.Login {
+					return ErrUserReferenced
+				}
+			}
+
 			db.users = append(db.users[:i], db.users[i+1:]...)
 			return nil
 		}
@@ -83,6 +197,9 @@ func (db *MockDB) DeleteUser(id int64) error {
 
 // FindUser returns the user with the given id.
 func (db *MockDB) FindUser(id int64) (*User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	for _, user := range db.users {
 		if user.ID == id {
 			return &user, nil
@@ -94,6 +211,9 @@ func (db *MockDB) FindUser(id int64) (*User, error) {
 
 // FindUserName searches for a user with the given login name.
 func (db *MockDB) FindUserName(name string) (*User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	for _, user := range db.users {
 		if user.Login == name {
 			return &user, nil
@@ -105,31 +225,109 @@ func (db *MockDB) FindUserName(name string) (*User, error) {
 
 // InsertPerson adds a new person to the db.
 func (db *MockDB) InsertPerson(p *Person) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.insertPerson(p)
+}
+
+// insertPerson implements InsertPerson, db.mu must be held.
+func (db *MockDB) insertPerson(p *Person) error {
 	p.Version++
 	db.personID++
 	p.ID = db.personID
-	db.people = append(db.people, *p)
+	p.updatePhoneticCodes()
+	db.people = append(db.people, db.copyPerson(*p))
 	return nil
 }
 
-// ListPeople returns a list of all people in the database.
-func (db *MockDB) ListPeople() ([]*Person, error) {
+// copyPerson returns a copy of p which does not share the list of tags. Tags
+// which do not exist are removed.
+func (db *MockDB) copyPerson(p Person) Person {
+	tags := p.Tags
+	p.Tags = nil
+	for _, tag := range tags {
+		if _, err := db.findTagName(tag); err == nil {
+			p.Tags = append(p.Tags, tag)
+		}
+	}
+	sort.Strings(p.Tags)
+	p.Custom = copyCustomValues(p.Custom)
+	return p
+}
+
+// ListPeople returns a page of the list of people matching the tag filter,
+// sorted and filtered as specified in opts.
+func (db *MockDB) ListPeople(tags TagFilter, opts ListOptions) ([]*Person, string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.listPeople(tags, opts)
+}
+
+// listPeople implements ListPeople, db.mu must be held.
+func (db *MockDB) listPeople(tags TagFilter, opts ListOptions) ([]*Person, string, error) {
+	q, err := opts.query(personListFields)
+	if err != nil {
+		return nil, "", err
+	}
+
 	list := make([]*Person, 0, len(db.people))
 	for _, u := range db.people {
-		list = append(list, &u)
+		p := u
+		if tags.Match(p.Tags) && q.match(&p) {
+			list = append(list, &p)
+		}
 	}
-	return list, nil
+
+	sort.Sort(listSorter{
+		q:    q,
+		len:  len(list),
+		swap: func(i, j int) { list[i], list[j] = list[j], list[i] },
+		get:  func(i int) interface{} { return list[i] },
+	})
+
+	var next string
+	if q.Limit > 0 && len(list) > q.Limit {
+		list = list[:q.Limit]
+		next = q.cursorAfter(list[q.Limit-1])
+	}
+
+	return list, next, nil
+}
+
+// IteratePeople returns an iterator over the people matching the tag filter,
+// sorted and filtered as specified in opts.
+func (db *MockDB) IteratePeople(tags TagFilter, opts ListOptions) (PeopleIterator, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	list, _, err := db.listPeople(tags, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &peopleSlice{list: list}, nil
 }
 
 // UpdatePerson modifies a person in the db.
 func (db *MockDB) UpdatePerson(p *Person) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.updatePerson(p)
+}
+
+// updatePerson implements UpdatePerson, db.mu must be held.
+func (db *MockDB) updatePerson(p *Person) error {
 	for i, person := range db.people {
 		if person.ID == p.ID {
 			if person.Version != p.Version {
-				return errors.New("wrong version")
+				return ErrVersionConflict
 			}
 			p.Version++
-			db.people[i] = *p
+			p.updatePhoneticCodes()
+			db.people[i] = db.copyPerson(*p)
 			return nil
 		}
 	}
@@ -139,9 +337,58 @@ func (db *MockDB) UpdatePerson(p *Person) error {
 
 // DeletePerson removes a person from the db.
 func (db *MockDB) DeletePerson(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.deletePerson(id)
+}
+
+// DeletePersonVersion removes a person from the db if it still has the given
+// version.
+func (db *MockDB) DeletePersonVersion(id, version int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.deletePersonVersion(id, version)
+}
+
+// deletePersonVersion implements DeletePersonVersion, db.mu must be held.
+func (db *MockDB) deletePersonVersion(id, version int64) error {
+	for _, person := range db.people {
+		if person.ID == id && person.Version != version {
+			return ErrVersionConflict
+		}
+	}
+
+	return db.deletePerson(id)
+}
+
+// deletePerson implements DeletePerson, db.mu must be held.
+func (db *MockDB) deletePerson(id int64) error {
 	for i, person := range db.people {
 		if person.ID == id {
 			db.people = append(db.people[:i], db.people[i+1:]...)
+			db.removeActivities(func(a Activity) bool {
+				return a.PersonID.Valid && a.PersonID.Int64 == id
+			})
+
+			for j, task := range db.tasks {
+				if task.PersonID.Valid && task.PersonID.Int64 == id {
+					db.tasks[j].PersonID.Valid = false
+					db.tasks[j].PersonID.Int64 = 0
+				}
+			}
+
+			for j, event := range db.events {
+				var people []int64
+				for _, pid := range event.People {
+					if pid != id {
+						people = append(people, pid)
+					}
+				}
+				db.events[j].People = people
+			}
+
 			return nil
 		}
 	}
@@ -151,6 +398,9 @@ func (db *MockDB) DeletePerson(id int64) error {
 
 // FindPerson searches for a person.
 func (db *MockDB) FindPerson(id int64) (*Person, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	for _, person := range db.people {
 		if person.ID == id {
 			return &person, nil
@@ -160,12 +410,73 @@ func (db *MockDB) FindPerson(id int64) (*Person, error) {
 	return nil, errors.New("person not found")
 }
 
-// FuzzyFindPersons returns all people matching query.
-func (db *MockDB) FuzzyFindPersons(query string) ([]*Person, error) {
-	query = strings.ToLower(query)
+// FuzzyFindPersons returns all people matching query and the tag filter,
+// ordered by relevance. See Database.FuzzyFindPersons for the semantics.
+func (db *MockDB) FuzzyFindPersons(query string, mode SearchMode, tags TagFilter) ([]*Person, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var match func(Person) (float64, bool)
+
+	switch mode {
+	case SearchFullText:
+		terms := searchTerms(query)
+		query = fold(query)
+		match = func(p Person) (float64, bool) {
+			rank := searchRank(p, terms)
+			return rank, rank > 0 || strings.Contains(fold(p.Name), query) || emailContains(p.EmailAddresses, query)
+		}
+	case SearchSimilar:
+		match = func(p Person) (float64, bool) {
+			score := nameSimilarity(p.Name, query)
+			return score, score >= similarityThreshold
+		}
+	case SearchPhonetic:
+		pq := newPhoneticQuery(query)
+		match = func(p Person) (float64, bool) {
+			rank := pq.rank(p)
+			return rank, rank > 0
+		}
+	default:
+		return nil, fmt.Errorf("invalid search mode %q", mode)
+	}
+
+	var results []rankedPerson
+	for _, person := range db.people {
+		if !tags.Match(person.Tags) {
+			continue
+		}
+
+		if rank, ok := match(person); ok {
+			p := person
+			results = append(results, rankedPerson{p: &p, rank: rank})
+		}
+	}
+
+	return sortByRank(results), nil
+}
+
+// emailContains returns true iff one of the folded addresses contains the
+// string s, see fold.
+func emailContains(addresses EmailAddresses, s string) bool {
+	for _, addr := range addresses {
+		if strings.Contains(fold(addr.Address), s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FindPeopleByEmail returns all persons which have the given email address.
+// Case is ignored.
+func (db *MockDB) FindPeopleByEmail(address string) ([]*Person, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	var list []*Person
 	for _, person := range db.people {
-		if strings.Contains(strings.ToLower(person.Name), query) {
+		if person.EmailAddresses.Contains(address) {
 			p := person
 			list = append(list, &p)
 		}
@@ -174,54 +485,1132 @@ func (db *MockDB) FuzzyFindPersons(query string) ([]*Person, error) {
 	return list, nil
 }
 
-// SaveNewSession creates a new session and saves it in the db.
-func (db *MockDB) SaveNewSession(login string, until time.Duration) (*Session, error) {
-	s, err := newSession(login, until)
+// LookupPhoneNumber returns the people having the phone number, regardless
+// of the formatting. See Database.LookupPhoneNumber for the semantics.
+func (db *MockDB) LookupPhoneNumber(number string) ([]*PhoneLookupResult, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	n := normalizePhoneNumber(number)
+	if n == "" {
+		return nil, errors.New("phone number is empty")
+	}
+
+	var result []*PhoneLookupResult
+	for _, person := range db.people {
+		for _, num := range person.PhoneNumbers {
+			if normalizePhoneNumber(num.Number) == n {
+				p := person
+				result = append(result, &PhoneLookupResult{Person: &p, Type: num.Type, Number: num.Number})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// SearchPeople returns all people matching the query and the tag filter. The
+// error for an invalid query is of type *query.Error.
+func (db *MockDB) SearchPeople(q query.Query, tags TagFilter) ([]*Person, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	match, err := queryPredicate(q)
 	if err != nil {
 		return nil, err
 	}
 
-	db.sessions = append(db.sessions, *s)
-	return s, nil
+	var list []*Person
+	for _, person := range db.people {
+		if tags.Match(person.Tags) && match(person) {
+			p := person
+			list = append(list, &p)
+		}
+	}
+
+	return list, nil
 }
 
-// FindSession returns the session for the given token.
-func (db *MockDB) FindSession(token string) (*Session, error) {
-	for _, s := range db.sessions {
-		if s.Token == token {
-			return &s, nil
+// Search returns at most limit entities of the given types which contain all
+// words of the query, ordered by relevance. See Database.Search for the
+// semantics.
+func (db *MockDB) Search(query string, types []string, limit int) ([]*SearchHit, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := checkSearchTypes(types); err != nil {
+		return nil, err
+	}
+
+	var docs []searchDoc
+	for _, typ := range types {
+		switch typ {
+		case SearchTypePerson:
+			for _, p := range db.people {
+				docs = append(docs, personSearchDoc(p))
+			}
+		case SearchTypeAccount:
+			for _, a := range db.accounts {
+				docs = append(docs, accountSearchDoc(a))
+			}
+		case SearchTypeActivity:
+			for _, a := range db.activities {
+				docs = append(docs, activitySearchDoc(a))
+			}
+		case SearchTypeTask:
+			for _, t := range db.tasks {
+				docs = append(docs, taskSearchDoc(t))
+			}
+		case SearchTypeEvent:
+			for _, e := range db.events {
+				docs = append(docs, eventSearchDoc(e))
+			}
+		case SearchTypeTag:
+			for _, t := range db.tags {
+				docs = append(docs, tagSearchDoc(t))
+			}
+		case SearchTypeUser:
+			for _, u := range db.users {
+				docs = append(docs, userSearchDoc(u))
+			}
 		}
 	}
 
-	return nil, errors.New("session not found")
+	return searchHits(docs, searchTerms(query), limit), nil
 }
 
-// Invalidate removes the session from the database.
-func (db *MockDB) Invalidate(s *Session) error {
-	for i, session := range db.sessions {
-		if session.Token == s.Token {
-			db.sessions = append(db.sessions[:i], db.sessions[i+1:]...)
+// SuggestPeople returns at most limit people for the prefix. See
+// Database.SuggestPeople for the semantics, the timeout is ignored.
+func (db *MockDB) SuggestPeople(prefix string, limit int, timeout time.Duration) ([]*PersonSuggestion, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	terms := searchTerms(prefix)
+	if len(terms) == 0 || limit <= 0 {
+		return nil, nil
+	}
+
+	var list []suggestion
+	for _, p := range db.people {
+		if match, isPrefix := suggestMatch(p.Name, prefix, terms); match {
+			s := &PersonSuggestion{ID: p.ID, Name: p.Name, Title: p.Title, Department: p.Department}
+			list = append(list, suggestion{s: s, prefix: isPrefix})
+		}
+	}
+
+	sort.Sort(bySuggestion(list))
+
+	var result []*PersonSuggestion
+	for i := 0; i < len(list) && i < limit; i++ {
+		result = append(result, list[i].s)
+	}
+
+	return result, nil
+}
+
+// InsertAccount adds a new account to the db.
+func (db *MockDB) InsertAccount(a *Account) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	a.Version++
+	db.accountID++
+	a.ID = db.accountID
+	db.accounts = append(db.accounts, *a)
+	return nil
+}
+
+// ListAccounts returns a list of all accounts in the database.
+func (db *MockDB) ListAccounts() ([]*Account, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	list := make([]*Account, 0, len(db.accounts))
+	for _, a := range db.accounts {
+		account := a
+		list = append(list, &account)
+	}
+	return list, nil
+}
+
+// UpdateAccount modifies an account in the db.
+func (db *MockDB) UpdateAccount(a *Account) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, account := range db.accounts {
+		if account.ID == a.ID {
+			if account.Version != a.Version {
+				return errors.New("wrong version")
+			}
+			a.Version++
+			db.accounts[i] = *a
 			return nil
 		}
 	}
 
-	return errors.New("session not found")
+	return errors.New("account not found")
 }
 
-// ExpireSessions removes all sessions which have timed out.
-func (db *MockDB) ExpireSessions(now time.Time) (n int, err error) {
-	var out []Session
+// DeleteAccount removes an account from the db. People associated with the
+// account are kept, their account is reset.
+func (db *MockDB) DeleteAccount(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
-	for _, session := range db.sessions {
-		if session.ValidUntil.Before(now) {
-			n++
-			continue
+	for i, account := range db.accounts {
+		if account.ID == id {
+			db.accounts = append(db.accounts[:i], db.accounts[i+1:]...)
+
+			for j, person := range db.people {
+				if person.AccountID.Valid && person.AccountID.Int64 == id {
+					db.people[j].AccountID.Valid = false
+					db.people[j].AccountID.Int64 = 0
+					db.people[j].Version++
+				}
+			}
+
+			db.removeActivities(func(a Activity) bool {
+				return a.AccountID.Valid && a.AccountID.Int64 == id
+			})
+
+			for j, task := range db.tasks {
+				if task.AccountID.Valid && task.AccountID.Int64 == id {
+					db.tasks[j].AccountID.Valid = false
+					db.tasks[j].AccountID.Int64 = 0
+				}
+			}
+
+			return nil
 		}
+	}
 
-		out = append(out, session)
+	return errors.New("account not found")
+}
+
+// FindAccount searches for an account.
+func (db *MockDB) FindAccount(id int64) (*Account, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, account := range db.accounts {
+		if account.ID == id {
+			return &account, nil
+		}
 	}
 
-	db.sessions = out
+	return nil, errors.New("account not found")
+}
 
-	return n, err
+// ListAccountPeople returns all people associated with the account.
+func (db *MockDB) ListAccountPeople(id int64) ([]*Person, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var list []*Person
+	for _, person := range db.people {
+		if person.AccountID.Valid && person.AccountID.Int64 == id {
+			p := person
+			list = append(list, &p)
+		}
+	}
+
+	return list, nil
+}
+
+// byOccurredAt sorts activities by the time they occurred, the most recent
+// first.
+type byOccurredAt []*Activity
+
+func (l byOccurredAt) Len() int      { return len(l) }
+func (l byOccurredAt) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byOccurredAt) Less(i, j int) bool {
+	if l[i].OccurredAt.Equal(l[j].OccurredAt) {
+		return l[i].ID > l[j].ID
+	}
+	return l[i].OccurredAt.After(l[j].OccurredAt)
+}
+
+// removeActivities removes all activities for which fn returns true.
+func (db *MockDB) removeActivities(fn func(Activity) bool) {
+	var out []Activity
+	for _, a := range db.activities {
+		if !fn(a) {
+			out = append(out, a)
+		}
+	}
+	db.activities = out
+}
+
+// InsertActivity adds a new activity to the db.
+func (db *MockDB) InsertActivity(a *Activity) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	a.Version++
+	db.activityID++
+	a.ID = db.activityID
+	db.activities = append(db.activities, *a)
+	return nil
+}
+
+// ListActivities returns a list of all activities in the database, the most
+// recent first.
+func (db *MockDB) ListActivities() ([]*Activity, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	list := make([]*Activity, 0, len(db.activities))
+	for _, a := range db.activities {
+		activity := a
+		list = append(list, &activity)
+	}
+	sort.Sort(byOccurredAt(list))
+	return list, nil
+}
+
+// UpdateActivity modifies an activity in the db.
+func (db *MockDB) UpdateActivity(a *Activity) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, activity := range db.activities {
+		if activity.ID == a.ID {
+			if activity.Version != a.Version {
+				return errors.New("wrong version")
+			}
+			a.Version++
+			db.activities[i] = *a
+			return nil
+		}
+	}
+
+	return errors.New("activity not found")
+}
+
+// DeleteActivity removes an activity from the db.
+func (db *MockDB) DeleteActivity(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, activity := range db.activities {
+		if activity.ID == id {
+			db.activities = append(db.activities[:i], db.activities[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("activity not found")
+}
+
+// FindActivity searches for an activity.
+func (db *MockDB) FindActivity(id int64) (*Activity, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, activity := range db.activities {
+		if activity.ID == id {
+			return &activity, nil
+		}
+	}
+
+	return nil, errors.New("activity not found")
+}
+
+// ListPersonActivities returns all activities linked to the person, the most
+// recent first.
+func (db *MockDB) ListPersonActivities(id int64) ([]*Activity, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var list []*Activity
+	for _, activity := range db.activities {
+		if activity.PersonID.Valid && activity.PersonID.Int64 == id {
+			a := activity
+			list = append(list, &a)
+		}
+	}
+	sort.Sort(byOccurredAt(list))
+	return list, nil
+}
+
+// InsertTask adds a new task to the db.
+func (db *MockDB) InsertTask(t *Task) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t.Version++
+	db.taskID++
+	t.ID = db.taskID
+	db.tasks = append(db.tasks, *t)
+	return nil
+}
+
+// ListTasks returns a list of all tasks in the database.
+func (db *MockDB) ListTasks() ([]*Task, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	list := make([]*Task, 0, len(db.tasks))
+	for _, t := range db.tasks {
+		task := t
+		list = append(list, &task)
+	}
+	return list, nil
+}
+
+// UpdateTask modifies a task in the db.
+func (db *MockDB) UpdateTask(t *Task) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, task := range db.tasks {
+		if task.ID == t.ID {
+			if task.Version != t.Version {
+				return errors.New("wrong version")
+			}
+			t.Version++
+			db.tasks[i] = *t
+			return nil
+		}
+	}
+
+	return errors.New("task not found")
+}
+
+// DeleteTask removes a task from the db.
+func (db *MockDB) DeleteTask(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, task := range db.tasks {
+		if task.ID == id {
+			db.tasks = append(db.tasks[:i], db.tasks[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("task not found")
+}
+
+// FindTask searches for a task.
+func (db *MockDB) FindTask(id int64) (*Task, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, task := range db.tasks {
+		if task.ID == id {
+			return &task, nil
+		}
+	}
+
+	return nil, errors.New("task not found")
+}
+
+// byDueDate sorts tasks by due date, tasks without a due date come last.
+type byDueDate []*Task
+
+func (l byDueDate) Len() int      { return len(l) }
+func (l byDueDate) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byDueDate) Less(i, j int) bool {
+	a, b := l[i].DueDate, l[j].DueDate
+	switch {
+	case a.Valid && b.Valid && !a.Time.Equal(b.Time):
+		return a.Time.Before(b.Time)
+	case a.Valid != b.Valid:
+		return a.Valid
+	}
+	return l[i].ID < l[j].ID
+}
+
+// ListOpenTasks returns the list of open tasks assigned to the user, ordered
+// by due date. Tasks without a due date come last.
+func (db *MockDB) ListOpenTasks(assignee string) ([]*Task, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var list []*Task
+	for _, task := range db.tasks {
+		if task.Assignee == assignee && task.Status == TaskOpen {
+			t := task
+			list = append(list, &t)
+		}
+	}
+	sort.Sort(byDueDate(list))
+	return list, nil
+}
+
+// copyEvent returns a copy of e which does not share the lists of
+// participants.
+func copyEvent(e Event) Event {
+	e.People = append([]int64(nil), e.People...)
+	e.Users = append([]string(nil), e.Users...)
+	return e
+}
+
+// InsertEvent adds a new event to the db.
+func (db *MockDB) InsertEvent(e *Event) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	e.Version++
+	db.eventID++
+	e.ID = db.eventID
+	db.events = append(db.events, copyEvent(*e))
+	return nil
+}
+
+// byStart sorts events by start time.
+type byStart []*Event
+
+func (l byStart) Len() int      { return len(l) }
+func (l byStart) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byStart) Less(i, j int) bool {
+	if l[i].StartAt.Equal(l[j].StartAt) {
+		return l[i].ID < l[j].ID
+	}
+	return l[i].StartAt.Before(l[j].StartAt)
+}
+
+// ListEvents returns a list of all events in the database, ordered by start
+// time.
+func (db *MockDB) ListEvents() ([]*Event, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	list := make([]*Event, 0, len(db.events))
+	for _, e := range db.events {
+		event := copyEvent(e)
+		list = append(list, &event)
+	}
+	sort.Sort(byStart(list))
+	return list, nil
+}
+
+// UpdateEvent modifies an event in the db.
+func (db *MockDB) UpdateEvent(e *Event) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, event := range db.events {
+		if event.ID == e.ID {
+			if event.Version != e.Version {
+				return errors.New("wrong version")
+			}
+			e.Version++
+			db.events[i] = copyEvent(*e)
+			return nil
+		}
+	}
+
+	return errors.New("event not found")
+}
+
+// DeleteEvent removes an event from the db.
+func (db *MockDB) DeleteEvent(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, event := range db.events {
+		if event.ID == id {
+			db.events = append(db.events[:i], db.events[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("event not found")
+}
+
+// FindEvent searches for an event.
+func (db *MockDB) FindEvent(id int64) (*Event, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, event := range db.events {
+		if event.ID == id {
+			e := copyEvent(event)
+			return &e, nil
+		}
+	}
+
+	return nil, errors.New("event not found")
+}
+
+// ListUserEvents returns the list of events the user participates in, ordered
+// by start time.
+func (db *MockDB) ListUserEvents(login string) ([]*Event, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var list []*Event
+	for _, event := range db.events {
+		if event.HasUser(login) {
+			e := copyEvent(event)
+			list = append(list, &e)
+		}
+	}
+	sort.Sort(byStart(list))
+	return list, nil
+}
+
+// CalendarToken returns the token for the calendar feed of the user. If the
+// user does not have a token yet, a new one is generated.
+func (db *MockDB) CalendarToken(login string) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, ct := range db.calendarTokens {
+		if ct.User == login {
+			return ct.Token, nil
+		}
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	db.calendarTokens = append(db.calendarTokens, CalendarToken{Token: token, User: login})
+	return token, nil
+}
+
+// FindCalendarUser returns the login name of the user the calendar token
+// belongs to.
+func (db *MockDB) FindCalendarUser(token string) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, ct := range db.calendarTokens {
+		if ct.Token == token {
+			return ct.User, nil
+		}
+	}
+
+	return "", errors.New("calendar token not found")
+}
+
+// InsertTag adds a new tag to the db.
+func (db *MockDB) InsertTag(t *Tag) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, err := db.findTagName(t.Name); err == nil {
+		return errors.New("duplicate tag name")
+	}
+
+	t.Version++
+	db.tagID++
+	t.ID = db.tagID
+	db.tags = append(db.tags, *t)
+	return nil
+}
+
+// byName sorts tags by name.
+type byName []*Tag
+
+func (l byName) Len() int           { return len(l) }
+func (l byName) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l byName) Less(i, j int) bool { return l[i].Name < l[j].Name }
+
+// ListTags returns a list of all tags in the database, ordered by name.
+func (db *MockDB) ListTags() ([]*Tag, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	list := make([]*Tag, 0, len(db.tags))
+	for _, t := range db.tags {
+		tag := t
+		list = append(list, &tag)
+	}
+	sort.Sort(byName(list))
+	return list, nil
+}
+
+// UpdateTag modifies a tag in the db. When the tag is renamed, the people
+// having the tag are updated accordingly.
+func (db *MockDB) UpdateTag(t *Tag) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if other, err := db.findTagName(t.Name); err == nil && other.ID != t.ID {
+		return errors.New("duplicate tag name")
+	}
+
+	for i, tag := range db.tags {
+		if tag.ID == t.ID {
+			if tag.Version != t.Version {
+				return errors.New("wrong version")
+			}
+			t.Version++
+			db.tags[i] = *t
+			db.replacePersonTag(tag.Name, t.Name)
+			db.replaceSavedSearchTag(tag.Name, t.Name)
+			return nil
+		}
+	}
+
+	return errors.New("tag not found")
+}
+
+// replacePersonTag replaces the tag name old with new for all people. If new
+// is empty, the tag is removed. The version of the people with the tag is
+// increased.
+func (db *MockDB) replacePersonTag(old, new string) {
+	for i, person := range db.people {
+		var tags []string
+		found := false
+		for _, tag := range person.Tags {
+			switch {
+			case tag != old:
+				tags = append(tags, tag)
+			case new != "":
+				tags = append(tags, new)
+				found = true
+			default:
+				found = true
+			}
+		}
+		sort.Strings(tags)
+		db.people[i].Tags = tags
+		if found {
+			db.people[i].Version++
+		}
+	}
+}
+
+// replaceSavedSearchTag replaces the tag name old with new for all saved
+// searches, the order of the tags is kept. If new is empty, the tag is
+// removed. The version of the saved searches with the tag is increased.
+func (db *MockDB) replaceSavedSearchTag(old, new string) {
+	if old == new {
+		return
+	}
+
+	for i, search := range db.savedSearches {
+		var tags StringList
+		found := false
+		for _, tag := range search.Tags {
+			switch {
+			case tag != old:
+				tags = append(tags, tag)
+			case new != "":
+				tags = append(tags, new)
+				found = true
+			default:
+				found = true
+			}
+		}
+
+		if found {
+			db.savedSearches[i].Tags = tags
+			db.savedSearches[i].Version++
+		}
+	}
+}
+
+// DeleteTag removes a tag from the db, from all people and saved searches.
+func (db *MockDB) DeleteTag(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, tag := range db.tags {
+		if tag.ID == id {
+			db.tags = append(db.tags[:i], db.tags[i+1:]...)
+			db.replacePersonTag(tag.Name, "")
+			db.replaceSavedSearchTag(tag.Name, "")
+			return nil
+		}
+	}
+
+	return errors.New("tag not found")
+}
+
+// FindTag searches for a tag.
+func (db *MockDB) FindTag(id int64) (*Tag, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, tag := range db.tags {
+		if tag.ID == id {
+			t := tag
+			return &t, nil
+		}
+	}
+
+	return nil, errors.New("tag not found")
+}
+
+// FindTagName searches for a tag by name.
+func (db *MockDB) FindTagName(name string) (*Tag, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.findTagName(name)
+}
+
+// findTagName implements FindTagName, db.mu must be held.
+func (db *MockDB) findTagName(name string) (*Tag, error) {
+	for _, tag := range db.tags {
+		if tag.Name == name {
+			t := tag
+			return &t, nil
+		}
+	}
+
+	return nil, errors.New("tag not found")
+}
+
+// InsertCustomField adds a new custom field to the db.
+func (db *MockDB) InsertCustomField(f *CustomField) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, field := range db.customFields {
+		if field.Name == f.Name {
+			return errors.New("duplicate custom field name")
+		}
+	}
+
+	f.Version++
+	db.customFieldID++
+	f.ID = db.customFieldID
+	db.customFields = append(db.customFields, *f)
+	return nil
+}
+
+// byFieldName sorts custom fields by name.
+type byFieldName []*CustomField
+
+func (l byFieldName) Len() int           { return len(l) }
+func (l byFieldName) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l byFieldName) Less(i, j int) bool { return l[i].Name < l[j].Name }
+
+// ListCustomFields returns a list of all custom fields in the database,
+// ordered by name.
+func (db *MockDB) ListCustomFields() ([]*CustomField, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	list := make([]*CustomField, 0, len(db.customFields))
+	for _, f := range db.customFields {
+		field := f
+		list = append(list, &field)
+	}
+	sort.Sort(byFieldName(list))
+	return list, nil
+}
+
+// UpdateCustomField modifies a custom field in the db. When the field is
+// renamed, the values stored for people are renamed as well.
+func (db *MockDB) UpdateCustomField(f *CustomField) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, field := range db.customFields {
+		if field.Name == f.Name && field.ID != f.ID {
+			return errors.New("duplicate custom field name")
+		}
+	}
+
+	for i, field := range db.customFields {
+		if field.ID == f.ID {
+			if field.Version != f.Version {
+				return errors.New("wrong version")
+			}
+			f.Version++
+			db.customFields[i] = *f
+			db.renameCustomValue(field.Name, f.Name)
+			return nil
+		}
+	}
+
+	return errors.New("custom field not found")
+}
+
+// renameCustomValue renames the custom value old to new for all people. If
+// new is empty, the value is removed. The version of the people with the
+// value is increased.
+func (db *MockDB) renameCustomValue(old, new string) {
+	if old == new {
+		return
+	}
+
+	for i, person := range db.people {
+		v, ok := person.Custom[old]
+		if !ok {
+			continue
+		}
+
+		custom := copyCustomValues(person.Custom)
+		delete(custom, old)
+		if new != "" {
+			custom[new] = v
+		}
+		db.people[i].Custom = custom
+		db.people[i].Version++
+	}
+}
+
+// DeleteCustomField removes a custom field from the db and the values from
+// all people.
+func (db *MockDB) DeleteCustomField(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, field := range db.customFields {
+		if field.ID == id {
+			db.customFields = append(db.customFields[:i], db.customFields[i+1:]...)
+			db.renameCustomValue(field.Name, "")
+			return nil
+		}
+	}
+
+	return errors.New("custom field not found")
+}
+
+// FindCustomField searches for a custom field.
+func (db *MockDB) FindCustomField(id int64) (*CustomField, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, field := range db.customFields {
+		if field.ID == id {
+			f := field
+			return &f, nil
+		}
+	}
+
+	return nil, errors.New("custom field not found")
+}
+
+// copySavedSearch returns a copy of s which does not share the list of tags.
+func copySavedSearch(s SavedSearch) SavedSearch {
+	s.Tags = append(StringList(nil), s.Tags...)
+	return s
+}
+
+// InsertSavedSearch adds a new saved search to the db.
+func (db *MockDB) InsertSavedSearch(s *SavedSearch) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	s.Version++
+	db.savedSearchID++
+	s.ID = db.savedSearchID
+	db.savedSearches = append(db.savedSearches, copySavedSearch(*s))
+	return nil
+}
+
+// bySearchName sorts saved searches by name.
+type bySearchName []*SavedSearch
+
+func (l bySearchName) Len() int      { return len(l) }
+func (l bySearchName) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l bySearchName) Less(i, j int) bool {
+	if l[i].Name == l[j].Name {
+		return l[i].ID < l[j].ID
+	}
+	return l[i].Name < l[j].Name
+}
+
+// ListSavedSearches returns the searches owned by the user and all shared
+// searches, ordered by name.
+func (db *MockDB) ListSavedSearches(login string) ([]*SavedSearch, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var list []*SavedSearch
+	for _, search := range db.savedSearches {
+		if search.VisibleTo(login) {
+			s := copySavedSearch(search)
+			list = append(list, &s)
+		}
+	}
+	sort.Sort(bySearchName(list))
+	return list, nil
+}
+
+// UpdateSavedSearch modifies a saved search in the db.
+func (db *MockDB) UpdateSavedSearch(s *SavedSearch) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, search := range db.savedSearches {
+		if search.ID == s.ID {
+			if search.Version != s.Version {
+				return errors.New("wrong version")
+			}
+			s.Version++
+			db.savedSearches[i] = copySavedSearch(*s)
+			return nil
+		}
+	}
+
+	return errors.New("saved search not found")
+}
+
+// DeleteSavedSearch removes a saved search from the db.
+func (db *MockDB) DeleteSavedSearch(id int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, search := range db.savedSearches {
+		if search.ID == id {
+			db.savedSearches = append(db.savedSearches[:i], db.savedSearches[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("saved search not found")
+}
+
+// FindSavedSearch searches for a saved search.
+func (db *MockDB) FindSavedSearch(id int64) (*SavedSearch, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, search := range db.savedSearches {
+		if search.ID == id {
+			s := copySavedSearch(search)
+			return &s, nil
+		}
+	}
+
+	return nil, errors.New("saved search not found")
+}
+
+// SaveNewSession creates a new session and saves it in the db.
+func (db *MockDB) SaveNewSession(login string, until time.Duration) (*Session, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	s, err := newSession(login, until)
+	if err != nil {
+		return nil, err
+	}
+
+	db.sessions = append(db.sessions, *s)
+	return s, nil
+}
+
+// FindSession returns the session for the given token.
+func (db *MockDB) FindSession(token string) (*Session, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, s := range db.sessions {
+		if s.Token == token {
+			return &s, nil
+		}
+	}
+
+	return nil, errors.New("session not found")
+}
+
+// Invalidate removes the session from the database.
+func (db *MockDB) Invalidate(s *Session) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, session := range db.sessions {
+		if session.Token == s.Token {
+			db.sessions = append(db.sessions[:i], db.sessions[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("session not found")
+}
+
+// ExpireSessions removes all sessions which have timed out.
+func (db *MockDB) ExpireSessions(now time.Time) (n int, err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var out []Session
+
+	for _, session := range db.sessions {
+		if session.ValidUntil.Before(now) {
+			n++
+			continue
+		}
+
+		out = append(out, session)
+	}
+
+	db.sessions = out
+
+	return n, err
+}
+
+// mockBatchTx implements BatchTx for the mock database, db.mu must be held.
+type mockBatchTx struct {
+	db *MockDB
+}
+
+func (b mockBatchTx) InsertPerson(p *Person) error { return b.db.insertPerson(p) }
+func (b mockBatchTx) UpdatePerson(p *Person) error { return b.db.updatePerson(p) }
+func (b mockBatchTx) DeletePerson(id int64) error  { return b.db.deletePerson(id) }
+func (b mockBatchTx) InsertUser(u *User) error     { return b.db.insertUser(u) }
+
+func (b mockBatchTx) DeletePersonVersion(id, version int64) error {
+	return b.db.deletePersonVersion(id, version)
+}
+
+// mockState is a copy of the data which can be changed in a batch.
+type mockState struct {
+	users      []User
+	userID     int64
+	people     []Person
+	personID   int64
+	activities []Activity
+	tasks      []Task
+	events     []Event
+}
+
+// state returns a copy of the data which can be changed in a batch.
+func (db *MockDB) state() mockState {
+	return mockState{
+		users:      append([]User(nil), db.users...),
+		userID:     db.userID,
+		people:     append([]Person(nil), db.people...),
+		personID:   db.personID,
+		activities: append([]Activity(nil), db.activities...),
+		tasks:      append([]Task(nil), db.tasks...),
+		events:     append([]Event(nil), db.events...),
+	}
+}
+
+// restore resets the data to the state s.
+func (db *MockDB) restore(s mockState) {
+	db.users, db.userID = s.users, s.userID
+	db.people, db.personID = s.people, s.personID
+	db.activities, db.tasks, db.events = s.activities, s.tasks, s.events
+}
+
+// RunBatch runs the operations in order, see Database.RunBatch.
+func (db *MockDB) RunBatch(ops []BatchOperation, atomic bool) (errs []error, err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	start := db.state()
+	for _, op := range ops {
+		var before mockState
+		if !atomic {
+			before = db.state()
+		}
+
+		opErr := op(mockBatchTx{db})
+		errs = append(errs, opErr)
+
+		switch {
+		case opErr != nil && atomic:
+			db.restore(start)
+			return errs, nil
+		case opErr != nil:
+			db.restore(before)
+		}
+	}
+
+	return errs, nil
 }
@@ -1,9 +1,15 @@
 package db
 
 import (
+	"bytes"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"ghenga/query"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/modl"
@@ -15,21 +21,28 @@ type PeopleDatabase interface {
 	FindPerson(int64) (*Person, error)
 
 	InsertPerson(*Person) error
-	ListPeople() ([]*Person, error)
+	ListPeople(TagFilter, ListOptions) (people []*Person, next string, err error)
+	IteratePeople(TagFilter, ListOptions) (PeopleIterator, error)
 	UpdatePerson(*Person) error
 	DeletePerson(int64) error
+	DeletePersonVersion(id, version int64) error
 
-	FuzzyFindPersons(query string) ([]*Person, error)
+	FuzzyFindPersons(query string, mode SearchMode, tags TagFilter) ([]*Person, error)
+	FindPeopleByEmail(address string) ([]*Person, error)
+	LookupPhoneNumber(number string) ([]*PhoneLookupResult, error)
+	SearchPeople(q query.Query, tags TagFilter) ([]*Person, error)
+	SuggestPeople(prefix string, limit int, timeout time.Duration) ([]*PersonSuggestion, error)
 }
 
 // Person is a person in the database.
 type Person struct {
-	ID           int64
-	Name         string
-	Title        string
-	Department   string
-	EmailAddress string
-	PhoneNumbers PhoneNumbers `db:"-"`
+	ID             int64
+	Name           string
+	Title          string
+	Department     string
+	EmailAddresses EmailAddresses `db:"-"`
+	PhoneNumbers   PhoneNumbers   `db:"-"`
+	Tags           []string       `db:"-"`
 
 	// Address
 	Street     string
@@ -40,6 +53,16 @@ type Person struct {
 
 	Comment string
 
+	AccountID sql.NullInt64
+
+	// Custom holds the values for the custom fields defined by the admin.
+	Custom CustomValues
+
+	// NameCologne and NameMetaphone hold the phonetic codes for the name,
+	// they are computed before the person is saved (see phoneticCodes).
+	NameCologne   string
+	NameMetaphone string
+
 	ChangedAt time.Time
 	CreatedAt time.Time
 	Version   int64
@@ -48,17 +71,22 @@ type Person struct {
 // PersonJSON is the JSON representation of a Person as returned or consumed by
 // the API.
 type PersonJSON struct {
-	ID           int64             `json:"id,omitempty"`
-	Name         string            `json:"name,omitempty"`
-	Title        string            `json:"title,omitempty"`
-	Department   string            `json:"department,omitempty"`
-	EmailAddress string            `json:"email_address,omitempty"`
-	PhoneNumbers []PhoneNumberJSON `json:"phone_numbers"`
+	ID             int64              `json:"id,omitempty"`
+	Name           string             `json:"name,omitempty"`
+	Title          string             `json:"title,omitempty"`
+	Department     string             `json:"department,omitempty"`
+	EmailAddresses []EmailAddressJSON `json:"email_addresses"`
+	PhoneNumbers   []PhoneNumberJSON  `json:"phone_numbers"`
+	Tags           []string           `json:"tags"`
 
 	Address AddressJSON `json:"address,omitempty"`
 
 	Comment string `json:"comment,omitempty"`
 
+	AccountID *int64 `json:"account_id,omitempty"`
+
+	Custom map[string]interface{} `json:"custom"`
+
 	ChangedAt string `json:"changed_at,omitempty"`
 	CreatedAt string `json:"created_at,omitempty"`
 
@@ -101,7 +129,15 @@ func (p Person) MarshalJSON() ([]byte, error) {
 
 	jp.Title = p.Title
 	jp.Department = p.Department
-	jp.EmailAddress = p.EmailAddress
+
+	jp.EmailAddresses = []EmailAddressJSON{}
+	for _, addr := range p.EmailAddresses {
+		jp.EmailAddresses = append(jp.EmailAddresses, EmailAddressJSON{
+			Type:    addr.Type,
+			Address: addr.Address,
+			Primary: addr.Primary,
+		})
+	}
 
 	jp.PhoneNumbers = []PhoneNumberJSON{}
 	for _, pn := range p.PhoneNumbers {
@@ -111,6 +147,11 @@ func (p Person) MarshalJSON() ([]byte, error) {
 		})
 	}
 
+	jp.Tags = p.Tags
+	if jp.Tags == nil {
+		jp.Tags = []string{}
+	}
+
 	jp.Address = AddressJSON{
 		Street:     p.Street,
 		PostalCode: p.PostalCode,
@@ -120,6 +161,14 @@ func (p Person) MarshalJSON() ([]byte, error) {
 	}
 
 	jp.Comment = p.Comment
+
+	jp.AccountID = int64Ptr(p.AccountID)
+
+	jp.Custom = p.Custom
+	if jp.Custom == nil {
+		jp.Custom = map[string]interface{}{}
+	}
+
 	return json.Marshal(jp)
 }
 
@@ -143,11 +192,10 @@ func (p *Person) UnmarshalJSON(data []byte) error {
 	}
 
 	*p = Person{
-		ID:           jp.ID,
-		Name:         jp.Name,
-		Title:        jp.Title,
-		Department:   jp.Department,
-		EmailAddress: jp.EmailAddress,
+		ID:         jp.ID,
+		Name:       jp.Name,
+		Title:      jp.Title,
+		Department: jp.Department,
 
 		Street:     jp.Address.Street,
 		PostalCode: jp.Address.PostalCode,
@@ -157,6 +205,8 @@ func (p *Person) UnmarshalJSON(data []byte) error {
 
 		Comment: jp.Comment,
 
+		AccountID: nullInt64(jp.AccountID),
+
 		CreatedAt: createdAt,
 		ChangedAt: changedAt,
 		Version:   jp.Version,
@@ -170,11 +220,26 @@ func (p *Person) UnmarshalJSON(data []byte) error {
 		p.PhoneNumbers = append(p.PhoneNumbers, n)
 	}
 
+	for _, addr := range jp.EmailAddresses {
+		p.EmailAddresses = append(p.EmailAddresses, EmailAddress{
+			Address: addr.Address,
+			Type:    addr.Type,
+			Primary: addr.Primary,
+		})
+	}
+
+	for _, tag := range jp.Tags {
+		p.Tags = append(p.Tags, tag)
+	}
+
+	p.Custom = copyCustomValues(jp.Custom)
+
 	return nil
 }
 
-// Validate checks if p is valid and returns an error if not.
-func (p *Person) Validate() error {
+// Validate checks if p is valid and returns an error if not. The values of
+// the custom fields are checked against the field definitions in fields.
+func (p *Person) Validate(fields []*CustomField) error {
 	if p.Name == "" {
 		return errors.New("name is empty")
 	}
@@ -183,30 +248,156 @@ func (p *Person) Validate() error {
 		return errors.New("invalid timestamps")
 	}
 
-	return nil
+	if err := p.EmailAddresses.Validate(); err != nil {
+		return err
+	}
+
+	return p.Custom.Validate(fields)
 }
 
 // PostInsert is run after a person is saved into the database. It is
-// used to handle phone numbers associated with a person.
+// used to handle phone numbers, email addresses and tags associated with a
+// person.
 func (p *Person) PostInsert(db modl.SqlExecutor) error {
-	if len(p.PhoneNumbers) == 0 {
-		return nil
-	}
-
 	for _, num := range p.PhoneNumbers {
 		num.PersonID = p.ID
+		num.NormalizedNumber = normalizePhoneNumber(num.Number)
 		err := db.Insert(&num)
 		if err != nil {
 			return err
 		}
 	}
 
+	for _, addr := range p.EmailAddresses {
+		addr.PersonID = p.ID
+		err := db.Insert(&addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	return p.insertTags(db)
+}
+
+// insertTags links the tags of p to the person. Tags which do not exist are
+// ignored.
+func (p *Person) insertTags(db modl.SqlExecutor) error {
+	for _, tag := range p.Tags {
+		_, err := db.Exec(`INSERT INTO person_tags (person_id, tag_id)
+			SELECT $1, id FROM tags WHERE name = $2`, p.ID, tag)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// PostGet loads the phone numbers associated with the person.
+// PostGet loads the phone numbers, email addresses and tags associated with
+// the person.
 func (p *Person) PostGet(db modl.SqlExecutor) error {
-	return db.Select(&p.PhoneNumbers, "SELECT * FROM phone_numbers WHERE person_id = $1", p.ID)
+	err := db.Select(&p.PhoneNumbers, "SELECT * FROM phone_numbers WHERE person_id = $1", p.ID)
+	if err != nil {
+		return err
+	}
+
+	err = db.Select(&p.EmailAddresses, "SELECT * FROM email_addresses WHERE person_id = $1 ORDER BY id", p.ID)
+	if err != nil {
+		return err
+	}
+
+	return db.Select(&p.Tags, `SELECT tags.name FROM tags JOIN person_tags ON tags.id = person_tags.tag_id
+		WHERE person_tags.person_id = $1 ORDER BY tags.name`, p.ID)
+}
+
+// selectPeople runs the query, which must select rows of the table people,
+// and loads the phone numbers, email addresses and tags for all people in the
+// result with one query each (see loadPeopleDetails). Selecting people with
+// db.dbmap.Select would run PostGet, and thus three queries, for each person.
+func (db *Database) selectPeople(query string, args ...interface{}) ([]*Person, error) {
+	var people []*Person
+	err := db.dbmap.Dbx.Select(&people, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadPeopleDetails(db.dbmap.Dbx, people)
+	if err != nil {
+		return nil, err
+	}
+
+	return people, nil
+}
+
+// idArray returns a Postgres array literal for the IDs, which can be passed
+// as a single parameter instead of one parameter per ID.
+func idArray(ids []int64) string {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, id := range ids {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(strconv.FormatInt(id, 10))
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// loadPeopleDetails loads the phone numbers, email addresses and tags
+// associated with the people, like PostGet does for a single person.
+func loadPeopleDetails(db *sqlx.DB, people []*Person) error {
+	if len(people) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(people))
+	byID := make(map[int64]*Person, len(people))
+	for _, p := range people {
+		ids = append(ids, p.ID)
+		byID[p.ID] = p
+		p.PhoneNumbers, p.EmailAddresses, p.Tags = nil, nil, nil
+	}
+
+	var nums []PhoneNumber
+	err := db.Select(&nums, "SELECT * FROM phone_numbers WHERE person_id = ANY($1::int[]) ORDER BY id", idArray(ids))
+	if err != nil {
+		return err
+	}
+
+	for _, num := range nums {
+		p := byID[num.PersonID]
+		p.PhoneNumbers = append(p.PhoneNumbers, num)
+	}
+
+	var addrs []EmailAddress
+	err = db.Select(&addrs, "SELECT * FROM email_addresses WHERE person_id = ANY($1::int[]) ORDER BY id", idArray(ids))
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range addrs {
+		p := byID[addr.PersonID]
+		p.EmailAddresses = append(p.EmailAddresses, addr)
+	}
+
+	var tags []struct {
+		PersonID int64
+		Name     string
+	}
+	err = db.Select(&tags, `SELECT person_tags.person_id, tags.name FROM tags
+		JOIN person_tags ON tags.id = person_tags.tag_id
+		WHERE person_tags.person_id = ANY($1::int[]) ORDER BY tags.name`, idArray(ids))
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		p := byID[tag.PersonID]
+		p.Tags = append(p.Tags, tag.Name)
+	}
+
+	return nil
 }
 
 // in is a small wrapper around the sqlx.In() function which handles rebinding
@@ -224,11 +415,12 @@ func in(query string, args ...interface{}) (string, []interface{}, error) {
 }
 
 // PostUpdate is run after a person has been updated. It handles updating the
-// phone numbers for a person.
+// phone numbers, email addresses and tags for a person.
 func (p *Person) PostUpdate(db modl.SqlExecutor) error {
 	var ids []int64
 	for _, num := range p.PhoneNumbers {
 		num.PersonID = p.ID
+		num.NormalizedNumber = normalizePhoneNumber(num.Number)
 		var err error
 		if num.ID != 0 {
 			_, err = db.Update(&num)
@@ -243,9 +435,43 @@ func (p *Person) PostUpdate(db modl.SqlExecutor) error {
 		ids = append(ids, num.ID)
 	}
 
+	if err := deleteExcess(db, "phone_numbers", p.ID, ids); err != nil {
+		return err
+	}
+
+	ids = nil
+	for _, addr := range p.EmailAddresses {
+		addr.PersonID = p.ID
+		var err error
+		if addr.ID != 0 {
+			_, err = db.Update(&addr)
+		} else {
+			err = db.Insert(&addr)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		ids = append(ids, addr.ID)
+	}
+
+	if err := deleteExcess(db, "email_addresses", p.ID, ids); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("DELETE FROM person_tags WHERE person_id = $1", p.ID); err != nil {
+		return err
+	}
+
+	return p.insertTags(db)
+}
+
+// deleteExcess removes all rows in table which belong to the person but are
+// not listed in ids.
+func deleteExcess(db modl.SqlExecutor, table string, personID int64, ids []int64) error {
 	if len(ids) > 0 {
-		// remove excess phone numbers
-		query, args, err := in("DELETE FROM phone_numbers WHERE person_id = ? AND id NOT IN (?)", p.ID, ids)
+		query, args, err := in("DELETE FROM "+table+" WHERE person_id = ? AND id NOT IN (?)", personID, ids)
 		if err != nil {
 			return err
 		}
@@ -254,8 +480,8 @@ func (p *Person) PostUpdate(db modl.SqlExecutor) error {
 		return err
 	}
 
-	// else remove all phone numbers
-	_, err := db.Exec("DELETE FROM phone_numbers WHERE person_id = $1", p.ID)
+	// else remove all rows
+	_, err := db.Exec("DELETE FROM "+table+" WHERE person_id = $1", personID)
 	return err
 }
 
@@ -264,7 +490,20 @@ func (p *Person) Update(other PersonJSON) {
 	p.Name = other.Name
 	p.Title = other.Title
 	p.Department = other.Department
-	p.EmailAddress = other.EmailAddress
+
+	p.EmailAddresses = nil
+	for _, addr := range other.EmailAddresses {
+		p.EmailAddresses = append(p.EmailAddresses, EmailAddress{
+			Type:    addr.Type,
+			Address: addr.Address,
+			Primary: addr.Primary,
+		})
+	}
+
+	// the first address is the primary address unless specified otherwise
+	if len(p.EmailAddresses) > 0 && p.EmailAddresses.Primary() == "" {
+		p.EmailAddresses[0].Primary = true
+	}
 
 	p.PhoneNumbers = nil
 
@@ -275,6 +514,17 @@ func (p *Person) Update(other PersonJSON) {
 		})
 	}
 
+	p.Tags = nil
+	seenTags := make(map[string]bool)
+	for _, tag := range other.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !seenTags[tag] {
+			p.Tags = append(p.Tags, tag)
+			seenTags[tag] = true
+		}
+	}
+	sort.Strings(p.Tags)
+
 	p.Street = other.Address.Street
 	p.PostalCode = other.Address.PostalCode
 	p.State = other.Address.State
@@ -283,9 +533,52 @@ func (p *Person) Update(other PersonJSON) {
 
 	p.Comment = other.Comment
 
+	p.AccountID = nullInt64(other.AccountID)
+
+	p.Custom = copyCustomValues(other.Custom)
+
 	p.Version = other.Version
 }
 
+// copyCustomValues returns a copy of values, values which are null are
+// removed.
+func copyCustomValues(values map[string]interface{}) CustomValues {
+	var res CustomValues
+	for name, v := range values {
+		if v == nil {
+			continue
+		}
+
+		if res == nil {
+			res = make(CustomValues)
+		}
+		res[name] = v
+	}
+
+	return res
+}
+
+// nullInt64 converts an optional ID as used in the JSON representation to a
+// value suitable for the database.
+func nullInt64(id *int64) sql.NullInt64 {
+	if id == nil {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: *id, Valid: true}
+}
+
+// int64Ptr converts an optional ID as saved in the database to the value used
+// in the JSON representation.
+func int64Ptr(id sql.NullInt64) *int64 {
+	if !id.Valid {
+		return nil
+	}
+
+	v := id.Int64
+	return &v
+}
+
 func (p Person) String() string {
 	numbers := ""
 	if len(p.PhoneNumbers) > 0 {
@@ -309,10 +602,10 @@ func (db *Database) FindPerson(id int64) (*Person, error) {
 	return &p, nil
 }
 
-// UpdatePerson modifies an existing person.
+// UpdatePerson modifies an existing person. When the person has been modified
+// since p was loaded (the version differs), ErrVersionConflict is returned.
 func (db *Database) UpdatePerson(p *Person) error {
-	_, err := db.dbmap.Update(p)
-	return err
+	return db.updateVersioned(p, &p.Version, "person")
 }
 
 // InsertPerson creates a new person.
@@ -320,11 +613,44 @@ func (db *Database) InsertPerson(p *Person) error {
 	return db.dbmap.Insert(p)
 }
 
-// ListPeople returns the list of people.
-func (db *Database) ListPeople() ([]*Person, error) {
-	var people []*Person
-	err := db.dbmap.Select(&people, "select * from people")
-	return people, err
+// ListPeople returns a page of the list of people matching the tag filter,
+// sorted and filtered as specified in opts. The cursor for the next page is
+// returned in next, which is empty for the last page. Errors for invalid
+// options are of type *ListError.
+func (db *Database) ListPeople(tags TagFilter, opts ListOptions) (people []*Person, next string, err error) {
+	q, err := opts.query(personListFields)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cond, order, args := q.sql()
+	tagCond, tagArgs := tags.sqlCondition()
+	args = append(args, tagArgs...)
+
+	query, args, err := in("select * from people where "+cond+" and "+tagCond+order, args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	people, err = db.selectPeople(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if q.Limit > 0 && len(people) > q.Limit {
+		people = people[:q.Limit]
+		next = q.cursorAfter(people[q.Limit-1])
+	}
+
+	return people, next, nil
+}
+
+// bumpPeopleVersions increases the version of the people matching cond. This
+// is needed when data which is part of the representation of a person (e.g.
+// the name of a tag) is changed elsewhere, so that the entity tag changes.
+func bumpPeopleVersions(e modl.SqlExecutor, cond string, args ...interface{}) error {
+	_, err := e.Exec("UPDATE people SET version = version + 1 WHERE "+cond, args...)
+	return err
 }
 
 // DeletePerson removes a person.
@@ -341,3 +667,9 @@ func (db *Database) DeletePerson(id int64) error {
 
 	return nil
 }
+
+// DeletePersonVersion removes a person if it has not been modified since the
+// version was loaded, otherwise ErrVersionConflict is returned.
+func (db *Database) DeletePersonVersion(id, version int64) error {
+	return deleteVersion(db.dbmap, "people", "person", id, version)
+}
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -28,8 +31,8 @@ var testPersons = []struct {
 	{
 		name: "testperson1",
 		p: Person{
-			Name:         "Tamara Skibicki",
-			EmailAddress: "pit@ackermannsehls.org",
+			Name:           "Tamara Skibicki",
+			EmailAddresses: EmailAddresses{{Type: "work", Address: "pit@ackermannsehls.org", Primary: true}},
 			PhoneNumbers: []PhoneNumber{
 				{Type: "work", Number: "(03867) 3074101"},
 				{Type: "mobile", Number: "+49-077-1634655"},
@@ -44,18 +47,21 @@ var testPersons = []struct {
 	{
 		name: "testperson2",
 		p: Person{
-			Name:         "Mario Drees",
-			EmailAddress: "bela_freigang@herweg.com",
-			ChangedAt:    parseTime("2016-04-24T10:30:07+00:00"),
-			CreatedAt:    parseTime("2016-04-24T10:30:07+00:00"),
-			Version:      1,
+			Name:           "Mario Drees",
+			EmailAddresses: EmailAddresses{{Type: "work", Address: "bela_freigang@herweg.com", Primary: true}},
+			ChangedAt:      parseTime("2016-04-24T10:30:07+00:00"),
+			CreatedAt:      parseTime("2016-04-24T10:30:07+00:00"),
+			Version:        1,
 		},
 	},
 	{
 		name: "testperson3",
 		p: Person{
-			Name:         "Mario Drees",
-			EmailAddress: "bela_freigang@herweg.com",
+			Name: "Mario Drees",
+			EmailAddresses: EmailAddresses{
+				{Type: "work", Address: "bela_freigang@herweg.com", Primary: true},
+				{Type: "private", Address: "mario@drees.example.com"},
+			},
 			PhoneNumbers: []PhoneNumber{
 				{Type: "wörk", Number: "1234123 3074101"},
 			},
@@ -132,8 +138,8 @@ func testPersonVersion(t *testing.T, db DB) {
 
 	p.Version = 25
 	err = db.UpdatePerson(p)
-	if err == nil {
-		t.Fatalf("expected error due to outdated version not found")
+	if err != ErrVersionConflict {
+		t.Fatalf("expected error due to outdated version not found, got %v", err)
 	}
 }
 
@@ -146,6 +152,122 @@ func TestMockDBPersonVersion(t *testing.T) {
 	testPersonVersion(t, db)
 }
 
+func testPersonConcurrentUpdate(t *testing.T, db DB) {
+	p := NewPerson("Concurrent Person")
+	p.PhoneNumbers = PhoneNumbers{{Type: "work", Number: "+49 221 1231234"}}
+	if err := db.InsertPerson(p); err != nil {
+		t.Fatal(err)
+	}
+
+	const writers = 8
+
+	// all writers load the same version of the person
+	var people []*Person
+	for i := 0; i < writers; i++ {
+		person, err := db.FindPerson(p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		people = append(people, person)
+	}
+
+	version := people[0].Version
+
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for i, person := range people {
+		wg.Add(1)
+		go func(i int, person *Person) {
+			defer wg.Done()
+			person.Name = fmt.Sprintf("Concurrent Person %d", i)
+			person.PhoneNumbers = PhoneNumbers{{Type: "work", Number: fmt.Sprintf("+49 221 %d", i)}}
+			errs <- db.UpdatePerson(person)
+		}(i, person)
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			succeeded++
+		case ErrVersionConflict:
+		default:
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+
+	if succeeded != 1 {
+		t.Fatalf("%d concurrent updates of the same version succeeded, want 1", succeeded)
+	}
+
+	p, err := db.FindPerson(p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Version != version+1 {
+		t.Errorf("wrong version after update, want %v, got %v", version+1, p.Version)
+	}
+
+	var i int
+	if _, err = fmt.Sscanf(p.Name, "Concurrent Person %d", &i); err != nil {
+		t.Fatalf("unexpected name %q", p.Name)
+	}
+
+	// the phone numbers must belong to the update which succeeded
+	want := PhoneNumbers{{Type: "work", Number: fmt.Sprintf("+49 221 %d", i)}}
+	if len(p.PhoneNumbers) != 1 || p.PhoneNumbers[0].Number != want[0].Number {
+		t.Errorf("phone numbers of person %q are wrong, want %v, got %v", p.Name, want, p.PhoneNumbers)
+	}
+
+	if err = db.DeletePerson(p.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBPersonConcurrentUpdate(t *testing.T) {
+	testPersonConcurrentUpdate(t, testDB)
+}
+
+func TestMockDBPersonConcurrentUpdate(t *testing.T) {
+	testPersonConcurrentUpdate(t, NewMockDB(20, 5))
+}
+
+func testPersonDeleteVersion(t *testing.T, db DB) {
+	p := NewPerson("Delete Version Person")
+	if err := db.InsertPerson(p); err != nil {
+		t.Fatal(err)
+	}
+
+	version := p.Version
+	p.Name = "Delete Version Person Changed"
+	updatePerson(t, db, p)
+
+	if err := db.DeletePersonVersion(p.ID, version); err != ErrVersionConflict {
+		t.Fatalf("deleting an outdated version returned error %v, want %v", err, ErrVersionConflict)
+	}
+
+	findPerson(t, db, p.ID)
+
+	if err := db.DeletePersonVersion(p.ID, p.Version); err != nil {
+		t.Fatalf("deleting the current version failed: %v", err)
+	}
+
+	if err := db.DeletePersonVersion(p.ID, p.Version); err == nil || err == ErrVersionConflict {
+		t.Fatalf("deleting a removed person returned error %v", err)
+	}
+}
+
+func TestDBPersonDeleteVersion(t *testing.T) {
+	testPersonDeleteVersion(t, testDB)
+}
+
+func TestMockDBPersonDeleteVersion(t *testing.T) {
+	testPersonDeleteVersion(t, NewMockDB(20, 5))
+}
+
 func marshal(t *testing.T, item interface{}) []byte {
 	buf, err := json.MarshalIndent(item, "", "  ")
 	if err != nil {
@@ -217,17 +339,50 @@ var testPersonValidate = []struct {
 			Name: "",
 		},
 	},
+	{
+		name:  "invalid-email-type",
+		valid: false,
+		p: Person{
+			Name:           "foo",
+			EmailAddresses: EmailAddresses{{Type: "foo", Address: "foo@example.com"}},
+			ChangedAt:      parseTime("2016-04-24T10:30:07+00:00"),
+			CreatedAt:      parseTime("2016-04-24T10:30:07+00:00"),
+		},
+	},
+	{
+		name:  "invalid-email-address",
+		valid: false,
+		p: Person{
+			Name:           "foo",
+			EmailAddresses: EmailAddresses{{Type: "work", Address: "foo"}},
+			ChangedAt:      parseTime("2016-04-24T10:30:07+00:00"),
+			CreatedAt:      parseTime("2016-04-24T10:30:07+00:00"),
+		},
+	},
+	{
+		name:  "invalid-two-primary-emails",
+		valid: false,
+		p: Person{
+			Name: "foo",
+			EmailAddresses: EmailAddresses{
+				{Type: "work", Address: "foo@example.com", Primary: true},
+				{Type: "private", Address: "bar@example.com", Primary: true},
+			},
+			ChangedAt: parseTime("2016-04-24T10:30:07+00:00"),
+			CreatedAt: parseTime("2016-04-24T10:30:07+00:00"),
+		},
+	},
 }
 
 func TestPersonValidate(t *testing.T) {
 	for i, test := range testPersons {
-		if err := test.p.Validate(); err != nil {
+		if err := test.p.Validate(nil); err != nil {
 			t.Errorf("test %v (%v) failed: testPerson is invalid: %v", test.name, i, err)
 		}
 	}
 
 	for i, test := range testPersonValidate {
-		err := test.p.Validate()
+		err := test.p.Validate(nil)
 		if test.valid && err != nil {
 			t.Errorf("test %v (%v) failed: testPerson should be valid but is invalid: %v", test.name, i, err)
 		}
@@ -345,6 +500,35 @@ func TestMockDBPersonDeleteAllPhoneNumbers(t *testing.T) {
 	testPersonDeleteAllPhoneNumbers(t, db)
 }
 
+func testPersonUpdateEmailAddresses(t *testing.T, db DB) {
+	p := findPerson(t, db, 14)
+	p.EmailAddresses = append(p.EmailAddresses, EmailAddress{Type: "other", Address: "other@example.com"})
+
+	updatePerson(t, db, p)
+
+	p2 := findPerson(t, db, p.ID)
+	if !p.EmailAddresses.Equals(p2.EmailAddresses) {
+		t.Fatalf("changing email addresses did not work, want:\n%v\n  got:\n%v", p.EmailAddresses, p2.EmailAddresses)
+	}
+
+	p2.EmailAddresses = p2.EmailAddresses[:0]
+	updatePerson(t, db, p2)
+
+	p3 := findPerson(t, db, p.ID)
+	if len(p3.EmailAddresses) > 0 {
+		t.Fatalf("removing email addresses did not work, got:\n%v", p3.EmailAddresses)
+	}
+}
+
+func TestDBPersonUpdateEmailAddresses(t *testing.T) {
+	testPersonUpdateEmailAddresses(t, testDB)
+}
+
+func TestMockDBPersonUpdateEmailAddresses(t *testing.T) {
+	db := NewMockDB(20, 5)
+	testPersonUpdateEmailAddresses(t, db)
+}
+
 func testPersonReplacePhoneNumbers(t *testing.T, db DB) {
 	p := findPerson(t, db, 14)
 	p.PhoneNumbers = PhoneNumbers{PhoneNumber{Type: "test", Number: "12345"}}
@@ -360,3 +544,93 @@ func testPersonReplacePhoneNumbers(t *testing.T, db DB) {
 func TestDBPersonReplacePhoneNumbers(t *testing.T) {
 	testPersonReplacePhoneNumbers(t, testDB)
 }
+
+func TestDBLoadPeopleDetails(t *testing.T) {
+	db := testDB.(*Database)
+
+	var want []*Person
+	if err := db.dbmap.Select(&want, "SELECT * FROM people ORDER BY id"); err != nil {
+		t.Fatal(err)
+	}
+
+	people, err := db.selectPeople("SELECT * FROM people ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(people) != len(want) {
+		t.Fatalf("wrong number of people loaded, want %d, got %d", len(want), len(people))
+	}
+
+	for i, p := range people {
+		if !p.PhoneNumbers.Equals(want[i].PhoneNumbers) {
+			t.Errorf("person %v: wrong phone numbers, want %v, got %v", p.ID, want[i].PhoneNumbers, p.PhoneNumbers)
+		}
+
+		if !p.EmailAddresses.Equals(want[i].EmailAddresses) {
+			t.Errorf("person %v: wrong email addresses, want %v, got %v", p.ID, want[i].EmailAddresses, p.EmailAddresses)
+		}
+
+		if strings.Join(p.Tags, ",") != strings.Join(want[i].Tags, ",") {
+			t.Errorf("person %v: wrong tags, want %v, got %v", p.ID, want[i].Tags, p.Tags)
+		}
+	}
+}
+
+// benchmarkPeople is the number of people inserted for the benchmarks.
+const benchmarkPeople = 500
+
+// insertBenchmarkPeople inserts fake people into db and returns a function
+// which removes them again.
+func insertBenchmarkPeople(b *testing.B, db DB) func() {
+	var ids []int64
+	for i := 0; i < benchmarkPeople; i++ {
+		p, err := NewFakePerson("de")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if err = db.InsertPerson(p); err != nil {
+			b.Fatal(err)
+		}
+
+		ids = append(ids, p.ID)
+	}
+
+	return func() {
+		for _, id := range ids {
+			if err := db.DeletePerson(id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkDBListPeoplePostGet loads all people with PostGet, which runs
+// three queries per person.
+func BenchmarkDBListPeoplePostGet(b *testing.B) {
+	db := testDB.(*Database)
+	defer insertBenchmarkPeople(b, db)()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var people []*Person
+		if err := db.dbmap.Select(&people, "SELECT * FROM people ORDER BY id"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDBListPeople loads all people with ListPeople, which runs one
+// query each for the phone numbers, email addresses and tags of all people.
+func BenchmarkDBListPeople(b *testing.B) {
+	db := testDB.(*Database)
+	defer insertBenchmarkPeople(b, db)()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, _, err := db.ListPeople(TagFilter{}, ListOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
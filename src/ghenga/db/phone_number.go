@@ -1,6 +1,12 @@
 package db
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/modl"
+)
 
 // PhoneNumber is a phone number of a specified type.
 type PhoneNumber struct {
@@ -8,6 +14,10 @@ type PhoneNumber struct {
 	Number   string
 	Type     string
 	PersonID int64
+
+	// NormalizedNumber is the number in international format without any
+	// formatting, see normalizePhoneNumber. It is used for reverse lookups.
+	NormalizedNumber string
 }
 
 // PhoneNumberJSON is the JSON representation of a phone number.
@@ -48,3 +58,150 @@ func (p PhoneNumbers) Equals(other PhoneNumbers) bool {
 
 	return true
 }
+
+// AccountPhoneNumber is a phone number of a specified type which belongs to an
+// account.
+type AccountPhoneNumber struct {
+	ID        int64
+	Number    string
+	Type      string
+	AccountID int64
+}
+
+func (p AccountPhoneNumber) String() string {
+	return fmt.Sprintf("<AccountPhoneNumber [%v] %v>", p.Type, p.Number)
+}
+
+// AccountPhoneNumbers is a collection of phone numbers for an account.
+type AccountPhoneNumbers []AccountPhoneNumber
+
+// Equals returns true iff other contains exactly the same phone numbers and
+// types.
+func (p AccountPhoneNumbers) Equals(other AccountPhoneNumbers) bool {
+	var a, b PhoneNumbers
+
+	for _, num := range p {
+		a = append(a, PhoneNumber{Number: num.Number, Type: num.Type})
+	}
+
+	for _, num := range other {
+		b = append(b, PhoneNumber{Number: num.Number, Type: num.Type})
+	}
+
+	return a.Equals(b)
+}
+
+// defaultCountryCode is the country code used for numbers in national format.
+const defaultCountryCode = "49"
+
+// normalizePhoneNumber returns the number in international format, consisting
+// only of digits and without the leading "+" or "00". Numbers in national
+// format (starting with a single zero) are assumed to belong to the country
+// defaultCountryCode, for which a zero after the country code is removed as
+// well (e.g. "+49 (0)221"). Numbers without any prefix are returned as they
+// are.
+func normalizePhoneNumber(number string) string {
+	number = strings.Replace(number, "(0)", "", -1)
+
+	var digits []rune
+	international := false
+	for _, r := range number {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = append(digits, r)
+		case r == '+' && len(digits) == 0:
+			international = true
+		}
+	}
+
+	s := string(digits)
+	switch {
+	case international:
+	case strings.HasPrefix(s, "00"):
+		s = s[2:]
+	case strings.HasPrefix(s, "0"):
+		s = defaultCountryCode + s[1:]
+	}
+
+	if strings.HasPrefix(s, defaultCountryCode+"0") {
+		s = defaultCountryCode + s[len(defaultCountryCode)+1:]
+	}
+
+	return s
+}
+
+// PhoneLookupResult is a person found by a reverse lookup of a phone number.
+type PhoneLookupResult struct {
+	Person *Person `json:"person"`
+	Type   string  `json:"type"`
+	Number string  `json:"number"`
+}
+
+// LookupPhoneNumber returns the people having the phone number, regardless
+// of the formatting (see normalizePhoneNumber). The result is ordered by the
+// ID of the person.
+func (db *Database) LookupPhoneNumber(number string) ([]*PhoneLookupResult, error) {
+	n := normalizePhoneNumber(number)
+	if n == "" {
+		return nil, errors.New("phone number is empty")
+	}
+
+	var nums []PhoneNumber
+	err := db.dbmap.Select(&nums, `SELECT * FROM phone_numbers
+		WHERE normalized_number = $1 AND person_id IS NOT NULL ORDER BY person_id, id`, n)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for _, num := range nums {
+		ids = append(ids, num.PersonID)
+	}
+
+	people, err := db.selectPeople("SELECT * FROM people WHERE id = ANY($1::int[])", idArray(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]*Person, len(people))
+	for _, p := range people {
+		byID[p.ID] = p
+	}
+
+	var result []*PhoneLookupResult
+	for _, num := range nums {
+		result = append(result, &PhoneLookupResult{Person: byID[num.PersonID], Type: num.Type, Number: num.Number})
+	}
+
+	return result, nil
+}
+
+// refreshNormalizedNumbers computes the normalized numbers for all phone
+// numbers which do not have one yet, e.g. numbers created before the column
+// was introduced.
+func refreshNormalizedNumbers(db *modl.DbMap) error {
+	var nums []struct {
+		ID     int64
+		Number string
+	}
+
+	err := db.Dbx.Select(&nums, `SELECT id, number FROM phone_numbers
+		WHERE normalized_number = '' AND number <> ''`)
+	if err != nil {
+		return err
+	}
+
+	for _, num := range nums {
+		n := normalizePhoneNumber(num.Number)
+		if n == "" {
+			continue
+		}
+
+		_, err = db.Exec("UPDATE phone_numbers SET normalized_number = $1 WHERE id = $2", n, num.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
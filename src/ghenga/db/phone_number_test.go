@@ -0,0 +1,106 @@
+package db
+
+import "testing"
+
+var normalizePhoneNumberTests = []struct {
+	number, want string
+}{
+	{"+49 221 555123", "49221555123"},
+	{"+49 (0)221 555-123", "49221555123"},
+	{"+49-0221-555123", "49221555123"},
+	{"0049 221 555123", "49221555123"},
+	{"0221 / 55 51 23", "49221555123"},
+	{"(0221) 555123", "49221555123"},
+	{"+43 1 5551234", "4315551234"},
+	{"0043 1 5551234", "4315551234"},
+	{"+39 06 5551234", "39065551234"},
+	{"555123", "555123"},
+	{"12+34", "1234"},
+	{"", ""},
+	{"none", ""},
+}
+
+func TestNormalizePhoneNumber(t *testing.T) {
+	for i, test := range normalizePhoneNumberTests {
+		if res := normalizePhoneNumber(test.number); res != test.want {
+			t.Errorf("test %d: normalizePhoneNumber(%q) returned %q, want %q", i, test.number, res, test.want)
+		}
+	}
+}
+
+func testLookupPhoneNumber(t *testing.T, db DB) {
+	p1 := NewPerson("Lookup One")
+	p1.PhoneNumbers = PhoneNumbers{
+		{Type: "work", Number: "+49 (0)221 999-4711"},
+		{Type: "mobile", Number: "0171 9994711"},
+	}
+
+	p2 := NewPerson("Lookup Two")
+	p2.PhoneNumbers = PhoneNumbers{{Type: "other", Number: "0049 221 9994711"}}
+
+	for _, p := range []*Person{p1, p2} {
+		if err := db.InsertPerson(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		number string
+		people []int64
+		types  []string
+	}{
+		{"02219994711", []int64{p1.ID, p2.ID}, []string{"work", "other"}},
+		{"+491719994711", []int64{p1.ID}, []string{"mobile"}},
+		{"+49 30 9994711", nil, nil},
+	} {
+		result, err := db.LookupPhoneNumber(test.number)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(result) != len(test.people) {
+			t.Errorf("lookup of %q returned wrong number of results, want %v, got %v", test.number, len(test.people), len(result))
+			continue
+		}
+
+		for i, r := range result {
+			if r.Person.ID != test.people[i] || r.Type != test.types[i] {
+				t.Errorf("lookup of %q returned wrong result %d, want person %v (%v), got %v (%v)",
+					test.number, i, test.people[i], test.types[i], r.Person.ID, r.Type)
+			}
+		}
+	}
+
+	// the normalized number is updated with the number
+	p1.PhoneNumbers = PhoneNumbers{{Type: "work", Number: "+49 30 9994711"}}
+	if err := db.UpdatePerson(p1); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := db.LookupPhoneNumber("030 9994711")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result) != 1 || result[0].Person.ID != p1.ID {
+		t.Errorf("lookup of updated number returned wrong result: %v", result)
+	}
+
+	if _, err = db.LookupPhoneNumber("-"); err == nil {
+		t.Errorf("lookup of an empty number did not return an error")
+	}
+
+	for _, p := range []*Person{p1, p2} {
+		if err := db.DeletePerson(p.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDBLookupPhoneNumber(t *testing.T) {
+	testLookupPhoneNumber(t, testDB)
+}
+
+func TestMockDBLookupPhoneNumber(t *testing.T) {
+	testLookupPhoneNumber(t, NewMockDB(20, 5))
+}
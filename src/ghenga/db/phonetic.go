@@ -0,0 +1,190 @@
+package db
+
+import (
+	"fmt"
+	"ghenga/phonetic"
+	"strings"
+
+	"github.com/jmoiron/modl"
+)
+
+// phoneticCodes returns the Kölner Phonetik and the Double Metaphone codes
+// for the words in s. Each list is separated by spaces and contains every
+// code only once, words without a code are ignored.
+func phoneticCodes(s string) (cologne, metaphone string) {
+	var colognes, metaphones []string
+	add := func(list []string, code string) []string {
+		if code == "" {
+			return list
+		}
+
+		for _, c := range list {
+			if c == code {
+				return list
+			}
+		}
+
+		return append(list, code)
+	}
+
+	for _, word := range searchTerms(s) {
+		colognes = add(colognes, phonetic.Cologne(word))
+
+		primary, alternate := phonetic.DoubleMetaphone(word)
+		metaphones = add(metaphones, primary)
+		metaphones = add(metaphones, alternate)
+	}
+
+	return strings.Join(colognes, " "), strings.Join(metaphones, " ")
+}
+
+// updatePhoneticCodes computes the phonetic codes for the name of p.
+func (p *Person) updatePhoneticCodes() {
+	p.NameCologne, p.NameMetaphone = phoneticCodes(p.Name)
+}
+
+// PreInsert is run before a person is saved into the database. It is used to
+// compute the phonetic codes for the name.
+func (p *Person) PreInsert(db modl.SqlExecutor) error {
+	p.updatePhoneticCodes()
+	return nil
+}
+
+// PreUpdate is run before a person is updated in the database. It is used to
+// compute the phonetic codes for the name.
+func (p *Person) PreUpdate(db modl.SqlExecutor) error {
+	p.updatePhoneticCodes()
+	return nil
+}
+
+// refreshPhoneticCodes computes the phonetic codes for all people which do
+// not have any codes yet, e.g. people created before the codes were
+// introduced. The version of the people is not changed.
+func refreshPhoneticCodes(db *modl.DbMap) error {
+	var people []struct {
+		ID   int64
+		Name string
+	}
+
+	err := db.Dbx.Select(&people, `SELECT id, name FROM people
+		WHERE name_cologne = '' AND name_metaphone = '' AND name <> ''`)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range people {
+		cologne, metaphone := phoneticCodes(p.Name)
+		if cologne == "" && metaphone == "" {
+			continue
+		}
+
+		_, err = db.Exec("UPDATE people SET name_cologne = $1, name_metaphone = $2 WHERE id = $3",
+			cologne, metaphone, p.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// phoneticQuery contains the phonetic codes for each word of a query.
+type phoneticQuery []struct {
+	cologne, metaphone string
+}
+
+// newPhoneticQuery returns the codes for the words of the query. Words
+// without any code are ignored.
+func newPhoneticQuery(query string) phoneticQuery {
+	var q phoneticQuery
+	for _, word := range searchTerms(query) {
+		cologne, metaphone := phoneticCodes(word)
+		if cologne == "" && metaphone == "" {
+			continue
+		}
+
+		q = append(q, struct{ cologne, metaphone string }{cologne, metaphone})
+	}
+
+	return q
+}
+
+// containsCode returns true iff one of the codes in the space separated list
+// want is contained in the list codes.
+func containsCode(codes, want string) bool {
+	for _, c := range strings.Fields(codes) {
+		for _, w := range strings.Fields(want) {
+			if c == w {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// rank returns the number of matching codes for the person, which is zero if
+// not every word of the query matches at least one code.
+func (q phoneticQuery) rank(p Person) float64 {
+	if len(q) == 0 {
+		return 0
+	}
+
+	var rank float64
+	for _, w := range q {
+		n := 0
+		if containsCode(p.NameCologne, w.cologne) {
+			n++
+		}
+
+		if containsCode(p.NameMetaphone, w.metaphone) {
+			n++
+		}
+
+		if n == 0 {
+			return 0
+		}
+
+		rank += float64(n)
+	}
+
+	return rank
+}
+
+// sql returns the SQL condition (using the bindvar '?') for people matching
+// the query, and the expression for the rank (same as the method rank).
+func (q phoneticQuery) sql() (cond string, condArgs []interface{}, rank string, rankArgs []interface{}) {
+	var conds, ranks []string
+	for _, w := range q {
+		c := "string_to_array(name_cologne, ' ') && string_to_array(?, ' ')"
+		m := "string_to_array(name_metaphone, ' ') && string_to_array(?, ' ')"
+
+		conds = append(conds, fmt.Sprintf("(%s OR %s)", c, m))
+		ranks = append(ranks, fmt.Sprintf("(%s)::int + (%s)::int", c, m))
+		condArgs = append(condArgs, w.cologne, w.metaphone)
+	}
+
+	return strings.Join(conds, " AND "), condArgs, strings.Join(ranks, " + "), condArgs
+}
+
+// phoneticFindPersons returns people with a name which sounds like the query,
+// see FuzzyFindPersons.
+func (db *Database) phoneticFindPersons(query string, tags TagFilter) ([]*Person, error) {
+	pq := newPhoneticQuery(query)
+	if len(pq) == 0 {
+		return nil, nil
+	}
+
+	cond, args, rank, rankArgs := pq.sql()
+	tagCond, tagArgs := tags.sqlCondition()
+	args = append(args, tagArgs...)
+	args = append(args, rankArgs...)
+
+	q, args, err := in("SELECT * FROM people WHERE "+cond+" AND "+tagCond+
+		" ORDER BY ("+rank+") DESC, id", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.selectPeople(q, args...)
+}
@@ -0,0 +1,113 @@
+package db
+
+import "testing"
+
+var phoneticCodesTests = []struct {
+	name               string
+	cologne, metaphone string
+}{
+	{"Hans Meier", "068 67", "HNS MR"},
+	{"Karl Müller-Schmidt", "475 657 862", "KRL MLR XMT SMT"},
+	{"Meyer Maier", "67", "MR"},
+	{"", "", ""},
+}
+
+func TestPhoneticCodes(t *testing.T) {
+	for i, test := range phoneticCodesTests {
+		cologne, metaphone := phoneticCodes(test.name)
+		if cologne != test.cologne || metaphone != test.metaphone {
+			t.Errorf("test %d: phoneticCodes(%q) returned (%q, %q), want (%q, %q)",
+				i, test.name, cologne, metaphone, test.cologne, test.metaphone)
+		}
+	}
+}
+
+func testPhoneticFindPersons(t *testing.T, db DB) {
+	var ids []int64
+	for _, name := range []string{"Hans Meier", "Sabine Mayer", "Karl Müller", "Qwv Zyx"} {
+		p := NewPerson(name)
+		if err := db.InsertPerson(p); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, p.ID)
+	}
+
+	for _, test := range []struct {
+		query string
+		want  []int64
+	}{
+		{"Maier", []int64{ids[0], ids[1]}},
+		{"Mueller", []int64{ids[2]}},
+		{"Hanz Meyer", []int64{ids[0]}},
+		{"Schmidt", nil},
+		{"-", nil},
+	} {
+		result, err := db.FuzzyFindPersons(test.query, SearchPhonetic, TagFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// only consider the test persons
+		var found []int64
+		for _, p := range result {
+			for _, id := range ids {
+				if p.ID == id {
+					found = append(found, id)
+				}
+			}
+		}
+
+		if len(found) != len(test.want) {
+			t.Errorf("query %q: wrong people returned, want %v, got %v", test.query, test.want, found)
+			continue
+		}
+
+		for i := range found {
+			if found[i] != test.want[i] {
+				t.Errorf("query %q: wrong order, want %v, got %v", test.query, test.want, found)
+				break
+			}
+		}
+	}
+
+	// the codes are updated with the name
+	p, err := db.FindPerson(ids[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Name = "Peter Schmitt"
+	if err = db.UpdatePerson(p); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := db.FuzzyFindPersons("Schmidt", SearchPhonetic, TagFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, person := range result {
+		if person.ID == p.ID {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("renamed person not found: %v", result)
+	}
+
+	for _, id := range ids {
+		if err := db.DeletePerson(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDBPhoneticFindPersons(t *testing.T) {
+	testPhoneticFindPersons(t, testDB)
+}
+
+func TestMockDBPhoneticFindPersons(t *testing.T) {
+	testPhoneticFindPersons(t, NewMockDB(20, 5))
+}
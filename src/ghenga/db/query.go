@@ -0,0 +1,306 @@
+package db
+
+import (
+	"ghenga/query"
+	"strings"
+	"time"
+)
+
+// queryField describes a field of a person which can be used in a search
+// query.
+type queryField struct {
+	// column is the column in the table people, if set.
+	column string
+
+	// subquery selects the IDs of people by the value of the field in a
+	// different table, using the bindvar '?' for the value.
+	subquery string
+
+	// exact is true if the value needs to match exactly instead of being
+	// contained in the field. Otherwise the value and the field are folded
+	// before comparing them, see fold.
+	exact bool
+
+	// date is true for timestamp fields, the value is a date then.
+	date bool
+
+	// values returns the values of the field for a person, for date fields the
+	// value is returned by timestamp.
+	values    func(p Person) []string
+	timestamp func(p Person) time.Time
+}
+
+// personQueryFields are the fields which can be used in search queries for
+// people.
+var personQueryFields = map[string]queryField{
+	"name":        {column: "name", values: func(p Person) []string { return []string{p.Name} }},
+	"title":       {column: "title", values: func(p Person) []string { return []string{p.Title} }},
+	"department":  {column: "department", values: func(p Person) []string { return []string{p.Department} }},
+	"street":      {column: "street", values: func(p Person) []string { return []string{p.Street} }},
+	"postal_code": {column: "postal_code", values: func(p Person) []string { return []string{p.PostalCode} }},
+	"state":       {column: "state", values: func(p Person) []string { return []string{p.State} }},
+	"city":        {column: "city", values: func(p Person) []string { return []string{p.City} }},
+	"country":     {column: "country", values: func(p Person) []string { return []string{p.Country} }},
+	"comment":     {column: "comment", values: func(p Person) []string { return []string{p.Comment} }},
+	"email": {
+		subquery: "SELECT person_id FROM email_addresses WHERE people_search_fold(address) LIKE ?",
+		values: func(p Person) []string {
+			var list []string
+			for _, addr := range p.EmailAddresses {
+				list = append(list, addr.Address)
+			}
+			return list
+		},
+	},
+	"phone": {
+		subquery: "SELECT person_id FROM phone_numbers WHERE people_search_fold(number) LIKE ?",
+		values: func(p Person) []string {
+			var list []string
+			for _, num := range p.PhoneNumbers {
+				list = append(list, num.Number)
+			}
+			return list
+		},
+	},
+	"tag": {
+		subquery: "SELECT pt.person_id FROM person_tags pt JOIN tags t ON t.id = pt.tag_id WHERE t.name = ?",
+		exact:    true,
+		values:   func(p Person) []string { return p.Tags },
+	},
+	"created": {column: "created_at", date: true, timestamp: func(p Person) time.Time { return p.CreatedAt }},
+	"changed": {column: "changed_at", date: true, timestamp: func(p Person) time.Time { return p.ChangedAt }},
+}
+
+// personTextFields are the fields searched for terms without a field name.
+var personTextFields = []string{
+	"name", "title", "department", "email", "phone",
+	"street", "postal_code", "state", "city", "country", "comment",
+}
+
+// likeEscaper escapes the special characters for LIKE patterns.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// dateRange returns the range of timestamps [from, to) selected by the term.
+// A zero value means the range is open on that side.
+func dateRange(t query.Term) (from, to time.Time, err error) {
+	d, err := time.ParseInLocation(dateLayout, t.Value, time.UTC)
+	if err != nil {
+		return from, to, t.Errorf("invalid date %q for field %q", t.Value, t.Field)
+	}
+
+	next := d.AddDate(0, 0, 1)
+
+	switch t.Op {
+	case query.Match:
+		return d, next, nil
+	case query.Less:
+		return from, d, nil
+	case query.LessEqual:
+		return from, next, nil
+	case query.Greater:
+		return next, to, nil
+	case query.GreaterEqual:
+		return d, to, nil
+	}
+
+	return from, to, t.Errorf("invalid operator %v", t.Op)
+}
+
+// lookupField returns the definition for the field used in the term.
+func lookupField(t query.Term) (queryField, error) {
+	f, ok := personQueryFields[t.Field]
+	if !ok {
+		return f, t.Errorf("unknown field %q", t.Field)
+	}
+
+	if !f.date && t.Op != query.Match {
+		return f, t.Errorf("operator %v is not supported for field %q", t.Op, t.Field)
+	}
+
+	return f, nil
+}
+
+// fieldSQL returns the SQL condition for the field and the term.
+func fieldSQL(f queryField, t query.Term) (string, []interface{}, error) {
+	if f.date {
+		from, to, err := dateRange(t)
+		if err != nil {
+			return "", nil, err
+		}
+
+		var conds []string
+		var args []interface{}
+		if !from.IsZero() {
+			conds = append(conds, f.column+" >= ?")
+			args = append(args, from)
+		}
+
+		if !to.IsZero() {
+			conds = append(conds, f.column+" < ?")
+			args = append(args, to)
+		}
+
+		return strings.Join(conds, " AND "), args, nil
+	}
+
+	value := interface{}(t.Value)
+	if !f.exact {
+		value = "%" + likeEscaper.Replace(fold(t.Value)) + "%"
+	}
+
+	if f.subquery != "" {
+		return "id IN (" + f.subquery + ")", []interface{}{value}, nil
+	}
+
+	return "people_search_fold(" + f.column + ") LIKE ?", []interface{}{value}, nil
+}
+
+// querySQL returns an SQL condition (using the bindvar '?') which selects all
+// people matching the query.
+func querySQL(q query.Query) (string, []interface{}, error) {
+	if len(q.Terms) == 0 {
+		return "TRUE", nil, nil
+	}
+
+	var conds []string
+	var args []interface{}
+
+	for _, t := range q.Terms {
+		var cond string
+		var termArgs []interface{}
+
+		if t.Field == "" {
+			var alternatives []string
+			for _, name := range personTextFields {
+				c, a, err := fieldSQL(personQueryFields[name], t)
+				if err != nil {
+					return "", nil, err
+				}
+
+				alternatives = append(alternatives, c)
+				termArgs = append(termArgs, a...)
+			}
+
+			cond = strings.Join(alternatives, " OR ")
+		} else {
+			f, err := lookupField(t)
+			if err != nil {
+				return "", nil, err
+			}
+
+			cond, termArgs, err = fieldSQL(f, t)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+
+		if t.Negate {
+			cond = "NOT (" + cond + ")"
+		}
+
+		conds = append(conds, "("+cond+")")
+		args = append(args, termArgs...)
+	}
+
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// fieldPredicate returns a function which tests whether the field of a person
+// matches the term.
+func fieldPredicate(f queryField, t query.Term) (func(Person) bool, error) {
+	if f.date {
+		from, to, err := dateRange(t)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(p Person) bool {
+			ts := f.timestamp(p)
+			return (from.IsZero() || !ts.Before(from)) && (to.IsZero() || ts.Before(to))
+		}, nil
+	}
+
+	value := fold(t.Value)
+	return func(p Person) bool {
+		for _, v := range f.values(p) {
+			if f.exact && v == t.Value {
+				return true
+			}
+
+			if !f.exact && strings.Contains(fold(v), value) {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+// queryPredicate returns a function which tests whether a person matches the
+// query. It has the same semantics as the SQL condition returned by
+// querySQL.
+func queryPredicate(q query.Query) (func(Person) bool, error) {
+	var preds []func(Person) bool
+
+	for _, t := range q.Terms {
+		var fields []queryField
+		if t.Field == "" {
+			for _, name := range personTextFields {
+				fields = append(fields, personQueryFields[name])
+			}
+		} else {
+			f, err := lookupField(t)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, f)
+		}
+
+		var alternatives []func(Person) bool
+		for _, f := range fields {
+			pred, err := fieldPredicate(f, t)
+			if err != nil {
+				return nil, err
+			}
+			alternatives = append(alternatives, pred)
+		}
+
+		negate := t.Negate
+		preds = append(preds, func(p Person) bool {
+			for _, pred := range alternatives {
+				if pred(p) {
+					return !negate
+				}
+			}
+			return negate
+		})
+	}
+
+	return func(p Person) bool {
+		for _, pred := range preds {
+			if !pred(p) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// SearchPeople returns all people matching the query and the tag filter. The
+// error for an invalid query is of type *query.Error.
+func (db *Database) SearchPeople(q query.Query, tags TagFilter) ([]*Person, error) {
+	cond, args, err := querySQL(q)
+	if err != nil {
+		return nil, err
+	}
+
+	tagCond, tagArgs := tags.sqlCondition()
+	args = append(args, tagArgs...)
+
+	sql, args, err := in("SELECT * FROM people WHERE "+cond+" AND "+tagCond+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.selectPeople(sql, args...)
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"ghenga/query"
+	"testing"
+)
+
+var queryTestPersons = []*Person{
+	{
+		Name:           "Query Person",
+		Title:          "CEO",
+		Department:     "Management",
+		City:           "Köln",
+		EmailAddresses: EmailAddresses{{Type: "work", Address: "qperson@example.com", Primary: true}},
+		PhoneNumbers:   PhoneNumbers{{Type: "work", Number: "+49 221 555123"}},
+		Comment:        "met at the trade fair",
+		CreatedAt:      parseTime("2016-01-15T10:00:00+00:00"),
+	},
+	{
+		Name:       "Query Tester",
+		Title:      "CEO",
+		Department: "Testers",
+		City:       "Bonn",
+		Comment:    "50% discount",
+		CreatedAt:  parseTime("2015-12-31T10:00:00+00:00"),
+	},
+}
+
+var searchPeopleTests = []struct {
+	query string
+	in    []int
+}{
+	{`title:CEO`, []int{0, 1}},
+	{`title:ceo -department:Testers`, []int{0}},
+	{`city:Köln title:CEO`, []int{0}},
+	{`"trade fair"`, []int{0}},
+	{`"fair trade"`, nil},
+	{`email:qperson@`, []int{0}},
+	{`phone:555123`, []int{0}},
+	{`-phone:555123 title:CEO`, []int{1}},
+	{`created:>2016-01-01`, []int{0}},
+	{`created:<2016-01-01`, []int{1}},
+	{`created:2016-01-15`, []int{0}},
+	{`created:>=2015-12-31 created:<=2016-01-15`, []int{0, 1}},
+	{`comment:"50%"`, []int{1}},
+	{`comment:"0%"`, []int{1}},
+	{`comment:"5_"`, nil},
+	{`bonn`, []int{1}},
+	{`city:koeln`, []int{0}},
+	{`KÖLN`, []int{0}},
+}
+
+func testSearchPeople(t *testing.T, db DB) {
+	var ids []int64
+	for _, p := range queryTestPersons {
+		person := *p
+		person.ChangedAt = person.CreatedAt
+		if err := db.InsertPerson(&person); err != nil {
+			t.Fatalf("insert test person returned error %v", err)
+		}
+		ids = append(ids, person.ID)
+	}
+
+	for i, test := range searchPeopleTests {
+		q, err := query.Parse(test.query)
+		if err != nil {
+			t.Errorf("test %d: parsing %q failed: %v", i, test.query, err)
+			continue
+		}
+
+		result, err := db.SearchPeople(q, TagFilter{})
+		if err != nil {
+			t.Errorf("test %d: SearchPeople(%q) returned error %v", i, test.query, err)
+			continue
+		}
+
+		// only consider the test persons
+		var found []int
+		for _, p := range result {
+			for j, id := range ids {
+				if p.ID == id {
+					found = append(found, j)
+				}
+			}
+		}
+
+		if len(found) != len(test.in) {
+			t.Errorf("test %d: SearchPeople(%q) returned wrong people, want %v, got %v", i, test.query, test.in, found)
+			continue
+		}
+
+		for j := range found {
+			if found[j] != test.in[j] {
+				t.Errorf("test %d: SearchPeople(%q) returned wrong people, want %v, got %v", i, test.query, test.in, found)
+				break
+			}
+		}
+	}
+
+	for _, id := range ids {
+		if err := db.DeletePerson(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDBSearchPeople(t *testing.T) {
+	testSearchPeople(t, testDB)
+}
+
+func TestMockDBSearchPeople(t *testing.T) {
+	testSearchPeople(t, NewMockDB(20, 5))
+}
+
+var searchPeopleErrorTests = []struct {
+	query string
+	pos   int
+}{
+	{`foo:bar`, 0},
+	{`city:Köln -size:>3`, 10},
+	{`name:>foo`, 0},
+	{`title:CEO created:2016-13-01`, 10},
+	{`created:>yesterday`, 0},
+}
+
+func testSearchPeopleError(t *testing.T, db DB) {
+	for i, test := range searchPeopleErrorTests {
+		q, err := query.Parse(test.query)
+		if err != nil {
+			t.Errorf("test %d: parsing %q failed: %v", i, test.query, err)
+			continue
+		}
+
+		_, err = db.SearchPeople(q, TagFilter{})
+		e, ok := err.(*query.Error)
+		if !ok {
+			t.Errorf("test %d: SearchPeople(%q) returned wrong error %v", i, test.query, err)
+			continue
+		}
+
+		if e.Pos != test.pos {
+			t.Errorf("test %d: SearchPeople(%q) returned wrong position, want %v, got %v", i, test.query, test.pos, e.Pos)
+		}
+	}
+}
+
+func TestDBSearchPeopleError(t *testing.T) {
+	testSearchPeopleError(t, testDB)
+}
+
+func TestMockDBSearchPeopleError(t *testing.T) {
+	testSearchPeopleError(t, NewMockDB(20, 5))
+}
@@ -0,0 +1,282 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ghenga/query"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/modl"
+)
+
+// SavedSearchDatabase allows handling saved searches.
+type SavedSearchDatabase interface {
+	FindSavedSearch(int64) (*SavedSearch, error)
+
+	InsertSavedSearch(*SavedSearch) error
+	ListSavedSearches(login string) ([]*SavedSearch, error)
+	UpdateSavedSearch(*SavedSearch) error
+	DeleteSavedSearch(int64) error
+}
+
+// SavedSearch is a search for people which is stored by a user, so that it
+// can be executed again later. A shared search is visible to all users, but
+// can only be changed by its owner.
+type SavedSearch struct {
+	ID    int64
+	Owner string
+	Name  string
+
+	Query    string
+	Mode     SearchMode
+	Tags     StringList
+	TagMatch string
+
+	Shared bool
+
+	ChangedAt time.Time
+	CreatedAt time.Time
+	Version   int64
+}
+
+// SavedSearchJSON is the JSON representation of a SavedSearch as returned or
+// consumed by the API.
+type SavedSearchJSON struct {
+	ID    int64  `json:"id,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	Name  string `json:"name,omitempty"`
+
+	Query    string   `json:"query"`
+	Mode     string   `json:"mode,omitempty"`
+	Tags     []string `json:"tags"`
+	TagMatch string   `json:"tag_match,omitempty"`
+
+	Shared bool `json:"shared"`
+
+	ChangedAt string `json:"changed_at,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+
+	Version int64 `json:"version"`
+}
+
+// Modes for matching the tags of a saved search, see TagFilter.
+const (
+	TagMatchAll = "all"
+	TagMatchAny = "any"
+)
+
+// NewSavedSearch returns a new saved search owned by the user.
+func NewSavedSearch(owner, name string) *SavedSearch {
+	ts := time.Now()
+	return &SavedSearch{
+		Owner:     owner,
+		Name:      strings.TrimSpace(name),
+		Mode:      SearchFullText,
+		TagMatch:  TagMatchAll,
+		CreatedAt: ts,
+		ChangedAt: ts,
+	}
+}
+
+// MarshalJSON returns the JSON representation of s.
+func (s SavedSearch) MarshalJSON() ([]byte, error) {
+	tags := []string(s.Tags)
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return json.Marshal(SavedSearchJSON{
+		ID:    s.ID,
+		Owner: s.Owner,
+		Name:  s.Name,
+
+		Query:    s.Query,
+		Mode:     string(s.Mode),
+		Tags:     tags,
+		TagMatch: s.TagMatch,
+
+		Shared: s.Shared,
+
+		ChangedAt: s.ChangedAt.Format(timeLayout),
+		CreatedAt: s.CreatedAt.Format(timeLayout),
+		Version:   s.Version,
+	})
+}
+
+// UnmarshalJSON returns a saved search from JSON.
+func (s *SavedSearch) UnmarshalJSON(data []byte) error {
+	var js SavedSearchJSON
+
+	err := json.Unmarshal(data, &js)
+	if err != nil {
+		return err
+	}
+
+	createdAt, err := time.Parse(timeLayout, js.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	changedAt, err := time.Parse(timeLayout, js.ChangedAt)
+	if err != nil {
+		return err
+	}
+
+	*s = SavedSearch{
+		ID:        js.ID,
+		Owner:     js.Owner,
+		CreatedAt: createdAt,
+		ChangedAt: changedAt,
+	}
+
+	s.Update(js)
+	return nil
+}
+
+// Validate checks if s is valid and returns an error if not.
+func (s *SavedSearch) Validate() error {
+	if s.Owner == "" {
+		return errors.New("owner is empty")
+	}
+
+	if s.Name == "" {
+		return errors.New("name is empty")
+	}
+
+	valid := false
+	for _, m := range SearchModes {
+		if s.Mode == m {
+			valid = true
+		}
+	}
+
+	if !valid {
+		return fmt.Errorf("invalid search mode %q", s.Mode)
+	}
+
+	if s.TagMatch != TagMatchAll && s.TagMatch != TagMatchAny {
+		return fmt.Errorf("invalid value %q for tag_match", s.TagMatch)
+	}
+
+	if s.Mode == SearchFullText {
+		if _, err := query.Parse(s.Query); err != nil {
+			return err
+		}
+	}
+
+	if s.CreatedAt.IsZero() || s.ChangedAt.IsZero() {
+		return errors.New("invalid timestamps")
+	}
+
+	return nil
+}
+
+// Update updates s with the fields from other. The owner is not changed.
+func (s *SavedSearch) Update(other SavedSearchJSON) {
+	s.Name = strings.TrimSpace(other.Name)
+	s.Query = other.Query
+
+	s.Mode = SearchMode(other.Mode)
+	if s.Mode == "" {
+		s.Mode = SearchFullText
+	}
+
+	s.Tags = nil
+	seen := make(map[string]bool)
+	for _, tag := range other.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !seen[tag] {
+			s.Tags = append(s.Tags, tag)
+			seen[tag] = true
+		}
+	}
+
+	s.TagMatch = other.TagMatch
+	if s.TagMatch == "" {
+		s.TagMatch = TagMatchAll
+	}
+
+	s.Shared = other.Shared
+	s.Version = other.Version
+}
+
+// TagFilter returns the filter for the tags of the saved search.
+func (s SavedSearch) TagFilter() TagFilter {
+	return TagFilter{Tags: s.Tags, MatchAll: s.TagMatch == TagMatchAll}
+}
+
+// VisibleTo returns true if the user may see and execute the search.
+func (s SavedSearch) VisibleTo(login string) bool {
+	return s.Shared || s.Owner == login
+}
+
+func (s SavedSearch) String() string {
+	return fmt.Sprintf("<SavedSearch[%v] %v (%v)>", s.ID, s.Name, s.Owner)
+}
+
+// replaceSavedSearchTag replaces the name of the tag with the given id by
+// name in all saved searches, the order of the tags is kept. If name is
+// empty, the tag is removed. The version of the saved searches is increased.
+// It must be run before the tag is changed.
+func replaceSavedSearchTag(e modl.SqlExecutor, id int64, name string) error {
+	if name == "" {
+		_, err := e.Exec(`UPDATE saved_searches SET tags = saved_searches.tags - t.name, version = version + 1
+			FROM tags t WHERE t.id = $1 AND saved_searches.tags @> jsonb_build_array(t.name)`, id)
+		return err
+	}
+
+	_, err := e.Exec(`UPDATE saved_searches SET tags = (
+				SELECT jsonb_agg(CASE WHEN e.name = t.name THEN $2::text ELSE e.name END ORDER BY e.n)
+				FROM jsonb_array_elements_text(saved_searches.tags) WITH ORDINALITY AS e(name, n)
+			), version = version + 1
+		FROM tags t WHERE t.id = $1 AND t.name <> $2::text AND saved_searches.tags @> jsonb_build_array(t.name)`, id, name)
+	return err
+}
+
+// FindSavedSearch returns the saved search with the given id.
+func (db *Database) FindSavedSearch(id int64) (*SavedSearch, error) {
+	var s SavedSearch
+
+	err := db.dbmap.SelectOne(&s, "SELECT * FROM saved_searches WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// InsertSavedSearch creates a new saved search.
+func (db *Database) InsertSavedSearch(s *SavedSearch) error {
+	return db.dbmap.Insert(s)
+}
+
+// ListSavedSearches returns the searches owned by the user and all shared
+// searches, ordered by name.
+func (db *Database) ListSavedSearches(login string) ([]*SavedSearch, error) {
+	var list []*SavedSearch
+	err := db.dbmap.Select(&list, "select * from saved_searches where owner = $1 or shared order by name, id", login)
+	return list, err
+}
+
+// UpdateSavedSearch modifies an existing saved search.
+func (db *Database) UpdateSavedSearch(s *SavedSearch) error {
+	_, err := db.dbmap.Update(s)
+	return err
+}
+
+// DeleteSavedSearch removes a saved search.
+func (db *Database) DeleteSavedSearch(id int64) error {
+	res := db.dbmap.Dbx.MustExec("delete from saved_searches where id = $1", id)
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n != 1 {
+		return errors.New("saved search not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func insertSavedSearch(t *testing.T, db DB, owner, name string, shared bool) *SavedSearch {
+	s := NewSavedSearch(owner, name)
+	s.Query = "city:Köln"
+	s.Tags = StringList{"customer"}
+	s.Shared = shared
+
+	if err := s.Validate(); err != nil {
+		t.Fatalf("saved search %v is invalid: %v", s, err)
+	}
+
+	if err := db.InsertSavedSearch(s); err != nil {
+		t.Fatalf("unable to insert saved search %v: %v", s, err)
+	}
+
+	return s
+}
+
+func savedSearchIDs(list []*SavedSearch) []int64 {
+	var ids []int64
+	for _, s := range list {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+func testSavedSearches(t *testing.T, db DB) {
+	s1 := insertSavedSearch(t, db, "user", "savedtest b", false)
+	s2 := insertSavedSearch(t, db, "admin", "savedtest a", true)
+	s3 := insertSavedSearch(t, db, "admin", "savedtest c", false)
+
+	s, err := db.FindSavedSearch(s1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Owner != "user" || s.Query != "city:Köln" || s.Mode != SearchFullText ||
+		!reflect.DeepEqual(s.Tags, StringList{"customer"}) || !s.TagFilter().MatchAll {
+		t.Fatalf("wrong saved search loaded: %#v", s)
+	}
+
+	for _, test := range []struct {
+		login string
+		ids   []int64
+	}{
+		{"user", []int64{s2.ID, s1.ID}},
+		{"admin", []int64{s2.ID, s3.ID}},
+	} {
+		list, err := db.ListSavedSearches(test.login)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []int64
+		for _, id := range savedSearchIDs(list) {
+			if id == s1.ID || id == s2.ID || id == s3.ID {
+				ids = append(ids, id)
+			}
+		}
+
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("wrong saved searches listed for %v, want %v, got %v", test.login, test.ids, ids)
+		}
+	}
+
+	s.Shared = true
+	s.Tags = StringList{"customer", "vip"}
+	s.TagMatch = TagMatchAny
+	if err = db.UpdateSavedSearch(s); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = db.FindSavedSearch(s1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.Shared || s.TagFilter().MatchAll || len(s.Tags) != 2 {
+		t.Fatalf("saved search was not updated: %#v", s)
+	}
+
+	s.Version = 1000
+	if err = db.UpdateSavedSearch(s); err == nil {
+		t.Fatalf("update did not fail despite wrong version field")
+	}
+
+	for _, s := range []*SavedSearch{s1, s2, s3} {
+		if err = db.DeleteSavedSearch(s.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = db.DeleteSavedSearch(s1.ID); err == nil {
+		t.Fatalf("deleting a removed saved search did not fail")
+	}
+}
+
+func TestDBSavedSearches(t *testing.T) {
+	testSavedSearches(t, testDB)
+}
+
+func TestMockDBSavedSearches(t *testing.T) {
+	testSavedSearches(t, NewMockDB(20, 5))
+}
+
+func testSavedSearchTags(t *testing.T, db DB) {
+	renamed := insertTag(t, db, "savedtest-renamed")
+	deleted := insertTag(t, db, "savedtest-deleted")
+
+	s1 := insertSavedSearch(t, db, "user", "savedtest tags", false)
+	s1.Tags = StringList{renamed.Name, "customer", deleted.Name}
+	if err := db.UpdateSavedSearch(s1); err != nil {
+		t.Fatal(err)
+	}
+
+	s2 := insertSavedSearch(t, db, "user", "savedtest other", false)
+
+	renamed.Name = "savedtest-new"
+	if err := db.UpdateTag(renamed); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteTag(deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		s       *SavedSearch
+		tags    StringList
+		version int64
+	}{
+		{s1, StringList{"savedtest-new", "customer"}, s1.Version + 2},
+		{s2, StringList{"customer"}, s2.Version},
+	} {
+		s, err := db.FindSavedSearch(test.s.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(s.Tags, test.tags) || s.Version != test.version {
+			t.Errorf("saved search %v has wrong tags or version, want %v (version %d), got %v (version %d)",
+				s.Name, test.tags, test.version, s.Tags, s.Version)
+		}
+
+		if err = db.DeleteSavedSearch(s.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.DeleteTag(renamed.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBSavedSearchTags(t *testing.T) {
+	testSavedSearchTags(t, testDB)
+}
+
+func TestMockDBSavedSearchTags(t *testing.T) {
+	testSavedSearchTags(t, NewMockDB(20, 5))
+}
+
+var savedSearchValidateTests = []struct {
+	js    string
+	valid bool
+}{
+	{`{"name": "foo"}`, true},
+	{`{"name": "foo", "query": "city:Köln", "tags": ["a"], "tag_match": "any"}`, true},
+	{`{"name": "foo", "query": "Maier", "mode": "similar"}`, true},
+	{`{"name": " "}`, false},
+	{`{"name": "foo", "mode": "bar"}`, false},
+	{`{"name": "foo", "tag_match": "some"}`, false},
+	{`{"name": "foo", "query": "city:\"Köln"}`, false},
+}
+
+func TestSavedSearchValidate(t *testing.T) {
+	for i, test := range savedSearchValidateTests {
+		var js SavedSearchJSON
+		if err := json.Unmarshal([]byte(test.js), &js); err != nil {
+			t.Fatal(err)
+		}
+
+		s := NewSavedSearch("user", "")
+		s.Update(js)
+
+		err := s.Validate()
+		if test.valid && err != nil {
+			t.Errorf("test %d: saved search %v is invalid: %v", i, test.js, err)
+		}
+
+		if !test.valid && err == nil {
+			t.Errorf("test %d: invalid saved search %v passed validation", i, test.js)
+		}
+	}
+}
@@ -1,14 +1,274 @@
 package db
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// searchTerms splits the query into words consisting only of letters and
+// digits, which are folded (see fold). The search documents in the database
+// are built the same way, see the migration for the table people_search.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(fold(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// tsQuery returns a full-text query for PostgreSQL which matches documents
+// containing all terms, each term may be a prefix of a word.
+func tsQuery(terms []string) string {
+	var parts []string
+	for _, term := range terms {
+		parts = append(parts, term+":*")
+	}
+
+	return strings.Join(parts, " & ")
+}
+
+// SearchMode selects how FuzzyFindPersons matches people.
+type SearchMode string
+
+// Search modes for FuzzyFindPersons.
+const (
+	// SearchFullText finds people with all words of the query in any field.
+	SearchFullText SearchMode = "fulltext"
+
+	// SearchSimilar finds people with a name similar to the query, based on
+	// trigrams.
+	SearchSimilar SearchMode = "similar"
+
+	// SearchPhonetic finds people with a name which sounds like the query,
+	// based on the Kölner Phonetik and Double Metaphone codes.
+	SearchPhonetic SearchMode = "phonetic"
+)
+
+// SearchModes contains all valid search modes.
+var SearchModes = []SearchMode{SearchFullText, SearchSimilar, SearchPhonetic}
+
 // FuzzyFindPersons searches the database for persons related to the query
-// string.
-func (db *Database) FuzzyFindPersons(query string) ([]*Person, error) {
-	var result []*Person
+// string, using the given search mode. The result is ordered by relevance.
+// Only people matching the tag filter are returned.
+//
+// In the mode SearchFullText a person matches when all words of the query are
+// found (as a prefix) in any field, or when the query is a substring of the
+// name or an email address.
+//
+// In all modes, the query and the data are folded before matching (see fold),
+// so that e.g. "Mueller" finds "Müller" and "Strasse" finds "Straße".
+//
+// In the mode SearchSimilar a person matches when the similarity of the name
+// (see nameSimilarity) is at least similarityThreshold.
+//
+// In the mode SearchPhonetic a person matches when each word of the query
+// has the same Kölner Phonetik or Double Metaphone code as a word of the
+// name. People matching more codes are returned first.
+func (db *Database) FuzzyFindPersons(query string, mode SearchMode, tags TagFilter) ([]*Person, error) {
+	switch mode {
+	case SearchFullText:
+		return db.fullTextFindPersons(query, tags)
+	case SearchSimilar:
+		return db.similarFindPersons(query, tags)
+	case SearchPhonetic:
+		return db.phoneticFindPersons(query, tags)
+	}
+
+	return nil, fmt.Errorf("invalid search mode %q", mode)
+}
+
+// similarFindPersons returns people with a name similar to the query, see
+// FuzzyFindPersons.
+func (db *Database) similarFindPersons(query string, tags TagFilter) ([]*Person, error) {
+	cond, tagArgs := tags.sqlCondition()
+	query = fold(query)
+
+	// The operators % (similarity of the name) and <% (similarity of a part of
+	// the name) can use the trigram index on the name, their thresholds are
+	// set for the transaction. The score is checked again afterwards, because
+	// <% also matches parts of the name spanning several words.
+	args := append([]interface{}{query, query, query, query, similarityThreshold}, tagArgs...)
+	q, args, err := in(`SELECT people.* FROM people,
+		LATERAL (SELECT greatest(similarity(people_search_fold(people.name), ?),
+			(SELECT max(similarity(w, ?)) FROM regexp_split_to_table(people_search_fold(people.name), '\s+') AS w)) AS score) s
+		WHERE (people_search_fold(people.name) % ? OR ? <% people_search_fold(people.name))
+			AND s.score >= ? AND `+cond+` ORDER BY s.score DESC, people.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.dbmap.Dbx.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	// SET does not support bind parameters
+	for _, name := range []string{"similarity_threshold", "word_similarity_threshold"} {
+		_, err = tx.Exec(fmt.Sprintf("SET LOCAL pg_trgm.%s = %v", name, similarityThreshold))
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	var people []*Person
+	if err = tx.Select(&people, q, args...); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	err = loadPeopleDetails(db.dbmap.Dbx, people)
+	if err != nil {
+		return nil, err
+	}
+
+	return people, nil
+}
+
+// fullTextFindPersons returns people matching all words of the query, see
+// FuzzyFindPersons.
+func (db *Database) fullTextFindPersons(query string, tags TagFilter) ([]*Person, error) {
+	cond, tagArgs := tags.sqlCondition()
+	pattern := "%" + likeEscaper.Replace(fold(query)) + "%"
 
-	err := db.dbmap.Select(&result, "SELECT * FROM people WHERE name ILIKE $1", "%"+query+"%")
+	match := `people_search_fold(name) LIKE ? OR
+		id IN (SELECT person_id FROM email_addresses WHERE people_search_fold(address) LIKE ?)`
+	matchArgs := []interface{}{pattern, pattern}
+	order := "people.id"
+	var orderArgs []interface{}
+
+	if terms := searchTerms(query); len(terms) > 0 {
+		tsq := tsQuery(terms)
+		match = "s.document @@ to_tsquery('simple', ?) OR " + match
+		matchArgs = append([]interface{}{tsq}, matchArgs...)
+		order = "ts_rank(s.document, to_tsquery('simple', ?)) DESC, " + order
+		orderArgs = append(orderArgs, tsq)
+	}
+
+	// the arguments must be in the same order as in the query
+	var args []interface{}
+	args = append(args, matchArgs...)
+	args = append(args, tagArgs...)
+	args = append(args, orderArgs...)
+
+	q, args, err := in(`SELECT people.* FROM people LEFT JOIN people_search s ON s.person_id = people.id
+		WHERE (`+match+`) AND `+cond+` ORDER BY `+order, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	return result, nil
+	return db.selectPeople(q, args...)
+}
+
+// Weights for the fields of a person in the full-text search, same as the
+// default weights for ts_rank in PostgreSQL.
+const (
+	weightA = 1.0
+	weightB = 0.4
+	weightC = 0.2
+	weightD = 0.1
+)
+
+// searchWord is a word in the search document of a person.
+type searchWord struct {
+	word   string
+	weight float64
+}
+
+// searchDocument returns the words of all fields of p, weighted in the same
+// way as the search documents in the database.
+func searchDocument(p Person) []searchWord {
+	var doc []searchWord
+	add := func(weight float64, fields ...string) {
+		for _, field := range fields {
+			for _, word := range searchTerms(field) {
+				doc = append(doc, searchWord{word, weight})
+			}
+		}
+	}
+
+	add(weightA, p.Name)
+
+	add(weightB, p.Title, p.Department)
+	for _, addr := range p.EmailAddresses {
+		add(weightB, addr.Address)
+	}
+
+	add(weightC, p.Street, p.PostalCode, p.State, p.City, p.Country)
+	for _, num := range p.PhoneNumbers {
+		add(weightC, num.Number)
+	}
+
+	add(weightD, p.Comment)
+
+	return doc
+}
+
+// searchRank returns the relevance of p for the search terms, which is zero if
+// not all terms are found in the search document.
+func searchRank(p Person, terms []string) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+
+	doc := searchDocument(p)
+
+	var rank float64
+	for _, term := range terms {
+		best := 0.0
+		for _, w := range doc {
+			if strings.HasPrefix(w.word, term) && w.weight > best {
+				best = w.weight
+			}
+		}
+
+		if best == 0 {
+			return 0
+		}
+
+		rank += best
+	}
+
+	return rank
+}
+
+// rankedPerson is a search result with the relevance.
+type rankedPerson struct {
+	p    *Person
+	rank float64
+}
+
+// byRank sorts search results by relevance, the most relevant first.
+type byRank []rankedPerson
+
+func (l byRank) Len() int      { return len(l) }
+func (l byRank) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l byRank) Less(i, j int) bool {
+	if l[i].rank == l[j].rank {
+		return l[i].p.ID < l[j].p.ID
+	}
+	return l[i].rank > l[j].rank
+}
+
+// sortByRank sorts the people by the relevance and returns the result.
+func sortByRank(results []rankedPerson) []*Person {
+	sort.Sort(byRank(results))
+
+	var list []*Person
+	for _, r := range results {
+		list = append(list, r.p)
+	}
+
+	return list
+}
+
+// FindPeopleByEmail returns all persons which have the given email address.
+// Case is ignored.
+func (db *Database) FindPeopleByEmail(address string) ([]*Person, error) {
+	return db.selectPeople(`SELECT * FROM people WHERE id IN
+		(SELECT person_id FROM email_addresses WHERE lower(address) = lower($1)) ORDER BY id`, address)
 }
@@ -4,8 +4,8 @@ import "testing"
 
 var searchTestPersons = []Person{
 	{
-		Name:         "Tamara Skibicki",
-		EmailAddress: "pit@ackermannsehls.org",
+		Name:           "Tamara Skibicki",
+		EmailAddresses: EmailAddresses{{Type: "work", Address: "pit@ackermannsehls.org", Primary: true}},
 		PhoneNumbers: []PhoneNumber{
 			{Type: "work", Number: "(03867) 3074101"},
 			{Type: "mobile", Number: "+49-077-1634655"},
@@ -17,18 +17,18 @@ var searchTestPersons = []Person{
 		Version:   23,
 	},
 	{
-		Name:         "Mario Drees",
-		EmailAddress: "bela_freigang@herweg.com",
-		ChangedAt:    parseTime("2016-04-24T10:30:07+00:00"),
-		CreatedAt:    parseTime("2016-04-24T10:30:07+00:00"),
-		Version:      1,
+		Name:           "Mario Drees",
+		EmailAddresses: EmailAddresses{{Type: "work", Address: "bela_freigang@herweg.com", Primary: true}},
+		ChangedAt:      parseTime("2016-04-24T10:30:07+00:00"),
+		CreatedAt:      parseTime("2016-04-24T10:30:07+00:00"),
+		Version:        1,
 	},
 }
 
-//  fuzzyFindPersons makes sure that at least people are contained within the
-//  result set.
+// fuzzyFindPersons makes sure that at least people are contained within the
+// result set.
 func fuzzyFindPersons(t *testing.T, db DB, query string, in []Person, out []Person) {
-	result, err := db.FuzzyFindPersons(query)
+	result, err := db.FuzzyFindPersons(query, SearchFullText, TagFilter{})
 	if err != nil {
 		t.Fatalf("FuzzyFindPersons(%q) returned error %v", query, err)
 	}
@@ -91,6 +91,31 @@ var fuzzyFindTests = []struct {
 		query: "y",
 		out:   []Person{searchTestPersons[0], searchTestPersons[1]},
 	},
+	{
+		query: "HERWEG.com",
+		in:    []Person{searchTestPersons[1]},
+		out:   []Person{searchTestPersons[0]},
+	},
+	{
+		query: "3074101",
+		in:    []Person{searchTestPersons[0]},
+		out:   []Person{searchTestPersons[1]},
+	},
+	{
+		query: "fake prof",
+		in:    []Person{searchTestPersons[0]},
+		out:   []Person{searchTestPersons[1]},
+	},
+	{
+		query: "ackermannsehls",
+		in:    []Person{searchTestPersons[0]},
+		out:   []Person{searchTestPersons[1]},
+	},
+	{
+		query: "drees herweg",
+		in:    []Person{searchTestPersons[1]},
+		out:   []Person{searchTestPersons[0]},
+	},
 }
 
 func testFuzzyFindPersons(t *testing.T, db DB) {
@@ -114,3 +139,165 @@ func TestMockDBFuzzyFindPersons(t *testing.T) {
 	db := NewMockDB(20, 5)
 	testFuzzyFindPersons(t, db)
 }
+
+func testFuzzyFindPersonsRank(t *testing.T, db DB) {
+	var ids []int64
+	for _, p := range []*Person{
+		{Name: "Rank Comment", Comment: "knows qwertzrank"},
+		{Name: "Rank City", City: "Qwertzrank"},
+		{Name: "Qwertzrank Name"},
+		{Name: "Rank Title", Title: "Qwertzrank Officer"},
+	} {
+		p.CreatedAt = parseTime("2016-04-24T10:30:07+00:00")
+		p.ChangedAt = p.CreatedAt
+		if err := db.InsertPerson(p); err != nil {
+			t.Fatalf("insert test person returned error %v", err)
+		}
+		ids = append(ids, p.ID)
+	}
+
+	result, err := db.FuzzyFindPersons("qwertz", SearchFullText, TagFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int64{ids[2], ids[3], ids[1], ids[0]}
+	if len(result) != len(want) {
+		t.Fatalf("wrong number of results, want %v, got %v", len(want), len(result))
+	}
+
+	for i, id := range want {
+		if result[i].ID != id {
+			t.Errorf("wrong person at position %d, want %v, got %v", i, id, result[i])
+		}
+	}
+
+	for _, id := range ids {
+		if err = db.DeletePerson(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDBFuzzyFindPersonsRank(t *testing.T) {
+	testFuzzyFindPersonsRank(t, testDB)
+}
+
+func TestMockDBFuzzyFindPersonsRank(t *testing.T) {
+	testFuzzyFindPersonsRank(t, NewMockDB(20, 5))
+}
+
+func testFuzzyFindPersonsFold(t *testing.T, db DB) {
+	p := NewPerson("José Jürgen Müller")
+	p.Street = "Hauptstraße 1"
+	p.EmailAddresses = EmailAddresses{{Type: "work", Address: "jürgen@müller.example.com", Primary: true}}
+	if err := db.InsertPerson(p); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range SearchModes {
+		for _, query := range []string{"Mueller", "MÜLLER", "juergen", "Jose"} {
+			result, err := db.FuzzyFindPersons(query, mode, TagFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			found := false
+			for _, r := range result {
+				if r.ID == p.ID {
+					found = true
+				}
+			}
+
+			if !found {
+				t.Errorf("FuzzyFindPersons(%q, %v) did not find person %v", query, mode, p)
+			}
+		}
+	}
+
+	for _, query := range []string{"hauptstrasse", "juergen@mueller"} {
+		fuzzyFindPersons(t, db, query, []Person{*p}, nil)
+	}
+
+	if err := db.DeletePerson(p.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBFuzzyFindPersonsFold(t *testing.T) {
+	testFuzzyFindPersonsFold(t, testDB)
+}
+
+func TestMockDBFuzzyFindPersonsFold(t *testing.T) {
+	testFuzzyFindPersonsFold(t, NewMockDB(20, 5))
+}
+
+func testFuzzyFindPersonsLike(t *testing.T, db DB) {
+	p1 := NewPerson("Qzaxw Test")
+	p2 := NewPerson("Like Test")
+	p2.EmailAddresses = EmailAddresses{{Type: "work", Address: "qz_xw@example.com", Primary: true}}
+
+	for _, p := range []*Person{p1, p2} {
+		if err := db.InsertPerson(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the special characters for LIKE patterns must match literally
+	fuzzyFindPersons(t, db, "qz_xw", []Person{*p2}, []Person{*p1})
+	fuzzyFindPersons(t, db, "qz%xw", nil, []Person{*p1})
+
+	for _, p := range []*Person{p1, p2} {
+		if err := db.DeletePerson(p.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDBFuzzyFindPersonsLike(t *testing.T) {
+	testFuzzyFindPersonsLike(t, testDB)
+}
+
+func TestMockDBFuzzyFindPersonsLike(t *testing.T) {
+	testFuzzyFindPersonsLike(t, NewMockDB(20, 5))
+}
+
+func testFindPeopleByEmail(t *testing.T, db DB) {
+	p := NewPerson("Email Test")
+	p.EmailAddresses = EmailAddresses{
+		{Type: "work", Address: "work@email-test.example.com", Primary: true},
+		{Type: "private", Address: "private@email-test.example.com"},
+	}
+
+	if err := db.InsertPerson(p); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, addr := range []string{"work@email-test.example.com", "Private@Email-Test.example.com"} {
+		list, err := db.FindPeopleByEmail(addr)
+		if err != nil {
+			t.Fatalf("FindPeopleByEmail(%q) returned error %v", addr, err)
+		}
+
+		if len(list) != 1 || list[0].ID != p.ID {
+			t.Errorf("FindPeopleByEmail(%q) returned wrong result %v", addr, list)
+		}
+	}
+
+	list, err := db.FindPeopleByEmail("email-test.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 0 {
+		t.Errorf("FindPeopleByEmail returned people for partial address: %v", list)
+	}
+}
+
+func TestDBFindPeopleByEmail(t *testing.T) {
+	testFindPeopleByEmail(t, testDB)
+}
+
+func TestMockDBFindPeopleByEmail(t *testing.T) {
+	testFindPeopleByEmail(t, NewMockDB(20, 5))
+}
@@ -30,16 +30,26 @@ func (s Session) String() string {
 
 const tokenLength = 32
 
-// newSession generates a new session for a user.
-func newSession(user string, valid time.Duration) (*Session, error) {
+// newToken returns a new random token.
+func newToken() (string, error) {
 	buf := make([]byte, tokenLength)
 	_, err := io.ReadFull(rand.Reader, buf)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// newSession generates a new session for a user.
+func newSession(user string, valid time.Duration) (*Session, error) {
+	token, err := newToken()
 	if err != nil {
 		return nil, err
 	}
 
 	s := &Session{
-		Token:      hex.EncodeToString(buf),
+		Token:      token,
 		User:       user,
 		ValidUntil: time.Now().Add(valid),
 	}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrTimeout is returned when a query took longer than allowed.
+var ErrTimeout = errors.New("query timed out")
+
+// PersonSuggestion is a lightweight representation of a person, used for
+// autocompletion.
+type PersonSuggestion struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Title      string `json:"title"`
+	Department string `json:"department"`
+}
+
+// suggestPrefixQuery returns a full-text query for PostgreSQL which matches
+// documents where each term is the prefix of a word in the name (weight A).
+func suggestPrefixQuery(terms []string) string {
+	var parts []string
+	for _, term := range terms {
+		parts = append(parts, term+":*A")
+	}
+
+	return strings.Join(parts, " & ")
+}
+
+// SuggestPeople returns at most limit people for the prefix typed by a user.
+// A person matches when the name starts with the prefix, or when every word
+// of the prefix is the beginning of a word in the name. People with a name
+// starting with the prefix are returned first, then the result is ordered by
+// name. Case, umlauts and diacritics are ignored (see fold).
+//
+// When timeout is not zero and the query takes longer, ErrTimeout is
+// returned.
+func (db *Database) SuggestPeople(prefix string, limit int, timeout time.Duration) ([]*PersonSuggestion, error) {
+	terms := searchTerms(prefix)
+	if len(terms) == 0 || limit <= 0 {
+		return nil, nil
+	}
+
+	tx, err := db.dbmap.Dbx.Beginx()
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout > 0 {
+		// SET does not support bind parameters
+		_, err = tx.Exec(fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout/time.Millisecond))
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	var result []*PersonSuggestion
+	err = tx.Select(&result, `SELECT p.id, p.name, p.title, p.department
+		FROM people p JOIN people_search s ON s.person_id = p.id
+		WHERE people_search_fold(p.name) LIKE $1 OR s.document @@ to_tsquery('simple', $2)
+		ORDER BY people_search_fold(p.name) LIKE $1 DESC, p.name, p.id LIMIT $3`,
+		likeEscaper.Replace(fold(prefix))+"%", suggestPrefixQuery(terms), limit)
+	if err != nil {
+		tx.Rollback()
+
+		if e, ok := err.(*pq.Error); ok && e.Code == "57014" {
+			return nil, ErrTimeout
+		}
+
+		return nil, err
+	}
+
+	return result, tx.Commit()
+}
+
+// suggestion is a person matching a prefix.
+type suggestion struct {
+	s      *PersonSuggestion
+	prefix bool
+}
+
+// bySuggestion sorts suggestions like SuggestPeople.
+type bySuggestion []suggestion
+
+func (l bySuggestion) Len() int      { return len(l) }
+func (l bySuggestion) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l bySuggestion) Less(i, j int) bool {
+	if l[i].prefix != l[j].prefix {
+		return l[i].prefix
+	}
+
+	if l[i].s.Name != l[j].s.Name {
+		return l[i].s.Name < l[j].s.Name
+	}
+
+	return l[i].s.ID < l[j].s.ID
+}
+
+// suggestMatch returns whether the name matches the prefix (see
+// SuggestPeople), and whether the name starts with the prefix.
+func suggestMatch(name, prefix string, terms []string) (match, isPrefix bool) {
+	if strings.HasPrefix(fold(name), fold(prefix)) {
+		return true, true
+	}
+
+	words := searchTerms(name)
+	for _, term := range terms {
+		found := false
+		for _, w := range words {
+			if strings.HasPrefix(w, term) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false, false
+		}
+	}
+
+	return true, false
+}
@@ -0,0 +1,79 @@
+package db
+
+import "testing"
+
+func testSuggestPeople(t *testing.T, db DB) {
+	var ids []int64
+	for _, name := range []string{"Sugtest Jürgen", "Anna Sugtest", "Sugtestmann Zyx", "Other Person"} {
+		p := NewPerson(name)
+		p.Title = "Title " + name
+		if err := db.InsertPerson(p); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, p.ID)
+	}
+
+	for _, test := range []struct {
+		prefix string
+		limit  int
+		want   []int64
+	}{
+		{"sugtest", 10, []int64{ids[0], ids[2], ids[1]}},
+		{"Sugtest J", 10, []int64{ids[0]}},
+		{"juer sug", 10, []int64{ids[0]}},
+		{"sugtest", 2, []int64{ids[0], ids[2]}},
+		{"ann", 10, []int64{ids[1]}},
+		{"sugtest", 0, nil},
+		{"", 10, nil},
+	} {
+		result, err := db.SuggestPeople(test.prefix, test.limit, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// only consider the test persons
+		var found []int64
+		for _, s := range result {
+			for _, id := range ids {
+				if s.ID == id {
+					found = append(found, id)
+				}
+			}
+		}
+
+		if len(found) != len(test.want) {
+			t.Errorf("prefix %q: wrong people returned, want %v, got %v", test.prefix, test.want, found)
+			continue
+		}
+
+		for i := range found {
+			if found[i] != test.want[i] {
+				t.Errorf("prefix %q: wrong order, want %v, got %v", test.prefix, test.want, found)
+				break
+			}
+		}
+	}
+
+	result, err := db.SuggestPeople("Sugtest J", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result) != 1 || result[0].Name != "Sugtest Jürgen" || result[0].Title != "Title Sugtest Jürgen" {
+		t.Errorf("wrong suggestion returned: %v", result)
+	}
+
+	for _, id := range ids {
+		if err := db.DeletePerson(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDBSuggestPeople(t *testing.T) {
+	testSuggestPeople(t, testDB)
+}
+
+func TestMockDBSuggestPeople(t *testing.T) {
+	testSuggestPeople(t, NewMockDB(20, 5))
+}
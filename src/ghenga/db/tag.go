@@ -0,0 +1,287 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TagDatabase allows handling tags.
+type TagDatabase interface {
+	FindTag(int64) (*Tag, error)
+	FindTagName(string) (*Tag, error)
+
+	InsertTag(*Tag) error
+	ListTags() ([]*Tag, error)
+	UpdateTag(*Tag) error
+	DeleteTag(int64) error
+}
+
+// Tag is a label which can be attached to people to categorize them.
+type Tag struct {
+	ID   int64
+	Name string
+
+	ChangedAt time.Time
+	CreatedAt time.Time
+	Version   int64
+}
+
+// TagJSON is the JSON representation of a Tag as returned or consumed by the
+// API.
+type TagJSON struct {
+	ID   int64  `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	ChangedAt string `json:"changed_at,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+
+	Version int64 `json:"version"`
+}
+
+// NewTag returns a new tag.
+func NewTag(name string) *Tag {
+	ts := time.Now()
+	return &Tag{
+		Name:      strings.TrimSpace(name),
+		CreatedAt: ts,
+		ChangedAt: ts,
+	}
+}
+
+// MarshalJSON returns the JSON representation of t.
+func (t Tag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(TagJSON{
+		ID:   t.ID,
+		Name: t.Name,
+
+		ChangedAt: t.ChangedAt.Format(timeLayout),
+		CreatedAt: t.CreatedAt.Format(timeLayout),
+		Version:   t.Version,
+	})
+}
+
+// UnmarshalJSON returns a tag from JSON.
+func (t *Tag) UnmarshalJSON(data []byte) error {
+	var jt TagJSON
+
+	err := json.Unmarshal(data, &jt)
+	if err != nil {
+		return err
+	}
+
+	createdAt, err := time.Parse(timeLayout, jt.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	changedAt, err := time.Parse(timeLayout, jt.ChangedAt)
+	if err != nil {
+		return err
+	}
+
+	*t = Tag{
+		ID:        jt.ID,
+		CreatedAt: createdAt,
+		ChangedAt: changedAt,
+	}
+
+	t.Update(jt)
+	return nil
+}
+
+// Validate checks if t is valid and returns an error if not.
+func (t *Tag) Validate() error {
+	if t.Name == "" {
+		return errors.New("name is empty")
+	}
+
+	if t.CreatedAt.IsZero() || t.ChangedAt.IsZero() {
+		return errors.New("invalid timestamps")
+	}
+
+	return nil
+}
+
+// Update updates t with the fields from other.
+func (t *Tag) Update(other TagJSON) {
+	t.Name = strings.TrimSpace(other.Name)
+	t.Version = other.Version
+}
+
+func (t Tag) String() string {
+	return fmt.Sprintf("<Tag[%v] %v>", t.ID, t.Name)
+}
+
+// TagFilter selects people based on the tags attached to them. A TagFilter
+// without tags matches all people.
+type TagFilter struct {
+	Tags []string
+
+	// MatchAll selects whether a person must have all tags (AND) or at least
+	// one of them (OR).
+	MatchAll bool
+}
+
+// Empty returns true iff f does not contain any tags.
+func (f TagFilter) Empty() bool {
+	return len(f.Tags) == 0
+}
+
+// Match returns true iff the tags match the filter.
+func (f TagFilter) Match(tags []string) bool {
+	if f.Empty() {
+		return true
+	}
+
+	has := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		has[tag] = true
+	}
+
+	for _, tag := range f.Tags {
+		if f.MatchAll && !has[tag] {
+			return false
+		}
+
+		if !f.MatchAll && has[tag] {
+			return true
+		}
+	}
+
+	return f.MatchAll
+}
+
+// sqlCondition returns an SQL condition (using the bindvar '?') for the
+// filter, which selects all matching people. For an empty filter, the
+// condition is always true.
+func (f TagFilter) sqlCondition() (string, []interface{}) {
+	if f.Empty() {
+		return "TRUE", nil
+	}
+
+	query := `id IN (SELECT pt.person_id FROM person_tags pt JOIN tags t ON t.id = pt.tag_id
+		WHERE t.name IN (?)`
+	args := []interface{}{f.Tags}
+
+	if !f.MatchAll {
+		return query + ")", args
+	}
+
+	// count the distinct tag names, so that duplicates in the filter don't
+	// prevent matches
+	distinct := make(map[string]struct{})
+	for _, tag := range f.Tags {
+		distinct[tag] = struct{}{}
+	}
+
+	query += " GROUP BY pt.person_id HAVING count(DISTINCT t.id) = ?)"
+	args = append(args, len(distinct))
+
+	return query, args
+}
+
+// FindTag returns the tag with the given id.
+func (db *Database) FindTag(id int64) (*Tag, error) {
+	var t Tag
+
+	err := db.dbmap.SelectOne(&t, "SELECT * FROM tags WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// FindTagName returns the tag with the given name.
+func (db *Database) FindTagName(name string) (*Tag, error) {
+	var t Tag
+
+	err := db.dbmap.SelectOne(&t, "SELECT * FROM tags WHERE name = $1", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// UpdateTag modifies an existing tag. The tag is renamed in all saved
+// searches, the version of all people and saved searches with the tag is
+// increased.
+func (db *Database) UpdateTag(t *Tag) error {
+	tx, err := db.dbmap.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = replaceSavedSearchTag(tx, t.ID, t.Name); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.Update(t); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = bumpPeopleVersions(tx, "id IN (SELECT person_id FROM person_tags WHERE tag_id = $1)", t.ID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InsertTag creates a new tag.
+func (db *Database) InsertTag(t *Tag) error {
+	return db.dbmap.Insert(t)
+}
+
+// ListTags returns the list of tags, ordered by name.
+func (db *Database) ListTags() ([]*Tag, error) {
+	var tags []*Tag
+	err := db.dbmap.Select(&tags, "select * from tags order by name")
+	return tags, err
+}
+
+// DeleteTag removes a tag. The tag is also removed from all people and saved
+// searches, their version is increased.
+func (db *Database) DeleteTag(id int64) error {
+	tx, err := db.dbmap.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = bumpPeopleVersions(tx, "id IN (SELECT person_id FROM person_tags WHERE tag_id = $1)", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = replaceSavedSearchTag(tx, id, ""); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	res, err := tx.Exec("delete from tags where id = $1", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if n != 1 {
+		tx.Rollback()
+		return errors.New("tag not found")
+	}
+
+	return tx.Commit()
+}
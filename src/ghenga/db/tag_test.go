@@ -0,0 +1,237 @@
+package db
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func insertTag(t *testing.T, db DB, name string) *Tag {
+	tag := NewTag(name)
+	if err := tag.Validate(); err != nil {
+		t.Fatalf("tag %v is invalid: %v", tag, err)
+	}
+
+	if err := db.InsertTag(tag); err != nil {
+		t.Fatalf("unable to insert tag %v: %v", tag, err)
+	}
+
+	return tag
+}
+
+func insertTaggedPerson(t *testing.T, db DB, name string, tags ...string) *Person {
+	p := NewPerson(name)
+	p.Update(PersonJSON{Name: name, Tags: tags})
+
+	if err := db.InsertPerson(p); err != nil {
+		t.Fatalf("unable to insert person %v: %v", p, err)
+	}
+
+	return p
+}
+
+func personIDs(people []*Person) []int64 {
+	var ids []int64
+	for _, p := range people {
+		ids = append(ids, p.ID)
+	}
+	sort.Sort(int64Slice(ids))
+	return ids
+}
+
+type int64Slice []int64
+
+func (l int64Slice) Len() int           { return len(l) }
+func (l int64Slice) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l int64Slice) Less(i, j int) bool { return l[i] < l[j] }
+
+func testTagFilter(t *testing.T, db DB) {
+	customer := insertTag(t, db, "tagtest-customer")
+	insertTag(t, db, "tagtest-vip")
+	insertTag(t, db, "tagtest-supplier")
+
+	p1 := insertTaggedPerson(t, db, "Tag Test One", "tagtest-vip", "tagtest-customer", "tagtest-vip")
+	p2 := insertTaggedPerson(t, db, "Tag Test Two", "tagtest-customer")
+	p3 := insertTaggedPerson(t, db, "Tag Test Three", "tagtest-supplier", "tagtest-unknown")
+
+	p, err := db.FindPerson(p1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"tagtest-customer", "tagtest-vip"}
+	if !reflect.DeepEqual(p.Tags, want) {
+		t.Fatalf("wrong tags for person, want %v, got %v", want, p.Tags)
+	}
+
+	p, err = db.FindPerson(p3.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = []string{"tagtest-supplier"}
+	if !reflect.DeepEqual(p.Tags, want) {
+		t.Fatalf("unknown tag was not ignored, want %v, got %v", want, p.Tags)
+	}
+
+	var tests = []struct {
+		filter TagFilter
+		query  string
+		ids    []int64
+	}{
+		{TagFilter{Tags: []string{"tagtest-customer"}, MatchAll: true}, "", []int64{p1.ID, p2.ID}},
+		{TagFilter{Tags: []string{"tagtest-customer", "tagtest-vip"}, MatchAll: true}, "", []int64{p1.ID}},
+		{TagFilter{Tags: []string{"tagtest-customer", "tagtest-customer"}, MatchAll: true}, "", []int64{p1.ID, p2.ID}},
+		{TagFilter{Tags: []string{"tagtest-vip", "tagtest-supplier"}, MatchAll: false}, "", []int64{p1.ID, p3.ID}},
+		{TagFilter{Tags: []string{"tagtest-vip", "tagtest-supplier"}, MatchAll: true}, "", nil},
+		{TagFilter{Tags: []string{"tagtest-customer"}, MatchAll: true}, "two", []int64{p2.ID}},
+		{TagFilter{Tags: []string{"tagtest-supplier", "tagtest-customer"}}, "tag test", []int64{p1.ID, p2.ID, p3.ID}},
+	}
+
+	for i, test := range tests {
+		var people []*Person
+		if test.query == "" {
+			people, _, err = db.ListPeople(test.filter, ListOptions{})
+		} else {
+			people, err = db.FuzzyFindPersons(test.query, SearchFullText, test.filter)
+		}
+
+		if err != nil {
+			t.Errorf("test %d: filter %v returned error %v", i, test.filter, err)
+			continue
+		}
+
+		ids := personIDs(people)
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("test %d: filter %v returned wrong people, want %v, got %v", i, test.filter, test.ids, ids)
+		}
+	}
+
+	// renaming the tag changes it for all people
+	customer.Name = "tagtest-client"
+	if err = db.UpdateTag(customer); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = db.FindPerson(p2.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = []string{"tagtest-client"}
+	if !reflect.DeepEqual(p.Tags, want) {
+		t.Fatalf("renamed tag not found, want %v, got %v", want, p.Tags)
+	}
+
+	if p.Version <= p2.Version {
+		t.Fatalf("version of person was not increased when the tag was renamed")
+	}
+
+	p, err = db.FindPerson(p3.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Version != p3.Version {
+		t.Fatalf("version of person without the tag was changed from %v to %v", p3.Version, p.Version)
+	}
+
+	// removing the tag removes it from all people
+	if err = db.DeleteTag(customer.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err = db.FindPerson(p1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = []string{"tagtest-vip"}
+	if !reflect.DeepEqual(p.Tags, want) {
+		t.Fatalf("deleted tag still present, want %v, got %v", want, p.Tags)
+	}
+
+	if p.Version <= p1.Version+1 {
+		t.Fatalf("version of person was not increased when the tag was deleted")
+	}
+
+	// update the tags of a person
+	p.Update(PersonJSON{Name: p.Name, Tags: []string{"tagtest-supplier"}, Version: p.Version})
+	if err = db.UpdatePerson(p); err != nil {
+		t.Fatal(err)
+	}
+
+	people, _, err := db.ListPeople(TagFilter{Tags: []string{"tagtest-vip"}}, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(people) != 0 {
+		t.Fatalf("removed tag still found: %v", people)
+	}
+
+	for _, p := range []*Person{p1, p2, p3} {
+		if err = db.DeletePerson(p.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDBTagFilter(t *testing.T) {
+	testTagFilter(t, testDB)
+}
+
+func TestMockDBTagFilter(t *testing.T) {
+	testTagFilter(t, NewMockDB(20, 5))
+}
+
+func testTagDuplicateName(t *testing.T, db DB) {
+	tag := insertTag(t, db, "tagtest-duplicate")
+
+	if err := db.InsertTag(NewTag("tagtest-duplicate")); err == nil {
+		t.Fatalf("inserting a tag with a duplicate name did not fail")
+	}
+
+	tag.Version = 1000
+	if err := db.UpdateTag(tag); err == nil {
+		t.Fatalf("update did not fail despite wrong version field")
+	}
+
+	if err := db.DeleteTag(tag.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteTag(tag.ID); err == nil {
+		t.Fatalf("deleting a removed tag did not fail")
+	}
+}
+
+func TestDBTagDuplicateName(t *testing.T) {
+	testTagDuplicateName(t, testDB)
+}
+
+func TestMockDBTagDuplicateName(t *testing.T) {
+	testTagDuplicateName(t, NewMockDB(20, 5))
+}
+
+var tagFilterMatchTests = []struct {
+	filter TagFilter
+	tags   []string
+	match  bool
+}{
+	{TagFilter{}, nil, true},
+	{TagFilter{}, []string{"a"}, true},
+	{TagFilter{Tags: []string{"a"}, MatchAll: true}, nil, false},
+	{TagFilter{Tags: []string{"a", "b"}, MatchAll: true}, []string{"a"}, false},
+	{TagFilter{Tags: []string{"a", "b"}, MatchAll: true}, []string{"b", "c", "a"}, true},
+	{TagFilter{Tags: []string{"a", "b"}}, []string{"b"}, true},
+	{TagFilter{Tags: []string{"a", "b"}}, []string{"c"}, false},
+}
+
+func TestTagFilterMatch(t *testing.T) {
+	for i, test := range tagFilterMatchTests {
+		if res := test.filter.Match(test.tags); res != test.match {
+			t.Errorf("test %d: filter %v, tags %v: want %v, got %v", i, test.filter, test.tags, test.match, res)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TaskDatabase allows handling tasks.
+type TaskDatabase interface {
+	FindTask(int64) (*Task, error)
+
+	InsertTask(*Task) error
+	ListTasks() ([]*Task, error)
+	UpdateTask(*Task) error
+	DeleteTask(int64) error
+
+	ListOpenTasks(assignee string) ([]*Task, error)
+}
+
+// Status values for a task.
+const (
+	TaskOpen      = "open"
+	TaskDone      = "done"
+	TaskCancelled = "cancelled"
+)
+
+// taskTransitions lists the status values a task may be changed to, depending
+// on the current status.
+var taskTransitions = map[string][]string{
+	TaskOpen:      {TaskDone, TaskCancelled},
+	TaskDone:      {TaskOpen},
+	TaskCancelled: {TaskOpen},
+}
+
+// dateLayout is the format used for dates (without time) in the JSON
+// representation.
+const dateLayout = "2006-01-02"
+
+// Task is something a user needs to do, optionally related to a person or an
+// account.
+type Task struct {
+	ID          int64
+	Title       string
+	Description string
+	DueDate     pq.NullTime
+	Status      string
+	Assignee    string
+
+	PersonID  sql.NullInt64
+	AccountID sql.NullInt64
+
+	ChangedAt time.Time
+	CreatedAt time.Time
+	Version   int64
+}
+
+// TaskJSON is the JSON representation of a Task as returned or consumed by
+// the API.
+type TaskJSON struct {
+	ID          int64  `json:"id,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	DueDate     string `json:"due_date,omitempty"`
+	Status      string `json:"status,omitempty"`
+	Assignee    string `json:"assignee,omitempty"`
+
+	PersonID  *int64 `json:"person_id,omitempty"`
+	AccountID *int64 `json:"account_id,omitempty"`
+
+	ChangedAt string `json:"changed_at,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+
+	Version int64 `json:"version"`
+}
+
+// NewTask returns a new open task assigned to the given user.
+func NewTask(title, assignee string) *Task {
+	ts := time.Now()
+	return &Task{
+		Title:     title,
+		Assignee:  assignee,
+		Status:    TaskOpen,
+		CreatedAt: ts,
+		ChangedAt: ts,
+	}
+}
+
+// MarshalJSON returns the JSON representation of t.
+func (t Task) MarshalJSON() ([]byte, error) {
+	jt := TaskJSON{
+		ID:          t.ID,
+		Title:       t.Title,
+		Description: t.Description,
+		Status:      t.Status,
+		Assignee:    t.Assignee,
+
+		PersonID:  int64Ptr(t.PersonID),
+		AccountID: int64Ptr(t.AccountID),
+
+		ChangedAt: t.ChangedAt.Format(timeLayout),
+		CreatedAt: t.CreatedAt.Format(timeLayout),
+		Version:   t.Version,
+	}
+
+	if t.DueDate.Valid {
+		jt.DueDate = t.DueDate.Time.Format(dateLayout)
+	}
+
+	return json.Marshal(jt)
+}
+
+// UnmarshalJSON returns a task from JSON.
+func (t *Task) UnmarshalJSON(data []byte) error {
+	var jt TaskJSON
+
+	err := json.Unmarshal(data, &jt)
+	if err != nil {
+		return err
+	}
+
+	createdAt, err := time.Parse(timeLayout, jt.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	changedAt, err := time.Parse(timeLayout, jt.ChangedAt)
+	if err != nil {
+		return err
+	}
+
+	*t = Task{
+		ID:        jt.ID,
+		Status:    jt.Status,
+		CreatedAt: createdAt,
+		ChangedAt: changedAt,
+	}
+
+	return t.Update(jt)
+}
+
+// Validate checks if t is valid and returns an error if not.
+func (t *Task) Validate() error {
+	if t.Title == "" {
+		return errors.New("title is empty")
+	}
+
+	if _, ok := taskTransitions[t.Status]; !ok {
+		return fmt.Errorf("invalid status %q", t.Status)
+	}
+
+	if t.Assignee == "" {
+		return errors.New("assignee is empty")
+	}
+
+	if t.CreatedAt.IsZero() || t.ChangedAt.IsZero() {
+		return errors.New("invalid timestamps")
+	}
+
+	return nil
+}
+
+// SetStatus changes the status of t. An error is returned if t cannot be
+// changed from the current status to the new one.
+func (t *Task) SetStatus(status string) error {
+	if status == t.Status {
+		return nil
+	}
+
+	for _, s := range taskTransitions[t.Status] {
+		if s == status {
+			t.Status = status
+			return nil
+		}
+	}
+
+	return fmt.Errorf("status cannot be changed from %q to %q", t.Status, status)
+}
+
+// Update updates t with the fields from other. The status is not changed, use
+// SetStatus for that.
+func (t *Task) Update(other TaskJSON) error {
+	t.Title = other.Title
+	t.Description = other.Description
+	t.Assignee = other.Assignee
+
+	t.DueDate = pq.NullTime{}
+	if other.DueDate != "" {
+		d, err := time.Parse(dateLayout, other.DueDate)
+		if err != nil {
+			return err
+		}
+		t.DueDate = pq.NullTime{Time: d, Valid: true}
+	}
+
+	t.PersonID = nullInt64(other.PersonID)
+	t.AccountID = nullInt64(other.AccountID)
+
+	t.Version = other.Version
+
+	return nil
+}
+
+func (t Task) String() string {
+	return fmt.Sprintf("<Task[%v] %v (%v, %v)>", t.ID, t.Title, t.Status, t.Assignee)
+}
+
+// FindTask returns the task with the given id.
+func (db *Database) FindTask(id int64) (*Task, error) {
+	var t Task
+
+	err := db.dbmap.SelectOne(&t, "SELECT * FROM tasks WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// UpdateTask modifies an existing task.
+func (db *Database) UpdateTask(t *Task) error {
+	_, err := db.dbmap.Update(t)
+	return err
+}
+
+// InsertTask creates a new task.
+func (db *Database) InsertTask(t *Task) error {
+	return db.dbmap.Insert(t)
+}
+
+// ListTasks returns the list of tasks.
+func (db *Database) ListTasks() ([]*Task, error) {
+	var tasks []*Task
+	err := db.dbmap.Select(&tasks, "select * from tasks")
+	return tasks, err
+}
+
+// DeleteTask removes a task.
+func (db *Database) DeleteTask(id int64) error {
+	res := db.dbmap.Dbx.MustExec("delete from tasks where id = $1", id)
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n != 1 {
+		return errors.New("task not found")
+	}
+
+	return nil
+}
+
+// ListOpenTasks returns the list of open tasks assigned to the user, ordered
+// by due date. Tasks without a due date come last.
+func (db *Database) ListOpenTasks(assignee string) ([]*Task, error) {
+	var tasks []*Task
+	err := db.dbmap.Select(&tasks,
+		"select * from tasks where assignee = $1 and status = $2 order by due_date asc nulls last, id asc",
+		assignee, TaskOpen)
+	return tasks, err
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func insertTask(t *testing.T, db DB, title, assignee string, due time.Time) *Task {
+	task := NewTask(title, assignee)
+	if !due.IsZero() {
+		task.DueDate = pq.NullTime{Time: due, Valid: true}
+	}
+
+	if err := task.Validate(); err != nil {
+		t.Fatalf("task %v is invalid: %v", task, err)
+	}
+
+	if err := db.InsertTask(task); err != nil {
+		t.Fatalf("unable to insert task %v: %v", task, err)
+	}
+
+	return task
+}
+
+func testTaskOpenTasks(t *testing.T, db DB) {
+	due := time.Date(2016, 5, 1, 0, 0, 0, 0, time.UTC)
+	t1 := insertTask(t, db, "no due date", "user", time.Time{})
+	t2 := insertTask(t, db, "later", "user", due.AddDate(0, 0, 7))
+	t3 := insertTask(t, db, "soon", "user", due)
+	t4 := insertTask(t, db, "done", "user", due)
+	insertTask(t, db, "other user", "admin", due)
+
+	if err := t4.SetStatus(TaskDone); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.UpdateTask(t4); err != nil {
+		t.Fatalf("unable to update task: %v", err)
+	}
+
+	list, err := db.ListOpenTasks("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int64{t3.ID, t2.ID, t1.ID}
+	if len(list) != len(want) {
+		t.Fatalf("wrong number of open tasks returned, want %v, got %v", len(want), len(list))
+	}
+
+	for i, id := range want {
+		if list[i].ID != id {
+			t.Errorf("wrong task at position %d, want %v, got %v", i, id, list[i])
+		}
+	}
+
+	t4.Version = 1000
+	if err = db.UpdateTask(t4); err == nil {
+		t.Fatalf("update did not fail despite wrong version field")
+	}
+
+	for _, task := range []*Task{t1, t2, t3} {
+		if err = db.DeleteTask(task.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err = db.ListOpenTasks("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != 0 {
+		t.Fatalf("deleted tasks are still returned: %v", list)
+	}
+}
+
+func testTaskAssigneeDelete(t *testing.T, db DB) {
+	u, err := NewUser("assignee", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.InsertUser(u); err != nil {
+		t.Fatal(err)
+	}
+
+	task := insertTask(t, db, "call back", u.Login, time.Time{})
+
+	if err = db.DeleteUser(u.ID); err != ErrUserReferenced {
+		t.Fatalf("deleting the assignee of a task returned error %v, want %v", err, ErrUserReferenced)
+	}
+
+	if _, err = db.FindTask(task.ID); err != nil {
+		t.Fatalf("task has been removed: %v", err)
+	}
+
+	if err = db.DeleteTask(task.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.DeleteUser(u.ID); err != nil {
+		t.Fatalf("unable to delete user: %v", err)
+	}
+}
+
+func TestDBTaskAssigneeDelete(t *testing.T) {
+	testTaskAssigneeDelete(t, testDB)
+}
+
+func TestMockDBTaskAssigneeDelete(t *testing.T) {
+	testTaskAssigneeDelete(t, NewMockDB(20, 5))
+}
+
+func TestDBTaskOpenTasks(t *testing.T) {
+	testTaskOpenTasks(t, testDB)
+}
+
+func TestMockDBTaskOpenTasks(t *testing.T) {
+	testTaskOpenTasks(t, NewMockDB(20, 5))
+}
+
+var taskTransitionTests = []struct {
+	from, to string
+	valid    bool
+}{
+	{TaskOpen, TaskDone, true},
+	{TaskOpen, TaskCancelled, true},
+	{TaskOpen, TaskOpen, true},
+	{TaskDone, TaskOpen, true},
+	{TaskDone, TaskCancelled, false},
+	{TaskCancelled, TaskOpen, true},
+	{TaskCancelled, TaskDone, false},
+	{TaskOpen, "foo", false},
+	{TaskOpen, "", false},
+}
+
+func TestTaskSetStatus(t *testing.T) {
+	for i, test := range taskTransitionTests {
+		task := NewTask("test", "user")
+		task.Status = test.from
+
+		err := task.SetStatus(test.to)
+		if test.valid && err != nil {
+			t.Errorf("test %d: transition %q -> %q failed: %v", i, test.from, test.to, err)
+		}
+
+		if !test.valid && err == nil {
+			t.Errorf("test %d: invalid transition %q -> %q succeeded", i, test.from, test.to)
+		}
+	}
+}
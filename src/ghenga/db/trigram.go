@@ -0,0 +1,67 @@
+package db
+
+import (
+	"strings"
+	"unicode"
+)
+
+// similarityThreshold is the minimal similarity for a person to be returned
+// by a similarity search. This is the default threshold of pg_trgm.
+const similarityThreshold = 0.3
+
+// trigrams returns the set of trigrams for s, computed in the same way as
+// the PostgreSQL extension pg_trgm does: The string is folded (see fold) and
+// split into words consisting of letters and digits. Each word is prefixed
+// with two spaces and suffixed with one space, then all sequences of three
+// characters are collected.
+func trigrams(s string) map[string]struct{} {
+	set := make(map[string]struct{})
+	words := strings.FieldsFunc(fold(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+
+	return set
+}
+
+// similarity returns the similarity of a and b as a number between zero and
+// one, like the function similarity() of pg_trgm: The number of shared
+// trigrams divided by the number of trigrams in both strings.
+func similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+
+	shared := 0
+	for t := range ta {
+		if _, ok := tb[t]; ok {
+			shared++
+		}
+	}
+
+	all := len(ta) + len(tb) - shared
+	if all == 0 {
+		return 0
+	}
+
+	return float64(shared) / float64(all)
+}
+
+// nameSimilarity returns the similarity of the query to a name. This is the
+// similarity to the complete name, or to a single word of the name, whichever
+// is greater. This way a query for one name part (e.g. "Maier") also finds
+// people with a longer name (e.g. "Hans Meier").
+func nameSimilarity(name, query string) float64 {
+	best := similarity(name, query)
+	for _, word := range strings.Fields(name) {
+		if s := similarity(word, query); s > best {
+			best = s
+		}
+	}
+
+	return best
+}
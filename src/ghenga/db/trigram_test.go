@@ -0,0 +1,100 @@
+package db
+
+import (
+	"math"
+	"testing"
+)
+
+var similarityTests = []struct {
+	a, b string
+	sim  float64
+}{
+	{"word", "two words", 4.0 / 11},
+	{"Meier", "Maier", 3.0 / 9},
+	{"Müller", "mueller", 1},
+	{"Müller", "muller", 5.0 / 10},
+	{"foo", "FOO", 1},
+	{"foo", "bar", 0},
+	{"", "", 0},
+	{"Hans-Peter", "hans peter", 1},
+}
+
+func TestSimilarity(t *testing.T) {
+	for i, test := range similarityTests {
+		sim := similarity(test.a, test.b)
+		if math.Abs(sim-test.sim) > 1e-9 {
+			t.Errorf("test %d: similarity(%q, %q) returned %v, want %v", i, test.a, test.b, sim, test.sim)
+		}
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	if sim := nameSimilarity("Hans Meier", "Maier"); math.Abs(sim-3.0/9) > 1e-9 {
+		t.Errorf("wrong similarity for name part, got %v", sim)
+	}
+
+	if sim := nameSimilarity("Hans Meier", "hans meier"); sim != 1 {
+		t.Errorf("wrong similarity for complete name, got %v", sim)
+	}
+}
+
+func testSimilarFindPersons(t *testing.T, db DB) {
+	var ids []int64
+	for _, name := range []string{"Hans Meier", "Sabine Maier", "Karl Müller", "Qwv Zyx"} {
+		p := NewPerson(name)
+		if err := db.InsertPerson(p); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, p.ID)
+	}
+
+	for _, test := range []struct {
+		query string
+		want  []int64
+	}{
+		{"Maier", []int64{ids[1], ids[0]}},
+		{"Mueller", []int64{ids[2]}},
+		{"hans meier", []int64{ids[0]}},
+	} {
+		result, err := db.FuzzyFindPersons(test.query, SearchSimilar, TagFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// only consider the test persons
+		var found []int64
+		for _, p := range result {
+			for _, id := range ids {
+				if p.ID == id {
+					found = append(found, id)
+				}
+			}
+		}
+
+		if len(found) != len(test.want) {
+			t.Errorf("query %q: wrong people returned, want %v, got %v", test.query, test.want, found)
+			continue
+		}
+
+		for i := range found {
+			if found[i] != test.want[i] {
+				t.Errorf("query %q: wrong order, want %v, got %v", test.query, test.want, found)
+				break
+			}
+		}
+	}
+
+	for _, id := range ids {
+		if err := db.DeletePerson(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDBSimilarFindPersons(t *testing.T) {
+	testSimilarFindPersons(t, testDB)
+}
+
+func TestMockDBSimilarFindPersons(t *testing.T) {
+	testSimilarFindPersons(t, NewMockDB(20, 5))
+}
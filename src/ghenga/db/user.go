@@ -8,6 +8,7 @@ import (
 
 	"github.com/elithrar/simple-scrypt"
 	"github.com/jmoiron/modl"
+	"github.com/lib/pq"
 )
 
 // UserDatabase stores user records.
@@ -16,9 +17,10 @@ type UserDatabase interface {
 	FindUserName(string) (*User, error)
 
 	InsertUser(*User) error
-	ListUsers() ([]*User, error)
+	ListUsers(ListOptions) (users []*User, next string, err error)
 	UpdateUser(*User) error
 	DeleteUser(int64) error
+	DeleteUserVersion(id, version int64) error
 }
 
 // User is a user of the system in the database.
@@ -239,17 +241,39 @@ func (db *Database) FindUser(id int64) (*User, error) {
 	return &u, nil
 }
 
-// ListUsers returns the list of User.
-func (db *Database) ListUsers() ([]*User, error) {
-	var user []*User
-	err := db.dbmap.Select(&user, "select * from users")
-	return user, err
+// ListUsers returns a page of the list of users, sorted and filtered as
+// specified in opts. The cursor for the next page is returned in next, which
+// is empty for the last page. Errors for invalid options are of type
+// *ListError.
+func (db *Database) ListUsers(opts ListOptions) (users []*User, next string, err error) {
+	q, err := opts.query(userListFields)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cond, order, args := q.sql()
+	query, args, err := in("select * from users where "+cond+order, args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = db.dbmap.Select(&users, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if q.Limit > 0 && len(users) > q.Limit {
+		users = users[:q.Limit]
+		next = q.cursorAfter(users[q.Limit-1])
+	}
+
+	return users, next, nil
 }
 
-// UpdateUser modifies an existing user.
+// UpdateUser modifies an existing user. When the user has been modified since
+// u was loaded (the version differs), ErrVersionConflict is returned.
 func (db *Database) UpdateUser(u *User) error {
-	_, err := db.dbmap.Update(u)
-	return err
+	return db.updateVersioned(u, &u.Version, "user")
 }
 
 // InsertUser creates a new user.
@@ -257,9 +281,18 @@ func (db *Database) InsertUser(u *User) error {
 	return db.dbmap.Insert(u)
 }
 
-// DeleteUser removes a user.
+// ErrUserReferenced is returned by DeleteUser when the user is still
+// referenced as the author of an activity or the assignee of a task.
+var ErrUserReferenced = errors.New("user is still referenced")
+
+// DeleteUser removes a user. When the user is still referenced by other
+// entities, ErrUserReferenced is returned.
 func (db *Database) DeleteUser(id int64) error {
-	res := db.dbmap.Dbx.MustExec("delete from people where id = $1", id)
+	res, err := db.dbmap.Dbx.Exec("delete from users where id = $1", id)
+	if err != nil {
+		return userDeleteError(err)
+	}
+
 	n, err := res.RowsAffected()
 	if err != nil {
 		return err
@@ -271,3 +304,20 @@ func (db *Database) DeleteUser(id int64) error {
 
 	return nil
 }
+
+// DeleteUserVersion removes a user if it has not been modified since the
+// version was loaded, otherwise ErrVersionConflict is returned. When the user
+// is still referenced by other entities, ErrUserReferenced is returned.
+func (db *Database) DeleteUserVersion(id, version int64) error {
+	return userDeleteError(deleteVersion(db.dbmap, "users", "user", id, version))
+}
+
+// userDeleteError returns ErrUserReferenced if err is a foreign key
+// violation, otherwise err is returned.
+func userDeleteError(err error) error {
+	if e, ok := err.(*pq.Error); ok && e.Code == "23503" {
+		return ErrUserReferenced
+	}
+
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io/ioutil"
 	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -76,8 +77,8 @@ func testUserVersion(t *testing.T, db DB) {
 
 	u.Version = 25
 	err = db.UpdateUser(u)
-	if err == nil {
-		t.Fatalf("expected error due to outdated version not found")
+	if err != ErrVersionConflict {
+		t.Fatalf("expected error due to outdated version not found, got %v", err)
 	}
 }
 
@@ -89,6 +90,83 @@ func TestMockDBUserVersion(t *testing.T) {
 	testUserVersion(t, NewMockDB(20, 5))
 }
 
+func testUserConcurrentUpdate(t *testing.T, db DB) {
+	u, err := NewUser("concurrent", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.InsertUser(u); err != nil {
+		t.Fatal(err)
+	}
+
+	const writers = 8
+
+	var users []*User
+	for i := 0; i < writers; i++ {
+		user, err := db.FindUser(u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user)
+	}
+
+	version := users[0].Version
+
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for i, user := range users {
+		wg.Add(1)
+		go func(i int, user *User) {
+			defer wg.Done()
+			user.Admin = i%2 == 0
+			errs <- db.UpdateUser(user)
+		}(i, user)
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			succeeded++
+		case ErrVersionConflict:
+		default:
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+
+	if succeeded != 1 {
+		t.Fatalf("%d concurrent updates of the same version succeeded, want 1", succeeded)
+	}
+
+	u, err = db.FindUser(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.Version != version+1 {
+		t.Errorf("wrong version after update, want %v, got %v", version+1, u.Version)
+	}
+
+	if err = db.DeleteUser(u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = db.FindUser(u.ID); err == nil {
+		t.Errorf("user %v still exists after DeleteUser", u.ID)
+	}
+}
+
+func TestDBUserConcurrentUpdate(t *testing.T) {
+	testUserConcurrentUpdate(t, testDB)
+}
+
+func TestMockDBUserConcurrentUpdate(t *testing.T) {
+	testUserConcurrentUpdate(t, NewMockDB(20, 5))
+}
+
 func TestUserMarshal(t *testing.T) {
 	for i, test := range testUsers {
 		buf := marshal(t, test.u)
@@ -240,3 +318,82 @@ func TestDBUserUpdatePassword(t *testing.T) {
 func TestMockDBUserUpdatePassword(t *testing.T) {
 	testUserUpdatePassword(t, NewMockDB(20, 5))
 }
+
+func testUserDeleteVersion(t *testing.T, db DB) {
+	u, err := NewUser("deleteversion", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.InsertUser(u); err != nil {
+		t.Fatal(err)
+	}
+
+	version := u.Version
+	u.Admin = true
+	if err = db.UpdateUser(u); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.DeleteUserVersion(u.ID, version); err != ErrVersionConflict {
+		t.Fatalf("deleting an outdated version returned error %v, want %v", err, ErrVersionConflict)
+	}
+
+	if err = db.DeleteUserVersion(u.ID, u.Version); err != nil {
+		t.Fatalf("deleting the current version failed: %v", err)
+	}
+
+	if _, err = db.FindUser(u.ID); err == nil {
+		t.Fatalf("deleted user %v still found", u.ID)
+	}
+}
+
+func TestDBUserDeleteVersion(t *testing.T) {
+	testUserDeleteVersion(t, testDB)
+}
+
+func TestMockDBUserDeleteVersion(t *testing.T) {
+	testUserDeleteVersion(t, NewMockDB(20, 5))
+}
+
+func testUserDeleteReferenced(t *testing.T, db DB) {
+	u, err := NewUser("author", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.InsertUser(u); err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewActivity("call", "test", u.Login)
+	a.PersonID.Int64 = 7
+	a.PersonID.Valid = true
+	if err = db.InsertActivity(a); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.DeleteUser(u.ID); err != ErrUserReferenced {
+		t.Fatalf("deleting the author of an activity returned error %v, want %v", err, ErrUserReferenced)
+	}
+
+	if _, err = db.FindUser(u.ID); err != nil {
+		t.Fatalf("author has been deleted: %v", err)
+	}
+
+	if err = db.DeleteActivity(a.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.DeleteUser(u.ID); err != nil {
+		t.Fatalf("unable to delete user: %v", err)
+	}
+}
+
+func TestDBUserDeleteReferenced(t *testing.T) {
+	testUserDeleteReferenced(t, testDB)
+}
+
+func TestMockDBUserDeleteReferenced(t *testing.T) {
+	testUserDeleteReferenced(t, NewMockDB(20, 5))
+}
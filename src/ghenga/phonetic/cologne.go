@@ -0,0 +1,132 @@
+// Package phonetic implements phonetic algorithms which map words to codes
+// such that words which sound alike get the same code. This allows finding
+// names regardless of the spelling, e.g. "Meier" and "Mayer".
+//
+// Cologne returns the Kölner Phonetik code, which is tuned for German words.
+// DoubleMetaphone returns the codes of the Double Metaphone algorithm, which
+// handles English and a range of other languages.
+package phonetic
+
+import (
+	"strings"
+	"unicode"
+)
+
+// normalize returns the upper-case letters of s, umlauts are replaced by
+// the base vowel and ß by "SS".
+func normalize(s string) []rune {
+	var out []rune
+	for _, r := range strings.ToUpper(s) {
+		switch r {
+		case 'Ä', 'À', 'Á', 'Â':
+			out = append(out, 'A')
+		case 'Ö', 'Ò', 'Ó', 'Ô':
+			out = append(out, 'O')
+		case 'Ü', 'Ù', 'Ú', 'Û':
+			out = append(out, 'U')
+		case 'É', 'È', 'Ê':
+			out = append(out, 'E')
+		case 'ß':
+			out = append(out, 'S', 'S')
+		default:
+			if unicode.IsLetter(r) {
+				out = append(out, r)
+			}
+		}
+	}
+
+	return out
+}
+
+// in returns true iff r is one of the characters in set.
+func in(r rune, set string) bool {
+	return r != 0 && strings.ContainsRune(set, r)
+}
+
+// cologneCode returns the code for the character at position i of word, or
+// -1 for characters which are ignored.
+func cologneCode(word []rune, i int) rune {
+	var prev, next rune
+	if i > 0 {
+		prev = word[i-1]
+	}
+	if i < len(word)-1 {
+		next = word[i+1]
+	}
+
+	switch r := word[i]; r {
+	case 'A', 'E', 'I', 'J', 'O', 'U', 'Y':
+		return '0'
+	case 'B':
+		return '1'
+	case 'P':
+		if next == 'H' {
+			return '3'
+		}
+		return '1'
+	case 'D', 'T':
+		if in(next, "CSZ") {
+			return '8'
+		}
+		return '2'
+	case 'F', 'V', 'W':
+		return '3'
+	case 'G', 'K', 'Q':
+		return '4'
+	case 'C':
+		if i == 0 {
+			if in(next, "AHKLOQRUX") {
+				return '4'
+			}
+			return '8'
+		}
+
+		if in(next, "AHKOQUX") && !in(prev, "SZ") {
+			return '4'
+		}
+		return '8'
+	case 'X':
+		if in(prev, "CKQ") {
+			return '8'
+		}
+		return 'x'
+	case 'L':
+		return '5'
+	case 'M', 'N':
+		return '6'
+	case 'R':
+		return '7'
+	case 'S', 'Z', 'Ç':
+		return '8'
+	}
+
+	return -1
+}
+
+// Cologne returns the code of the word according to the Kölner Phonetik.
+// The code consists of digits, it is empty when the word does not contain
+// any letters with a code.
+func Cologne(word string) string {
+	w := normalize(word)
+
+	var code []rune
+	last := rune(-1)
+	for i := range w {
+		c := cologneCode(w, i)
+
+		// X not preceded by C, K or Q is coded as "48"
+		digits := []rune{c}
+		if c == 'x' {
+			digits = []rune{'4', '8'}
+		}
+
+		for _, d := range digits {
+			if d != -1 && d != last && (d != '0' || len(code) == 0) {
+				code = append(code, d)
+			}
+			last = d
+		}
+	}
+
+	return string(code)
+}
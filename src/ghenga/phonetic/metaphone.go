@@ -0,0 +1,563 @@
+package phonetic
+
+// metaphoneLength is the maximal length of a Double Metaphone code.
+const metaphoneLength = 4
+
+// metaphone holds the state while computing the Double Metaphone codes for a
+// word.
+type metaphone struct {
+	word    []rune
+	last    int
+	slavo   bool
+	primary []rune
+	second  []rune
+}
+
+// at returns the character at position i, or 0 if i is out of range.
+func (m *metaphone) at(i int) rune {
+	if i < 0 || i >= len(m.word) {
+		return 0
+	}
+	return m.word[i]
+}
+
+// is returns true iff the substring of length n starting at position i
+// equals one of the strings.
+func (m *metaphone) is(i, n int, list ...string) bool {
+	if i < 0 || i+n > len(m.word) {
+		return false
+	}
+
+	s := string(m.word[i : i+n])
+	for _, item := range list {
+		if s == item {
+			return true
+		}
+	}
+
+	return false
+}
+
+// vowel returns true iff the character at position i is a vowel.
+func (m *metaphone) vowel(i int) bool {
+	return in(m.at(i), "AEIOUY")
+}
+
+// add appends the strings to the primary and secondary code. When only one
+// string is passed, it is used for both codes.
+func (m *metaphone) add(codes ...string) {
+	primary, second := codes[0], codes[0]
+	if len(codes) > 1 {
+		second = codes[1]
+	}
+
+	m.addPrimary(primary)
+	m.addSecond(second)
+}
+
+func (m *metaphone) addPrimary(s string) {
+	for _, r := range s {
+		if len(m.primary) < metaphoneLength {
+			m.primary = append(m.primary, r)
+		}
+	}
+}
+
+func (m *metaphone) addSecond(s string) {
+	for _, r := range s {
+		if len(m.second) < metaphoneLength {
+			m.second = append(m.second, r)
+		}
+	}
+}
+
+// done returns true iff both codes are complete.
+func (m *metaphone) done() bool {
+	return len(m.primary) >= metaphoneLength && len(m.second) >= metaphoneLength
+}
+
+// germanic returns true iff the word starts with "VAN ", "VON " or "SCH".
+func (m *metaphone) germanic() bool {
+	return m.is(0, 4, "VAN ", "VON ") || m.is(0, 3, "SCH")
+}
+
+// DoubleMetaphone returns the primary and the alternate code of the word
+// according to the Double Metaphone algorithm by Lawrence Philips. Both codes
+// are at most four characters long and empty when the word does not contain
+// any letters.
+func DoubleMetaphone(word string) (primary, alternate string) {
+	m := &metaphone{word: normalize(word)}
+	if len(m.word) == 0 {
+		return "", ""
+	}
+
+	m.last = len(m.word) - 1
+	for i := range m.word {
+		if m.is(i, 1, "W", "K") || m.is(i, 2, "CZ") {
+			m.slavo = true
+		}
+	}
+
+	i := 0
+	if m.is(0, 2, "GN", "KN", "PN", "WR", "PS") {
+		i = 1
+	}
+
+	for i <= m.last && !m.done() {
+		i = m.step(i)
+	}
+
+	return string(m.primary), string(m.second)
+}
+
+// step adds the code for the character at position i and returns the
+// position of the next character to look at.
+func (m *metaphone) step(i int) int {
+	switch m.at(i) {
+	case 'A', 'E', 'I', 'O', 'U', 'Y':
+		// only initial vowels are coded
+		if i == 0 {
+			m.add("A")
+		}
+		return i + 1
+	case 'B':
+		m.add("P")
+		return m.skip(i, "B")
+	case 'Ç':
+		m.add("S")
+		return i + 1
+	case 'C':
+		return m.c(i)
+	case 'D':
+		return m.d(i)
+	case 'F':
+		m.add("F")
+		return m.skip(i, "F")
+	case 'G':
+		return m.g(i)
+	case 'H':
+		// only keep H between vowels or at the start before a vowel
+		if (i == 0 || m.vowel(i-1)) && m.vowel(i+1) {
+			m.add("H")
+			return i + 2
+		}
+		return i + 1
+	case 'J':
+		return m.j(i)
+	case 'K':
+		m.add("K")
+		return m.skip(i, "K")
+	case 'L':
+		return m.l(i)
+	case 'M':
+		m.add("M")
+		if m.at(i+1) == 'M' || (m.is(i-1, 3, "UMB") && (i+1 == m.last || m.is(i+2, 2, "ER"))) {
+			return i + 2
+		}
+		return i + 1
+	case 'N':
+		m.add("N")
+		return m.skip(i, "N")
+	case 'Ñ':
+		m.add("N")
+		return i + 1
+	case 'P':
+		if m.at(i+1) == 'H' {
+			m.add("F")
+			return i + 2
+		}
+		m.add("P")
+		return m.skip(i, "PB")
+	case 'Q':
+		m.add("K")
+		return m.skip(i, "Q")
+	case 'R':
+		// French words like "Rogier"
+		if i == m.last && !m.slavo && m.is(i-2, 2, "IE") && !m.is(i-4, 2, "ME", "MA") {
+			m.addSecond("R")
+		} else {
+			m.add("R")
+		}
+		return m.skip(i, "R")
+	case 'S':
+		return m.s(i)
+	case 'T':
+		return m.t(i)
+	case 'V':
+		m.add("F")
+		return m.skip(i, "V")
+	case 'W':
+		return m.w(i)
+	case 'X':
+		// initial "X" is pronounced "Z", like in "Xavier"
+		if i == 0 {
+			m.add("S")
+			return i + 1
+		}
+
+		// French words like "Breaux"
+		if !(i == m.last && (m.is(i-3, 3, "IAU", "EAU") || m.is(i-2, 2, "AU", "OU"))) {
+			m.add("KS")
+		}
+		return m.skip(i, "CX")
+	case 'Z':
+		return m.z(i)
+	}
+
+	return i + 1
+}
+
+// skip returns the position after the character at i, the next character is
+// skipped as well if it is contained in set.
+func (m *metaphone) skip(i int, set string) int {
+	if in(m.at(i+1), set) {
+		return i + 2
+	}
+	return i + 1
+}
+
+func (m *metaphone) c(i int) int {
+	switch {
+	case m.is(i, 4, "CHIA") ||
+		(i > 1 && !m.vowel(i-2) && m.is(i-1, 3, "ACH") &&
+			((m.at(i+2) != 'I' && m.at(i+2) != 'E') || m.is(i-2, 6, "BACHER", "MACHER"))):
+		// various Germanic words like "Bacher"
+		m.add("K")
+		return i + 2
+	case i == 0 && m.is(i, 6, "CAESAR"):
+		m.add("S")
+		return i + 2
+	case m.is(i, 2, "CH"):
+		return m.ch(i)
+	case m.is(i, 2, "CZ") && !m.is(i-2, 4, "WICZ"):
+		// "Czerny"
+		m.add("S", "X")
+		return i + 2
+	case m.is(i+1, 3, "CIA"):
+		// "Focaccia"
+		m.add("X")
+		return i + 3
+	case m.is(i, 2, "CC") && !(i == 1 && m.at(0) == 'M'):
+		// "Accident", "Bellocchio", but not "McClellan"
+		if in(m.at(i+2), "IEH") && !m.is(i+2, 2, "HU") {
+			if (i == 1 && m.at(0) == 'A') || m.is(i-1, 5, "UCCEE", "UCCES") {
+				m.add("KS")
+			} else {
+				m.add("X")
+			}
+			return i + 3
+		}
+
+		m.add("K")
+		return i + 2
+	case m.is(i, 2, "CK", "CG", "CQ"):
+		m.add("K")
+		return i + 2
+	case m.is(i, 2, "CI", "CE", "CY"):
+		// Italian and English words
+		if m.is(i, 3, "CIO", "CIE", "CIA") {
+			m.add("S", "X")
+		} else {
+			m.add("S")
+		}
+		return i + 2
+	}
+
+	m.add("K")
+	switch {
+	case m.is(i+1, 2, " C", " Q", " G"):
+		// "Mac Caffrey", "Mac Gregor"
+		return i + 3
+	case in(m.at(i+1), "CKQ") && !m.is(i+1, 2, "CE", "CI"):
+		return i + 2
+	}
+
+	return i + 1
+}
+
+func (m *metaphone) ch(i int) int {
+	switch {
+	case i > 0 && m.is(i, 4, "CHAE"):
+		// "Michael"
+		m.add("K", "X")
+	case i == 0 && (m.is(i+1, 5, "HARAC", "HARIS") || m.is(i+1, 3, "HOR", "HYM", "HIA", "HEM")) &&
+		!m.is(0, 5, "CHORE"):
+		// Greek roots like "Chemistry", "Chorus"
+		m.add("K")
+	case m.germanic() || m.is(i-2, 6, "ORCHES", "ARCHIT", "ORCHID") || in(m.at(i+2), "TS") ||
+		((i == 0 || in(m.at(i-1), "AOUE")) && (in(m.at(i+2), "LRNMBHFVW ") || i+1 == m.last)):
+		// Germanic, Greek or otherwise "CH" for "KH" sound
+		m.add("K")
+	case i > 0:
+		if m.is(0, 2, "MC") {
+			m.add("K")
+		} else {
+			m.add("X", "K")
+		}
+	default:
+		m.add("X")
+	}
+
+	return i + 2
+}
+
+func (m *metaphone) d(i int) int {
+	switch {
+	case m.is(i, 2, "DG"):
+		if in(m.at(i+2), "IEY") {
+			// "Edge"
+			m.add("J")
+			return i + 3
+		}
+
+		// "Edgar"
+		m.add("TK")
+		return i + 2
+	case m.is(i, 2, "DT", "DD"):
+		m.add("T")
+		return i + 2
+	}
+
+	m.add("T")
+	return i + 1
+}
+
+func (m *metaphone) g(i int) int {
+	next := m.at(i + 1)
+
+	switch {
+	case next == 'H':
+		return m.gh(i)
+	case next == 'N':
+		switch {
+		case i == 1 && m.vowel(0) && !m.slavo:
+			m.add("KN", "N")
+		case !m.is(i+2, 2, "EY") && !m.slavo:
+			// not "Cagney"
+			m.add("N", "KN")
+		default:
+			m.add("KN")
+		}
+		return i + 2
+	case m.is(i+1, 2, "LI") && !m.slavo:
+		// "Tagliaro"
+		m.add("KL", "L")
+		return i + 2
+	case i == 0 && (next == 'Y' || m.is(i+1, 2, "ES", "EP", "EB", "EL", "EY", "IB", "IL", "IN", "IE", "EI", "ER")):
+		m.add("K", "J")
+		return i + 2
+	case (m.is(i+1, 2, "ER") || next == 'Y') && !m.is(0, 6, "DANGER", "RANGER", "MANGER") &&
+		!in(m.at(i-1), "EI") && !m.is(i-1, 3, "RGY", "OGY"):
+		// "-ger-", "-gy-"
+		m.add("K", "J")
+		return i + 2
+	case in(next, "EIY") || m.is(i-1, 4, "AGGI", "OGGI"):
+		// Italian words like "Biaggi"
+		switch {
+		case m.germanic() || m.is(i+1, 2, "ET"):
+			m.add("K")
+		case m.is(i+1, 3, "IER"):
+			m.add("J")
+		default:
+			m.add("J", "K")
+		}
+		return i + 2
+	}
+
+	m.add("K")
+	return m.skip(i, "G")
+}
+
+func (m *metaphone) gh(i int) int {
+	switch {
+	case i > 0 && !m.vowel(i-1):
+		m.add("K")
+	case i == 0:
+		// "Ghislane", "Ghiradelli"
+		if m.at(i+2) == 'I' {
+			m.add("J")
+		} else {
+			m.add("K")
+		}
+	case (i > 1 && in(m.at(i-2), "BHD")) || (i > 2 && in(m.at(i-3), "BHD")) || (i > 3 && in(m.at(i-4), "BH")):
+		// silent, like in "Hugh", "Bough", "Broughton"
+	case i > 2 && m.at(i-1) == 'U' && in(m.at(i-3), "CGLRT"):
+		// "Laugh", "McLaughlin", "Cough", "Tough"
+		m.add("F")
+	case m.at(i-1) != 'I':
+		m.add("K")
+	}
+
+	return i + 2
+}
+
+func (m *metaphone) j(i int) int {
+	if m.is(i, 4, "JOSE") || m.is(0, 4, "SAN ") {
+		// Spanish pronunciation of "Jose"
+		if (i == 0 && m.at(i+4) == ' ') || len(m.word) == 4 || m.is(0, 4, "SAN ") {
+			m.add("H")
+		} else {
+			m.add("J", "H")
+		}
+		return i + 1
+	}
+
+	switch {
+	case i == 0:
+		// "Jankelowicz"
+		m.add("J", "A")
+	case m.vowel(i-1) && !m.slavo && (m.at(i+1) == 'A' || m.at(i+1) == 'O'):
+		// Spanish pronunciation like in "Bajador"
+		m.add("J", "H")
+	case i == m.last:
+		m.add("J", "")
+	case !in(m.at(i+1), "LTKSNMBZ") && !in(m.at(i-1), "SKL"):
+		m.add("J")
+	}
+
+	return m.skip(i, "J")
+}
+
+func (m *metaphone) l(i int) int {
+	if m.at(i+1) != 'L' {
+		m.add("L")
+		return i + 1
+	}
+
+	// Spanish words like "Cabrillo", "Gallegos"
+	if (i == len(m.word)-3 && m.is(i-1, 4, "ILLO", "ILLA", "ALLE")) ||
+		((m.is(len(m.word)-2, 2, "AS", "OS") || in(m.at(m.last), "AO")) && m.is(i-1, 4, "ALLE")) {
+		m.addPrimary("L")
+	} else {
+		m.add("L")
+	}
+
+	return i + 2
+}
+
+func (m *metaphone) s(i int) int {
+	switch {
+	case m.is(i-1, 3, "ISL", "YSL"):
+		// silent, like in "Island", "Carlisle"
+		return i + 1
+	case i == 0 && m.is(i, 5, "SUGAR"):
+		m.add("X", "S")
+		return i + 1
+	case m.is(i, 2, "SH"):
+		if m.is(i+1, 4, "HEIM", "HOEK", "HOLM", "HOLZ") {
+			// Germanic words like "Rheinsheim"
+			m.add("S")
+		} else {
+			m.add("X")
+		}
+		return i + 2
+	case m.is(i, 3, "SIO", "SIA") || m.is(i, 4, "SIAN"):
+		// Italian and Armenian words
+		if m.slavo {
+			m.add("S")
+		} else {
+			m.add("S", "X")
+		}
+		return i + 3
+	case (i == 0 && in(m.at(i+1), "MNLW")) || m.at(i+1) == 'Z':
+		// German and anglicisations like "Smith" and "Schmidt", "Snider"
+		// and "Schneider"
+		m.add("S", "X")
+		return m.skip(i, "Z")
+	case m.is(i, 2, "SC"):
+		return m.sc(i)
+	}
+
+	if i == m.last && m.is(i-2, 2, "AI", "OI") {
+		// French words like "Resnais", "Artois"
+		m.addSecond("S")
+	} else {
+		m.add("S")
+	}
+
+	return m.skip(i, "SZ")
+}
+
+func (m *metaphone) sc(i int) int {
+	switch {
+	case m.at(i+2) == 'H':
+		switch {
+		case m.is(i+3, 2, "ER", "EN"):
+			// "Schenker"
+			m.add("X", "SK")
+		case m.is(i+3, 2, "OO", "UY", "ED", "EM"):
+			// Dutch origin like "School", "Schooner"
+			m.add("SK")
+		case i == 0 && !m.vowel(3) && m.at(3) != 'W':
+			m.add("X", "S")
+		default:
+			m.add("X")
+		}
+	case in(m.at(i+2), "IEY"):
+		m.add("S")
+	default:
+		m.add("SK")
+	}
+
+	return i + 3
+}
+
+func (m *metaphone) t(i int) int {
+	switch {
+	case m.is(i, 4, "TION"), m.is(i, 3, "TIA", "TCH"):
+		m.add("X")
+		return i + 3
+	case m.is(i, 2, "TH"), m.is(i, 3, "TTH"):
+		// "Thomas", "Thames" or Germanic
+		if m.is(i+2, 2, "OM", "AM") || m.germanic() {
+			m.add("T")
+		} else {
+			m.add("0", "T")
+		}
+		return i + 2
+	}
+
+	m.add("T")
+	return m.skip(i, "TD")
+}
+
+func (m *metaphone) w(i int) int {
+	if m.is(i, 2, "WR") {
+		m.add("R")
+		return i + 2
+	}
+
+	switch {
+	case i == 0 && (m.vowel(i+1) || m.is(i, 2, "WH")):
+		// "Wasserman" should match "Vasserman"
+		if m.vowel(i + 1) {
+			m.add("A", "F")
+		} else {
+			m.add("A")
+		}
+	case (i == m.last && m.vowel(i-1)) || m.is(i-1, 5, "EWSKI", "EWSKY", "OWSKI", "OWSKY") || m.is(0, 3, "SCH"):
+		// Polish words like "Filipowicz"
+		m.addSecond("F")
+	case m.is(i, 4, "WICZ", "WITZ"):
+		m.add("TS", "FX")
+		return i + 4
+	}
+
+	return i + 1
+}
+
+func (m *metaphone) z(i int) int {
+	if m.at(i+1) == 'H' {
+		// Chinese names like "Zhao"
+		m.add("J")
+		return i + 2
+	}
+
+	if m.is(i+1, 2, "ZO", "ZI", "ZA") || (m.slavo && i > 0 && m.at(i-1) != 'T') {
+		m.add("S", "TS")
+	} else {
+		m.add("S")
+	}
+
+	return m.skip(i, "Z")
+}
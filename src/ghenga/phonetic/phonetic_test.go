@@ -0,0 +1,65 @@
+package phonetic
+
+import "testing"
+
+var cologneTests = []struct {
+	word, code string
+}{
+	{"Wikipedia", "3412"},
+	{"Müller-Lüdenscheidt", "65752682"},
+	{"Breschnew", "17863"},
+	{"Meier", "67"},
+	{"Mayer", "67"},
+	{"Müller", "657"},
+	{"Mueller", "657"},
+	{"Schmidt", "862"},
+	{"Schmitt", "862"},
+	{"Anna", "06"},
+	{"Xaver", "4837"},
+	{"Axel", "0485"},
+	{"Christoph", "47823"},
+	{"Philipp", "351"},
+	{"Weiß", "38"},
+	{"", ""},
+	{"123", ""},
+}
+
+func TestCologne(t *testing.T) {
+	for i, test := range cologneTests {
+		code := Cologne(test.word)
+		if code != test.code {
+			t.Errorf("test %d: Cologne(%q) returned %q, want %q", i, test.word, code, test.code)
+		}
+	}
+}
+
+var metaphoneTests = []struct {
+	word               string
+	primary, alternate string
+}{
+	{"Smith", "SM0", "XMT"},
+	{"Schmidt", "XMT", "SMT"},
+	{"Schneider", "XNTR", "SNTR"},
+	{"Thomas", "TMS", "TMS"},
+	{"Meier", "MR", "MR"},
+	{"Maier", "MR", "MR"},
+	{"Müller", "MLR", "MLR"},
+	{"Michael", "MKL", "MXL"},
+	{"Jose", "HS", "HS"},
+	{"Wasserman", "ASRM", "FSRM"},
+	{"Xavier", "SF", "SFR"},
+	{"Knight", "NT", "NT"},
+	{"Edge", "AJ", "AJ"},
+	{"Caesar", "SSR", "SSR"},
+	{"", "", ""},
+}
+
+func TestDoubleMetaphone(t *testing.T) {
+	for i, test := range metaphoneTests {
+		primary, alternate := DoubleMetaphone(test.word)
+		if primary != test.primary || alternate != test.alternate {
+			t.Errorf("test %d: DoubleMetaphone(%q) returned (%q, %q), want (%q, %q)",
+				i, test.word, primary, alternate, test.primary, test.alternate)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// Package query implements the search query language for ghenga.
+//
+// A query consists of terms separated by white space, all terms must match.
+// A term is either a word, a phrase in double quotes, or a filter for a field
+// in the form `field:value`. The value may also be quoted. Filters support
+// comparisons with the operators `<`, `<=`, `>` and `>=` directly after the
+// colon, e.g. `created:>2016-01-01`. Prefixing a term with `-` negates it.
+//
+// Example:
+//
+//	city:Köln title:CEO -department:Testers "exact phrase" created:>2016-01-01
+//
+// This package only parses queries, interpreting the field names and values
+// is up to the caller.
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Operator describes how the value of a term is compared.
+type Operator int
+
+// Operators for terms.
+const (
+	Match Operator = iota
+	Less
+	LessEqual
+	Greater
+	GreaterEqual
+)
+
+var operators = []struct {
+	s  string
+	op Operator
+}{
+	// longer operators must be listed first
+	{"<=", LessEqual},
+	{">=", GreaterEqual},
+	{"<", Less},
+	{">", Greater},
+}
+
+func (op Operator) String() string {
+	for _, o := range operators {
+		if o.op == op {
+			return o.s
+		}
+	}
+
+	return ":"
+}
+
+// Term is a single condition within a query.
+type Term struct {
+	// Pos is the position of the term in the query, in characters starting at
+	// zero.
+	Pos int
+
+	// Negate is true for terms prefixed with `-`.
+	Negate bool
+
+	// Field is the name of the field in lower case, it is empty for words and
+	// phrases without a field.
+	Field string
+
+	Op    Operator
+	Value string
+
+	// Phrase is true if the value was quoted.
+	Phrase bool
+}
+
+func (t Term) String() string {
+	s := ""
+	if t.Negate {
+		s = "-"
+	}
+
+	if t.Field != "" {
+		s += t.Field + ":"
+		if t.Op != Match {
+			s += t.Op.String()
+		}
+	}
+
+	if t.Phrase {
+		return s + fmt.Sprintf("%q", t.Value)
+	}
+
+	return s + t.Value
+}
+
+// Query is a parsed search query. All terms must match.
+type Query struct {
+	Terms []Term
+}
+
+func (q Query) String() string {
+	var terms []string
+	for _, t := range q.Terms {
+		terms = append(terms, t.String())
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// Simple returns true iff the query consists only of plain words, without
+// fields, phrases or negations.
+func (q Query) Simple() bool {
+	for _, t := range q.Terms {
+		if t.Negate || t.Field != "" || t.Phrase {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Error is returned for invalid queries.
+type Error struct {
+	// Pos is the position of the error in the query, in characters starting
+	// at zero.
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("query: %s at position %d", e.Msg, e.Pos)
+}
+
+// Errorf returns a new error for the term.
+func (t Term) Errorf(format string, args ...interface{}) error {
+	return &Error{Pos: t.Pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parser holds the state while parsing a query.
+type parser struct {
+	s   []rune
+	pos int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *parser) peek() rune {
+	return p.s[p.pos]
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// quoted reads a string in double quotes, the current character must be the
+// opening quote.
+func (p *parser) quoted() (string, error) {
+	start := p.pos
+	p.pos++
+	for !p.eof() {
+		if p.peek() == '"' {
+			s := string(p.s[start+1 : p.pos])
+			p.pos++
+			return s, nil
+		}
+		p.pos++
+	}
+
+	return "", p.errorf(start, "unterminated quote")
+}
+
+// word reads characters until white space is found.
+func (p *parser) word() string {
+	start := p.pos
+	for !p.eof() && !unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+
+	return string(p.s[start:p.pos])
+}
+
+// isFieldName returns true if s is a valid name for a field.
+func isFieldName(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		if !unicode.IsLetter(r) && r != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// term parses the next term.
+func (p *parser) term() (Term, error) {
+	t := Term{Pos: p.pos}
+
+	if p.peek() == '-' {
+		t.Negate = true
+		p.pos++
+		if p.eof() || unicode.IsSpace(p.peek()) {
+			return t, p.errorf(t.Pos, "missing term after '-'")
+		}
+	}
+
+	if p.peek() == '"' {
+		s, err := p.quoted()
+		if err != nil {
+			return t, err
+		}
+
+		if s == "" {
+			return t, p.errorf(t.Pos, "empty phrase")
+		}
+
+		t.Value = s
+		t.Phrase = true
+		return t, nil
+	}
+
+	start := p.pos
+	for !p.eof() && !unicode.IsSpace(p.peek()) && p.peek() != ':' && p.peek() != '"' {
+		p.pos++
+	}
+
+	name := string(p.s[start:p.pos])
+	if p.eof() || p.peek() != ':' || !isFieldName(name) {
+		// plain word
+		p.pos = start
+		t.Value = p.word()
+		return t, nil
+	}
+
+	t.Field = strings.ToLower(name)
+	p.pos++
+
+	rest := string(p.s[p.pos:])
+	for _, o := range operators {
+		if strings.HasPrefix(rest, o.s) {
+			t.Op = o.op
+			p.pos += len([]rune(o.s))
+			break
+		}
+	}
+
+	if !p.eof() && p.peek() == '"' {
+		s, err := p.quoted()
+		if err != nil {
+			return t, err
+		}
+
+		t.Value = s
+		t.Phrase = true
+	} else {
+		t.Value = p.word()
+	}
+
+	if t.Value == "" {
+		return t, p.errorf(p.pos, "missing value for field %q", t.Field)
+	}
+
+	return t, nil
+}
+
+// Parse parses the string into a query. The returned error is of type *Error.
+func Parse(s string) (Query, error) {
+	p := &parser{s: []rune(s)}
+
+	var q Query
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return q, nil
+		}
+
+		t, err := p.term()
+		if err != nil {
+			return Query{}, err
+		}
+
+		q.Terms = append(q.Terms, t)
+	}
+}
@@ -0,0 +1,117 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+var parseTests = []struct {
+	s     string
+	terms []Term
+}{
+	{"", nil},
+	{"  ", nil},
+	{"foo", []Term{{Pos: 0, Value: "foo"}}},
+	{"foo  bar", []Term{{Pos: 0, Value: "foo"}, {Pos: 5, Value: "bar"}}},
+	{`"exact phrase"`, []Term{{Pos: 0, Value: "exact phrase", Phrase: true}}},
+	{"city:Köln title:CEO", []Term{
+		{Pos: 0, Field: "city", Value: "Köln"},
+		{Pos: 10, Field: "title", Value: "CEO"},
+	}},
+	{"-department:Testers", []Term{{Pos: 0, Negate: true, Field: "department", Value: "Testers"}}},
+	{`City:"Bad Honnef"`, []Term{{Pos: 0, Field: "city", Value: "Bad Honnef", Phrase: true}}},
+	{"created:>2016-01-01 changed:<=2016-02-01", []Term{
+		{Pos: 0, Field: "created", Op: Greater, Value: "2016-01-01"},
+		{Pos: 20, Field: "changed", Op: LessEqual, Value: "2016-02-01"},
+	}},
+	{`-"foo bar" x`, []Term{
+		{Pos: 0, Negate: true, Value: "foo bar", Phrase: true},
+		{Pos: 11, Value: "x"},
+	}},
+	{"12:30 foo@example.com", []Term{
+		{Pos: 0, Value: "12:30"},
+		{Pos: 6, Value: "foo@example.com"},
+	}},
+}
+
+func TestParse(t *testing.T) {
+	for i, test := range parseTests {
+		q, err := Parse(test.s)
+		if err != nil {
+			t.Errorf("test %d: Parse(%q) returned error: %v", i, test.s, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(q.Terms, test.terms) {
+			t.Errorf("test %d: Parse(%q) returned wrong terms:\n  want: %#v\n   got: %#v", i, test.s, test.terms, q.Terms)
+		}
+	}
+}
+
+var parseErrorTests = []struct {
+	s   string
+	pos int
+}{
+	{`"foo`, 0},
+	{`city:Köln "bar baz`, 10},
+	{`title:"CEO`, 6},
+	{"foo - bar", 4},
+	{"foo -", 4},
+	{"city:", 5},
+	{"created:>", 9},
+	{`foo ""`, 4},
+}
+
+func TestParseError(t *testing.T) {
+	for i, test := range parseErrorTests {
+		_, err := Parse(test.s)
+		if err == nil {
+			t.Errorf("test %d: Parse(%q) did not return an error", i, test.s)
+			continue
+		}
+
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("test %d: Parse(%q) returned error of wrong type %T", i, test.s, err)
+			continue
+		}
+
+		if e.Pos != test.pos {
+			t.Errorf("test %d: Parse(%q) returned wrong position, want %d, got %d (%v)", i, test.s, test.pos, e.Pos, e)
+		}
+	}
+}
+
+func TestQuerySimple(t *testing.T) {
+	for _, test := range []struct {
+		s      string
+		simple bool
+	}{
+		{"", true},
+		{"foo bar", true},
+		{"foo -bar", false},
+		{`"foo bar"`, false},
+		{"city:Köln", false},
+	} {
+		q, err := Parse(test.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if q.Simple() != test.simple {
+			t.Errorf("Parse(%q).Simple() returned %v", test.s, q.Simple())
+		}
+	}
+}
+
+func TestQueryString(t *testing.T) {
+	s := `-city:"Bad Honnef" created:>=2016-01-01 foo`
+	q, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.String() != s {
+		t.Errorf("wrong string returned, want %q, got %q", s, q.String())
+	}
+}
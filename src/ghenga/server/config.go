@@ -6,4 +6,14 @@ import "time"
 type Config struct {
 	SessionDuration time.Duration
 	Debug           bool
+
+	// MaxSuggestions is the maximal number of suggestions returned for a
+	// prefix, zero means no limit. SuggestTimeout is the time a query for
+	// suggestions may take at most, zero means no timeout.
+	MaxSuggestions int
+	SuggestTimeout time.Duration
+
+	// MaxSearchHits is the maximal number of hits returned by the global
+	// search, zero means no limit.
+	MaxSearchHits int
 }
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// entityTag returns the entity tag for the version of the entity with the ID,
+// which is sent to the client in the header `ETag`.
+func entityTag(id, version int64) string {
+	return fmt.Sprintf(`"%d-%d"`, id, version)
+}
+
+// listTag returns a weak entity tag for a list of entities, derived from the
+// tags of the entities and the cursor for the next page.
+func listTag(tags []string, next string) string {
+	h := sha256.New()
+	for _, tag := range tags {
+		io.WriteString(h, tag+"\n")
+	}
+	io.WriteString(h, next)
+
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// matchTags returns true if etag is contained in the list of entity tags in
+// header, as sent by the client in the headers `If-Match` and
+// `If-None-Match`. The list `*` matches all tags. With weak comparison, weak
+// tags also match their strong counterpart, otherwise weak tags never match.
+func matchTags(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+
+		if tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModified sets the header `ETag` of the response. If the client already
+// has this version (the header `If-None-Match` of the request matches), the
+// status code 304 (Not Modified) is written and true is returned, the caller
+// must not write a body then.
+func notModified(res http.ResponseWriter, req *http.Request, etag string) bool {
+	res.Header().Set("ETag", etag)
+
+	h := req.Header.Get("If-None-Match")
+	if h == "" || !matchTags(h, etag, true) {
+		return false
+	}
+
+	res.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// checkIfMatch checks the header `If-Match` of the request against the
+// current entity tag of the entity the request modifies. An error with the
+// status code 412 (Precondition Failed) is returned if it does not match.
+// Otherwise, matched reports whether the header was present.
+func checkIfMatch(req *http.Request, etag string) (matched bool, err error) {
+	h := req.Header.Get("If-Match")
+	if h == "" {
+		return false, nil
+	}
+
+	if !matchTags(h, etag, false) {
+		return false, StatusError{
+			Code: http.StatusPreconditionFailed,
+			Err:  errors.New("entity has been modified"),
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,26 @@
+package server
+
+import "testing"
+
+var matchTagsTests = []struct {
+	header, etag string
+	weak, match  bool
+}{
+	{`"1-2"`, `"1-2"`, false, true},
+	{`"1-2"`, `"1-3"`, false, false},
+	{`"1-3", "1-2"`, `"1-2"`, false, true},
+	{`*`, `"1-2"`, false, true},
+	{`W/"1-2"`, `"1-2"`, false, false},
+	{`W/"1-2"`, `"1-2"`, true, true},
+	{`"abc"`, `W/"abc"`, false, false},
+	{`"abc"`, `W/"abc"`, true, true},
+	{`W/"abc"`, `W/"abc"`, true, true},
+}
+
+func TestMatchTags(t *testing.T) {
+	for i, test := range matchTagsTests {
+		if matchTags(test.header, test.etag, test.weak) != test.match {
+			t.Errorf("test %d: matchTags(%q, %q, %v) != %v", i, test.header, test.etag, test.weak, test.match)
+		}
+	}
+}
@@ -33,6 +33,9 @@ func TestEnv(t testing.TB) (env *Env, cleanup func()) {
 		DB: db,
 		Cfg: Config{
 			SessionDuration: 600 * time.Second,
+			MaxSuggestions:  50,
+			SuggestTimeout:  200 * time.Millisecond,
+			MaxSearchHits:   100,
 		},
 	}
 
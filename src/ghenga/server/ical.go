@@ -0,0 +1,110 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"ghenga/db"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// icalTimeLayout is the format for UTC timestamps in iCalendar data (RFC 5545,
+// section 3.3.5).
+const icalTimeLayout = "20060102T150405Z"
+
+// icalMaxLineLength is the maximum number of octets in a line of iCalendar
+// data, excluding the line break (RFC 5545, section 3.1).
+const icalMaxLineLength = 75
+
+// icalEscaper escapes special characters in TEXT values (RFC 5545, section
+// 3.3.11).
+var icalEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+// icalWriter writes content lines in the iCalendar format.
+type icalWriter struct {
+	wr  *bufio.Writer
+	err error
+}
+
+// line writes a content line, folded at the maximum line length.
+func (w *icalWriter) line(name, value string) {
+	if w.err != nil {
+		return
+	}
+
+	s := name + ":" + value
+	for len(s) > icalMaxLineLength {
+		n := icalMaxLineLength
+		// don't split multi-byte UTF-8 sequences
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+
+		if _, w.err = w.wr.WriteString(s[:n] + "\r\n"); w.err != nil {
+			return
+		}
+
+		// continuation lines start with a single space
+		s = " " + s[n:]
+	}
+
+	_, w.err = w.wr.WriteString(s + "\r\n")
+}
+
+// text writes a content line with an escaped text value. Empty values are
+// omitted.
+func (w *icalWriter) text(name, value string) {
+	if value == "" {
+		return
+	}
+
+	w.line(name, icalEscaper.Replace(value))
+}
+
+// time writes a content line with a timestamp in UTC.
+func (w *icalWriter) time(name string, t time.Time) {
+	w.line(name, t.UTC().Format(icalTimeLayout))
+}
+
+// writeICalendar writes the events as an iCalendar object (RFC 5545) to wr.
+func writeICalendar(wr io.Writer, name string, events []*db.Event) error {
+	w := &icalWriter{wr: bufio.NewWriter(wr)}
+
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//ghenga//ghenga//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	w.text("X-WR-CALNAME", name)
+
+	for _, e := range events {
+		w.line("BEGIN", "VEVENT")
+		w.line("UID", fmt.Sprintf("event-%d@ghenga", e.ID))
+		w.time("DTSTAMP", e.ChangedAt)
+		w.time("CREATED", e.CreatedAt)
+		w.time("LAST-MODIFIED", e.ChangedAt)
+		w.line("SEQUENCE", fmt.Sprintf("%d", e.Version))
+		w.time("DTSTART", e.StartAt)
+		w.time("DTEND", e.EndAt)
+		w.text("SUMMARY", e.Title)
+		w.text("LOCATION", e.Location)
+		w.text("DESCRIPTION", e.Description)
+		w.line("END", "VEVENT")
+	}
+
+	w.line("END", "VCALENDAR")
+
+	if w.err != nil {
+		return w.err
+	}
+
+	return w.wr.Flush()
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"bytes"
+	"ghenga/db"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteICalendar(t *testing.T) {
+	start := time.Date(2016, 4, 24, 10, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+	e := db.NewEvent("Meeting; important, really", start, start.Add(time.Hour))
+	e.ID = 23
+	e.Version = 2
+	e.Location = `Köln\Raum 1`
+	e.Description = "first line\nsecond line " + strings.Repeat("ä", 60)
+
+	buf := bytes.NewBuffer(nil)
+	if err := writeICalendar(buf, "ghenga", []*db.Event{e}); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"BEGIN:VEVENT\r\n",
+		"UID:event-23@ghenga\r\n",
+		"SEQUENCE:2\r\n",
+		"DTSTART:20160424T083000Z\r\n",
+		"DTEND:20160424T093000Z\r\n",
+		`SUMMARY:Meeting\; important\, really` + "\r\n",
+		`LOCATION:Köln\\Raum 1` + "\r\n",
+		`DESCRIPTION:first line\nsecond line`,
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("iCalendar data does not contain %q:\n%s", want, data)
+		}
+	}
+
+	for _, line := range strings.Split(data, "\r\n") {
+		if len(line) > icalMaxLineLength {
+			t.Errorf("line is too long (%d octets): %q", len(line), line)
+		}
+	}
+
+	// unfold lines and check that the description is still complete
+	unfolded := strings.Replace(data, "\r\n ", "", -1)
+	want := `DESCRIPTION:first line\nsecond line ` + strings.Repeat("ä", 60) + "\r\n"
+	if !strings.Contains(unfolded, want) {
+		t.Errorf("unfolded data does not contain %q:\n%s", want, unfolded)
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"errors"
+	"ghenga/db"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultPageSize is the number of entities returned by list endpoints when
+// the request does not specify a limit, maxPageSize is the maximal limit.
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// listOptions returns the options for a list endpoint from the request. The
+// parameter `limit` sets the size of the page, `all` selects the whole list
+// (see streamPeople). The parameter `cursor` selects the page
+// (see setNextPage) and `sort` the field to sort by, a leading `-` reverses
+// the order. All other parameters except the reserved ones are filters for
+// fields, e.g. `city=Köln`.
+func listOptions(req *http.Request, reserved ...string) (db.ListOptions, error) {
+	values := req.URL.Query()
+
+	opts := db.ListOptions{
+		Limit:  defaultPageSize,
+		Cursor: values.Get("cursor"),
+		Sort:   values.Get("sort"),
+		Filter: make(map[string]string),
+	}
+
+	if strings.HasPrefix(opts.Sort, "-") {
+		opts.Sort = opts.Sort[1:]
+		opts.Desc = true
+	}
+
+	if s := values.Get("limit"); s == "all" {
+		opts.Limit = 0
+	} else if s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageSize {
+			return opts, StatusError{
+				Code: http.StatusBadRequest,
+				Err:  errors.New("invalid limit"),
+			}
+		}
+		opts.Limit = n
+	}
+
+	reserved = append(reserved, "limit", "cursor", "sort")
+
+next:
+	for name := range values {
+		for _, r := range reserved {
+			if name == r {
+				continue next
+			}
+		}
+
+		opts.Filter[name] = values.Get(name)
+	}
+
+	return opts, nil
+}
+
+// listError returns an error with status code 400 for an invalid list
+// request, other errors are returned unchanged.
+func listError(err error) error {
+	if e, ok := err.(*db.ListError); ok {
+		return StatusError{Code: http.StatusBadRequest, Err: e}
+	}
+
+	return err
+}
+
+// setNextPage announces the next page of a list in the response headers, if
+// there is one. The cursor is returned in the header `X-Next-Cursor`, and the
+// URL for the next page in the header `Link` with the relation `next`.
+func setNextPage(res http.ResponseWriter, req *http.Request, cursor string) {
+	if cursor == "" {
+		return
+	}
+
+	values := req.URL.Query()
+	values.Set("cursor", cursor)
+
+	u := *req.URL
+	u.RawQuery = values.Encode()
+
+	res.Header().Set("X-Next-Cursor", cursor)
+	res.Header().Set("Link", "<"+u.RequestURI()+`>; rel="next"`)
+}
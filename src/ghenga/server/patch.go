@@ -0,0 +1,420 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// mergePatchType is the media type for JSON merge patch documents
+// (RFC 7386), jsonPatchType is the media type for JSON Patch documents
+// (RFC 6902).
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// patchJSON applies the patch in the body of req to the JSON representation
+// of current and decodes the result into result. The patch is either a merge
+// patch (which is also assumed for the media type application/json) or a
+// JSON Patch, depending on the header `Content-Type`. Unless the version was
+// already checked with the header `If-Match` (see checkIfMatch), the patch
+// must contain the version of the object, so that the caller can check it.
+func patchJSON(req *http.Request, current, result interface{}, versionChecked bool) error {
+	t, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || (t != mergePatchType && t != jsonPatchType && t != "application/json") {
+		return StatusError{
+			Code: http.StatusUnsupportedMediaType,
+			Err:  fmt.Errorf("unsupported patch type %q", req.Header.Get("Content-Type")),
+		}
+	}
+
+	buf, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+
+	if !versionChecked && !patchHasVersion(t, buf) {
+		return StatusError{
+			Code: http.StatusBadRequest,
+			Err:  errors.New("patch does not contain the version"),
+		}
+	}
+
+	doc, err := toJSONValue(current)
+	if err != nil {
+		return err
+	}
+
+	if t == jsonPatchType {
+		doc, err = applyJSONPatch(doc, buf)
+	} else {
+		doc, err = applyMergePatch(doc, buf)
+	}
+
+	if err == errPatchTestFailed {
+		return StatusError{Code: http.StatusConflict, Err: err}
+	}
+
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	buf, err = json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(buf, result); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	return nil
+}
+
+// toJSONValue returns the generic JSON representation of v, consisting of
+// maps, slices, strings, float64, bool and nil.
+func toJSONValue(v interface{}) (interface{}, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	err = json.Unmarshal(buf, &value)
+	return value, err
+}
+
+// patchHasVersion returns true if the patch in buf of the media type t
+// contains the version: a merge patch must set the field `version`, a JSON
+// Patch must test or replace it.
+func patchHasVersion(t string, buf []byte) bool {
+	if t != jsonPatchType {
+		var patch map[string]interface{}
+		return json.Unmarshal(buf, &patch) == nil && patch["version"] != nil
+	}
+
+	var ops []patchOperation
+	if json.Unmarshal(buf, &ops) != nil {
+		return false
+	}
+
+	for _, op := range ops {
+		if op.Path != nil && *op.Path == "/version" && (op.Op == "test" || op.Op == "replace") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// applyMergePatch applies the merge patch in buf to doc.
+func applyMergePatch(doc interface{}, buf []byte) (interface{}, error) {
+	var patch interface{}
+	if err := json.Unmarshal(buf, &patch); err != nil {
+		return nil, err
+	}
+
+	return mergePatch(doc, patch), nil
+}
+
+// mergePatch returns target with patch merged into it as described in
+// RFC 7386: objects are merged recursively, members with the value null are
+// removed and all other values replace the value in target.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+			continue
+		}
+
+		t[name] = mergePatch(t[name], value)
+	}
+
+	return t
+}
+
+// patchOperation is a single operation of a JSON Patch.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// errPatchTestFailed is returned when a test operation of a JSON Patch fails.
+var errPatchTestFailed = errors.New("patch test operation failed")
+
+// applyJSONPatch applies the JSON Patch in buf to doc. The operations are
+// applied in order, the first failing operation aborts the patch.
+func applyJSONPatch(doc interface{}, buf []byte) (interface{}, error) {
+	var ops []patchOperation
+	if err := json.Unmarshal(buf, &ops); err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		var err error
+		doc, err = op.apply(doc)
+		if err == errPatchTestFailed {
+			return nil, err
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("patch operation %d (%v): %v", i, op.Op, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// apply returns doc with the operation applied.
+func (op patchOperation) apply(doc interface{}) (interface{}, error) {
+	if op.Path == nil {
+		return nil, errors.New("path is missing")
+	}
+
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var from []string
+	switch op.Op {
+	case "move", "copy":
+		if op.From == nil {
+			return nil, errors.New("from is missing")
+		}
+
+		from, err = parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("value is missing")
+		}
+
+		if err = json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return addValue(doc, path, value)
+	case "remove":
+		return removeValue(doc, path)
+	case "replace":
+		if len(path) == 0 {
+			return value, nil
+		}
+
+		if _, err = getValue(doc, path); err != nil {
+			return nil, err
+		}
+
+		if doc, err = removeValue(doc, path); err != nil {
+			return nil, err
+		}
+
+		return addValue(doc, path, value)
+	case "move":
+		if strings.HasPrefix(*op.Path+"/", *op.From+"/") && *op.Path != *op.From {
+			return nil, errors.New("cannot move a value into itself")
+		}
+
+		if value, err = getValue(doc, from); err != nil {
+			return nil, err
+		}
+
+		if doc, err = removeValue(doc, from); err != nil {
+			return nil, err
+		}
+
+		return addValue(doc, path, value)
+	case "copy":
+		if value, err = getValue(doc, from); err != nil {
+			return nil, err
+		}
+
+		// copy the value, so that later operations do not change both
+		if value, err = toJSONValue(value); err != nil {
+			return nil, err
+		}
+
+		return addValue(doc, path, value)
+	case "test":
+		current, err := getValue(doc, path)
+		if err != nil || !reflect.DeepEqual(current, value) {
+			return nil, errPatchTestFailed
+		}
+
+		return doc, nil
+	}
+
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// parsePointer returns the reference tokens of a JSON pointer (RFC 6901).
+func parsePointer(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("invalid pointer %q", s)
+	}
+
+	tokens := strings.Split(s[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex returns the index token refers to in an array of length n. The
+// index n is only valid if end is true.
+func arrayIndex(token string, n int, end bool) (int, error) {
+	if token == "-" && end {
+		return n, nil
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > n || (i == n && !end) || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	return i, nil
+}
+
+// getValue returns the value the pointer path refers to in doc.
+func getValue(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			value, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = v[i]
+		default:
+			return nil, fmt.Errorf("member %q not found", token)
+		}
+	}
+
+	return doc, nil
+}
+
+// modifyValue calls fn for the object or array containing the value the
+// pointer path refers to, and replaces it with the result of fn. It returns
+// the modified document.
+func modifyValue(doc interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	token := path[0]
+	child, err := getValue(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+
+	child, err = modifyValue(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		v[token] = child
+	case []interface{}:
+		i, _ := arrayIndex(token, len(v), false)
+		v[i] = child
+	}
+
+	return doc, nil
+}
+
+// addValue returns doc with value added at the pointer path. Values in
+// arrays are inserted, members of objects are replaced.
+func addValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return modifyValue(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch v := parent.(type) {
+		case map[string]interface{}:
+			v[token] = value
+			return v, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(v), true)
+			if err != nil {
+				return nil, err
+			}
+
+			v = append(v, nil)
+			copy(v[i+1:], v[i:])
+			v[i] = value
+			return v, nil
+		}
+
+		return nil, fmt.Errorf("cannot add member %q", token)
+	})
+}
+
+// removeValue returns doc with the value at the pointer path removed.
+func removeValue(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+
+	return modifyValue(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch v := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := v[token]; !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+
+			delete(v, token)
+			return v, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+
+			return append(v[:i], v[i+1:]...), nil
+		}
+
+		return nil, fmt.Errorf("member %q not found", token)
+	})
+}
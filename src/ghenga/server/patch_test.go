@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var mergePatchTests = []struct {
+	doc, patch, result string
+}{
+	{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+	{`{"a":"b"}`, `{"a":null}`, `{}`},
+	{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+	{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+	{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+	{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+	{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+	{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+	{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	{`{"a":"b"}`, `["c"]`, `["c"]`},
+}
+
+func decodeJSON(t *testing.T, s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("invalid JSON %q: %v", s, err)
+	}
+	return v
+}
+
+func TestMergePatch(t *testing.T) {
+	for i, test := range mergePatchTests {
+		result := mergePatch(decodeJSON(t, test.doc), decodeJSON(t, test.patch))
+		if !reflect.DeepEqual(result, decodeJSON(t, test.result)) {
+			t.Errorf("test %d: wrong result, want %s, got %v", i, test.result, result)
+		}
+	}
+}
+
+var jsonPatchTests = []struct {
+	doc, patch, result string
+}{
+	{`{"version":1,"a":"b"}`, `[{"op":"test","path":"/version","value":1},{"op":"replace","path":"/a","value":"c"}]`, `{"version":1,"a":"c"}`},
+	{`{"version":1,"a":"b"}`, `[{"op":"test","path":"/version","value":1},{"op":"add","path":"/b","value":["c"]}]`, `{"version":1,"a":"b","b":["c"]}`},
+	{`{"version":1,"a":["x","z"]}`, `[{"op":"test","path":"/version","value":1},{"op":"add","path":"/a/1","value":"y"}]`, `{"version":1,"a":["x","y","z"]}`},
+	{`{"version":1,"a":["x"]}`, `[{"op":"test","path":"/version","value":1},{"op":"add","path":"/a/-","value":"y"}]`, `{"version":1,"a":["x","y"]}`},
+	{`{"version":1,"a":["x","y"]}`, `[{"op":"test","path":"/version","value":1},{"op":"remove","path":"/a/0"}]`, `{"version":1,"a":["y"]}`},
+	{`{"version":1,"a":{"b":"c"}}`, `[{"op":"test","path":"/version","value":1},{"op":"move","from":"/a/b","path":"/d"}]`, `{"version":1,"a":{},"d":"c"}`},
+	{`{"version":1,"a":{"b":"c"}}`, `[{"op":"test","path":"/version","value":1},{"op":"copy","from":"/a","path":"/d"},{"op":"add","path":"/d/e","value":null}]`, `{"version":1,"a":{"b":"c"},"d":{"b":"c","e":null}}`},
+	{`{"version":1,"a/b":{"m~n":1}}`, `[{"op":"replace","path":"/version","value":1},{"op":"replace","path":"/a~1b/m~0n","value":2}]`, `{"version":1,"a/b":{"m~n":2}}`},
+}
+
+var invalidJSONPatchTests = []string{
+	`{"version":1}`,
+	`[{"op":"test","path":"/version","value":1},{"op":"replace","path":"/x","value":"c"}]`,
+	`[{"op":"test","path":"/version","value":1},{"op":"remove","path":"/x"}]`,
+	`[{"op":"test","path":"/version","value":1},{"op":"add","path":"/a/b","value":1}]`,
+	`[{"op":"test","path":"/version","value":1},{"op":"add","path":"/l/5","value":1}]`,
+	`[{"op":"test","path":"/version","value":1},{"op":"add","path":"/l/01","value":1}]`,
+	`[{"op":"test","path":"/version","value":1},{"op":"add","path":"x","value":1}]`,
+	`[{"op":"test","path":"/version","value":1},{"op":"add","path":"/x"}]`,
+	`[{"op":"test","path":"/version","value":1},{"op":"move","path":"/l/0"}]`,
+	`[{"op":"test","path":"/version","value":1},{"op":"move","from":"/l","path":"/l/0"}]`,
+	`[{"op":"test","path":"/version","value":1},{"op":"foo","path":"/a"}]`,
+	`[{"op":"test","path":"/version","value":1},{"op":"remove","path":""}]`,
+}
+
+func TestPatchHasVersion(t *testing.T) {
+	for i, test := range []struct {
+		t, patch string
+		version  bool
+	}{
+		{mergePatchType, `{"version":1,"a":"b"}`, true},
+		{mergePatchType, `{"a":"b"}`, false},
+		{mergePatchType, `{"version":null}`, false},
+		{mergePatchType, `[1]`, false},
+		{jsonPatchType, `[{"op":"test","path":"/version","value":1}]`, true},
+		{jsonPatchType, `[{"op":"replace","path":"/version","value":1}]`, true},
+		{jsonPatchType, `[{"op":"remove","path":"/version"}]`, false},
+		{jsonPatchType, `[{"op":"replace","path":"/a","value":"c"}]`, false},
+		{jsonPatchType, `{"version":1}`, false},
+	} {
+		if patchHasVersion(test.t, []byte(test.patch)) != test.version {
+			t.Errorf("test %d: wrong result for %s, want %v", i, test.patch, test.version)
+		}
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	for i, test := range jsonPatchTests {
+		result, err := applyJSONPatch(decodeJSON(t, test.doc), []byte(test.patch))
+		if err != nil {
+			t.Errorf("test %d: unexpected error %v", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(result, decodeJSON(t, test.result)) {
+			t.Errorf("test %d: wrong result, want %s, got %v", i, test.result, result)
+		}
+	}
+
+	for i, patch := range invalidJSONPatchTests {
+		_, err := applyJSONPatch(decodeJSON(t, `{"version":1,"a":"b","l":[1,2]}`), []byte(patch))
+		if err == nil || err == errPatchTestFailed {
+			t.Errorf("invalid patch %d: wrong error %v", i, err)
+		}
+	}
+
+	_, err := applyJSONPatch(decodeJSON(t, `{"version":2}`), []byte(`[{"op":"test","path":"/version","value":1}]`))
+	if err != errPatchTestFailed {
+		t.Errorf("failing test operation returned wrong error %v", err)
+	}
+}
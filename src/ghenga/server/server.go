@@ -9,8 +9,20 @@ import (
 func NewRouter(ctx context.Context, env *Env) *mux.Router {
 	router := mux.NewRouter()
 	PeopleHandler(ctx, env, router)
+	AccountHandler(ctx, env, router)
+	ActivityHandler(ctx, env, router)
+	TaskHandler(ctx, env, router)
+	EventHandler(ctx, env, router)
+	TagHandler(ctx, env, router)
+	CustomFieldHandler(ctx, env, router)
 	LoginHandler(ctx, env, router)
 	SearchHandler(ctx, env, router)
+	SavedSearchHandler(ctx, env, router)
+	LookupHandler(ctx, env, router)
+	SuggestHandler(ctx, env, router)
 	UserHandler(ctx, env, router)
+	BatchHandler(ctx, env, router)
+	ImportHandler(ctx, env, router)
+	ExportHandler(ctx, env, router)
 	return router
 }
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type Account struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Website string `json:"website"`
+	Version int    `json:"version"`
+}
+
+func verifyAccount(t *testing.T, name string, data []byte) Account {
+	var account Account
+
+	unmarshal(t, data, &account)
+
+	if account.ID == 0 {
+		t.Fatalf("account has ID 0")
+	}
+
+	if account.Name != name {
+		t.Fatalf("name does not match, want %q, got %q", name, account.Name)
+	}
+
+	return account
+}
+
+func TestAccountCRUD(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	a := readFixture(t, "sample_account.json")
+
+	token := login(t, srv, "admin", "geheim")
+
+	status, body := request(t, token, "POST", srv.URL+"/api/account", a)
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	account := verifyAccount(t, "Beispiel GmbH", body)
+	url := fmt.Sprintf("%s/api/account/%d", srv.URL, account.ID)
+
+	status, body = request(t, token, "GET", url, nil)
+	if status != 200 {
+		t.Fatalf("reading account again yielded unexpected status %d: %s", status, body)
+	}
+
+	account = verifyAccount(t, account.Name, body)
+	account.Name = "Beispiel AG"
+
+	status, body = request(t, token, "PUT", url, marshal(t, account))
+	if status != 200 {
+		t.Fatalf("updating account, invalid status %d: %s", status, body)
+	}
+
+	verifyAccount(t, account.Name, body)
+
+	status, _ = request(t, token, "PUT", url, marshal(t, account))
+	if status != 409 {
+		t.Fatalf("updating account with outdated version, want status 409, got %d", status)
+	}
+
+	status, body = request(t, token, "DELETE", url, nil)
+	if status != 200 {
+		t.Fatalf("deleting account yielded unexpected status %d", status)
+	}
+
+	if strings.TrimSpace(string(body)) != "{}" {
+		t.Fatalf("expected empty JSON body not found, got:\n%s", body)
+	}
+
+	status, _ = request(t, token, "GET", url, nil)
+	if status != 404 {
+		t.Fatalf("reading deleted account yielded unexpected status %d", status)
+	}
+}
+
+func TestAccountPeople(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	status, body := request(t, token, "POST", srv.URL+"/api/account", readFixture(t, "sample_account.json"))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	account := verifyAccount(t, "Beispiel GmbH", body)
+
+	p := fmt.Sprintf(`{"name": "Nicolai Person", "account_id": %d}`, account.ID)
+	status, body = request(t, token, "POST", srv.URL+"/api/person", []byte(p))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	person := verifyPerson(t, "Nicolai Person", body)
+
+	status, body = request(t, token, "GET", fmt.Sprintf("%s/api/account/%d/people", srv.URL, account.ID), nil)
+	if status != 200 {
+		t.Fatalf("listing people for account yielded unexpected status %d: %s", status, body)
+	}
+
+	var list []Person
+	unmarshal(t, body, &list)
+	if len(list) != 1 || list[0].ID != person.ID {
+		t.Fatalf("wrong list of people for account returned: %v", list)
+	}
+
+	p = `{"name": "Nicolai Person", "account_id": 10000}`
+	status, body = request(t, token, "POST", srv.URL+"/api/person", []byte(p))
+	if status != 400 {
+		t.Fatalf("person with invalid account was accepted, status %v, body:\n  %s", status, body)
+	}
+}
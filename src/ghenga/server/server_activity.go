@@ -0,0 +1,203 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"ghenga/db"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/gorilla/mux"
+)
+
+// ListActivities handles listing activity records.
+func ListActivities(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	activities, err := env.DB.ListActivities()
+	if err != nil {
+		return err
+	}
+
+	return httpWriteJSON(res, http.StatusOK, activities)
+}
+
+// ShowActivity returns an Activity record.
+func ShowActivity(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	activity, err := env.DB.FindActivity(int64(id))
+	if err != nil {
+		return StatusError{
+			Err:  errors.New("activity not found"),
+			Code: http.StatusNotFound,
+		}
+	}
+
+	return httpWriteJSON(res, http.StatusOK, activity)
+}
+
+// ListPersonActivities returns the list of activities linked to a person.
+func ListPersonActivities(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if _, err = env.DB.FindPerson(int64(id)); err != nil {
+		return StatusError{
+			Err:  errors.New("person not found"),
+			Code: http.StatusNotFound,
+		}
+	}
+
+	activities, err := env.DB.ListPersonActivities(int64(id))
+	if err != nil {
+		return err
+	}
+
+	if activities == nil {
+		activities = []*db.Activity{}
+	}
+
+	return httpWriteJSON(res, http.StatusOK, activities)
+}
+
+// checkActivity validates a and makes sure the linked person and account
+// exist.
+func checkActivity(env *Env, a *db.Activity) error {
+	if err := a.Validate(); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if err := checkPerson(env, a.PersonID); err != nil {
+		return err
+	}
+
+	return checkAccount(env, a.AccountID)
+}
+
+// CreateActivity inserts a new activity into the database. The author is set
+// to the user of the current session. The request body must be valid JSON.
+func CreateActivity(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	session, ok := db.SessionFromContext(ctx)
+	if !ok {
+		return errors.New("no session found in context")
+	}
+
+	var ja db.ActivityJSON
+	dec := json.NewDecoder(req.Body)
+	if err = dec.Decode(&ja); err != nil {
+		return err
+	}
+
+	var a db.Activity
+	if err = a.Update(ja); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	// overwrite fields we'd like to be set
+	a.Author = session.User
+	a.CreatedAt = time.Now()
+	a.ChangedAt = time.Now()
+	a.Version = 0
+
+	if a.OccurredAt.IsZero() {
+		a.OccurredAt = a.CreatedAt
+	}
+
+	if err = checkActivity(env, &a); err != nil {
+		return err
+	}
+
+	err = env.DB.InsertActivity(&a)
+	if err != nil {
+		return err
+	}
+
+	env.Debugf("created activity %v", a)
+
+	return httpWriteJSON(wr, http.StatusCreated, a)
+}
+
+// UpdateActivity changes an existing activity record. The request body must be valid JSON.
+func UpdateActivity(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	var newActivity db.ActivityJSON
+	dec := json.NewDecoder(req.Body)
+	if err = dec.Decode(&newActivity); err != nil {
+		return err
+	}
+
+	a, err := env.DB.FindActivity(int64(id))
+	if err != nil {
+		env.Logf("unable to find activity ID %v, error: %v", id, err)
+		return StatusError{
+			Err:  errors.New("activity not found"),
+			Code: http.StatusNotFound,
+		}
+	}
+
+	if a.Version != newActivity.Version {
+		env.Debugf("activity record is outdated, version %v != %v",
+			a.Version, newActivity.Version)
+		return StatusError{
+			Err:  errors.New("version field does not match"),
+			Code: http.StatusConflict,
+		}
+	}
+
+	if err = a.Update(newActivity); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	a.ChangedAt = time.Now()
+
+	if err = checkActivity(env, a); err != nil {
+		return err
+	}
+
+	err = env.DB.UpdateActivity(a)
+	if err != nil {
+		env.Logf("unable update activity %v, sql error: %v", a, err)
+		return err
+	}
+
+	return httpWriteJSON(wr, http.StatusOK, a)
+}
+
+// DeleteActivity removes an activity from the database.
+func DeleteActivity(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if err := env.DB.DeleteActivity(int64(id)); err != nil {
+		return err
+	}
+
+	return httpWriteJSON(wr, http.StatusOK, nil)
+}
+
+// ActivityHandler adds routes for ghenga API in the given environment to r.
+func ActivityHandler(ctx context.Context, env *Env, r *mux.Router) {
+	r.Handle("/api/activity", Handle(ctx, env, RequireAuth(ListActivities))).Methods("GET")
+	r.Handle("/api/activity", Handle(ctx, env, RequireAuth(CreateActivity))).Methods("POST")
+	r.Handle("/api/activity/{id}", Handle(ctx, env, RequireAuth(ShowActivity))).Methods("GET")
+	r.Handle("/api/activity/{id}", Handle(ctx, env, RequireAuth(UpdateActivity))).Methods("PUT")
+	r.Handle("/api/activity/{id}", Handle(ctx, env, RequireAuth(DeleteActivity))).Methods("DELETE")
+	r.Handle("/api/person/{id}/activities", Handle(ctx, env, RequireAuth(ListPersonActivities))).Methods("GET")
+}
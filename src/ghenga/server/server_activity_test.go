@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+type Activity struct {
+	ID         int    `json:"id"`
+	Type       string `json:"type"`
+	Subject    string `json:"subject"`
+	Author     string `json:"author"`
+	PersonID   int    `json:"person_id"`
+	OccurredAt string `json:"occurred_at"`
+	Version    int    `json:"version"`
+}
+
+func TestActivityCRUD(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "user", "geheim")
+
+	data := []byte(`{"type": "call", "subject": "Called about the offer", "person_id": 3, "occurred_at": "2016-04-24T10:30:07+00:00"}`)
+	status, body := request(t, token, "POST", srv.URL+"/api/activity", data)
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	var activity Activity
+	unmarshal(t, body, &activity)
+
+	if activity.ID == 0 || activity.Author != "user" || activity.PersonID != 3 {
+		t.Fatalf("wrong activity returned: %+v", activity)
+	}
+
+	url := fmt.Sprintf("%s/api/activity/%d", srv.URL, activity.ID)
+
+	activity.Subject = "Called again"
+	status, body = request(t, token, "PUT", url, marshal(t, activity))
+	if status != 200 {
+		t.Fatalf("updating activity, invalid status %d: %s", status, body)
+	}
+
+	status, _ = request(t, token, "PUT", url, marshal(t, activity))
+	if status != 409 {
+		t.Fatalf("updating activity with outdated version, want status 409, got %d", status)
+	}
+
+	status, body = request(t, token, "GET", srv.URL+"/api/person/3/activities", nil)
+	if status != 200 {
+		t.Fatalf("listing activities for person yielded unexpected status %d: %s", status, body)
+	}
+
+	var list []Activity
+	unmarshal(t, body, &list)
+	if len(list) != 1 || list[0].Subject != "Called again" {
+		t.Fatalf("wrong list of activities returned: %v", list)
+	}
+
+	status, _ = request(t, token, "DELETE", url, nil)
+	if status != 200 {
+		t.Fatalf("deleting activity yielded unexpected status %d", status)
+	}
+
+	status, _ = request(t, token, "GET", url, nil)
+	if status != 404 {
+		t.Fatalf("reading deleted activity yielded unexpected status %d", status)
+	}
+}
+
+var invalidActivityTests = []string{
+	`{}`,
+	`{"type": "call"}`,
+	`{"type": "foo", "person_id": 3}`,
+	`{"type": "call", "person_id": 10000}`,
+	`{"type": "call", "person_id": 3, "occurred_at": "yesterday"}`,
+}
+
+func TestInvalidActivity(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	for _, test := range invalidActivityTests {
+		status, body := request(t, token, "POST", srv.URL+"/api/activity", []byte(test))
+		if status != 400 {
+			t.Errorf("status code for invalid activity %s not found, want 400, got %v, body:\n  %s", test, status, body)
+		}
+	}
+}
+
+func TestActivityAuthorDelete(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "user", "geheim")
+
+	data := []byte(`{"type": "call", "subject": "Called about the offer", "person_id": 3}`)
+	status, body := request(t, token, "POST", srv.URL+"/api/activity", data)
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	// the user "user" is created right after "admin"
+	token = login(t, srv, "admin", "geheim")
+	status, body = request(t, token, "DELETE", srv.URL+"/api/user/2", nil)
+	if status != 409 {
+		t.Fatalf("deleting the author of an activity returned status %d, want 409: %s", status, body)
+	}
+}
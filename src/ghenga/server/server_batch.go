@@ -0,0 +1,302 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ghenga/db"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+)
+
+// maxBatchSize is the maximal number of operations in a batch.
+const maxBatchSize = 1000
+
+// statusFailedDependency is the status code 424 (Failed Dependency), which is
+// not defined in net/http before Go 1.7.
+const statusFailedDependency = 424
+
+// batchRequest is the body of a batch request. By default, the batch is
+// atomic: when one operation fails, none of the changes are saved. When
+// ContinueOnError is set, only the failing operations are discarded.
+type batchRequest struct {
+	ContinueOnError bool             `json:"continue_on_error"`
+	Operations      []batchOperation `json:"operations"`
+}
+
+// batchOperation is a single operation of a batch. Op is one of `create`,
+// `update` and `delete`, Type is `person` or `user` (only for `create`). The
+// ID selects the entity for `update` and `delete`, Data contains the JSON
+// document for `create` and `update`. If Version is set for `delete`, it must
+// match the version of the person, it is checked again while deleting. A
+// person can only be updated or deleted by one operation of a batch.
+type batchOperation struct {
+	Op      string          `json:"op"`
+	Type    string          `json:"type"`
+	ID      int64           `json:"id,omitempty"`
+	Version int64           `json:"version,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// batchResult is the result of a single operation, with the status code the
+// operation would have as a single request.
+type batchResult struct {
+	Status int         `json:"status"`
+	Error  string      `json:"error,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// batchResponse is the response to a batch request. Message is set when the
+// batch was aborted.
+type batchResponse struct {
+	Message   string        `json:"message,omitempty"`
+	Committed bool          `json:"committed"`
+	Results   []batchResult `json:"results"`
+}
+
+// errBatchAborted is the error for operations which were not saved because
+// another operation of an atomic batch failed.
+var errBatchAborted = StatusError{
+	Code: statusFailedDependency,
+	Err:  errors.New("batch aborted"),
+}
+
+// batchError returns the result for an operation which failed with err.
+func batchError(env *Env, err error) batchResult {
+	if err == db.ErrVersionConflict {
+		return batchResult{Status: http.StatusConflict, Error: "version field does not match"}
+	}
+
+	if e, ok := err.(Error); ok {
+		return batchResult{Status: e.Status(), Error: e.Error()}
+	}
+
+	env.Logf("batch operation failed: %v", err)
+
+	res := batchResult{Status: http.StatusInternalServerError, Error: "internal server error"}
+	if env.Cfg.Debug {
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+// prepareBatchOperation checks the operation and returns the function which
+// runs it in the batch, together with the result of the operation if it
+// succeeds. The entity in the result is changed when the operation runs.
+func prepareBatchOperation(env *Env, op batchOperation, admin bool) (db.BatchOperation, batchResult, error) {
+	badRequest := func(format string, args ...interface{}) error {
+		return StatusError{Code: http.StatusBadRequest, Err: fmt.Errorf(format, args...)}
+	}
+
+	switch {
+	case op.Type == "user" && op.Op == "create":
+		if !admin {
+			return nil, batchResult{}, StatusError{
+				Code: http.StatusForbidden,
+				Err:  errors.New("user is not admin"),
+			}
+		}
+
+		var ju db.UserJSON
+		if err := json.Unmarshal(op.Data, &ju); err != nil {
+			return nil, batchResult{}, badRequest("invalid user: %v", err)
+		}
+
+		u, err := userFromJSON(ju)
+		if err != nil {
+			return nil, batchResult{}, err
+		}
+
+		if err = checkUserLogin(env, u); err != nil {
+			return nil, batchResult{}, err
+		}
+
+		return func(tx db.BatchTx) error {
+			return tx.InsertUser(u)
+		}, batchResult{Status: http.StatusCreated, Data: u}, nil
+
+	case op.Type != "person":
+		return nil, batchResult{}, badRequest("invalid type %q", op.Type)
+
+	case op.Op == "create":
+		var jp db.PersonJSON
+		if err := json.Unmarshal(op.Data, &jp); err != nil {
+			return nil, batchResult{}, badRequest("invalid person: %v", err)
+		}
+
+		p, err := personFromJSON(env, jp)
+		if err != nil {
+			return nil, batchResult{}, err
+		}
+
+		return func(tx db.BatchTx) error {
+			return tx.InsertPerson(p)
+		}, batchResult{Status: http.StatusCreated, Data: p}, nil
+
+	case op.Op != "update" && op.Op != "delete":
+		return nil, batchResult{}, badRequest("invalid operation %q", op.Op)
+	}
+
+	p, err := env.DB.FindPerson(op.ID)
+	if err != nil {
+		return nil, batchResult{}, StatusError{
+			Err:  errors.New("person not found"),
+			Code: http.StatusNotFound,
+		}
+	}
+
+	if op.Op == "delete" {
+		if op.Version != 0 && op.Version != p.Version {
+			return nil, batchResult{}, StatusError{
+				Err:  errors.New("version field does not match"),
+				Code: http.StatusConflict,
+			}
+		}
+
+		return func(tx db.BatchTx) error {
+			if op.Version == 0 {
+				return tx.DeletePerson(p.ID)
+			}
+			return tx.DeletePersonVersion(p.ID, op.Version)
+		}, batchResult{Status: http.StatusOK}, nil
+	}
+
+	var jp db.PersonJSON
+	if err = json.Unmarshal(op.Data, &jp); err != nil {
+		return nil, batchResult{}, badRequest("invalid person: %v", err)
+	}
+
+	if err = updatePersonFromJSON(env, p, jp); err != nil {
+		return nil, batchResult{}, err
+	}
+
+	return func(tx db.BatchTx) error {
+		return tx.UpdatePerson(p)
+	}, batchResult{Status: http.StatusOK, Data: p}, nil
+}
+
+// Batch runs a list of operations on people and users in one database
+// transaction, see batchRequest. The response contains the result of each
+// operation. When an atomic batch fails, the status code of the first failed
+// operation is returned, operations which did not fail themselves have the
+// status code 424 (Failed Dependency).
+func Batch(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	var br batchRequest
+	if err = json.NewDecoder(req.Body).Decode(&br); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if len(br.Operations) == 0 || len(br.Operations) > maxBatchSize {
+		return StatusError{
+			Code: http.StatusBadRequest,
+			Err:  fmt.Errorf("a batch must contain between 1 and %d operations", maxBatchSize),
+		}
+	}
+
+	login, err := sessionUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := env.DB.FindUserName(login)
+	if err != nil {
+		return err
+	}
+
+	atomic := !br.ContinueOnError
+	results := make([]batchResult, len(br.Operations))
+	failed := -1
+
+	// indexes of the operations which are run, in order
+	var ops []db.BatchOperation
+	var idx []int
+
+	// the operations are checked against the state before the batch, so
+	// several operations on the same person or creating the same user are
+	// rejected
+	changed := make(map[int64]bool)
+	created := make(map[string]bool)
+
+	for i, op := range br.Operations {
+		fn, res, err := prepareBatchOperation(env, op, user.Admin)
+		if err == nil && op.Type == "person" && op.Op != "create" {
+			if changed[op.ID] {
+				err = StatusError{
+					Code: http.StatusBadRequest,
+					Err:  fmt.Errorf("person %d is already changed by another operation", op.ID),
+				}
+			}
+			changed[op.ID] = true
+		}
+
+		if u, ok := res.Data.(*db.User); err == nil && ok {
+			if created[u.Login] {
+				err = StatusError{
+					Code: http.StatusConflict,
+					Err:  fmt.Errorf("user %q is already created by another operation", u.Login),
+				}
+			}
+			created[u.Login] = true
+		}
+
+		if err != nil {
+			results[i] = batchError(env, err)
+			if failed < 0 {
+				failed = i
+			}
+			continue
+		}
+
+		results[i] = res
+		ops = append(ops, fn)
+		idx = append(idx, i)
+	}
+
+	if !atomic || failed < 0 {
+		errs, err := env.DB.RunBatch(ops, atomic)
+		if err != nil {
+			return err
+		}
+
+		for j, err := range errs {
+			if err == nil {
+				continue
+			}
+
+			i := idx[j]
+			results[i] = batchError(env, err)
+			if failed < 0 || i < failed {
+				failed = i
+			}
+		}
+	}
+
+	response := batchResponse{
+		Committed: !atomic || failed < 0,
+		Results:   results,
+	}
+
+	status := http.StatusOK
+	if !response.Committed {
+		status = results[failed].Status
+		response.Message = fmt.Sprintf("batch aborted, operation %d failed: %v", failed, results[failed].Error)
+
+		for i := range results {
+			if results[i].Status < 400 {
+				results[i] = batchError(env, errBatchAborted)
+			}
+		}
+	}
+
+	return httpWriteJSON(wr, status, response)
+}
+
+// BatchHandler adds routes for the ghenga API in the given environment to r.
+func BatchHandler(ctx context.Context, env *Env, r *mux.Router) {
+	r.Handle("/api/batch", Handle(ctx, env, RequireAuth(Batch))).Methods("POST")
+}
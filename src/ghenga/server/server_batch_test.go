@@ -0,0 +1,181 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+type BatchResponse struct {
+	Message   string `json:"message"`
+	Committed bool   `json:"committed"`
+	Results   []struct {
+		Status int             `json:"status"`
+		Error  string          `json:"error"`
+		Data   json.RawMessage `json:"data"`
+	} `json:"results"`
+}
+
+func batchStatus(res BatchResponse) []int {
+	var list []int
+	for _, r := range res.Results {
+		list = append(list, r.Status)
+	}
+	return list
+}
+
+func findPeopleByName(t *testing.T, token, url, name string) []Person {
+	status, body := request(t, token, "GET", url+"/api/person?name="+name, nil)
+	if status != 200 {
+		t.Fatalf("listing people failed with status %d: %s", status, body)
+	}
+
+	var list []Person
+	unmarshal(t, body, &list)
+	return list
+}
+
+func TestBatch(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	var people []Person
+	for _, id := range []int{1, 2} {
+		status, body := request(t, token, "GET", fmt.Sprintf("%s/api/person/%d", srv.URL, id), nil)
+		if status != 200 {
+			t.Fatalf("reading person %d failed with status %d", id, status)
+		}
+
+		var p Person
+		unmarshal(t, body, &p)
+		people = append(people, p)
+	}
+
+	batch := fmt.Sprintf(`{"operations": [
+		{"op": "create", "type": "person", "data": {"name": "Batch Person"}},
+		{"op": "update", "type": "person", "id": %d, "data": {"name": "Batch Renamed", "version": %d}},
+		{"op": "delete", "type": "person", "id": %d, "version": %d},
+		{"op": "create", "type": "user", "data": {"login": "batchuser", "password": "secret"}}
+	]}`, people[0].ID, people[0].Version, people[1].ID, people[1].Version)
+
+	status, body := request(t, token, "POST", srv.URL+"/api/batch", []byte(batch))
+	if status != 200 {
+		t.Fatalf("batch failed with status %d: %s", status, body)
+	}
+
+	var res BatchResponse
+	unmarshal(t, body, &res)
+
+	if !res.Committed || fmt.Sprint(batchStatus(res)) != "[201 200 200 201]" {
+		t.Fatalf("batch returned wrong results: %s", body)
+	}
+
+	created := verifyPerson(t, "Batch Person", res.Results[0].Data)
+	if list := findPeopleByName(t, token, srv.URL, "Batch%20Person"); len(list) != 1 || list[0].ID != created.ID {
+		t.Errorf("person created in batch not found: %v", list)
+	}
+
+	status, body = request(t, token, "GET", fmt.Sprintf("%s/api/person/%d", srv.URL, people[0].ID), nil)
+	if status != 200 {
+		t.Fatalf("reading person failed with status %d", status)
+	}
+	verifyPerson(t, "Batch Renamed", body)
+
+	status, _ = request(t, token, "GET", fmt.Sprintf("%s/api/person/%d", srv.URL, people[1].ID), nil)
+	if status != 404 {
+		t.Errorf("person deleted in batch still exists, status %d", status)
+	}
+
+	login(t, srv, "batchuser", "secret")
+}
+
+func TestBatchAtomic(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	batch := `{%s"operations": [
+		{"op": "create", "type": "person", "data": {"name": "Batch Atomic"}},
+		{"op": "update", "type": "person", "id": 1, "data": {"name": "Batch Outdated", "version": 23}},
+		{"op": "create", "type": "person", "data": {"name": ""}},
+		{"op": "delete", "type": "person", "id": 5}
+	]}`
+
+	status, body := request(t, token, "POST", srv.URL+"/api/batch", []byte(fmt.Sprintf(batch, "")))
+	if status != 409 {
+		t.Fatalf("atomic batch returned wrong status, want 409, got %d: %s", status, body)
+	}
+
+	var res BatchResponse
+	unmarshal(t, body, &res)
+
+	if res.Committed || res.Message == "" || fmt.Sprint(batchStatus(res)) != "[424 409 400 424]" {
+		t.Fatalf("atomic batch returned wrong results: %s", body)
+	}
+
+	if list := findPeopleByName(t, token, srv.URL, "Batch%20Atomic"); len(list) != 0 {
+		t.Errorf("person created in aborted batch was saved: %v", list)
+	}
+
+	status, _ = request(t, token, "GET", srv.URL+"/api/person/5", nil)
+	if status != 200 {
+		t.Errorf("person deleted in aborted batch was removed, status %d", status)
+	}
+
+	status, body = request(t, token, "POST", srv.URL+"/api/batch", []byte(fmt.Sprintf(batch, `"continue_on_error": true, `)))
+	if status != 200 {
+		t.Fatalf("batch returned wrong status, want 200, got %d: %s", status, body)
+	}
+
+	res = BatchResponse{}
+	unmarshal(t, body, &res)
+
+	if !res.Committed || fmt.Sprint(batchStatus(res)) != "[201 409 400 200]" {
+		t.Fatalf("batch returned wrong results: %s", body)
+	}
+
+	if list := findPeopleByName(t, token, srv.URL, "Batch%20Atomic"); len(list) != 1 {
+		t.Errorf("person created in batch was not saved: %v", list)
+	}
+
+	status, _ = request(t, token, "GET", srv.URL+"/api/person/5", nil)
+	if status != 404 {
+		t.Errorf("person deleted in batch still exists, status %d", status)
+	}
+}
+
+var invalidBatchTests = []struct {
+	token  string
+	batch  string
+	status int
+}{
+	{"admin", `{"operations": []}`, 400},
+	{"admin", `{"operations": [{"op": "create", "type": "account", "data": {}}]}`, 400},
+	{"admin", `{"operations": [{"op": "foo", "type": "person", "id": 1}]}`, 400},
+	{"admin", `{"operations": [{"op": "delete", "type": "person", "id": 1000}]}`, 404},
+	{"admin", `{"operations": [{"op": "delete", "type": "person", "id": 1, "version": 23}]}`, 409},
+	{"admin", `{"operations": [{"op": "delete", "type": "person", "id": 1}, {"op": "delete", "type": "person", "id": 1}]}`, 400},
+	{"user", `{"operations": [{"op": "create", "type": "user", "data": {"login": "foo", "password": "bar"}}]}`, 403},
+	{"admin", `{"operations": [{"op": "create", "type": "user", "data": {"login": "user", "password": "bar"}}]}`, 409},
+	{"admin", `{"operations": [{"op": "create", "type": "user", "data": {"login": "foo", "password": "bar"}}, {"op": "create", "type": "user", "data": {"login": "foo", "password": "baz"}}]}`, 409},
+}
+
+func TestInvalidBatch(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	tokens := map[string]string{
+		"admin": login(t, srv, "admin", "geheim"),
+		"user":  login(t, srv, "user", "geheim"),
+	}
+
+	for i, test := range invalidBatchTests {
+		status, body := request(t, tokens[test.token], "POST", srv.URL+"/api/batch", []byte(test.batch))
+		if status != test.status {
+			t.Errorf("test %d: wrong status, want %d, got %d: %s", i, test.status, status, body)
+		}
+	}
+}
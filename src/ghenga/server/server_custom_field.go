@@ -0,0 +1,178 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"ghenga/db"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/gorilla/mux"
+)
+
+// ListCustomFields handles listing the definitions of custom fields.
+func ListCustomFields(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	fields, err := env.DB.ListCustomFields()
+	if err != nil {
+		return err
+	}
+
+	return httpWriteJSON(res, http.StatusOK, fields)
+}
+
+// ShowCustomField returns a CustomField record.
+func ShowCustomField(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	field, err := env.DB.FindCustomField(int64(id))
+	if err != nil {
+		return StatusError{
+			Err:  errors.New("custom field not found"),
+			Code: http.StatusNotFound,
+		}
+	}
+
+	return httpWriteJSON(res, http.StatusOK, field)
+}
+
+// checkCustomFieldName returns an error if another custom field with the same
+// name as f already exists.
+func checkCustomFieldName(env *Env, f *db.CustomField) error {
+	fields, err := env.DB.ListCustomFields()
+	if err != nil {
+		return err
+	}
+
+	for _, other := range fields {
+		if other.Name == f.Name && other.ID != f.ID {
+			return StatusError{
+				Err:  errors.New("custom field already exists"),
+				Code: http.StatusConflict,
+			}
+		}
+	}
+
+	return nil
+}
+
+// CreateCustomField inserts a new custom field definition into the database.
+// The request body must be valid JSON.
+func CreateCustomField(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	var jf db.CustomFieldJSON
+	dec := json.NewDecoder(req.Body)
+	if err = dec.Decode(&jf); err != nil {
+		return err
+	}
+
+	var f db.CustomField
+	f.Update(jf)
+
+	// overwrite fields we'd like to be set
+	f.CreatedAt = time.Now()
+	f.ChangedAt = time.Now()
+	f.Version = 0
+
+	if err = f.Validate(); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if err = checkCustomFieldName(env, &f); err != nil {
+		return err
+	}
+
+	err = env.DB.InsertCustomField(&f)
+	if err != nil {
+		return err
+	}
+
+	env.Debugf("created custom field %v", f)
+
+	return httpWriteJSON(wr, http.StatusCreated, f)
+}
+
+// UpdateCustomField changes an existing custom field definition. The request
+// body must be valid JSON.
+func UpdateCustomField(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	var newField db.CustomFieldJSON
+	dec := json.NewDecoder(req.Body)
+	if err = dec.Decode(&newField); err != nil {
+		return err
+	}
+
+	f, err := env.DB.FindCustomField(int64(id))
+	if err != nil {
+		env.Logf("unable to find custom field ID %v, error: %v", id, err)
+		return StatusError{
+			Err:  errors.New("custom field not found"),
+			Code: http.StatusNotFound,
+		}
+	}
+
+	if f.Version != newField.Version {
+		env.Debugf("custom field record is outdated, version %v != %v",
+			f.Version, newField.Version)
+		return StatusError{
+			Err:  errors.New("version field does not match"),
+			Code: http.StatusConflict,
+		}
+	}
+
+	f.Update(newField)
+
+	f.ChangedAt = time.Now()
+
+	if err = f.Validate(); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if err = checkCustomFieldName(env, f); err != nil {
+		return err
+	}
+
+	err = env.DB.UpdateCustomField(f)
+	if err != nil {
+		env.Logf("unable update custom field %v, sql error: %v", f, err)
+		return err
+	}
+
+	return httpWriteJSON(wr, http.StatusOK, f)
+}
+
+// DeleteCustomField removes a custom field definition from the database,
+// together with the values stored for all people.
+func DeleteCustomField(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if err := env.DB.DeleteCustomField(int64(id)); err != nil {
+		return err
+	}
+
+	return httpWriteJSON(wr, http.StatusOK, nil)
+}
+
+// CustomFieldHandler adds routes for ghenga API in the given environment to r.
+func CustomFieldHandler(ctx context.Context, env *Env, r *mux.Router) {
+	r.Handle("/api/admin/fields", Handle(ctx, env, RequireAdmin(ListCustomFields))).Methods("GET")
+	r.Handle("/api/admin/fields", Handle(ctx, env, RequireAdmin(CreateCustomField))).Methods("POST")
+	r.Handle("/api/admin/fields/{id}", Handle(ctx, env, RequireAdmin(ShowCustomField))).Methods("GET")
+	r.Handle("/api/admin/fields/{id}", Handle(ctx, env, RequireAdmin(UpdateCustomField))).Methods("PUT")
+	r.Handle("/api/admin/fields/{id}", Handle(ctx, env, RequireAdmin(DeleteCustomField))).Methods("DELETE")
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+type CustomField struct {
+	ID       int      `json:"id"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options"`
+	Version  int      `json:"version"`
+}
+
+func TestCustomFieldCRUD(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	f := `{"name": "industry", "type": "enum", "options": ["it", "retail"], "required": true}`
+	status, body := request(t, token, "POST", srv.URL+"/api/admin/fields", []byte(f))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	var field CustomField
+	unmarshal(t, body, &field)
+
+	status, body = request(t, token, "POST", srv.URL+"/api/admin/fields", []byte(f))
+	if status != 409 {
+		t.Fatalf("duplicate field name was accepted, status %v, body:\n  %s", status, body)
+	}
+
+	status, body = request(t, token, "POST", srv.URL+"/api/admin/fields", []byte(`{"name": "foo", "type": "list"}`))
+	if status != 400 {
+		t.Fatalf("invalid field type was accepted, status %v, body:\n  %s", status, body)
+	}
+
+	for _, test := range []struct {
+		person string
+		status int
+	}{
+		{`{"name": "Custom Person", "custom": {"industry": "it"}}`, 201},
+		{`{"name": "Custom Person"}`, 400},
+		{`{"name": "Custom Person", "custom": {"industry": "banking"}}`, 400},
+		{`{"name": "Custom Person", "custom": {"industry": "it", "foo": 23}}`, 400},
+	} {
+		status, body = request(t, token, "POST", srv.URL+"/api/person", []byte(test.person))
+		if status != test.status {
+			t.Fatalf("creating person %s: want status %v, got %v, body:\n  %s", test.person, test.status, status, body)
+		}
+	}
+
+	url := fmt.Sprintf("%s/api/admin/fields/%d", srv.URL, field.ID)
+	field.Required = false
+
+	status, body = request(t, token, "PUT", url, marshal(t, field))
+	if status != 200 {
+		t.Fatalf("updating field, invalid status %d: %s", status, body)
+	}
+
+	status, body = request(t, token, "POST", srv.URL+"/api/person", []byte(`{"name": "Custom Person"}`))
+	if status != 201 {
+		t.Fatalf("person without optional field was rejected, status %v, body:\n  %s", status, body)
+	}
+
+	status, _ = request(t, token, "DELETE", url, nil)
+	if status != 200 {
+		t.Fatalf("deleting field yielded unexpected status %d", status)
+	}
+
+	status, _ = request(t, token, "GET", url, nil)
+	if status != 404 {
+		t.Fatalf("reading deleted field yielded unexpected status %d", status)
+	}
+
+	token = login(t, srv, "user", "geheim")
+	status, _ = request(t, token, "GET", srv.URL+"/api/admin/fields", nil)
+	if status != 403 {
+		t.Fatalf("non-admin user could list custom fields, status %d", status)
+	}
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"ghenga/db"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/gorilla/mux"
+)
+
+// ListEvents handles listing event records.
+func ListEvents(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	events, err := env.DB.ListEvents()
+	if err != nil {
+		return err
+	}
+
+	return httpWriteJSON(res, http.StatusOK, events)
+}
+
+// ShowEvent returns an Event record.
+func ShowEvent(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	event, err := env.DB.FindEvent(int64(id))
+	if err != nil {
+		return StatusError{
+			Err:  errors.New("event not found"),
+			Code: http.StatusNotFound,
+		}
+	}
+
+	return httpWriteJSON(res, http.StatusOK, event)
+}
+
+// checkEvent validates e and makes sure all participants exist.
+func checkEvent(env *Env, e *db.Event) error {
+	if err := e.Validate(); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	for _, id := range e.People {
+		if _, err := env.DB.FindPerson(id); err != nil {
+			return StatusError{
+				Code: http.StatusBadRequest,
+				Err:  fmt.Errorf("person %d not found", id),
+			}
+		}
+	}
+
+	for _, login := range e.Users {
+		if _, err := env.DB.FindUserName(login); err != nil {
+			return StatusError{
+				Code: http.StatusBadRequest,
+				Err:  fmt.Errorf("user %q not found", login),
+			}
+		}
+	}
+
+	return nil
+}
+
+// CreateEvent inserts a new event into the database. The request body must be valid JSON.
+func CreateEvent(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	var je db.EventJSON
+	dec := json.NewDecoder(req.Body)
+	if err = dec.Decode(&je); err != nil {
+		return err
+	}
+
+	var e db.Event
+	if err = e.Update(je); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	// overwrite fields we'd like to be set
+	e.CreatedAt = time.Now()
+	e.ChangedAt = time.Now()
+	e.Version = 0
+
+	if err = checkEvent(env, &e); err != nil {
+		return err
+	}
+
+	err = env.DB.InsertEvent(&e)
+	if err != nil {
+		return err
+	}
+
+	env.Debugf("created event %v", e)
+
+	return httpWriteJSON(wr, http.StatusCreated, e)
+}
+
+// UpdateEvent changes an existing event record. The request body must be valid JSON.
+func UpdateEvent(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	var newEvent db.EventJSON
+	dec := json.NewDecoder(req.Body)
+	if err = dec.Decode(&newEvent); err != nil {
+		return err
+	}
+
+	e, err := env.DB.FindEvent(int64(id))
+	if err != nil {
+		env.Logf("unable to find event ID %v, error: %v", id, err)
+		return StatusError{
+			Err:  errors.New("event not found"),
+			Code: http.StatusNotFound,
+		}
+	}
+
+	if e.Version != newEvent.Version {
+		env.Debugf("event record is outdated, version %v != %v",
+			e.Version, newEvent.Version)
+		return StatusError{
+			Err:  errors.New("version field does not match"),
+			Code: http.StatusConflict,
+		}
+	}
+
+	if err = e.Update(newEvent); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	e.ChangedAt = time.Now()
+
+	if err = checkEvent(env, e); err != nil {
+		return err
+	}
+
+	err = env.DB.UpdateEvent(e)
+	if err != nil {
+		env.Logf("unable update event %v, sql error: %v", e, err)
+		return err
+	}
+
+	return httpWriteJSON(wr, http.StatusOK, e)
+}
+
+// DeleteEvent removes an event from the database.
+func DeleteEvent(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if err := env.DB.DeleteEvent(int64(id)); err != nil {
+		return err
+	}
+
+	return httpWriteJSON(wr, http.StatusOK, nil)
+}
+
+// CalendarTokenJSON is the structure returned by a request for the calendar
+// feed of a user.
+type CalendarTokenJSON struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// ShowCalendarToken returns the token and path for the calendar feed of the
+// user of the current session.
+func ShowCalendarToken(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	session, ok := db.SessionFromContext(ctx)
+	if !ok {
+		return errors.New("no session found in context")
+	}
+
+	token, err := env.DB.CalendarToken(session.User)
+	if err != nil {
+		return err
+	}
+
+	return httpWriteJSON(res, http.StatusOK, CalendarTokenJSON{
+		Token: token,
+		URL:   fmt.Sprintf("/api/calendar/%s.ics", token),
+	})
+}
+
+// CalendarFeed returns all events a user participates in as an iCalendar
+// object. The user is identified by the calendar token in the path, so that
+// calendar clients can subscribe to the feed without logging in.
+func CalendarFeed(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	login, err := env.DB.FindCalendarUser(mux.Vars(req)["token"])
+	if err != nil {
+		return StatusError{
+			Code: http.StatusNotFound,
+			Err:  errors.New("calendar not found"),
+		}
+	}
+
+	events, err := env.DB.ListUserEvents(login)
+	if err != nil {
+		return err
+	}
+
+	res.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	res.WriteHeader(http.StatusOK)
+
+	return writeICalendar(res, "ghenga ("+login+")", events)
+}
+
+// EventHandler adds routes for ghenga API in the given environment to r.
+func EventHandler(ctx context.Context, env *Env, r *mux.Router) {
+	r.Handle("/api/event", Handle(ctx, env, RequireAuth(ListEvents))).Methods("GET")
+	r.Handle("/api/event", Handle(ctx, env, RequireAuth(CreateEvent))).Methods("POST")
+	r.Handle("/api/event/{id}", Handle(ctx, env, RequireAuth(ShowEvent))).Methods("GET")
+	r.Handle("/api/event/{id}", Handle(ctx, env, RequireAuth(UpdateEvent))).Methods("PUT")
+	r.Handle("/api/event/{id}", Handle(ctx, env, RequireAuth(DeleteEvent))).Methods("DELETE")
+	r.Handle("/api/calendar/token", Handle(ctx, env, RequireAuth(ShowCalendarToken))).Methods("GET")
+	r.Handle("/api/calendar/{token}.ics", Handle(ctx, env, CalendarFeed)).Methods("GET")
+}
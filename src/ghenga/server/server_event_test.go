@@ -0,0 +1,140 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type Event struct {
+	ID      int      `json:"id"`
+	Title   string   `json:"title"`
+	StartAt string   `json:"start_at"`
+	EndAt   string   `json:"end_at"`
+	People  []int    `json:"people"`
+	Users   []string `json:"users"`
+	Version int      `json:"version"`
+}
+
+func TestEventCRUD(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	data := []byte(`{"title": "Project kickoff", "start_at": "2016-04-24T10:30:00+02:00",
+		"end_at": "2016-04-24T12:00:00+02:00", "people": [3, 5], "users": ["user"]}`)
+	status, body := request(t, token, "POST", srv.URL+"/api/event", data)
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	var event Event
+	unmarshal(t, body, &event)
+
+	if event.ID == 0 || len(event.People) != 2 || len(event.Users) != 1 {
+		t.Fatalf("wrong event returned: %+v", event)
+	}
+
+	url := fmt.Sprintf("%s/api/event/%d", srv.URL, event.ID)
+
+	event.Users = append(event.Users, "admin")
+	status, body = request(t, token, "PUT", url, marshal(t, event))
+	if status != 200 {
+		t.Fatalf("updating event, invalid status %d: %s", status, body)
+	}
+
+	status, _ = request(t, token, "PUT", url, marshal(t, event))
+	if status != 409 {
+		t.Fatalf("updating event with outdated version, want status 409, got %d", status)
+	}
+
+	status, body = request(t, token, "GET", url, nil)
+	if status != 200 {
+		t.Fatalf("reading event yielded unexpected status %d: %s", status, body)
+	}
+
+	unmarshal(t, body, &event)
+	if len(event.Users) != 2 {
+		t.Fatalf("participants were not updated: %+v", event)
+	}
+
+	status, _ = request(t, token, "DELETE", url, nil)
+	if status != 200 {
+		t.Fatalf("deleting event yielded unexpected status %d", status)
+	}
+
+	status, _ = request(t, token, "GET", url, nil)
+	if status != 404 {
+		t.Fatalf("reading deleted event yielded unexpected status %d", status)
+	}
+}
+
+var invalidEventTests = []string{
+	`{}`,
+	`{"title": "foo"}`,
+	`{"title": "foo", "start_at": "2016-04-24T10:30:00+02:00", "end_at": "2016-04-24T09:30:00+02:00"}`,
+	`{"title": "foo", "start_at": "2016-04-24T10:30:00+02:00", "end_at": "2016-04-24T11:30:00+02:00", "users": ["nobody"]}`,
+	`{"title": "foo", "start_at": "2016-04-24T10:30:00+02:00", "end_at": "2016-04-24T11:30:00+02:00", "people": [10000]}`,
+}
+
+func TestInvalidEvent(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	for _, test := range invalidEventTests {
+		status, body := request(t, token, "POST", srv.URL+"/api/event", []byte(test))
+		if status != 400 {
+			t.Errorf("status code for invalid event %s not found, want 400, got %v, body:\n  %s", test, status, body)
+		}
+	}
+}
+
+func TestCalendarFeed(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	admin := login(t, srv, "admin", "geheim")
+	user := login(t, srv, "user", "geheim")
+
+	for _, data := range []string{
+		`{"title": "with user", "start_at": "2016-04-24T10:30:00+02:00", "end_at": "2016-04-24T12:00:00+02:00", "users": ["user"]}`,
+		`{"title": "without user", "start_at": "2016-04-24T10:30:00+02:00", "end_at": "2016-04-24T12:00:00+02:00", "users": ["admin"]}`,
+	} {
+		status, body := request(t, admin, "POST", srv.URL+"/api/event", []byte(data))
+		if status != 201 {
+			t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+		}
+	}
+
+	status, body := request(t, user, "GET", srv.URL+"/api/calendar/token", nil)
+	if status != 200 {
+		t.Fatalf("requesting calendar token yielded unexpected status %d: %s", status, body)
+	}
+
+	var ct struct {
+		URL string `json:"url"`
+	}
+	unmarshal(t, body, &ct)
+
+	status, body = request(t, "", "GET", srv.URL+ct.URL, nil)
+	if status != 200 {
+		t.Fatalf("requesting calendar feed yielded unexpected status %d: %s", status, body)
+	}
+
+	feed := string(body)
+	if !strings.Contains(feed, "SUMMARY:with user\r\n") || !strings.Contains(feed, "DTSTART:20160424T083000Z\r\n") {
+		t.Errorf("event not found in calendar feed:\n%s", feed)
+	}
+
+	if strings.Contains(feed, "without user") {
+		t.Errorf("calendar feed contains event the user does not participate in:\n%s", feed)
+	}
+
+	status, _ = request(t, "", "GET", srv.URL+"/api/calendar/invalid.ics", nil)
+	if status != 404 {
+		t.Fatalf("requesting calendar feed with invalid token yielded unexpected status %d", status)
+	}
+}
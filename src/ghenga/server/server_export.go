@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"ghenga/db"
+	"ghenga/xlsx"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+)
+
+// exportContentTypes maps the export formats to the content type of the
+// response.
+var exportContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"xlsx": xlsx.ContentType,
+}
+
+// exportIterator returns the people to export for the request. If the
+// parameter `query` is set, the people matching the search are returned (see
+// SearchPerson). Otherwise the list of people is returned, filtered and
+// sorted like in ListPeople, but the whole list unless `limit` is set.
+func exportIterator(env *Env, req *http.Request) (db.PeopleIterator, error) {
+	filter, err := tagFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if s := req.URL.Query().Get("query"); s != "" {
+		mode, err := searchMode(req)
+		if err != nil {
+			return nil, err
+		}
+
+		people, err := searchPeople(env, s, mode, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		return db.IterateSlice(people), nil
+	}
+
+	opts, err := listOptions(req, "tag", "tag_match", "format", "mode", "query")
+	if err != nil {
+		return nil, err
+	}
+
+	if req.URL.Query().Get("limit") == "" {
+		opts.Limit = 0
+	}
+
+	it, err := env.DB.IteratePeople(filter, opts)
+	if err != nil {
+		return nil, listError(err)
+	}
+
+	return it, nil
+}
+
+// ExportPeople exports people as a table in the format selected by the
+// parameter `format` (`csv` or `xlsx`, the default is `csv`), see
+// db.ExportPeople and exportIterator. The file is streamed to the client,
+// errors which occur after the response was started are only logged, the
+// response is cut off then.
+func ExportPeople(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		return StatusError{
+			Code: http.StatusBadRequest,
+			Err:  fmt.Errorf("invalid format %q", format),
+		}
+	}
+
+	fields, err := env.DB.ListCustomFields()
+	if err != nil {
+		return err
+	}
+
+	it, err := exportIterator(env, req)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := it.Close(); err != nil {
+			env.Logf("error closing people iterator: %v", err)
+		}
+	}()
+
+	res.Header().Set("Content-Type", contentType)
+	res.Header().Set("Content-Disposition", `attachment; filename="people.`+format+`"`)
+	res.WriteHeader(http.StatusOK)
+
+	n, err := db.ExportPeople(res, format, it, fields)
+	if err != nil {
+		env.Logf("error exporting people: %v", err)
+		return nil
+	}
+
+	env.Debugf("exported %d people as %v", n, format)
+	return nil
+}
+
+// ExportHandler adds routes for the ghenga API in the given environment to r.
+func ExportHandler(ctx context.Context, env *Env, r *mux.Router) {
+	r.Handle("/api/export/person", Handle(ctx, env, RequireAuth(ExportPeople))).Methods("GET")
+}
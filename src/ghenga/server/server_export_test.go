@@ -0,0 +1,128 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func exportCSV(t *testing.T, token, url string) [][]string {
+	status, header, body := requestHeader(t, token, "GET", url, nil, "")
+	if status != 200 {
+		t.Fatalf("export failed with status %d: %s", status, body)
+	}
+
+	if ct := header.Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("wrong content type %q", ct)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV file: %v", err)
+	}
+
+	if len(records) == 0 || records[0][0] != "id" || records[0][1] != "name" {
+		t.Fatalf("CSV file has wrong header: %q", records)
+	}
+
+	return records[1:]
+}
+
+func TestExportPeople(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "user", "geheim")
+
+	for _, u := range []string{"/api/export/person", "/api/export/person?query="} {
+		rows := exportCSV(t, token, srv.URL+u)
+		if len(rows) != 50 {
+			t.Errorf("export %v returned %d people, want 50", u, len(rows))
+		}
+	}
+
+	rows := exportCSV(t, token, srv.URL+"/api/export/person?format=csv&sort=-id&limit=5")
+	if len(rows) != 5 {
+		t.Fatalf("export returned %d people, want 5", len(rows))
+	}
+
+	for i := 1; i < len(rows); i++ {
+		a, _ := strconv.Atoi(rows[i-1][0])
+		b, _ := strconv.Atoi(rows[i][0])
+		if a <= b {
+			t.Errorf("export is not sorted by ID: %v, %v", a, b)
+		}
+	}
+
+	name := rows[0][1]
+
+	for _, params := range []url.Values{
+		{"name": {name}},
+		{"query": {`name:"` + name + `"`}},
+	} {
+		rows = exportCSV(t, token, srv.URL+"/api/export/person?"+params.Encode())
+		if len(rows) == 0 {
+			t.Errorf("export with %v returned no people", params)
+		}
+
+		for _, row := range rows {
+			if row[1] != name {
+				t.Errorf("export with %v returned wrong person %q", params, row)
+			}
+		}
+	}
+
+	status, header, body := requestHeader(t, token, "GET", srv.URL+"/api/export/person?format=xlsx", nil, "")
+	if status != 200 || header.Get("Content-Type") != "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet" {
+		t.Fatalf("XLSX export returned status %d, content type %q", status, header.Get("Content-Type"))
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("XLSX file is not a zip archive: %v", err)
+	}
+
+	for _, f := range zr.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+
+		rd, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sheet, err := ioutil.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n := bytes.Count(sheet, []byte("<row ")); n != 51 {
+			t.Errorf("XLSX file contains %d rows, want 51", n)
+		}
+	}
+}
+
+func TestExportPeopleInvalid(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "user", "geheim")
+
+	for _, params := range []string{"format=pdf", "sort=foo", "query=name:", "tag_match=some"} {
+		status, body := request(t, token, "GET", srv.URL+"/api/export/person?"+params, nil)
+		if status != 400 {
+			t.Errorf("export with %v returned status %d, want 400: %s", params, status, body)
+		}
+	}
+
+	status, _ := request(t, "", "GET", srv.URL+"/api/export/person", nil)
+	if status != 401 {
+		t.Errorf("export without authentication returned status %d", status)
+	}
+}
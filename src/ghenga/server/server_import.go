@@ -0,0 +1,92 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"ghenga/db"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+)
+
+// maxImportSize is the maximal size of a file to import in bytes.
+const maxImportSize = 32 << 20
+
+// csvImportOptions returns the options for importing a CSV file passed in the
+// parameters of the request: `map` (several times, `column=field`),
+// `separator` (a single character) and `dry_run`.
+func csvImportOptions(req *http.Request) (db.CSVImportOptions, error) {
+	values := req.URL.Query()
+	badRequest := func(err error) error {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	mapping, err := db.ParseCSVMapping(values["map"])
+	if err != nil {
+		return db.CSVImportOptions{}, badRequest(err)
+	}
+
+	opts := db.CSVImportOptions{Mapping: mapping}
+
+	if s := values.Get("separator"); s != "" {
+		if utf8.RuneCountInString(s) != 1 {
+			return opts, badRequest(fmt.Errorf("invalid separator %q", s))
+		}
+
+		opts.Separator, _ = utf8.DecodeRuneInString(s)
+	}
+
+	if s := values.Get("dry_run"); s != "" {
+		opts.DryRun, err = strconv.ParseBool(s)
+		if err != nil {
+			return opts, badRequest(fmt.Errorf("invalid value %q for dry_run", s))
+		}
+	}
+
+	return opts, nil
+}
+
+// ImportCSV creates people from the rows of the CSV file in the body of the
+// request, see db.ImportPeopleCSV. The result lists the rows which are not
+// valid. In a dry run, the rows are only checked.
+func ImportCSV(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	opts, err := csvImportOptions(req)
+	if err != nil {
+		return err
+	}
+
+	rd := http.MaxBytesReader(wr, req.Body, maxImportSize)
+
+	res, err := db.ImportPeopleCSV(env.DB, rd, opts)
+	if e, ok := err.(db.CSVError); ok {
+		return StatusError{Code: http.StatusBadRequest, Err: e}
+	}
+
+	// http.MaxBytesReader does not return a distinct error type in older Go
+	// versions
+	if err != nil && err.Error() == "http: request body too large" {
+		return StatusError{
+			Code: http.StatusRequestEntityTooLarge,
+			Err:  errors.New("file is too large"),
+		}
+	}
+
+	if err != nil {
+		env.Logf("importing CSV file failed: %v", err)
+		return err
+	}
+
+	env.Debugf("imported %d of %d rows from CSV file (dry run %v)", res.Imported, res.Rows, res.DryRun)
+
+	return httpWriteJSON(wr, http.StatusOK, res)
+}
+
+// ImportHandler adds routes for the ghenga API in the given environment to r.
+func ImportHandler(ctx context.Context, env *Env, r *mux.Router) {
+	r.Handle("/api/import/csv", Handle(ctx, env, RequireAuth(ImportCSV))).Methods("POST")
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"fmt"
+	"ghenga/db"
+	"net/url"
+	"testing"
+)
+
+type ImportResult struct {
+	Rows     int  `json:"rows"`
+	Valid    int  `json:"valid"`
+	Imported int  `json:"imported"`
+	DryRun   bool `json:"dry_run"`
+	Errors   []struct {
+		Line    int    `json:"line"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+const testImportCSV = `Vorname;Nachname;Telefon;Straße;Hausnummer;PLZ;Ort
+Max;Importmann;0221 123456;Domstraße;1;50667;Köln
+;;;;;;
+Erika;Importfrau;;;;;Berlin
+`
+
+func TestImportCSV(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "user", "geheim")
+
+	params := url.Values{
+		"separator": {";"},
+		"map": {
+			"Vorname=name", "Nachname=name", "Telefon=phone:work",
+			"Straße=street", "Hausnummer=street", "PLZ=postal_code", "Ort=city",
+		},
+	}
+
+	for _, dryRun := range []string{"true", "false"} {
+		params.Set("dry_run", dryRun)
+
+		status, body := request(t, token, "POST", srv.URL+"/api/import/csv?"+params.Encode(), []byte(testImportCSV))
+		if status != 200 {
+			t.Fatalf("import failed with status %d: %s", status, body)
+		}
+
+		var res ImportResult
+		unmarshal(t, body, &res)
+
+		if res.Rows != 3 || res.Valid != 2 || len(res.Errors) != 1 || res.Errors[0].Line != 3 {
+			t.Errorf("dry run %v: wrong result %s", dryRun, body)
+		}
+
+		imported := 2
+		if dryRun == "true" {
+			imported = 0
+		}
+
+		if res.Imported != imported {
+			t.Errorf("dry run %v: wrong number of imported rows, want %d, got %d", dryRun, imported, res.Imported)
+		}
+
+		list := findPeopleByName(t, token, srv.URL, "Max%20Importmann")
+		if len(list) != imported/2 {
+			t.Fatalf("dry run %v: found %d imported people", dryRun, len(list))
+		}
+	}
+
+	list := findPeopleByName(t, token, srv.URL, "Max%20Importmann")
+	status, body := request(t, token, "GET", fmt.Sprintf("%s/api/person/%d", srv.URL, list[0].ID), nil)
+	if status != 200 {
+		t.Fatalf("reading imported person failed with status %d", status)
+	}
+
+	var p db.Person
+	unmarshal(t, body, &p)
+
+	if p.Street != "Domstraße 1" || p.PostalCode != "50667" || p.City != "Köln" {
+		t.Errorf("imported person has wrong address: %+v", p)
+	}
+
+	if len(p.PhoneNumbers) != 1 || p.PhoneNumbers[0].Type != "work" {
+		t.Errorf("imported person has wrong phone numbers: %+v", p.PhoneNumbers)
+	}
+}
+
+var invalidImportTests = []struct {
+	params string
+	csv    string
+	status int
+}{
+	{"", "", 400},
+	{"", "foo,bar\n1,2\n", 400},
+	{"map=foo", "name\nx\n", 400},
+	{"map=name%3Dnickname", "name\nx\n", 400},
+	{"map=Name%3Dname", "name\nx\n", 400},
+	{"separator=ab", "name\nx\n", 400},
+	{"dry_run=maybe", "name\nx\n", 400},
+	{"", "name\n\"x\n", 400},
+}
+
+func TestImportCSVInvalid(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "user", "geheim")
+
+	for i, test := range invalidImportTests {
+		status, body := request(t, token, "POST", srv.URL+"/api/import/csv?"+test.params, []byte(test.csv))
+		if status != test.status {
+			t.Errorf("test %d: wrong status, want %d, got %d: %s", i, test.status, status, body)
+		}
+	}
+
+	status, _ := request(t, "", "POST", srv.URL+"/api/import/csv", []byte("name\nx\n"))
+	if status != 401 {
+		t.Errorf("import without authentication returned status %d", status)
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"errors"
+	"ghenga/db"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+)
+
+// LookupPhone returns the people having the phone number passed in the
+// parameter `number`, together with the type of the number. The formatting
+// of the number is ignored, so that e.g. a PBX can show who is calling.
+func LookupPhone(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	number := req.URL.Query().Get("number")
+	if !strings.ContainsAny(number, "0123456789") {
+		return StatusError{
+			Code: http.StatusBadRequest,
+			Err:  errors.New("invalid phone number"),
+		}
+	}
+
+	env.Debugf("looking up phone number %v", number)
+
+	result, err := env.DB.LookupPhoneNumber(number)
+	if err != nil {
+		return err
+	}
+
+	if result == nil {
+		result = []*db.PhoneLookupResult{}
+	}
+
+	return httpWriteJSON(res, http.StatusOK, result)
+}
+
+// LookupHandler adds routes to the for ghenga API in the given environment to r.
+func LookupHandler(ctx context.Context, env *Env, r *mux.Router) {
+	r.Handle("/api/lookup/phone", Handle(ctx, env, RequireAuth(LookupPhone))).Methods("GET")
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestLookupPhone(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "user", "geheim")
+
+	status, body := request(t, token, "POST", srv.URL+"/api/person", readFixture(t, "sample_person.json"))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	person := verifyPerson(t, "Nicolai Person", body)
+
+	for _, number := range []string{"+49 157 123123125", "0157-123123125", "0049157123123125"} {
+		status, body = request(t, token, "GET", srv.URL+"/api/lookup/phone?number="+url.QueryEscape(number), nil)
+		if status != 200 {
+			t.Fatalf("lookup yielded unexpected status %d: %s", status, body)
+		}
+
+		var result []struct {
+			Person Person `json:"person"`
+			Type   string `json:"type"`
+			Number string `json:"number"`
+		}
+		unmarshal(t, body, &result)
+
+		if len(result) != 1 || result[0].Person.ID != person.ID || result[0].Type != "fax" || result[0].Number != "+49 157 123123125" {
+			t.Errorf("lookup of %q returned wrong result: %v", number, result)
+		}
+	}
+
+	status, body = request(t, token, "GET", srv.URL+"/api/lookup/phone?number=0999999", nil)
+	if status != 200 {
+		t.Fatalf("lookup yielded unexpected status %d: %s", status, body)
+	}
+
+	var result []interface{}
+	unmarshal(t, body, &result)
+	if result == nil || len(result) != 0 {
+		t.Errorf("lookup of unknown number returned wrong result: %s", body)
+	}
+
+	status, body = request(t, token, "GET", srv.URL+"/api/lookup/phone?number=", nil)
+	if status != 400 {
+		t.Errorf("lookup of empty number yielded unexpected status %d: %s", status, body)
+	}
+}
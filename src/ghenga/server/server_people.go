@@ -1,8 +1,10 @@
 package server
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"ghenga/db"
 	"net/http"
 	"strconv"
@@ -13,14 +15,90 @@ import (
 	"github.com/gorilla/mux"
 )
 
-// ListPeople handles listing person records.
+// ListPeople handles listing person records. The list can be filtered by tags,
+// see tagFilter, and is returned in pages, see listOptions. The whole list is
+// streamed to the client when the parameter `limit` is set to `all`, or when
+// NDJSON is requested without a limit, see streamPeople. A page can also be
+// requested as NDJSON.
 func ListPeople(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
-	people, err := env.DB.ListPeople()
+	filter, err := tagFilter(req)
 	if err != nil {
 		return err
 	}
 
-	return httpWriteJSON(res, http.StatusOK, people)
+	opts, err := listOptions(req, "tag", "tag_match")
+	if err != nil {
+		return err
+	}
+
+	ndjson := acceptsNDJSON(req)
+	if ndjson && req.URL.Query().Get("limit") == "" {
+		opts.Limit = 0
+	}
+
+	if opts.Limit == 0 {
+		return streamPeople(env, res, filter, opts, ndjson)
+	}
+
+	people, next, err := env.DB.ListPeople(filter, opts)
+	if err != nil {
+		return listError(err)
+	}
+
+	setNextPage(res, req, next)
+
+	tags := make([]string, 0, len(people))
+	for _, p := range people {
+		tags = append(tags, entityTag(p.ID, p.Version))
+	}
+
+	if notModified(res, req, listTag(tags, next)) {
+		return nil
+	}
+
+	if !ndjson {
+		return httpWriteJSON(res, http.StatusOK, people)
+	}
+
+	s := newJSONStream(res, true)
+	for _, p := range people {
+		if err = s.Encode(p); err != nil {
+			return err
+		}
+	}
+
+	return s.Close()
+}
+
+// streamPeople writes the people to the client while they are read from the
+// database, as a JSON array or as NDJSON. Errors which occur after the first
+// person was sent are only logged, the response is cut off then.
+func streamPeople(env *Env, res http.ResponseWriter, filter db.TagFilter, opts db.ListOptions, ndjson bool) error {
+	it, err := env.DB.IteratePeople(filter, opts)
+	if err != nil {
+		return listError(err)
+	}
+
+	defer func() {
+		if err := it.Close(); err != nil {
+			env.Logf("error closing people iterator: %v", err)
+		}
+	}()
+
+	s := newJSONStream(res, ndjson)
+	for it.Next() {
+		if err = s.Encode(it.Person()); err != nil {
+			env.Logf("error streaming people: %v", err)
+			return nil
+		}
+	}
+
+	if err = it.Err(); err != nil {
+		env.Logf("error reading people: %v", err)
+		return nil
+	}
+
+	return s.Close()
 }
 
 // ShowPerson returns a Person record.
@@ -38,6 +116,10 @@ func ShowPerson(ctx context.Context, env *Env, res http.ResponseWriter, req *htt
 		}
 	}
 
+	if notModified(res, req, entityTag(person.ID, person.Version)) {
+		return nil
+	}
+
 	return httpWriteJSON(res, http.StatusOK, person)
 }
 
@@ -51,24 +133,19 @@ func CreatePerson(ctx context.Context, env *Env, wr http.ResponseWriter, req *ht
 		return err
 	}
 
-	var p db.Person
-	p.Update(jp)
-
-	// overwrite fields we'd like to be set
-	p.CreatedAt = time.Now()
-	p.ChangedAt = time.Now()
-
-	if err = p.Validate(); err != nil {
-		return StatusError{Code: http.StatusBadRequest, Err: err}
+	p, err := personFromJSON(env, jp)
+	if err != nil {
+		return err
 	}
 
-	err = env.DB.InsertPerson(&p)
+	err = env.DB.InsertPerson(p)
 	if err != nil {
 		return err
 	}
 
 	env.Debugf("created person %v", p)
 
+	wr.Header().Set("ETag", entityTag(p.ID, p.Version))
 	return httpWriteJSON(wr, http.StatusCreated, p)
 }
 
@@ -93,6 +170,67 @@ func UpdatePerson(ctx context.Context, env *Env, wr http.ResponseWriter, req *ht
 		return err
 	}
 
+	matched, err := checkIfMatch(req, entityTag(p.ID, p.Version))
+	if err != nil {
+		return err
+	}
+
+	// the version in the body may be omitted when it was checked with If-Match
+	if matched && newPerson.Version == 0 {
+		newPerson.Version = p.Version
+	}
+
+	return savePerson(env, wr, p, newPerson)
+}
+
+// PatchPerson changes a person record with a merge patch or a JSON Patch (see
+// patchJSON), fields not mentioned in the patch are left unchanged.
+func PatchPerson(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	p, err := env.DB.FindPerson(int64(id))
+	if err != nil {
+		env.Logf("unable to find person ID %v, error: %v", id, err)
+		return err
+	}
+
+	matched, err := checkIfMatch(req, entityTag(p.ID, p.Version))
+	if err != nil {
+		return err
+	}
+
+	var newPerson db.PersonJSON
+	if err = patchJSON(req, p, &newPerson, matched); err != nil {
+		return err
+	}
+
+	return savePerson(env, wr, p, newPerson)
+}
+
+// personFromJSON returns a new person from the JSON document and checks it.
+func personFromJSON(env *Env, jp db.PersonJSON) (*db.Person, error) {
+	var p db.Person
+	p.Update(jp)
+
+	// overwrite fields we'd like to be set
+	p.CreatedAt = time.Now()
+	p.ChangedAt = time.Now()
+
+	if err := validatePerson(env, &p); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// updatePersonFromJSON updates p with newPerson after checking the version,
+// and checks the result.
+func updatePersonFromJSON(env *Env, p *db.Person, newPerson db.PersonJSON) error {
 	if p.Version != newPerson.Version {
 		env.Debugf("person record is outdated, version %v != %v",
 			p.Version, newPerson.Version)
@@ -107,19 +245,123 @@ func UpdatePerson(ctx context.Context, env *Env, wr http.ResponseWriter, req *ht
 
 	p.ChangedAt = time.Now()
 
-	if err = p.Validate(); err != nil {
+	return validatePerson(env, p)
+}
+
+// validatePerson validates p and checks that the account and the tags of p
+// exist.
+func validatePerson(env *Env, p *db.Person) error {
+	fields, err := env.DB.ListCustomFields()
+	if err != nil {
+		return err
+	}
+
+	if err = p.Validate(fields); err != nil {
 		return StatusError{Code: http.StatusBadRequest, Err: err}
 	}
 
+	if err = checkAccount(env, p.AccountID); err != nil {
+		return err
+	}
+
+	return checkTags(env, p.Tags)
+}
+
+// savePerson updates p with newPerson after checking the version, validates
+// and saves the result and writes it to the client.
+func savePerson(env *Env, wr http.ResponseWriter, p *db.Person, newPerson db.PersonJSON) error {
+	err := updatePersonFromJSON(env, p, newPerson)
+	if err != nil {
+		return err
+	}
+
 	err = env.DB.UpdatePerson(p)
+	if err == db.ErrVersionConflict {
+		env.Debugf("person %v has been modified concurrently", p)
+		return StatusError{
+			Err:  errors.New("version field does not match"),
+			Code: http.StatusConflict,
+		}
+	}
+
 	if err != nil {
 		env.Logf("unable update person %v, sql error: %v", p, err)
 		return err
 	}
 
+	wr.Header().Set("ETag", entityTag(p.ID, p.Version))
 	return httpWriteJSON(wr, http.StatusOK, p)
 }
 
+// tagFilter returns the tag filter specified in the request. Tags are passed
+// in (possibly several) `tag` parameters, the parameter `tag_match` selects
+// whether people must have all tags (`all`, the default) or at least one of
+// them (`any`).
+func tagFilter(req *http.Request) (db.TagFilter, error) {
+	values := req.URL.Query()
+	filter := db.TagFilter{Tags: values["tag"]}
+
+	switch values.Get("tag_match") {
+	case "", "all":
+		filter.MatchAll = true
+	case "any":
+		filter.MatchAll = false
+	default:
+		return filter, StatusError{
+			Code: http.StatusBadRequest,
+			Err:  fmt.Errorf("invalid value %q for tag_match", values.Get("tag_match")),
+		}
+	}
+
+	return filter, nil
+}
+
+// checkTags returns an error if one of the tags does not exist.
+func checkTags(env *Env, tags []string) error {
+	for _, tag := range tags {
+		if _, err := env.DB.FindTagName(tag); err != nil {
+			return StatusError{
+				Code: http.StatusBadRequest,
+				Err:  fmt.Errorf("tag %q not found", tag),
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkAccount returns an error if the referenced account does not exist.
+func checkAccount(env *Env, id sql.NullInt64) error {
+	if !id.Valid {
+		return nil
+	}
+
+	if _, err := env.DB.FindAccount(id.Int64); err != nil {
+		return StatusError{
+			Code: http.StatusBadRequest,
+			Err:  errors.New("account not found"),
+		}
+	}
+
+	return nil
+}
+
+// checkPerson returns an error if the referenced person does not exist.
+func checkPerson(env *Env, id sql.NullInt64) error {
+	if !id.Valid {
+		return nil
+	}
+
+	if _, err := env.DB.FindPerson(id.Int64); err != nil {
+		return StatusError{
+			Code: http.StatusBadRequest,
+			Err:  errors.New("person not found"),
+		}
+	}
+
+	return nil
+}
+
 // DeletePerson removes a person from the database.
 func DeletePerson(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
 	id, err := strconv.Atoi(mux.Vars(req)["id"])
@@ -127,6 +369,10 @@ func DeletePerson(ctx context.Context, env *Env, wr http.ResponseWriter, req *ht
 		return StatusError{Code: http.StatusBadRequest, Err: err}
 	}
 
+	if req.Header.Get("If-Match") != "" {
+		return deletePersonIfMatch(env, wr, req, int64(id))
+	}
+
 	if err := env.DB.DeletePerson(int64(id)); err != nil {
 		return err
 	}
@@ -134,11 +380,43 @@ func DeletePerson(ctx context.Context, env *Env, wr http.ResponseWriter, req *ht
 	return httpWriteJSON(wr, http.StatusOK, nil)
 }
 
+// deletePersonIfMatch removes the person if the header `If-Match` matches the
+// current version. The version is checked again while deleting, so a
+// concurrent modification is not lost.
+func deletePersonIfMatch(env *Env, wr http.ResponseWriter, req *http.Request, id int64) error {
+	p, err := env.DB.FindPerson(id)
+	if err != nil {
+		return StatusError{
+			Err:  errors.New("person not found"),
+			Code: http.StatusNotFound,
+		}
+	}
+
+	if _, err = checkIfMatch(req, entityTag(p.ID, p.Version)); err != nil {
+		return err
+	}
+
+	err = env.DB.DeletePersonVersion(p.ID, p.Version)
+	if err == db.ErrVersionConflict {
+		return StatusError{
+			Code: http.StatusPreconditionFailed,
+			Err:  errors.New("entity has been modified"),
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return httpWriteJSON(wr, http.StatusOK, nil)
+}
+
 // PeopleHandler adds routes for ghenga API in the given environment to r.
 func PeopleHandler(ctx context.Context, env *Env, r *mux.Router) {
 	r.Handle("/api/person", Handle(ctx, env, RequireAuth(ListPeople))).Methods("GET")
 	r.Handle("/api/person", Handle(ctx, env, RequireAuth(CreatePerson))).Methods("POST")
 	r.Handle("/api/person/{id}", Handle(ctx, env, RequireAuth(ShowPerson))).Methods("GET")
 	r.Handle("/api/person/{id}", Handle(ctx, env, RequireAuth(UpdatePerson))).Methods("PUT")
+	r.Handle("/api/person/{id}", Handle(ctx, env, RequireAuth(PatchPerson))).Methods("PATCH")
 	r.Handle("/api/person/{id}", Handle(ctx, env, RequireAuth(DeletePerson))).Methods("DELETE")
 }
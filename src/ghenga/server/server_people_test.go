@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"ghenga/db"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -157,6 +159,261 @@ func TestPersonCRUD(t *testing.T) {
 	deletePerson(t, token, srv.URL, person.ID)
 }
 
+func requestHeader(t *testing.T, token, method, url string, header map[string]string, body string) (int, http.Header, []byte) {
+	var rd io.Reader
+	if body != "" {
+		rd = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, url, rd)
+	if err != nil {
+		t.Fatalf("NewRequest() %v", err)
+	}
+
+	req.Header.Add(authHeaderName, token)
+	for name, value := range header {
+		req.Header.Add(name, value)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%v request to %v failed: %v", method, url, err)
+	}
+
+	status, data := readBody(t, res)
+	return status, res.Header, data
+}
+
+func patchRequest(t *testing.T, token, url, contentType, patch string) (int, []byte) {
+	status, _, body := requestHeader(t, token, "PATCH", url, map[string]string{"Content-Type": contentType}, patch)
+	return status, body
+}
+
+func TestPersonPatch(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	status, body := request(t, token, "POST", srv.URL+"/api/person", readFixture(t, "sample_person.json"))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	person := verifyPerson(t, "Nicolai Person", body)
+	url := fmt.Sprintf("%s/api/person/%d", srv.URL, person.ID)
+
+	type patchedPerson struct {
+		Name         string `json:"name"`
+		Title        string `json:"title"`
+		PhoneNumbers []struct {
+			Number string `json:"number"`
+		} `json:"phone_numbers"`
+		Address struct {
+			City   string `json:"city"`
+			Street string `json:"street"`
+		} `json:"address"`
+		Version int `json:"version"`
+	}
+
+	patch := fmt.Sprintf(`{"version": %d, "title": null, "address": {"city": "Bonn"}, "phone_numbers": [{"type": "work", "number": "+49 228 123"}]}`, person.Version)
+	status, body = patchRequest(t, token, url, "application/merge-patch+json", patch)
+	if status != 200 {
+		t.Fatalf("merge patch returned invalid status %d: %s", status, body)
+	}
+
+	var p patchedPerson
+	unmarshal(t, body, &p)
+
+	if p.Name != "Nicolai Person" || p.Title != "" || p.Address.City != "Bonn" ||
+		p.Address.Street != "Teststraße 23" || len(p.PhoneNumbers) != 1 || p.PhoneNumbers[0].Number != "+49 228 123" {
+		t.Fatalf("merge patch was not applied correctly: %s", body)
+	}
+
+	patch = fmt.Sprintf(`[{"op": "test", "path": "/version", "value": %d}, {"op": "replace", "path": "/name", "value": "Robert Niemand"}]`, p.Version)
+	status, body = patchRequest(t, token, url, "application/json-patch+json", patch)
+	if status != 200 {
+		t.Fatalf("JSON patch returned invalid status %d: %s", status, body)
+	}
+
+	unmarshal(t, body, &p)
+	if p.Name != "Robert Niemand" || p.Address.City != "Bonn" {
+		t.Fatalf("JSON patch was not applied correctly: %s", body)
+	}
+
+	for _, test := range []struct {
+		contentType, patch string
+		status             int
+	}{
+		{"application/merge-patch+json", `{"version": 1, "name": "Foo"}`, 409},
+		{"application/json-patch+json", `[{"op": "test", "path": "/version", "value": 1}]`, 409},
+		{"application/merge-patch+json", `{"name": "Foo"}`, 400},
+		{"application/merge-patch+json", fmt.Sprintf(`{"version": %d, "name": null}`, p.Version), 400},
+		{"application/merge-patch+json", fmt.Sprintf(`{"version": %d, "custom": {"foo": 1}}`, p.Version), 400},
+		{"application/json-patch+json", fmt.Sprintf(`[{"op": "test", "path": "/version", "value": %d}, {"op": "remove", "path": "/foo"}]`, p.Version), 400},
+		{"text/plain", fmt.Sprintf(`{"version": %d, "name": "Foo"}`, p.Version), 415},
+	} {
+		status, body = patchRequest(t, token, url, test.contentType, test.patch)
+		if status != test.status {
+			t.Errorf("patch %s returned wrong status, want %d, got %d: %s", test.patch, test.status, status, body)
+		}
+	}
+
+	status, body = request(t, token, "GET", url, nil)
+	if status != 200 {
+		t.Fatalf("reading person again yielded unexpected status %d", status)
+	}
+
+	verifyPerson(t, "Robert Niemand", body)
+	deletePerson(t, token, srv.URL, person.ID)
+}
+
+func TestPersonETag(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	status, body := request(t, token, "POST", srv.URL+"/api/person", readFixture(t, "sample_person.json"))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	person := verifyPerson(t, "Nicolai Person", body)
+	url := fmt.Sprintf("%s/api/person/%d", srv.URL, person.ID)
+	etag := fmt.Sprintf(`"%d-%d"`, person.ID, person.Version)
+
+	status, header, body := requestHeader(t, token, "GET", url, nil, "")
+	if status != 200 || header.Get("ETag") != etag {
+		t.Fatalf("GET returned status %d and ETag %q, want 200 and %q", status, header.Get("ETag"), etag)
+	}
+
+	status, _, body = requestHeader(t, token, "GET", url, map[string]string{"If-None-Match": etag}, "")
+	if status != 304 || len(body) != 0 {
+		t.Fatalf("GET with matching If-None-Match returned status %d, want 304: %s", status, body)
+	}
+
+	status, _, body = requestHeader(t, token, "GET", url, map[string]string{"If-None-Match": `"0-0"`}, "")
+	if status != 200 {
+		t.Fatalf("GET with other If-None-Match returned status %d, want 200: %s", status, body)
+	}
+
+	status, header, _ = requestHeader(t, token, "GET", srv.URL+"/api/person?limit=10&sort=-id", nil, "")
+	listETag := header.Get("ETag")
+	if status != 200 || !strings.HasPrefix(listETag, `W/"`) {
+		t.Fatalf("list returned status %d and ETag %q", status, listETag)
+	}
+
+	status, _, _ = requestHeader(t, token, "GET", srv.URL+"/api/person?limit=10&sort=-id", map[string]string{"If-None-Match": listETag}, "")
+	if status != 304 {
+		t.Fatalf("list with matching If-None-Match returned status %d, want 304", status)
+	}
+
+	// the version in the body can be omitted when If-Match is given
+	status, _, body = requestHeader(t, token, "PUT", url, map[string]string{"If-Match": `"0-0"`}, `{"name": "Robert Niemand"}`)
+	if status != 412 {
+		t.Fatalf("PUT with wrong If-Match returned status %d, want 412: %s", status, body)
+	}
+
+	status, header, body = requestHeader(t, token, "PUT", url, map[string]string{"If-Match": etag}, `{"name": "Robert Niemand"}`)
+	if status != 200 {
+		t.Fatalf("PUT with If-Match returned status %d, want 200: %s", status, body)
+	}
+
+	person = verifyPerson(t, "Robert Niemand", body)
+	if newETag := fmt.Sprintf(`"%d-%d"`, person.ID, person.Version); header.Get("ETag") != newETag || newETag == etag {
+		t.Fatalf("PUT returned wrong ETag %q, want %q", header.Get("ETag"), newETag)
+	}
+
+	status, _, body = requestHeader(t, token, "PATCH", url, map[string]string{"If-Match": etag, "Content-Type": "application/merge-patch+json"}, `{"title": "CTO"}`)
+	if status != 412 {
+		t.Fatalf("PATCH with outdated If-Match returned status %d, want 412: %s", status, body)
+	}
+
+	etag = fmt.Sprintf(`"%d-%d"`, person.ID, person.Version)
+	status, _, body = requestHeader(t, token, "PATCH", url, map[string]string{"If-Match": etag, "Content-Type": "application/merge-patch+json"}, `{"title": "CTO"}`)
+	if status != 200 {
+		t.Fatalf("PATCH with If-Match returned status %d, want 200: %s", status, body)
+	}
+
+	person = verifyPerson(t, "Robert Niemand", body)
+
+	status, _, body = requestHeader(t, token, "GET", srv.URL+"/api/person?limit=10&sort=-id", map[string]string{"If-None-Match": listETag}, "")
+	if status != 200 {
+		t.Fatalf("list with outdated If-None-Match returned status %d, want 200: %s", status, body)
+	}
+
+	status, _, body = requestHeader(t, token, "DELETE", url, map[string]string{"If-Match": etag}, "")
+	if status != 412 {
+		t.Fatalf("DELETE with outdated If-Match returned status %d, want 412: %s", status, body)
+	}
+
+	etag = fmt.Sprintf(`"%d-%d"`, person.ID, person.Version)
+	status, _, body = requestHeader(t, token, "DELETE", url, map[string]string{"If-Match": etag}, "")
+	if status != 200 {
+		t.Fatalf("DELETE with If-Match returned status %d, want 200: %s", status, body)
+	}
+}
+
+// concurrentDB modifies people right before they are updated, like a
+// concurrent request would.
+type concurrentDB struct {
+	db.DB
+}
+
+func (d concurrentDB) UpdatePerson(p *db.Person) error {
+	other, err := d.DB.FindPerson(p.ID)
+	if err != nil {
+		return err
+	}
+
+	other.Comment = "concurrent update"
+	if err = d.DB.UpdatePerson(other); err != nil {
+		return err
+	}
+
+	return d.DB.UpdatePerson(p)
+}
+
+func TestPersonConcurrentUpdate(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	status, body := request(t, token, "POST", srv.URL+"/api/person", readFixture(t, "sample_person.json"))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	person := verifyPerson(t, "Nicolai Person", body)
+	url := fmt.Sprintf("%s/api/person/%d", srv.URL, person.ID)
+
+	srv.Env.DB = concurrentDB{srv.Env.DB}
+
+	person.Name = "Robert Niemand"
+	status, body = request(t, token, "PUT", url, marshal(t, person))
+	if status != 409 {
+		t.Fatalf("concurrent update returned wrong status, want 409, got %d: %s", status, body)
+	}
+
+	status, body = request(t, token, "GET", url, nil)
+	if status != 200 {
+		t.Fatalf("reading person again yielded unexpected status %d", status)
+	}
+
+	var p struct {
+		Comment string `json:"comment"`
+	}
+	unmarshal(t, body, &p)
+
+	if p.Comment != "concurrent update" {
+		t.Fatalf("concurrent update was overwritten: %s", body)
+	}
+
+	verifyPerson(t, "Nicolai Person", body)
+}
+
 func TestPersonList(t *testing.T) {
 	srv, cleanup := TestServer(t)
 	defer cleanup()
@@ -177,6 +434,172 @@ func TestPersonList(t *testing.T) {
 	t.Logf("loaded %d person records", len(list))
 }
 
+// requestPage requests a page of a list and returns the status code, the
+// body and the URL for the next page from the Link header.
+func requestPage(t *testing.T, token, url string) (int, []byte, string) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatalf("NewRequest() %v", err)
+	}
+
+	req.Header.Add(authHeaderName, token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET request to %v failed: %v", url, err)
+	}
+
+	link := res.Header.Get("Link")
+	status, body := readBody(t, res)
+
+	if link == "" {
+		return status, body, ""
+	}
+
+	if !strings.HasPrefix(link, "</api/") || !strings.HasSuffix(link, `>; rel="next"`) {
+		t.Fatalf("invalid Link header %q", link)
+	}
+
+	return status, body, link[1:strings.Index(link, ">")]
+}
+
+func TestPersonListPages(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	var ids []int
+	for _, name := range []string{"Pagetest C", "Pagetest A", "Pagetest B"} {
+		status, body := request(t, token, "POST", srv.URL+"/api/person",
+			[]byte(fmt.Sprintf(`{"name": %q, "address": {"city": "Pagecity"}}`, name)))
+		if status != 201 {
+			t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+		}
+		ids = append(ids, verifyPerson(t, name, body).ID)
+	}
+
+	for _, test := range []struct {
+		url string
+		ids []int
+	}{
+		{"/api/person?city=Pagecity&sort=name&limit=2", []int{ids[1], ids[2], ids[0]}},
+		{"/api/person?city=Pagecity&sort=-name&limit=1", []int{ids[0], ids[2], ids[1]}},
+		{"/api/person?city=Pagecity&name=Pagetest+B", []int{ids[2]}},
+	} {
+		var found []int
+		url := test.url
+		for url != "" && len(found) <= len(test.ids) {
+			status, body, next := requestPage(t, token, srv.URL+url)
+			if status != 200 {
+				t.Fatalf("listing %v yielded unexpected status %d: %s", url, status, body)
+			}
+
+			var list []Person
+			unmarshal(t, body, &list)
+			for _, p := range list {
+				found = append(found, p.ID)
+			}
+
+			url = next
+		}
+
+		if !reflect.DeepEqual(found, test.ids) {
+			t.Errorf("listing %v returned wrong people, want %v, got %v", test.url, test.ids, found)
+		}
+	}
+
+	for _, url := range []string{
+		"/api/person?limit=0",
+		"/api/person?limit=foo",
+		"/api/person?sort=foo",
+		"/api/person?foo=bar",
+		"/api/person?cursor=foo",
+	} {
+		status, body := request(t, token, "GET", srv.URL+url, nil)
+		if status != 400 {
+			t.Errorf("invalid list request %v yielded unexpected status %d: %s", url, status, body)
+		}
+	}
+}
+
+func TestPersonListStream(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	status, body := request(t, token, "GET", srv.URL+"/api/person?limit=1000", nil)
+	if status != 200 {
+		t.Fatalf("reading list of persons failed with invalid status: want 200, got %d", status)
+	}
+
+	var want []Person
+	unmarshal(t, body, &want)
+
+	status, body = request(t, token, "GET", srv.URL+"/api/person?limit=all", nil)
+	if status != 200 {
+		t.Fatalf("streaming list of persons failed with invalid status: want 200, got %d", status)
+	}
+
+	var list []Person
+	unmarshal(t, body, &list)
+	if !reflect.DeepEqual(list, want) {
+		t.Fatalf("streamed JSON list differs, want %d people, got %d", len(want), len(list))
+	}
+
+	req, err := http.NewRequest("GET", srv.URL+"/api/person", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add(authHeaderName, token)
+	req.Header.Add("Accept", "application/x-ndjson")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/x-ndjson") {
+		t.Fatalf("wrong content type for NDJSON: %q", ct)
+	}
+
+	status, body = readBody(t, res)
+	if status != 200 {
+		t.Fatalf("streaming NDJSON failed with invalid status: want 200, got %d", status)
+	}
+
+	list = nil
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		var p Person
+		unmarshal(t, []byte(line), &p)
+		list = append(list, p)
+	}
+
+	if !reflect.DeepEqual(list, want) {
+		t.Fatalf("streamed NDJSON list differs, want %d people, got %d", len(want), len(list))
+	}
+
+	status, header, body := requestHeader(t, token, "GET", srv.URL+"/api/person?limit=2", map[string]string{"Accept": "application/x-ndjson"}, "")
+	if status != 200 {
+		t.Fatalf("reading a page as NDJSON failed with invalid status: want 200, got %d", status)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(string(body)), "\n"); len(lines) != 2 {
+		t.Fatalf("page of NDJSON list has %d lines, want 2", len(lines))
+	}
+
+	if header.Get("X-Next-Cursor") == "" {
+		t.Fatalf("page of NDJSON list has no cursor for the next page")
+	}
+
+	status, body = request(t, token, "GET", srv.URL+"/api/person?limit=all&name=nonexisting", nil)
+	if status != 200 || strings.TrimSpace(string(body)) != "[]" {
+		t.Fatalf("streaming empty list returned status %d: %s", status, body)
+	}
+}
+
 func BenchmarkPersonList(b *testing.B) {
 	srv, cleanup := TestServer(b)
 	defer cleanup()
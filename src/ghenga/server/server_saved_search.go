@@ -0,0 +1,242 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"ghenga/db"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+)
+
+// sessionUser returns the login name of the user of the current session.
+func sessionUser(ctx context.Context) (string, error) {
+	session, ok := db.SessionFromContext(ctx)
+	if !ok {
+		return "", errors.New("no session found in context")
+	}
+
+	return session.User, nil
+}
+
+// findSavedSearch returns the saved search with the ID from the request, if
+// it is visible to the user. Otherwise an error with status code 404 is
+// returned.
+func findSavedSearch(env *Env, req *http.Request, login string) (*db.SavedSearch, error) {
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return nil, StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	s, err := env.DB.FindSavedSearch(int64(id))
+	if err != nil || !s.VisibleTo(login) {
+		return nil, StatusError{
+			Err:  errors.New("saved search not found"),
+			Code: http.StatusNotFound,
+		}
+	}
+
+	return s, nil
+}
+
+// findOwnSavedSearch works like findSavedSearch, but returns an error with
+// status code 403 if the search is not owned by the user.
+func findOwnSavedSearch(env *Env, req *http.Request, login string) (*db.SavedSearch, error) {
+	s, err := findSavedSearch(env, req, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Owner != login {
+		return nil, StatusError{
+			Err:  errors.New("saved search is owned by another user"),
+			Code: http.StatusForbidden,
+		}
+	}
+
+	return s, nil
+}
+
+// ListSavedSearches handles listing the saved searches of the user and all
+// shared searches.
+func ListSavedSearches(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	login, err := sessionUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	list, err := env.DB.ListSavedSearches(login)
+	if err != nil {
+		return err
+	}
+
+	if list == nil {
+		list = []*db.SavedSearch{}
+	}
+
+	return httpWriteJSON(res, http.StatusOK, list)
+}
+
+// ShowSavedSearch returns a SavedSearch record.
+func ShowSavedSearch(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	login, err := sessionUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	s, err := findSavedSearch(env, req, login)
+	if err != nil {
+		return err
+	}
+
+	return httpWriteJSON(res, http.StatusOK, s)
+}
+
+// CreateSavedSearch inserts a new saved search owned by the user of the
+// current session. The request body must be valid JSON.
+func CreateSavedSearch(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	login, err := sessionUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var js db.SavedSearchJSON
+	dec := json.NewDecoder(req.Body)
+	if err = dec.Decode(&js); err != nil {
+		return err
+	}
+
+	s := db.NewSavedSearch(login, js.Name)
+	s.Update(js)
+
+	// overwrite fields we'd like to be set
+	s.Version = 0
+
+	if err = s.Validate(); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if err = checkTags(env, s.Tags); err != nil {
+		return err
+	}
+
+	err = env.DB.InsertSavedSearch(s)
+	if err != nil {
+		return err
+	}
+
+	env.Debugf("created saved search %v", s)
+
+	return httpWriteJSON(wr, http.StatusCreated, s)
+}
+
+// UpdateSavedSearch changes an existing saved search, which must be owned by
+// the user of the current session. The request body must be valid JSON.
+func UpdateSavedSearch(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	login, err := sessionUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	var js db.SavedSearchJSON
+	dec := json.NewDecoder(req.Body)
+	if err = dec.Decode(&js); err != nil {
+		return err
+	}
+
+	s, err := findOwnSavedSearch(env, req, login)
+	if err != nil {
+		return err
+	}
+
+	if s.Version != js.Version {
+		env.Debugf("saved search record is outdated, version %v != %v",
+			s.Version, js.Version)
+		return StatusError{
+			Err:  errors.New("version field does not match"),
+			Code: http.StatusConflict,
+		}
+	}
+
+	s.Update(js)
+
+	s.ChangedAt = time.Now()
+
+	if err = s.Validate(); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if err = checkTags(env, s.Tags); err != nil {
+		return err
+	}
+
+	err = env.DB.UpdateSavedSearch(s)
+	if err != nil {
+		env.Logf("unable update saved search %v, sql error: %v", s, err)
+		return err
+	}
+
+	return httpWriteJSON(wr, http.StatusOK, s)
+}
+
+// DeleteSavedSearch removes a saved search, which must be owned by the user
+// of the current session.
+func DeleteSavedSearch(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) error {
+	login, err := sessionUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	s, err := findOwnSavedSearch(env, req, login)
+	if err != nil {
+		return err
+	}
+
+	if err := env.DB.DeleteSavedSearch(s.ID); err != nil {
+		return err
+	}
+
+	return httpWriteJSON(wr, http.StatusOK, nil)
+}
+
+// SavedSearchResults executes a saved search and returns the people currently
+// matching it.
+func SavedSearchResults(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	login, err := sessionUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	s, err := findSavedSearch(env, req, login)
+	if err != nil {
+		return err
+	}
+
+	people, err := searchPeople(env, s.Query, s.Mode, s.TagFilter())
+	if err != nil {
+		return err
+	}
+
+	if people == nil {
+		people = []*db.Person{}
+	}
+
+	return httpWriteJSON(res, http.StatusOK, people)
+}
+
+// SavedSearchHandler adds routes for ghenga API in the given environment to r.
+func SavedSearchHandler(ctx context.Context, env *Env, r *mux.Router) {
+	r.Handle("/api/saved-search", Handle(ctx, env, RequireAuth(ListSavedSearches))).Methods("GET")
+	r.Handle("/api/saved-search", Handle(ctx, env, RequireAuth(CreateSavedSearch))).Methods("POST")
+	r.Handle("/api/saved-search/{id}", Handle(ctx, env, RequireAuth(ShowSavedSearch))).Methods("GET")
+	r.Handle("/api/saved-search/{id}", Handle(ctx, env, RequireAuth(UpdateSavedSearch))).Methods("PUT")
+	r.Handle("/api/saved-search/{id}", Handle(ctx, env, RequireAuth(DeleteSavedSearch))).Methods("DELETE")
+	r.Handle("/api/saved-search/{id}/results", Handle(ctx, env, RequireAuth(SavedSearchResults))).Methods("GET")
+}
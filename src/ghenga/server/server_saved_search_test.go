@@ -0,0 +1,129 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+type SavedSearch struct {
+	ID       int      `json:"id"`
+	Owner    string   `json:"owner"`
+	Name     string   `json:"name"`
+	Query    string   `json:"query"`
+	Mode     string   `json:"mode"`
+	Tags     []string `json:"tags"`
+	TagMatch string   `json:"tag_match"`
+	Shared   bool     `json:"shared"`
+	Version  int      `json:"version"`
+}
+
+func TestSavedSearchCRUD(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	admin := login(t, srv, "admin", "geheim")
+	user := login(t, srv, "user", "geheim")
+
+	status, body := request(t, admin, "POST", srv.URL+"/api/person", []byte(`{"name": "Saved Searchperson", "comment": "qwvbn"}`))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	person := verifyPerson(t, "Saved Searchperson", body)
+
+	status, body = request(t, admin, "POST", srv.URL+"/api/saved-search", []byte(`{"name": "qwvbn people", "query": "comment:qwvbn"}`))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	var s SavedSearch
+	unmarshal(t, body, &s)
+
+	if s.ID == 0 || s.Owner != "admin" || s.Mode != "fulltext" || s.TagMatch != "all" || s.Shared {
+		t.Fatalf("wrong saved search returned: %+v", s)
+	}
+
+	url := fmt.Sprintf("%s/api/saved-search/%d", srv.URL, s.ID)
+
+	for _, test := range []struct {
+		token  string
+		method string
+		url    string
+		status int
+	}{
+		{admin, "GET", url, 200},
+		{admin, "GET", url + "/results", 200},
+		{user, "GET", url, 404},
+		{user, "GET", url + "/results", 404},
+		{user, "DELETE", url, 404},
+	} {
+		status, body = request(t, test.token, test.method, test.url, nil)
+		if status != test.status {
+			t.Errorf("%v %v yielded unexpected status %d, want %d: %s", test.method, test.url, status, test.status, body)
+		}
+	}
+
+	// share the search with all users
+	s.Shared = true
+	status, body = request(t, admin, "PUT", url, marshal(t, s))
+	if status != 200 {
+		t.Fatalf("updating saved search, invalid status %d: %s", status, body)
+	}
+
+	status, _ = request(t, admin, "PUT", url, marshal(t, s))
+	if status != 409 {
+		t.Fatalf("updating saved search with outdated version, want status 409, got %d", status)
+	}
+
+	status, body = request(t, user, "GET", srv.URL+"/api/saved-search", nil)
+	if status != 200 {
+		t.Fatalf("listing saved searches yielded unexpected status %d: %s", status, body)
+	}
+
+	var list []SavedSearch
+	unmarshal(t, body, &list)
+	if len(list) != 1 || list[0].ID != s.ID || !list[0].Shared {
+		t.Fatalf("wrong list of saved searches returned: %+v", list)
+	}
+
+	status, body = request(t, user, "GET", url+"/results", nil)
+	if status != 200 {
+		t.Fatalf("executing saved search yielded unexpected status %d: %s", status, body)
+	}
+
+	var people []Person
+	unmarshal(t, body, &people)
+	if len(people) != 1 || people[0].ID != person.ID {
+		t.Fatalf("saved search returned wrong list of people: %v", people)
+	}
+
+	// shared searches can only be changed by the owner
+	for _, method := range []string{"PUT", "DELETE"} {
+		status, body = request(t, user, method, url, marshal(t, list[0]))
+		if status != 403 {
+			t.Errorf("%v of shared saved search by other user yielded unexpected status %d: %s", method, status, body)
+		}
+	}
+
+	for _, js := range []string{
+		`{"name": ""}`,
+		`{"name": "foo", "mode": "bar"}`,
+		`{"name": "foo", "query": "city:\"Köln"}`,
+		`{"name": "foo", "tags": ["nonexisting"]}`,
+	} {
+		status, body = request(t, user, "POST", srv.URL+"/api/saved-search", []byte(js))
+		if status != 400 {
+			t.Errorf("invalid saved search %v yielded unexpected status %d: %s", js, status, body)
+		}
+	}
+
+	status, body = request(t, admin, "DELETE", url, nil)
+	if status != 200 {
+		t.Fatalf("deleting saved search yielded unexpected status %d: %s", status, body)
+	}
+
+	status, _ = request(t, admin, "GET", url, nil)
+	if status != 404 {
+		t.Fatalf("deleted saved search still found, status %d", status)
+	}
+}
@@ -1,19 +1,49 @@
 package server
 
 import (
+	"errors"
+	"fmt"
+	"ghenga/db"
+	"ghenga/query"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"golang.org/x/net/context"
 )
 
-// SearchPerson handles a search request for a person.
+// SearchPerson handles a search request for a person. If the parameter
+// `email` is set, people with exactly this email address are returned.
+// Otherwise the parameter `mode` selects the search mode (see searchMode). In
+// the default mode, the parameter `query` is parsed with the query language
+// (see package query). Queries consisting only of plain words are passed to
+// the full-text search, all others are evaluated as structured queries. The
+// result can be filtered by tags, see tagFilter.
 func SearchPerson(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
-	query := req.URL.Query().Get("query")
+	if email := req.URL.Query().Get("email"); email != "" {
+		env.Debugf("listing people with email address %v", email)
 
-	env.Debugf("listing people that match %v", query)
+		people, err := env.DB.FindPeopleByEmail(email)
+		if err != nil {
+			return err
+		}
 
-	people, err := env.DB.FuzzyFindPersons(query)
+		return httpWriteJSON(res, http.StatusOK, people)
+	}
+
+	s := req.URL.Query().Get("query")
+
+	mode, err := searchMode(req)
+	if err != nil {
+		return err
+	}
+
+	filter, err := tagFilter(req)
+	if err != nil {
+		return err
+	}
+
+	people, err := searchPeople(env, s, mode, filter)
 	if err != nil {
 		return err
 	}
@@ -21,7 +51,151 @@ func SearchPerson(ctx context.Context, env *Env, res http.ResponseWriter, req *h
 	return httpWriteJSON(res, http.StatusOK, people)
 }
 
+// searchPeople returns the people matching the search s in the given mode and
+// the tag filter. For an invalid query, an error with status code 400 is
+// returned.
+func searchPeople(env *Env, s string, mode db.SearchMode, filter db.TagFilter) ([]*db.Person, error) {
+	if mode != db.SearchFullText {
+		env.Debugf("listing people that match %v (mode %v), tags %v", s, mode, filter.Tags)
+		return env.DB.FuzzyFindPersons(s, mode, filter)
+	}
+
+	q, err := query.Parse(s)
+	if err != nil {
+		return nil, StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	env.Debugf("listing people that match %v, tags %v", q, filter.Tags)
+
+	var people []*db.Person
+	if q.Simple() {
+		people, err = env.DB.FuzzyFindPersons(s, db.SearchFullText, filter)
+	} else {
+		people, err = env.DB.SearchPeople(q, filter)
+	}
+
+	if e, ok := err.(*query.Error); ok {
+		return nil, StatusError{Code: http.StatusBadRequest, Err: e}
+	}
+
+	return people, err
+}
+
+// searchMode returns the search mode from the parameter `mode` of the
+// request. The default is db.SearchFullText.
+func searchMode(req *http.Request) (db.SearchMode, error) {
+	mode := db.SearchMode(req.URL.Query().Get("mode"))
+	if mode == "" {
+		return db.SearchFullText, nil
+	}
+
+	for _, m := range db.SearchModes {
+		if mode == m {
+			return mode, nil
+		}
+	}
+
+	return "", StatusError{
+		Code: http.StatusBadRequest,
+		Err:  fmt.Errorf("invalid search mode %q", mode),
+	}
+}
+
+// defaultSearchHits is the number of hits returned by the global search when
+// the request does not specify a limit.
+const defaultSearchHits = 20
+
+// Search handles a global search for the parameter `q` over all types of
+// entities. Users are only searched for admins. The parameter `type` (which
+// may be given several times) restricts the search to the given types. The
+// parameter `limit` sets the maximal number of hits, up to
+// Config.MaxSearchHits.
+func Search(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	session, ok := db.SessionFromContext(ctx)
+	if !ok {
+		return errors.New("no session found in context")
+	}
+
+	u, err := env.DB.FindUserName(session.User)
+	if err != nil {
+		return err
+	}
+
+	types, err := searchTypes(req, u.Admin)
+	if err != nil {
+		return err
+	}
+
+	limit := defaultSearchHits
+	if s := req.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return StatusError{
+				Code: http.StatusBadRequest,
+				Err:  errors.New("invalid limit"),
+			}
+		}
+		limit = n
+	}
+
+	if env.Cfg.MaxSearchHits > 0 && limit > env.Cfg.MaxSearchHits {
+		limit = env.Cfg.MaxSearchHits
+	}
+
+	q := req.URL.Query().Get("q")
+	env.Debugf("searching %v for %v, limit %d", types, q, limit)
+
+	hits, err := env.DB.Search(q, types, limit)
+	if err != nil {
+		return err
+	}
+
+	return httpWriteJSON(res, http.StatusOK, hits)
+}
+
+// searchTypes returns the types of entities to search from the parameter
+// `type` of the request, the default is all types. Users may only be
+// searched by admins.
+func searchTypes(req *http.Request, admin bool) ([]string, error) {
+	types := req.URL.Query()["type"]
+	if len(types) == 0 {
+		for _, typ := range db.SearchTypes {
+			if typ != db.SearchTypeUser || admin {
+				types = append(types, typ)
+			}
+		}
+
+		return types, nil
+	}
+
+	for _, typ := range types {
+		valid := false
+		for _, t := range db.SearchTypes {
+			if typ == t {
+				valid = true
+			}
+		}
+
+		if !valid {
+			return nil, StatusError{
+				Code: http.StatusBadRequest,
+				Err:  fmt.Errorf("invalid search type %q", typ),
+			}
+		}
+
+		if typ == db.SearchTypeUser && !admin {
+			return nil, StatusError{
+				Code: http.StatusForbidden,
+				Err:  errors.New("only admins can search for users"),
+			}
+		}
+	}
+
+	return types, nil
+}
+
 // SearchHandler adds routes to the for ghenga API in the given environment to r.
 func SearchHandler(ctx context.Context, env *Env, r *mux.Router) {
+	r.Handle("/api/search", Handle(ctx, env, RequireAuth(Search))).Methods("GET")
 	r.Handle("/api/search/person", Handle(ctx, env, RequireAuth(SearchPerson))).Methods("GET")
 }
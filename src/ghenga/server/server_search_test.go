@@ -1,6 +1,10 @@
 package server
 
-import "testing"
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
 
 func search(t *testing.T, query string) []Person {
 	return nil
@@ -14,8 +18,259 @@ func TestSearchPerson(t *testing.T) {
 
 	token := login(t, srv, "admin", "geheim")
 
-	status, _ := request(t, token, "POST", srv.URL+"/api/person", p)
+	status, body := request(t, token, "POST", srv.URL+"/api/person", p)
 	if status != 201 {
 		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, string(p))
 	}
+
+	person := verifyPerson(t, "Nicolai Person", body)
+
+	for _, query := range []string{
+		"CEO",
+		"Management",
+		"Teststraße",
+		"Teststrasse",
+		"koeln",
+		"köln nicolai",
+		"123123125",
+		"this is a comment",
+	} {
+		status, body = request(t, token, "GET", srv.URL+"/api/search/person?query="+url.QueryEscape(query), nil)
+		if status != 200 {
+			t.Fatalf("search yielded unexpected status %d: %s", status, body)
+		}
+
+		var list []Person
+		unmarshal(t, body, &list)
+
+		found := false
+		for _, p := range list {
+			if p.ID == person.ID {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Errorf("search for %q did not find person %v: %v", query, person.ID, list)
+		}
+	}
+}
+
+func TestSearchPersonEmail(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	p := readFixture(t, "sample_person.json")
+
+	token := login(t, srv, "admin", "geheim")
+
+	status, body := request(t, token, "POST", srv.URL+"/api/person", p)
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, string(p))
+	}
+
+	person := verifyPerson(t, "Nicolai Person", body)
+
+	for _, url := range []string{
+		"/api/search/person?email=Nicolai@example.com",
+		"/api/search/person?query=kleiningerkneifel",
+	} {
+		status, body = request(t, token, "GET", srv.URL+url, nil)
+		if status != 200 {
+			t.Fatalf("search yielded unexpected status %d: %s", status, body)
+		}
+
+		var list []Person
+		unmarshal(t, body, &list)
+		if len(list) != 1 || list[0].ID != person.ID {
+			t.Errorf("search %v returned wrong list of people: %v", url, list)
+		}
+	}
+}
+
+func TestSearchPersonQuery(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	status, body := request(t, token, "POST", srv.URL+"/api/person", readFixture(t, "sample_person.json"))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	person := verifyPerson(t, "Nicolai Person", body)
+
+	status, body = request(t, token, "GET", srv.URL+"/api/search/person?query="+
+		url.QueryEscape(`city:Köln title:CEO -department:Testers "is a comment"`), nil)
+	if status != 200 {
+		t.Fatalf("search yielded unexpected status %d: %s", status, body)
+	}
+
+	var list []Person
+	unmarshal(t, body, &list)
+	if len(list) != 1 || list[0].ID != person.ID {
+		t.Errorf("structured search returned wrong list of people: %v", list)
+	}
+
+	for _, test := range []struct {
+		query string
+		pos   string
+	}{
+		{`city:Köln "foo`, "position 10"},
+		{`city:Köln color:red`, "position 10"},
+	} {
+		status, body = request(t, token, "GET", srv.URL+"/api/search/person?query="+url.QueryEscape(test.query), nil)
+		if status != 400 {
+			t.Errorf("invalid query %q yielded unexpected status %d: %s", test.query, status, body)
+			continue
+		}
+
+		if !strings.Contains(string(body), test.pos) {
+			t.Errorf("error for invalid query %q does not contain %q: %s", test.query, test.pos, body)
+		}
+	}
+}
+
+func TestSearchPersonSimilar(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	status, body := request(t, token, "POST", srv.URL+"/api/person", []byte(`{"name": "Hans Meier"}`))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	person := verifyPerson(t, "Hans Meier", body)
+
+	status, body = request(t, token, "GET", srv.URL+"/api/search/person?mode=similar&query=Maier", nil)
+	if status != 200 {
+		t.Fatalf("search yielded unexpected status %d: %s", status, body)
+	}
+
+	var list []Person
+	unmarshal(t, body, &list)
+
+	found := false
+	for _, p := range list {
+		if p.ID == person.ID {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("similarity search did not find person %v: %v", person.ID, list)
+	}
+
+	status, body = request(t, token, "GET", srv.URL+"/api/search/person?mode=foo&query=Maier", nil)
+	if status != 400 {
+		t.Errorf("invalid search mode yielded unexpected status %d: %s", status, body)
+	}
+}
+
+func TestSearchPersonPhonetic(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	status, body := request(t, token, "POST", srv.URL+"/api/person", []byte(`{"name": "Karl Müller"}`))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	person := verifyPerson(t, "Karl Müller", body)
+
+	status, body = request(t, token, "GET", srv.URL+"/api/search/person?mode=phonetic&query=Carl+Mueller", nil)
+	if status != 200 {
+		t.Fatalf("search yielded unexpected status %d: %s", status, body)
+	}
+
+	var list []Person
+	unmarshal(t, body, &list)
+
+	found := false
+	for _, p := range list {
+		if p.ID == person.ID {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("phonetic search did not find person %v: %v", person.ID, list)
+	}
+}
+
+func TestSearchGlobal(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	status, body := request(t, token, "POST", srv.URL+"/api/person", []byte(`{"name": "Qwvbn Usermann"}`))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	person := verifyPerson(t, "Qwvbn Usermann", body)
+
+	status, body = request(t, token, "POST", srv.URL+"/api/user", []byte(`{"login": "qwvbn", "password": "secret"}`))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	for _, test := range []struct {
+		user  string
+		url   string
+		types []string
+	}{
+		{"admin", "/api/search?q=qwvbn", []string{"person", "user"}},
+		{"user", "/api/search?q=qwvbn", []string{"person"}},
+		{"admin", "/api/search?q=qwvbn&type=user", []string{"user"}},
+		{"admin", "/api/search?q=QWVBN+usermann", []string{"person"}},
+		{"admin", "/api/search?q=qwvbn&limit=1", []string{"person"}},
+	} {
+		token := login(t, srv, test.user, "geheim")
+		status, body = request(t, token, "GET", srv.URL+test.url, nil)
+		if status != 200 {
+			t.Fatalf("search %v yielded unexpected status %d: %s", test.url, status, body)
+		}
+
+		var hits []struct {
+			Type    string `json:"type"`
+			ID      int    `json:"id"`
+			Snippet string `json:"snippet"`
+		}
+		unmarshal(t, body, &hits)
+
+		var types []string
+		for _, h := range hits {
+			types = append(types, h.Type)
+		}
+
+		if strings.Join(types, " ") != strings.Join(test.types, " ") {
+			t.Errorf("search %v as %v returned wrong hits, want %v, got %v", test.url, test.user, test.types, hits)
+		}
+
+		if len(hits) > 0 && hits[0].Type == "person" && (hits[0].ID != person.ID || hits[0].Snippet != "Qwvbn Usermann") {
+			t.Errorf("search %v returned wrong hit for person: %v", test.url, hits[0])
+		}
+	}
+
+	token = login(t, srv, "user", "geheim")
+	for _, test := range []struct {
+		url    string
+		status int
+	}{
+		{"/api/search?q=qwvbn&type=user", 403},
+		{"/api/search?q=qwvbn&type=foo", 400},
+		{"/api/search?q=qwvbn&limit=0", 400},
+	} {
+		status, body = request(t, token, "GET", srv.URL+test.url, nil)
+		if status != test.status {
+			t.Errorf("search %v yielded unexpected status %d, want %d: %s", test.url, status, test.status, body)
+		}
+	}
 }
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"errors"
+	"ghenga/db"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+)
+
+// defaultSuggestions is the number of suggestions returned when the request
+// does not specify a limit.
+const defaultSuggestions = 10
+
+// SuggestPerson returns suggestions for people for the parameter `prefix`,
+// which is meant to be called for every key typed in a search box. The
+// parameter `limit` sets the maximal number of suggestions, up to
+// Config.MaxSuggestions.
+func SuggestPerson(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	limit := defaultSuggestions
+	if s := req.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return StatusError{
+				Code: http.StatusBadRequest,
+				Err:  errors.New("invalid limit"),
+			}
+		}
+		limit = n
+	}
+
+	if env.Cfg.MaxSuggestions > 0 && limit > env.Cfg.MaxSuggestions {
+		limit = env.Cfg.MaxSuggestions
+	}
+
+	prefix := req.URL.Query().Get("prefix")
+	env.Debugf("suggesting %d people for prefix %v", limit, prefix)
+
+	list, err := env.DB.SuggestPeople(prefix, limit, env.Cfg.SuggestTimeout)
+	if err == db.ErrTimeout {
+		return StatusError{Code: http.StatusServiceUnavailable, Err: err}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if list == nil {
+		list = []*db.PersonSuggestion{}
+	}
+
+	return httpWriteJSON(res, http.StatusOK, list)
+}
+
+// SuggestHandler adds routes to the for ghenga API in the given environment to r.
+func SuggestHandler(ctx context.Context, env *Env, r *mux.Router) {
+	r.Handle("/api/suggest/person", Handle(ctx, env, RequireAuth(SuggestPerson))).Methods("GET")
+}
@@ -0,0 +1,55 @@
+package server
+
+import "testing"
+
+func TestSuggestPerson(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "user", "geheim")
+
+	for _, name := range []string{"Qwsug Eins", "Qwsug Zwei", "Anna Qwsugmann"} {
+		status, body := request(t, token, "POST", srv.URL+"/api/person", []byte(`{"name": "`+name+`", "title": "Tester"}`))
+		if status != 201 {
+			t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+		}
+	}
+
+	for _, test := range []struct {
+		url   string
+		names []string
+	}{
+		{"/api/suggest/person?prefix=qwsug", []string{"Qwsug Eins", "Qwsug Zwei", "Anna Qwsugmann"}},
+		{"/api/suggest/person?prefix=qwsug&limit=1", []string{"Qwsug Eins"}},
+		{"/api/suggest/person?prefix=qwsug+z", []string{"Qwsug Zwei"}},
+		{"/api/suggest/person?prefix=", []string{}},
+	} {
+		status, body := request(t, token, "GET", srv.URL+test.url, nil)
+		if status != 200 {
+			t.Fatalf("suggest %v yielded unexpected status %d: %s", test.url, status, body)
+		}
+
+		var list []map[string]interface{}
+		unmarshal(t, body, &list)
+
+		if list == nil || len(list) != len(test.names) {
+			t.Errorf("suggest %v returned wrong list: %v", test.url, list)
+			continue
+		}
+
+		for i, item := range list {
+			if item["name"] != test.names[i] || item["title"] != "Tester" {
+				t.Errorf("suggest %v returned wrong item %d: %v", test.url, i, item)
+			}
+
+			if _, ok := item["phone_numbers"]; ok || len(item) != 4 {
+				t.Errorf("suggest %v returned wrong fields: %v", test.url, item)
+			}
+		}
+	}
+
+	status, body := request(t, token, "GET", srv.URL+"/api/suggest/person?prefix=q&limit=x", nil)
+	if status != 400 {
+		t.Errorf("invalid limit yielded unexpected status %d: %s", status, body)
+	}
+}
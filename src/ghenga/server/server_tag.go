@@ -0,0 +1,170 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"ghenga/db"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/gorilla/mux"
+)
+
+// ListTags handles listing tags.
+func ListTags(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	tags, err := env.DB.ListTags()
+	if err != nil {
+		return err
+	}
+
+	return httpWriteJSON(res, http.StatusOK, tags)
+}
+
+// ShowTag returns a Tag record.
+func ShowTag(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	tag, err := env.DB.FindTag(int64(id))
+	if err != nil {
+		return StatusError{
+			Err:  errors.New("tag not found"),
+			Code: http.StatusNotFound,
+		}
+	}
+
+	return httpWriteJSON(res, http.StatusOK, tag)
+}
+
+// checkTagName returns an error if another tag with the same name as t
+// already exists.
+func checkTagName(env *Env, t *db.Tag) error {
+	other, err := env.DB.FindTagName(t.Name)
+	if err != nil || other.ID == t.ID {
+		return nil
+	}
+
+	return StatusError{
+		Err:  errors.New("tag already exists"),
+		Code: http.StatusConflict,
+	}
+}
+
+// CreateTag inserts a new tag into the database. The request body must be valid JSON.
+func CreateTag(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	var jt db.TagJSON
+	dec := json.NewDecoder(req.Body)
+	if err = dec.Decode(&jt); err != nil {
+		return err
+	}
+
+	var t db.Tag
+	t.Update(jt)
+
+	// overwrite fields we'd like to be set
+	t.CreatedAt = time.Now()
+	t.ChangedAt = time.Now()
+	t.Version = 0
+
+	if err = t.Validate(); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if err = checkTagName(env, &t); err != nil {
+		return err
+	}
+
+	err = env.DB.InsertTag(&t)
+	if err != nil {
+		return err
+	}
+
+	env.Debugf("created tag %v", t)
+
+	return httpWriteJSON(wr, http.StatusCreated, t)
+}
+
+// UpdateTag changes an existing tag, e.g. renames it. The request body must be
+// valid JSON.
+func UpdateTag(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	var newTag db.TagJSON
+	dec := json.NewDecoder(req.Body)
+	if err = dec.Decode(&newTag); err != nil {
+		return err
+	}
+
+	t, err := env.DB.FindTag(int64(id))
+	if err != nil {
+		env.Logf("unable to find tag ID %v, error: %v", id, err)
+		return StatusError{
+			Err:  errors.New("tag not found"),
+			Code: http.StatusNotFound,
+		}
+	}
+
+	if t.Version != newTag.Version {
+		env.Debugf("tag record is outdated, version %v != %v",
+			t.Version, newTag.Version)
+		return StatusError{
+			Err:  errors.New("version field does not match"),
+			Code: http.StatusConflict,
+		}
+	}
+
+	t.Update(newTag)
+
+	t.ChangedAt = time.Now()
+
+	if err = t.Validate(); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if err = checkTagName(env, t); err != nil {
+		return err
+	}
+
+	err = env.DB.UpdateTag(t)
+	if err != nil {
+		env.Logf("unable update tag %v, sql error: %v", t, err)
+		return err
+	}
+
+	return httpWriteJSON(wr, http.StatusOK, t)
+}
+
+// DeleteTag removes a tag from the database and from all people.
+func DeleteTag(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if err := env.DB.DeleteTag(int64(id)); err != nil {
+		return err
+	}
+
+	return httpWriteJSON(wr, http.StatusOK, nil)
+}
+
+// TagHandler adds routes for ghenga API in the given environment to r.
+func TagHandler(ctx context.Context, env *Env, r *mux.Router) {
+	r.Handle("/api/tag", Handle(ctx, env, RequireAuth(ListTags))).Methods("GET")
+	r.Handle("/api/tag", Handle(ctx, env, RequireAuth(CreateTag))).Methods("POST")
+	r.Handle("/api/tag/{id}", Handle(ctx, env, RequireAuth(ShowTag))).Methods("GET")
+	r.Handle("/api/tag/{id}", Handle(ctx, env, RequireAuth(UpdateTag))).Methods("PUT")
+	r.Handle("/api/tag/{id}", Handle(ctx, env, RequireAuth(DeleteTag))).Methods("DELETE")
+}
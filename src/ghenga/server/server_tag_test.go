@@ -0,0 +1,147 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+type Tag struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+}
+
+func createTag(t *testing.T, srvURL, token, name string) Tag {
+	status, body := request(t, token, "POST", srvURL+"/api/tag", []byte(fmt.Sprintf(`{"name": %q}`, name)))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	var tag Tag
+	unmarshal(t, body, &tag)
+
+	if tag.ID == 0 || tag.Name != name {
+		t.Fatalf("wrong tag returned: %v", tag)
+	}
+
+	return tag
+}
+
+func TestTagCRUD(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	tag := createTag(t, srv.URL, token, "customer")
+	createTag(t, srv.URL, token, "supplier")
+
+	status, body := request(t, token, "POST", srv.URL+"/api/tag", []byte(`{"name": "customer"}`))
+	if status != 409 {
+		t.Fatalf("duplicate tag name was accepted, status %v, body:\n  %s", status, body)
+	}
+
+	url := fmt.Sprintf("%s/api/tag/%d", srv.URL, tag.ID)
+	tag.Name = "client"
+
+	status, body = request(t, token, "PUT", url, marshal(t, tag))
+	if status != 200 {
+		t.Fatalf("updating tag, invalid status %d: %s", status, body)
+	}
+
+	status, _ = request(t, token, "PUT", url, marshal(t, tag))
+	if status != 409 {
+		t.Fatalf("updating tag with outdated version, want status 409, got %d", status)
+	}
+
+	status, body = request(t, token, "GET", srv.URL+"/api/tag", nil)
+	if status != 200 {
+		t.Fatalf("listing tags yielded unexpected status %d: %s", status, body)
+	}
+
+	var list []Tag
+	unmarshal(t, body, &list)
+	if len(list) != 2 || list[0].Name != "client" || list[1].Name != "supplier" {
+		t.Fatalf("wrong list of tags returned: %v", list)
+	}
+
+	status, _ = request(t, token, "DELETE", url, nil)
+	if status != 200 {
+		t.Fatalf("deleting tag yielded unexpected status %d", status)
+	}
+
+	status, _ = request(t, token, "GET", url, nil)
+	if status != 404 {
+		t.Fatalf("reading deleted tag yielded unexpected status %d", status)
+	}
+}
+
+func TestTagFilterPeople(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	createTag(t, srv.URL, token, "customer")
+	createTag(t, srv.URL, token, "vip")
+
+	var ids []int
+	for _, p := range []string{
+		`{"name": "Tagged Person One", "tags": ["customer", "vip"]}`,
+		`{"name": "Tagged Person Two", "tags": ["customer"]}`,
+	} {
+		status, body := request(t, token, "POST", srv.URL+"/api/person", []byte(p))
+		if status != 201 {
+			t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+		}
+
+		var person Person
+		unmarshal(t, body, &person)
+		ids = append(ids, person.ID)
+	}
+
+	status, body := request(t, token, "POST", srv.URL+"/api/person", []byte(`{"name": "foo", "tags": ["unknown"]}`))
+	if status != 400 {
+		t.Fatalf("person with unknown tag was accepted, status %v, body:\n  %s", status, body)
+	}
+
+	var tests = []struct {
+		path  string
+		query url.Values
+		ids   []int
+	}{
+		{"/api/person", url.Values{"tag": {"customer"}}, ids},
+		{"/api/person", url.Values{"tag": {"customer", "vip"}}, ids[:1]},
+		{"/api/person", url.Values{"tag": {"customer", "vip"}, "tag_match": {"any"}}, ids},
+		{"/api/search/person", url.Values{"query": {"two"}, "tag": {"customer"}}, ids[1:]},
+		{"/api/search/person", url.Values{"query": {"two"}, "tag": {"vip"}}, nil},
+	}
+
+	for i, test := range tests {
+		status, body := request(t, token, "GET", srv.URL+test.path+"?"+test.query.Encode(), nil)
+		if status != 200 {
+			t.Errorf("test %d: unexpected status %d: %s", i, status, body)
+			continue
+		}
+
+		var list []Person
+		unmarshal(t, body, &list)
+
+		if len(list) != len(test.ids) {
+			t.Errorf("test %d: wrong number of people returned, want %v, got %v", i, test.ids, list)
+			continue
+		}
+
+		for j, p := range list {
+			if p.ID != test.ids[j] {
+				t.Errorf("test %d: wrong person at position %d, want %v, got %v", i, j, test.ids[j], p.ID)
+			}
+		}
+	}
+
+	status, _ = request(t, token, "GET", srv.URL+"/api/person?tag=vip&tag_match=foo", nil)
+	if status != 400 {
+		t.Fatalf("invalid tag_match was accepted, status %v", status)
+	}
+}
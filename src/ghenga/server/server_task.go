@@ -0,0 +1,212 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"ghenga/db"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/gorilla/mux"
+)
+
+// ListTasks handles listing task records.
+func ListTasks(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	tasks, err := env.DB.ListTasks()
+	if err != nil {
+		return err
+	}
+
+	return httpWriteJSON(res, http.StatusOK, tasks)
+}
+
+// ListMyOpenTasks returns the open tasks assigned to the user of the current
+// session.
+func ListMyOpenTasks(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	session, ok := db.SessionFromContext(ctx)
+	if !ok {
+		return errors.New("no session found in context")
+	}
+
+	tasks, err := env.DB.ListOpenTasks(session.User)
+	if err != nil {
+		return err
+	}
+
+	if tasks == nil {
+		tasks = []*db.Task{}
+	}
+
+	return httpWriteJSON(res, http.StatusOK, tasks)
+}
+
+// ShowTask returns a Task record.
+func ShowTask(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	task, err := env.DB.FindTask(int64(id))
+	if err != nil {
+		return StatusError{
+			Err:  errors.New("task not found"),
+			Code: http.StatusNotFound,
+		}
+	}
+
+	return httpWriteJSON(res, http.StatusOK, task)
+}
+
+// checkTask validates t and makes sure the assignee and the linked person and
+// account exist.
+func checkTask(env *Env, t *db.Task) error {
+	if err := t.Validate(); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if _, err := env.DB.FindUserName(t.Assignee); err != nil {
+		return StatusError{
+			Code: http.StatusBadRequest,
+			Err:  errors.New("assignee not found"),
+		}
+	}
+
+	if err := checkPerson(env, t.PersonID); err != nil {
+		return err
+	}
+
+	return checkAccount(env, t.AccountID)
+}
+
+// CreateTask inserts a new task into the database. When no assignee is
+// given, the task is assigned to the user of the current session. The request
+// body must be valid JSON.
+func CreateTask(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	session, ok := db.SessionFromContext(ctx)
+	if !ok {
+		return errors.New("no session found in context")
+	}
+
+	var jt db.TaskJSON
+	dec := json.NewDecoder(req.Body)
+	if err = dec.Decode(&jt); err != nil {
+		return err
+	}
+
+	t := db.NewTask(jt.Title, session.User)
+	if err = t.Update(jt); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if t.Assignee == "" {
+		t.Assignee = session.User
+	}
+
+	if jt.Status != "" {
+		if err = t.SetStatus(jt.Status); err != nil {
+			return StatusError{Code: http.StatusBadRequest, Err: err}
+		}
+	}
+
+	// overwrite fields we'd like to be set
+	t.Version = 0
+
+	if err = checkTask(env, t); err != nil {
+		return err
+	}
+
+	err = env.DB.InsertTask(t)
+	if err != nil {
+		return err
+	}
+
+	env.Debugf("created task %v", t)
+
+	return httpWriteJSON(wr, http.StatusCreated, t)
+}
+
+// UpdateTask changes an existing task record. The request body must be valid JSON.
+func UpdateTask(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	var newTask db.TaskJSON
+	dec := json.NewDecoder(req.Body)
+	if err = dec.Decode(&newTask); err != nil {
+		return err
+	}
+
+	t, err := env.DB.FindTask(int64(id))
+	if err != nil {
+		env.Logf("unable to find task ID %v, error: %v", id, err)
+		return StatusError{
+			Err:  errors.New("task not found"),
+			Code: http.StatusNotFound,
+		}
+	}
+
+	if t.Version != newTask.Version {
+		env.Debugf("task record is outdated, version %v != %v",
+			t.Version, newTask.Version)
+		return StatusError{
+			Err:  errors.New("version field does not match"),
+			Code: http.StatusConflict,
+		}
+	}
+
+	if err = t.Update(newTask); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if err = t.SetStatus(newTask.Status); err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	t.ChangedAt = time.Now()
+
+	if err = checkTask(env, t); err != nil {
+		return err
+	}
+
+	err = env.DB.UpdateTask(t)
+	if err != nil {
+		env.Logf("unable update task %v, sql error: %v", t, err)
+		return err
+	}
+
+	return httpWriteJSON(wr, http.StatusOK, t)
+}
+
+// DeleteTask removes a task from the database.
+func DeleteTask(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	if err := env.DB.DeleteTask(int64(id)); err != nil {
+		return err
+	}
+
+	return httpWriteJSON(wr, http.StatusOK, nil)
+}
+
+// TaskHandler adds routes for ghenga API in the given environment to r.
+func TaskHandler(ctx context.Context, env *Env, r *mux.Router) {
+	r.Handle("/api/task", Handle(ctx, env, RequireAuth(ListTasks))).Methods("GET")
+	r.Handle("/api/task", Handle(ctx, env, RequireAuth(CreateTask))).Methods("POST")
+	r.Handle("/api/task/mine", Handle(ctx, env, RequireAuth(ListMyOpenTasks))).Methods("GET")
+	r.Handle("/api/task/{id}", Handle(ctx, env, RequireAuth(ShowTask))).Methods("GET")
+	r.Handle("/api/task/{id}", Handle(ctx, env, RequireAuth(UpdateTask))).Methods("PUT")
+	r.Handle("/api/task/{id}", Handle(ctx, env, RequireAuth(DeleteTask))).Methods("DELETE")
+}
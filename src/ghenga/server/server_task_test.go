@@ -0,0 +1,115 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+type Task struct {
+	ID       int    `json:"id"`
+	Title    string `json:"title"`
+	DueDate  string `json:"due_date,omitempty"`
+	Status   string `json:"status"`
+	Assignee string `json:"assignee"`
+	Version  int    `json:"version"`
+}
+
+func createTask(t *testing.T, token, url string, data string) Task {
+	status, body := request(t, token, "POST", url+"/api/task", []byte(data))
+	if status != 201 {
+		t.Fatalf("invalid status code, want 201, got %v, body:\n  %s", status, body)
+	}
+
+	var task Task
+	unmarshal(t, body, &task)
+	return task
+}
+
+func myTasks(t *testing.T, token, url string) []Task {
+	status, body := request(t, token, "GET", url+"/api/task/mine", nil)
+	if status != 200 {
+		t.Fatalf("listing own tasks yielded unexpected status %d: %s", status, body)
+	}
+
+	var list []Task
+	unmarshal(t, body, &list)
+	return list
+}
+
+func TestTaskWorkflow(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	admin := login(t, srv, "admin", "geheim")
+	user := login(t, srv, "user", "geheim")
+
+	own := createTask(t, user, srv.URL, `{"title": "call back", "due_date": "2016-05-01"}`)
+	if own.Assignee != "user" || own.Status != "open" {
+		t.Fatalf("wrong task returned: %+v", own)
+	}
+
+	assigned := createTask(t, admin, srv.URL, `{"title": "send offer", "assignee": "user", "due_date": "2016-04-01"}`)
+	createTask(t, admin, srv.URL, `{"title": "admin task"}`)
+
+	list := myTasks(t, user, srv.URL)
+	if len(list) != 2 || list[0].ID != assigned.ID || list[1].ID != own.ID {
+		t.Fatalf("wrong list of open tasks returned: %v", list)
+	}
+
+	url := fmt.Sprintf("%s/api/task/%d", srv.URL, assigned.ID)
+
+	assigned.Status = "done"
+	status, body := request(t, user, "PUT", url, marshal(t, assigned))
+	if status != 200 {
+		t.Fatalf("updating task, invalid status %d: %s", status, body)
+	}
+
+	unmarshal(t, body, &assigned)
+
+	assigned.Status = "cancelled"
+	status, _ = request(t, user, "PUT", url, marshal(t, assigned))
+	if status != 400 {
+		t.Fatalf("invalid status transition, want status 400, got %d", status)
+	}
+
+	list = myTasks(t, user, srv.URL)
+	if len(list) != 1 || list[0].ID != own.ID {
+		t.Fatalf("wrong list of open tasks returned: %v", list)
+	}
+}
+
+var invalidTaskTests = []string{
+	`{}`,
+	`{"title": "foo", "status": "foo"}`,
+	`{"title": "foo", "assignee": "nobody"}`,
+	`{"title": "foo", "due_date": "tomorrow"}`,
+	`{"title": "foo", "person_id": 10000}`,
+}
+
+func TestInvalidTask(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	for _, test := range invalidTaskTests {
+		status, body := request(t, token, "POST", srv.URL+"/api/task", []byte(test))
+		if status != 400 {
+			t.Errorf("status code for invalid task %s not found, want 400, got %v, body:\n  %s", test, status, body)
+		}
+	}
+}
+
+func TestTaskAssigneeDelete(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	admin := login(t, srv, "admin", "geheim")
+	createTask(t, admin, srv.URL, `{"title": "send offer", "assignee": "user"}`)
+
+	// the user "user" is created right after "admin"
+	status, body := request(t, admin, "DELETE", srv.URL+"/api/user/2", nil)
+	if status != 409 {
+		t.Fatalf("deleting the assignee of a task returned status %d, want 409: %s", status, body)
+	}
+}
@@ -12,13 +12,30 @@ import (
 	"golang.org/x/net/context"
 )
 
-// ListUsers handles listing users.
+// ListUsers handles listing users. The list is returned in pages, see
+// listOptions.
 func ListUsers(ctx context.Context, env *Env, res http.ResponseWriter, req *http.Request) error {
-	users, err := env.DB.ListUsers()
+	opts, err := listOptions(req)
 	if err != nil {
 		return err
 	}
 
+	users, next, err := env.DB.ListUsers(opts)
+	if err != nil {
+		return listError(err)
+	}
+
+	setNextPage(res, req, next)
+
+	tags := make([]string, 0, len(users))
+	for _, u := range users {
+		tags = append(tags, entityTag(u.ID, u.Version))
+	}
+
+	if notModified(res, req, listTag(tags, next)) {
+		return nil
+	}
+
 	return httpWriteJSON(res, http.StatusOK, users)
 }
 
@@ -37,6 +54,10 @@ func ShowUser(ctx context.Context, env *Env, res http.ResponseWriter, req *http.
 		}
 	}
 
+	if notModified(res, req, entityTag(u.ID, u.Version)) {
+		return nil
+	}
+
 	return httpWriteJSON(res, http.StatusOK, u)
 }
 
@@ -50,27 +71,52 @@ func CreateUser(ctx context.Context, env *Env, wr http.ResponseWriter, req *http
 		return err
 	}
 
-	var u db.User
-	u.Update(ju)
-
-	// overwrite fields we'd like to be set
-	u.CreatedAt = time.Now()
-	u.ChangedAt = time.Now()
-
-	if err = u.Validate(); err != nil {
-		return StatusError{Code: http.StatusBadRequest, Err: err}
+	u, err := userFromJSON(ju)
+	if err != nil {
+		return err
 	}
 
-	err = env.DB.InsertUser(&u)
+	err = env.DB.InsertUser(u)
 	if err != nil {
 		return err
 	}
 
 	env.Debugf("created user %v", u)
 
+	wr.Header().Set("ETag", entityTag(u.ID, u.Version))
 	return httpWriteJSON(wr, http.StatusCreated, u)
 }
 
+// checkUserLogin returns an error if another user with the same login as u
+// already exists.
+func checkUserLogin(env *Env, u *db.User) error {
+	other, err := env.DB.FindUserName(u.Login)
+	if err != nil || other.ID == u.ID {
+		return nil
+	}
+
+	return StatusError{
+		Err:  errors.New("user already exists"),
+		Code: http.StatusConflict,
+	}
+}
+
+// userFromJSON returns a new user from the JSON document and validates it.
+func userFromJSON(ju db.UserJSON) (*db.User, error) {
+	var u db.User
+	u.Update(ju)
+
+	// overwrite fields we'd like to be set
+	u.CreatedAt = time.Now()
+	u.ChangedAt = time.Now()
+
+	if err := u.Validate(); err != nil {
+		return nil, StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	return &u, nil
+}
+
 // UpdateUser changes an existing user record. The request body must be valid JSON.
 func UpdateUser(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
 	defer cleanupErr(&err, req.Body.Close)
@@ -92,6 +138,51 @@ func UpdateUser(ctx context.Context, env *Env, wr http.ResponseWriter, req *http
 		return err
 	}
 
+	matched, err := checkIfMatch(req, entityTag(u.ID, u.Version))
+	if err != nil {
+		return err
+	}
+
+	// the version in the body may be omitted when it was checked with If-Match
+	if matched && newUser.Version == 0 {
+		newUser.Version = u.Version
+	}
+
+	return saveUser(env, wr, u, newUser)
+}
+
+// PatchUser changes a user with a merge patch or a JSON Patch (see
+// patchJSON), fields not mentioned in the patch are left unchanged.
+func PatchUser(ctx context.Context, env *Env, wr http.ResponseWriter, req *http.Request) (err error) {
+	defer cleanupErr(&err, req.Body.Close)
+
+	id, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		return StatusError{Code: http.StatusBadRequest, Err: err}
+	}
+
+	u, err := env.DB.FindUser(int64(id))
+	if err != nil {
+		env.Logf("unable to find user ID %v, error: %v", id, err)
+		return err
+	}
+
+	matched, err := checkIfMatch(req, entityTag(u.ID, u.Version))
+	if err != nil {
+		return err
+	}
+
+	var newUser db.UserJSON
+	if err = patchJSON(req, u, &newUser, matched); err != nil {
+		return err
+	}
+
+	return saveUser(env, wr, u, newUser)
+}
+
+// saveUser updates u with newUser after checking the version, validates and
+// saves the result and writes it to the client.
+func saveUser(env *Env, wr http.ResponseWriter, u *db.User, newUser db.UserJSON) error {
 	if u.Version != newUser.Version {
 		env.Debugf("person record is outdated, version %v != %v",
 			u.Version, newUser.Version)
@@ -105,15 +196,25 @@ func UpdateUser(ctx context.Context, env *Env, wr http.ResponseWriter, req *http
 	u.Update(newUser)
 	u.ChangedAt = time.Now()
 
-	if err = u.Validate(); err != nil {
+	if err := u.Validate(); err != nil {
 		return StatusError{Code: http.StatusBadRequest, Err: err}
 	}
 
-	if err := env.DB.UpdateUser(u); err != nil {
+	err := env.DB.UpdateUser(u)
+	if err == db.ErrVersionConflict {
+		env.Debugf("user %v has been modified concurrently", u)
+		return StatusError{
+			Err:  errors.New("version field does not match"),
+			Code: http.StatusConflict,
+		}
+	}
+
+	if err != nil {
 		env.Logf("unable update person %v, error: %v", u, err)
 		return err
 	}
 
+	wr.Header().Set("ETag", entityTag(u.ID, u.Version))
 	return httpWriteJSON(wr, http.StatusOK, u)
 }
 
@@ -124,18 +225,60 @@ func DeleteUser(ctx context.Context, env *Env, wr http.ResponseWriter, req *http
 		return StatusError{Code: http.StatusBadRequest, Err: err}
 	}
 
-	if err := env.DB.DeleteUser(int64(id)); err != nil {
+	if req.Header.Get("If-Match") != "" {
+		return deleteUserIfMatch(env, wr, req, int64(id))
+	}
+
+	err = env.DB.DeleteUser(int64(id))
+	if err == db.ErrUserReferenced {
+		return StatusError{Code: http.StatusConflict, Err: err}
+	}
+
+	if err != nil {
 		return err
 	}
 
 	return httpWriteJSON(wr, http.StatusOK, nil)
 }
 
+// deleteUserIfMatch removes the user if the header `If-Match` matches the
+// current version. The version is checked again while deleting, so a
+// concurrent modification is not lost.
+func deleteUserIfMatch(env *Env, wr http.ResponseWriter, req *http.Request, id int64) error {
+	u, err := env.DB.FindUser(id)
+	if err != nil {
+		return StatusError{
+			Err:  errors.New("user not found"),
+			Code: http.StatusNotFound,
+		}
+	}
+
+	if _, err = checkIfMatch(req, entityTag(u.ID, u.Version)); err != nil {
+		return err
+	}
+
+	err = env.DB.DeleteUserVersion(u.ID, u.Version)
+	switch err {
+	case nil:
+		return httpWriteJSON(wr, http.StatusOK, nil)
+	case db.ErrVersionConflict:
+		return StatusError{
+			Code: http.StatusPreconditionFailed,
+			Err:  errors.New("entity has been modified"),
+		}
+	case db.ErrUserReferenced:
+		return StatusError{Code: http.StatusConflict, Err: err}
+	}
+
+	return err
+}
+
 // UserHandler adds routes for the ghenga API in the given environment to r.
 func UserHandler(ctx context.Context, env *Env, r *mux.Router) {
 	r.Handle("/api/user", Handle(ctx, env, RequireAdmin(ListUsers))).Methods("GET")
 	r.Handle("/api/user", Handle(ctx, env, RequireAdmin(CreateUser))).Methods("Post")
 	r.Handle("/api/user/{id}", Handle(ctx, env, RequireAdmin(ShowUser))).Methods("GET")
 	r.Handle("/api/user/{id}", Handle(ctx, env, RequireAdmin(UpdateUser))).Methods("PUT")
+	r.Handle("/api/user/{id}", Handle(ctx, env, RequireAdmin(PatchUser))).Methods("PATCH")
 	r.Handle("/api/user/{id}", Handle(ctx, env, RequireAdmin(DeleteUser))).Methods("DELETE")
 }
@@ -1,6 +1,9 @@
 package server
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+)
 
 type User struct {
 	ID        int    `json:"id"`
@@ -102,3 +105,73 @@ func TestUserCRUD(t *testing.T) {
 // 		}
 // 	}
 // }
+
+func TestUserPatch(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	var user User
+	unmarshal(t, createUser(t, token, srv.URL+"/api/user", readFixture(t, "sample_user.json")), &user)
+
+	url := fmt.Sprintf("%s/api/user/%d", srv.URL, user.ID)
+
+	patch := fmt.Sprintf(`{"version": %d, "admin": false}`, user.Version)
+	status, body := patchRequest(t, token, url, "application/merge-patch+json", patch)
+	if status != 200 {
+		t.Fatalf("merge patch returned invalid status %d: %s", status, body)
+	}
+
+	unmarshal(t, body, &user)
+	if user.Login != "will" || user.Admin {
+		t.Fatalf("merge patch was not applied correctly: %s", body)
+	}
+
+	// the password must still be valid
+	login(t, srv, "will", "foobar")
+
+	status, body = patchRequest(t, token, url, "application/merge-patch+json", `{"version": 1, "admin": true}`)
+	if status != 409 {
+		t.Fatalf("outdated patch returned wrong status, want 409, got %d: %s", status, body)
+	}
+}
+
+func TestUserETag(t *testing.T) {
+	srv, cleanup := TestServer(t)
+	defer cleanup()
+
+	token := login(t, srv, "admin", "geheim")
+
+	var user User
+	unmarshal(t, createUser(t, token, srv.URL+"/api/user", readFixture(t, "sample_user.json")), &user)
+
+	url := fmt.Sprintf("%s/api/user/%d", srv.URL, user.ID)
+	etag := fmt.Sprintf(`"%d-%d"`, user.ID, user.Version)
+
+	status, header, _ := requestHeader(t, token, "GET", url, map[string]string{"If-None-Match": etag}, "")
+	if status != 304 || header.Get("ETag") != etag {
+		t.Fatalf("GET with matching If-None-Match returned status %d and ETag %q, want 304 and %q", status, header.Get("ETag"), etag)
+	}
+
+	status, _, body := requestHeader(t, token, "PUT", url, map[string]string{"If-Match": `"1-0"`}, `{"login": "will"}`)
+	if status != 412 {
+		t.Fatalf("PUT with wrong If-Match returned status %d, want 412: %s", status, body)
+	}
+
+	status, _, body = requestHeader(t, token, "PUT", url, map[string]string{"If-Match": etag}, `{"login": "will"}`)
+	if status != 200 {
+		t.Fatalf("PUT with If-Match returned status %d, want 200: %s", status, body)
+	}
+
+	status, _, body = requestHeader(t, token, "DELETE", url, map[string]string{"If-Match": etag}, "")
+	if status != 412 {
+		t.Fatalf("DELETE with outdated If-Match returned status %d, want 412: %s", status, body)
+	}
+
+	etag = fmt.Sprintf(`"%d-%d"`, user.ID, user.Version+1)
+	status, _, body = requestHeader(t, token, "DELETE", url, map[string]string{"If-Match": etag}, "")
+	if status != 200 {
+		t.Fatalf("DELETE with If-Match returned status %d, want 200: %s", status, body)
+	}
+}
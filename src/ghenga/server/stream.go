@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ndjsonType is the media type for newline delimited JSON, where each line
+// of the response is a JSON document.
+const ndjsonType = "application/x-ndjson"
+
+// acceptsNDJSON returns true if the client requested NDJSON in the header
+// `Accept`.
+func acceptsNDJSON(req *http.Request) bool {
+	for _, s := range strings.Split(req.Header.Get("Accept"), ",") {
+		t, _, err := mime.ParseMediaType(strings.TrimSpace(s))
+		if err == nil && t == ndjsonType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonStream writes a list to the client element by element, either as a
+// JSON array or as NDJSON, so that the list is never held in memory as a
+// whole. Since the status code is sent before the first element, errors
+// which occur later can only be signalled by cutting off the response.
+type jsonStream struct {
+	wr     http.ResponseWriter
+	ndjson bool
+	n      int
+}
+
+// newJSONStream writes the header for the response with the status code
+// 200 and returns a new stream.
+func newJSONStream(wr http.ResponseWriter, ndjson bool) *jsonStream {
+	if ndjson {
+		wr.Header().Set("Content-Type", ndjsonType+"; charset=utf-8")
+	} else {
+		wr.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	wr.WriteHeader(http.StatusOK)
+
+	return &jsonStream{wr: wr, ndjson: ndjson}
+}
+
+// Encode writes the JSON representation of item to the client.
+func (s *jsonStream) Encode(item interface{}) error {
+	buf, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case s.ndjson:
+		buf = append(buf, '\n')
+	case s.n == 0:
+		buf = append([]byte("[\n"), buf...)
+	default:
+		buf = append([]byte(",\n"), buf...)
+	}
+
+	s.n++
+	_, err = s.wr.Write(buf)
+	return err
+}
+
+// Close finishes the response. It must be called after the last element was
+// written.
+func (s *jsonStream) Close() error {
+	if s.ndjson {
+		return nil
+	}
+
+	end := "\n]\n"
+	if s.n == 0 {
+		end = "[]\n"
+	}
+
+	_, err := s.wr.Write([]byte(end))
+	return err
+}
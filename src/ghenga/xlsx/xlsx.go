@@ -0,0 +1,168 @@
+// Package xlsx writes spreadsheets in the Office Open XML format (XLSX).
+//
+// Only what is needed for exporting tables is supported: a workbook with a
+// single sheet, in which all cells contain text. The rows are written to the
+// underlying writer while they are added, so that large tables are never
+// held in memory as a whole.
+//
+// Example:
+//
+//	w, err := xlsx.NewWriter(f, "People")
+//	if err != nil { ... }
+//
+//	for _, row := range rows {
+//		if err := w.Write(row); err != nil { ... }
+//	}
+//
+//	if err := w.Close(); err != nil { ... }
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ContentType is the media type of XLSX files.
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+const contentTypes = xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`</Types>`
+
+const rootRels = xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbookRels = xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`</Relationships>`
+
+const workbook = xmlHeader + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+	`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const sheetStart = xmlHeader + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+const sheetEnd = `</sheetData></worksheet>`
+
+// maxRows and maxColumns are the limits of a sheet.
+const (
+	maxRows    = 1048576
+	maxColumns = 16384
+)
+
+// Writer writes a spreadsheet with a single sheet.
+type Writer struct {
+	zw   *zip.Writer
+	wr   *bufio.Writer
+	rows int
+}
+
+// NewWriter starts a new spreadsheet with a sheet of the given name, which is
+// written to wr. Close must be called after the last row was written.
+func NewWriter(wr io.Writer, sheet string) (*Writer, error) {
+	zw := zip.NewWriter(wr)
+
+	var name bytes.Buffer
+	if err := xml.EscapeText(&name, []byte(sheet)); err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name, data string
+	}{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", fmt.Sprintf(workbook, name.String())},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+	}
+
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = io.WriteString(w, f.data); err != nil {
+			return nil, err
+		}
+	}
+
+	w, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err = bw.WriteString(sheetStart); err != nil {
+		return nil, err
+	}
+
+	return &Writer{zw: zw, wr: bw}, nil
+}
+
+// Column returns the name of the column with the index (starting at zero) as
+// used in cell references, e.g. "A" or "AB".
+func Column(index int) string {
+	var name []byte
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = append([]byte{byte('A' + (index-1)%26)}, name...)
+	}
+
+	return string(name)
+}
+
+// Write adds a row to the sheet, each value is written to a cell as text.
+// Empty values leave the cell empty.
+func (w *Writer) Write(row []string) error {
+	if w.rows >= maxRows {
+		return errors.New("xlsx: too many rows")
+	}
+
+	if len(row) > maxColumns {
+		return errors.New("xlsx: too many columns")
+	}
+
+	w.rows++
+	r := strconv.Itoa(w.rows)
+
+	w.wr.WriteString(`<row r="` + r + `">`)
+	for i, v := range row {
+		if v == "" {
+			continue
+		}
+
+		w.wr.WriteString(`<c r="` + Column(i) + r + `" t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(w.wr, []byte(v)); err != nil {
+			return err
+		}
+		w.wr.WriteString(`</t></is></c>`)
+	}
+
+	_, err := w.wr.WriteString(`</row>`)
+	return err
+}
+
+// Close finishes the spreadsheet. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if _, err := w.wr.WriteString(sheetEnd); err != nil {
+		return err
+	}
+
+	if err := w.wr.Flush(); err != nil {
+		return err
+	}
+
+	return w.zw.Close()
+}
@@ -0,0 +1,153 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+var columnTests = []struct {
+	index int
+	name  string
+}{
+	{0, "A"},
+	{1, "B"},
+	{25, "Z"},
+	{26, "AA"},
+	{27, "AB"},
+	{51, "AZ"},
+	{52, "BA"},
+	{701, "ZZ"},
+	{702, "AAA"},
+	{16383, "XFD"},
+}
+
+func TestColumn(t *testing.T) {
+	for i, test := range columnTests {
+		if name := Column(test.index); name != test.name {
+			t.Errorf("test %d: wrong name for column %d, want %q, got %q", i, test.index, test.name, name)
+		}
+	}
+}
+
+// sheet is the part of a worksheet which is checked by the tests.
+type sheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R    string `xml:"r,attr"`
+			Text string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readFile(t *testing.T, zr *zip.Reader, name string) []byte {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+
+		rd, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rd.Close()
+
+		buf, err := ioutil.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return buf
+	}
+
+	t.Fatalf("file %v not found", name)
+	return nil
+}
+
+func TestWriter(t *testing.T) {
+	rows := [][]string{
+		{"name", "city", "comment"},
+		{"Max Mustermann", "Köln", `<b>"bold" & more</b>`},
+		{"Erika", "", "line 1\nline 2"},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "People & more")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, row := range rows {
+		if err = w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"} {
+		var v interface{}
+		if err = xml.Unmarshal(readFile(t, zr, name), &v); err != nil {
+			t.Errorf("invalid XML in %v: %v", name, err)
+		}
+	}
+
+	var wb struct {
+		Sheet struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err = xml.Unmarshal(readFile(t, zr, "xl/workbook.xml"), &wb); err != nil {
+		t.Fatal(err)
+	}
+
+	if wb.Sheet.Name != "People & more" {
+		t.Errorf("wrong sheet name %q", wb.Sheet.Name)
+	}
+
+	var s sheet
+	if err = xml.Unmarshal(readFile(t, zr, "xl/worksheets/sheet1.xml"), &s); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.Rows) != len(rows) {
+		t.Fatalf("wrong number of rows, want %d, got %d", len(rows), len(s.Rows))
+	}
+
+	for i, row := range s.Rows {
+		if row.R != i+1 {
+			t.Errorf("row %d: wrong number %d", i, row.R)
+		}
+
+		var values []string
+		for _, c := range row.Cells {
+			values = append(values, c.Text)
+		}
+
+		var want []string
+		for _, v := range rows[i] {
+			if v != "" {
+				want = append(want, v)
+			}
+		}
+
+		if !reflect.DeepEqual(values, want) {
+			t.Errorf("row %d: wrong values, want %q, got %q", i, want, values)
+		}
+	}
+
+	if c := s.Rows[2].Cells[1]; c.R != "C3" {
+		t.Errorf("empty cell was not skipped, got reference %v", c.R)
+	}
+}